@@ -10,12 +10,18 @@ import (
 	"github.com/sandevgo/tuskbot/internal/config"
 	"github.com/sandevgo/tuskbot/internal/core"
 	"github.com/sandevgo/tuskbot/internal/providers/llm"
+	"github.com/sandevgo/tuskbot/internal/providers/local"
 	"github.com/sandevgo/tuskbot/internal/providers/mcp"
+	"github.com/sandevgo/tuskbot/internal/providers/mcp/tools"
 	"github.com/sandevgo/tuskbot/internal/providers/rag"
 	"github.com/sandevgo/tuskbot/internal/service/agent"
+	"github.com/sandevgo/tuskbot/internal/service/approval"
 	"github.com/sandevgo/tuskbot/internal/service/command"
 	"github.com/sandevgo/tuskbot/internal/service/memory"
+	"github.com/sandevgo/tuskbot/internal/service/output"
+	"github.com/sandevgo/tuskbot/internal/service/replay"
 	"github.com/sandevgo/tuskbot/internal/service/state"
+	"github.com/sandevgo/tuskbot/internal/service/usage"
 	"github.com/sandevgo/tuskbot/internal/storage/sqlite"
 	"github.com/sandevgo/tuskbot/internal/transport/telegram"
 	"github.com/sandevgo/tuskbot/pkg/log"
@@ -44,15 +50,39 @@ func NewServices(ctx context.Context) []srv.Service {
 
 	// Knowledge Repo
 	knowledgeRepo := sqlite.NewKnowledgeRepo(db)
+	summariesRepo := sqlite.NewSummariesRepo(db)
+	plansRepo := sqlite.NewPlansRepo(db)
+	settingsRepo := sqlite.NewSettingsRepo(db)
+	usageRepo := sqlite.NewUsageRepo(db)
 
 	// 3. AI Provider
-	aiProvider, err := llm.NewDynamicProvider(ctx, appCfg)
+	// Local GGUF chat models run in process, "local/<model>" in runtime/models
+	localModels := local.NewRuntime(appCfg)
+	llm.RegisterProvider(local.ProviderName, localModels.Provider)
+	services = append(services, srv.NewCleanup(localModels.Shutdown))
+
+	// OpenAI-compatible endpoints named in providers.json, "<name>/<model>"
+	namedProviders, err := llm.LoadNamedProviders(appCfg.GetProvidersPath())
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to load providers")
+	}
+	if err := llm.RegisterNamedProviders(namedProviders); err != nil {
+		logger.Fatal().Err(err).Msg("failed to register providers")
+	}
+
+	aiProvider, err := llm.NewDynamicProvider(ctx, appCfg, settingsRepo)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to initialize LLM provider")
 	}
 
 	globState := state.NewGlobalState(aiProvider)
 
+	// Token usage and costs of every LLM request
+	meter, err := usage.NewMeter(usageRepo, appCfg, aiProvider)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to initialize usage meter")
+	}
+
 	// 4. RAG Provider (Embedder)
 	embedModel, err := rag.NewEmbeddingModel(appCfg)
 	if err != nil {
@@ -64,9 +94,20 @@ func NewServices(ctx context.Context) []srv.Service {
 
 	// 5. Knowledge Extractor Service
 	// Runs in background to convert conversation history into atomic facts
-	extractor := memory.NewExtractor(knowledgeRepo, aiProvider, embedder)
+	var extractorAI core.AIProvider = aiProvider
+	if model := appCfg.GetExtractorModel(); model != "" {
+		extractorAI, err = aiProvider.Pinned(ctx, model)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to initialize extractor model")
+		}
+	}
+	extractor := memory.NewExtractor(knowledgeRepo, meter.Provider(extractorAI, core.PurposeExtraction), embedder)
 	services = append(services, extractor)
 
+	// Compacts older history of long sessions into running summaries
+	summarizer := memory.NewSummarizer(summariesRepo, meter.Provider(aiProvider, core.PurposeSummary))
+	services = append(services, summarizer)
+
 	// Embedding extractor
 	embedderWorker := memory.NewEmbedderWorker(messagesRepo, embedder)
 	services = append(services, embedderWorker)
@@ -77,31 +118,67 @@ func NewServices(ctx context.Context) []srv.Service {
 		logger.Fatal().Err(err).Msg("failed to initialize MCP manager")
 	}
 	services = append(services, mcpManager)
+	mcpManager.RegisterTools(tools.NewPlan(plansRepo))
 
 	mem := memory.NewMemory(
 		appCfg,
 		messagesRepo,
 		knowledgeRepo,
+		summariesRepo,
+		plansRepo,
 		embedder,
 		memory.NewSysPrompt(appCfg),
+		aiProvider,
+		mcpManager,
 	)
 
-	executor := agent.NewExecutor(mcpManager)
+	// Large tool outputs are cut or spilled to files before they reach the history
+	limiter, err := output.NewLimiter(mcpManager, appCfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to initialize output policy")
+	}
+
+	// Every tool call of the agent passes the approval policy
+	guard, err := approval.NewGuard(limiter, appCfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to initialize approval policy")
+	}
+
+	// Optionally record the agent's LLM and tool traffic for offline replay
+	agentAI := meter.Provider(aiProvider, core.PurposeChat)
+	var agentMCP core.MCPServer = guard
+	if dir := appCfg.GetRecordDir(); dir != "" {
+		recorder, err := replay.NewRecorder(dir)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to initialize run recorder")
+		}
+		agentAI, agentMCP = recorder.AIProvider(agentAI), recorder.MCPServer(guard)
+		logger.Info().Str("dir", dir).Msg("recording agent runs")
+	}
+
+	executor := agent.NewExecutor(agentMCP, appCfg.GetToolConcurrency())
 
 	// 7. Agent Service
 	ag := agent.NewAgent(
-		aiProvider,
-		mcpManager,
+		agentAI,
+		agentMCP,
 		mem,
 		executor,
+		agent.NewBudget(appCfg),
+		agent.QueueMode(appCfg.GetQueueMode()),
 	)
 
+	// Sub-agents run on the agent, so their tool is registered last
+	delegator := agent.NewDelegator(ag)
+	mcpManager.RegisterNativeTool(delegator.Definition(), delegator.Handle)
+
 	// commands
-	commands := command.NewCommands(appCfg, globState, mcpManager)
+	ollama := llm.NewOllama(llm.OllamaConfig{BaseURL: appCfg.GetOllamaBaseURL(), APIKey: appCfg.GetOllamaAPIKey()})
+	commands := command.NewCommands(appCfg, globState, ollama, mcpManager, ag, plansRepo, settingsRepo, usageRepo, meter.Budget())
 	cmdRouter := command.New(commands)
 
 	// 8. Transports
-	transports, err := initTransports(ctx, appCfg, ag, cmdRouter)
+	transports, err := initTransports(ctx, appCfg, ag, cmdRouter, guard)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to initialize transports")
 	}
@@ -134,7 +211,13 @@ func initMCP(ctx context.Context, cfg *config.AppConfig) (*mcp.Service, error) {
 	return mgr, nil
 }
 
-func initTransports(ctx context.Context, cfg *config.AppConfig, ag *agent.Agent, router core.CmdRouter) ([]srv.Service, error) {
+func initTransports(
+	ctx context.Context,
+	cfg *config.AppConfig,
+	ag *agent.Agent,
+	router core.CmdRouter,
+	guard *approval.Guard,
+) ([]srv.Service, error) {
 	var services []srv.Service
 
 	// Telegram Bot
@@ -143,6 +226,7 @@ func initTransports(ctx context.Context, cfg *config.AppConfig, ag *agent.Agent,
 		if err != nil {
 			return nil, err
 		}
+		guard.SetApprover(bot)
 		services = append(services, bot)
 	}
 
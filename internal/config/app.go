@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v9"
 	envPkg "github.com/sandevgo/tuskbot/pkg/env"
@@ -14,20 +15,46 @@ import (
 )
 
 type AppConfig struct {
-	MainModel  string `env:"TUSK_MAIN_MODEL,required,notEmpty"`
-	EmbedModel string `env:"TUSK_EMBEDDING_MODEL,required,notEmpty"`
+	MainModel        string `env:"TUSK_MAIN_MODEL,required,notEmpty"`
+	FallbackModels   string `env:"TUSK_FALLBACK_MODELS"`
+	ExtractorModel   string `env:"TUSK_EXTRACTOR_MODEL"`
+	PromptToolModels string `env:"TUSK_PROMPT_TOOL_MODELS"`
+	EmbedModel       string `env:"TUSK_EMBEDDING_MODEL,required,notEmpty"`
 
 	AnthropicAPIKey  string `env:"TUSK_ANTHROPIC_API_KEY"`
 	OpenAIAPIKey     string `env:"TUSK_OPENAI_API_KEY"`
 	OpenRouterAPIKey string `env:"TUSK_OPENROUTER_API_KEY"`
 	OllamaAPIKey     string `env:"TUSK_OLLAMA_API_KEY"`
 	OllamaBaseURL    string `env:"TUSK_OLLAMA_BASE_URL" envDefault:"http://127.0.0.1:11434"`
+	OllamaNumCtx     int    `env:"TUSK_OLLAMA_NUM_CTX" envDefault:"8192"`
 
 	CustomOpenAIBaseURL string `env:"TUSK_CUSTOM_OPENAI_BASE_URL"`
 	CustomOpenAIAPIKey  string `env:"TUSK_CUSTOM_OPENAI_API_KEY"`
 
-	ChatChannel       string `env:"TUSK_CHAT_CHANNEL,required,notEmpty"`
-	ContextWindowSize int    `env:"TUSK_CONTEXT_WINDOW_SIZE" envDefault:"30"`
+	LLMRequestsPerMinute int `env:"TUSK_LLM_RPM" envDefault:"0"`
+	LLMTokensPerMinute   int `env:"TUSK_LLM_TPM" envDefault:"0"`
+	LLMConcurrency       int `env:"TUSK_LLM_CONCURRENCY" envDefault:"4"`
+
+	LocalContextSize int `env:"TUSK_LOCAL_CONTEXT_SIZE" envDefault:"8192"`
+	LocalThreads     int `env:"TUSK_LOCAL_THREADS" envDefault:"0"`
+	LocalGPULayers   int `env:"TUSK_LOCAL_GPU_LAYERS" envDefault:"0"`
+
+	ChatChannel     string `env:"TUSK_CHAT_CHANNEL,required,notEmpty"`
+	HistoryMessages int    `env:"TUSK_HISTORY_MESSAGES" envDefault:"200"`
+	ContextTokens   int    `env:"TUSK_CONTEXT_TOKENS" envDefault:"0"`
+
+	AgentMaxSteps         int           `env:"TUSK_AGENT_MAX_STEPS" envDefault:"25"`
+	AgentMaxDuration      time.Duration `env:"TUSK_AGENT_MAX_DURATION" envDefault:"15m"`
+	AgentMaxTokens        int           `env:"TUSK_AGENT_MAX_TOKENS" envDefault:"0"`
+	AgentMaxRepeatedCalls int           `env:"TUSK_AGENT_MAX_REPEATED_CALLS" envDefault:"3"`
+	ToolConcurrency       int           `env:"TUSK_TOOL_CONCURRENCY" envDefault:"4"`
+	QueueMode             string        `env:"TUSK_QUEUE_MODE" envDefault:"queue"`
+
+	ApprovalTimeout time.Duration `env:"TUSK_APPROVAL_TIMEOUT" envDefault:"5m"`
+
+	RecordDir string `env:"TUSK_RECORD_DIR"`
+
+	MonthlyBudget float64 `env:"TUSK_MONTHLY_BUDGET" envDefault:"0"`
 
 	TelegramToken   string `env:"TUSK_TELEGRAM_TOKEN,required,notEmpty"`
 	TelegramOwnerID int64  `env:"TUSK_TELEGRAM_OWNER_ID,required"`
@@ -44,12 +71,30 @@ func NewAppConfig(ctx context.Context, runtimePath string) *AppConfig {
 	if err := env.Parse(c); err != nil {
 		log.FromCtx(ctx).Fatal().Err(err).Msg("failed to parse App config")
 	}
+	if err := c.validate(); err != nil {
+		log.FromCtx(ctx).Fatal().Err(err).Msg("invalid App config")
+	}
+
+	// The context used to be sized in messages; it is sized in tokens now
+	if _, ok := os.LookupEnv("TUSK_CONTEXT_WINDOW_SIZE"); ok {
+		log.FromCtx(ctx).Warn().Msg("TUSK_CONTEXT_WINDOW_SIZE is no longer used: the context is sized by TUSK_CONTEXT_TOKENS, and TUSK_HISTORY_MESSAGES caps the messages loaded")
+	}
 
 	c.SetModel(c.MainModel)
 	c.runtimePath = runtimePath
 	return c
 }
 
+func (c *AppConfig) validate() error {
+	if c.HistoryMessages < 1 {
+		return fmt.Errorf("TUSK_HISTORY_MESSAGES must be at least 1, got %d", c.HistoryMessages)
+	}
+	if c.QueueMode != "queue" && c.QueueMode != "merge" {
+		return fmt.Errorf("TUSK_QUEUE_MODE must be queue or merge, got %q", c.QueueMode)
+	}
+	return nil
+}
+
 func (c *AppConfig) GetRuntimePath() string {
 	return c.runtimePath
 }
@@ -78,8 +123,99 @@ func (c *AppConfig) GetMCPConfigPath() string {
 	return filepath.Join(c.runtimePath, "mcp_config.json")
 }
 
-func (c *AppConfig) GetContextWindowSize() int {
-	return c.ContextWindowSize
+func (c *AppConfig) GetApprovalsPath() string {
+	return filepath.Join(c.runtimePath, "approvals.json")
+}
+
+func (c *AppConfig) GetOutputPolicyPath() string {
+	return filepath.Join(c.runtimePath, "output_policy.json")
+}
+
+// GetToolOutputsPath is the workspace directory for tool outputs that were
+// too large for the context.
+func (c *AppConfig) GetToolOutputsPath() string {
+	return filepath.Join(c.runtimePath, "tool_outputs")
+}
+
+// GetMediaPath is the directory of the images, audio and files attached to
+// messages.
+func (c *AppConfig) GetMediaPath() string {
+	return filepath.Join(c.runtimePath, "media")
+}
+
+// GetModelsPath is the directory of the GGUF models, both the embedding
+// model and the chat models of the local provider.
+func (c *AppConfig) GetModelsPath() string {
+	return filepath.Join(c.runtimePath, "models")
+}
+
+func (c *AppConfig) GetPricesPath() string {
+	return filepath.Join(c.runtimePath, "prices.json")
+}
+
+func (c *AppConfig) GetCapabilitiesPath() string {
+	return filepath.Join(c.runtimePath, "capabilities.json")
+}
+
+// GetOllamaOptionsPath is the file of per-model options of Ollama models.
+func (c *AppConfig) GetOllamaOptionsPath() string {
+	return filepath.Join(c.runtimePath, "ollama.json")
+}
+
+// GetProvidersPath is the file of named OpenAI-compatible providers.
+func (c *AppConfig) GetProvidersPath() string {
+	return filepath.Join(c.runtimePath, "providers.json")
+}
+
+func (c *AppConfig) GetHistoryMessages() int {
+	return c.HistoryMessages
+}
+
+func (c *AppConfig) GetContextTokens() int {
+	return c.ContextTokens
+}
+
+func (c *AppConfig) GetAgentMaxSteps() int {
+	return c.AgentMaxSteps
+}
+
+func (c *AppConfig) GetAgentMaxDuration() time.Duration {
+	return c.AgentMaxDuration
+}
+
+func (c *AppConfig) GetAgentMaxTokens() int {
+	return c.AgentMaxTokens
+}
+
+func (c *AppConfig) GetAgentMaxRepeatedCalls() int {
+	return c.AgentMaxRepeatedCalls
+}
+
+func (c *AppConfig) GetToolConcurrency() int {
+	return c.ToolConcurrency
+}
+
+func (c *AppConfig) GetQueueMode() string {
+	return c.QueueMode
+}
+
+func (c *AppConfig) GetApprovalTimeout() time.Duration {
+	return c.ApprovalTimeout
+}
+
+// GetRecordDir is where agent runs are recorded as replay fixtures, or ""
+// if recording is off. Relative paths are inside the runtime path.
+func (c *AppConfig) GetRecordDir() string {
+	if c.RecordDir == "" || filepath.IsAbs(c.RecordDir) {
+		return c.RecordDir
+	}
+	return filepath.Join(c.runtimePath, c.RecordDir)
+}
+
+// GetMonthlyBudget is the LLM spending limit per calendar month in USD,
+// 0 if there is none.
+func (c *AppConfig) GetMonthlyBudget() float64 {
+	return c.MonthlyBudget
 }
 
 func (c *AppConfig) IsTelegramSelected() bool {
@@ -106,6 +242,12 @@ func (c *AppConfig) GetOllamaBaseURL() string {
 	return c.OllamaBaseURL
 }
 
+// GetOllamaNumCtx is the context size of Ollama models that set none,
+// instead of Ollama's default of 2048 tokens.
+func (c *AppConfig) GetOllamaNumCtx() int {
+	return c.OllamaNumCtx
+}
+
 func (c *AppConfig) GetCustomOpenAIBaseURL() string {
 	return c.CustomOpenAIBaseURL
 }
@@ -139,6 +281,72 @@ func (c *AppConfig) SetModel(model string) error {
 	return c.persist()
 }
 
+// GetFallbackModels returns the "provider/model" list that is tried in order
+// when the main model fails.
+func (c *AppConfig) GetFallbackModels() []string {
+	var models []string
+	for _, m := range strings.Split(c.FallbackModels, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// GetPromptToolModels returns the "provider/model" patterns of models
+// without native tool calling, whose tools are described in the prompt.
+func (c *AppConfig) GetPromptToolModels() []string {
+	var patterns []string
+	for _, p := range strings.Split(c.PromptToolModels, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// GetExtractorModel is the "provider/model" for fact extraction, or "" to
+// use the main model.
+func (c *AppConfig) GetExtractorModel() string {
+	return c.ExtractorModel
+}
+
+// GetLLMRequestsPerMinute limits the requests to each LLM provider, 0 leaves
+// it to the limits the provider reports.
+func (c *AppConfig) GetLLMRequestsPerMinute() int {
+	return c.LLMRequestsPerMinute
+}
+
+// GetLLMTokensPerMinute limits the estimated prompt tokens sent to each LLM
+// provider, 0 leaves it to the limits the provider reports.
+func (c *AppConfig) GetLLMTokensPerMinute() int {
+	return c.LLMTokensPerMinute
+}
+
+// GetLLMConcurrency limits the requests running at once per LLM provider,
+// 0 is unlimited.
+func (c *AppConfig) GetLLMConcurrency() int {
+	return c.LLMConcurrency
+}
+
+// GetLocalContextSize is the context window of local models in tokens,
+// 0 uses the size the model was trained with.
+func (c *AppConfig) GetLocalContextSize() int {
+	return c.LocalContextSize
+}
+
+// GetLocalThreads is the number of CPU threads of local models, 0 picks
+// one per core up to 8.
+func (c *AppConfig) GetLocalThreads() int {
+	return c.LocalThreads
+}
+
+// GetLocalGPULayers is the number of layers of local models offloaded to
+// the GPU, if llama.cpp was built with GPU support.
+func (c *AppConfig) GetLocalGPULayers() int {
+	return c.LocalGPULayers
+}
+
 func (c *AppConfig) GetEmbeddingModel() string {
 	return c.EmbedModel
 }
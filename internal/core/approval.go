@@ -0,0 +1,42 @@
+package core
+
+import "context"
+
+// ApprovalRequest describes a tool call waiting for the owner's decision.
+type ApprovalRequest struct {
+	Tool   string
+	Server string
+	Args   string
+}
+
+type ApprovalDecision int
+
+const (
+	ApprovalDeny ApprovalDecision = iota
+	ApprovalApprove
+	ApprovalAlwaysAllow
+)
+
+// Approver asks a human to approve a tool call. It blocks until the owner
+// answers or ctx is done.
+type Approver interface {
+	RequestApproval(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error)
+}
+
+type pauseKey struct{}
+
+// WithPause returns a context through which a tool call gives up its
+// execution slot while it waits, for the owner or for a sub-agent. pause releases the slot and
+// returns a function that takes it back.
+func WithPause(ctx context.Context, pause func() (resume func(context.Context) error)) context.Context {
+	return context.WithValue(ctx, pauseKey{}, pause)
+}
+
+// Pause releases the execution slot of a tool call, if it holds one, until
+// the returned function is called.
+func Pause(ctx context.Context) (resume func(context.Context) error) {
+	if pause, ok := ctx.Value(pauseKey{}).(func() func(context.Context) error); ok {
+		return pause()
+	}
+	return func(context.Context) error { return nil }
+}
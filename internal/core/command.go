@@ -12,3 +12,32 @@ type Command interface {
 	Description() string
 	Execute(ctx context.Context, sessionID string, args []string) (string, error)
 }
+
+// RunStopper cancels the active agent run of a session.
+type RunStopper interface {
+	Stop(sessionID string) bool
+}
+
+// RunTracker lets long commands be stopped like the agent runs of their
+// session. Track returns a context that Stop cancels and a function to call
+// when the command is done.
+type RunTracker interface {
+	RunStopper
+	Track(ctx context.Context, sessionID string) (context.Context, func())
+}
+
+type progressKey struct{}
+
+// WithProgress returns a context through which commands report the progress
+// of long operations to report.
+func WithProgress(ctx context.Context, report func(text string)) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// ReportProgress reports the progress of a long operation, if the caller
+// of the command shows it.
+func ReportProgress(ctx context.Context, text string) {
+	if report, ok := ctx.Value(progressKey{}).(func(string)); ok {
+		report(text)
+	}
+}
@@ -2,13 +2,16 @@ package core
 
 import (
 	"context"
+	"time"
 )
 
 type AppConfig interface {
 	GetRuntimePath() string
 	GetDatabasePath() string
+	GetMediaPath() string
 	GetMCPConfigPath() string
-	GetContextWindowSize() int
+	GetHistoryMessages() int
+	GetContextTokens() int
 	IsTelegramSelected() bool
 }
 
@@ -23,13 +26,55 @@ type ProviderConfig interface {
 	GetModel() string
 	SetModel(model string) error
 	GetProvider() string
+	GetFallbackModels() []string
+	GetPromptToolModels() []string
+	GetCapabilitiesPath() string
+	GetMediaPath() string
 	GetAnthropicAPIKey() string
 	GetOpenAIAPIKey() string
 	GetOpenRouterAPIKey() string
 	GetOllamaAPIKey() string
 	GetOllamaBaseURL() string
+	GetOllamaNumCtx() int
+	GetOllamaOptionsPath() string
 	GetCustomOpenAIBaseURL() string
 	GetCustomOpenAIAPIKey() string
+	GetLLMRequestsPerMinute() int
+	GetLLMTokensPerMinute() int
+	GetLLMConcurrency() int
+}
+
+type AgentConfig interface {
+	GetAgentMaxSteps() int
+	GetAgentMaxDuration() time.Duration
+	GetAgentMaxTokens() int
+	GetAgentMaxRepeatedCalls() int
+	GetToolConcurrency() int
+	GetQueueMode() string
+}
+
+type ApprovalConfig interface {
+	GetApprovalsPath() string
+	GetApprovalTimeout() time.Duration
+}
+
+type OutputConfig interface {
+	GetRuntimePath() string
+	GetOutputPolicyPath() string
+	GetToolOutputsPath() string
+}
+
+type UsageConfig interface {
+	GetPricesPath() string
+	GetMonthlyBudget() float64
+}
+
+type LocalModelConfig interface {
+	GetModelsPath() string
+	GetEmbeddingModel() string
+	GetLocalContextSize() int
+	GetLocalThreads() int
+	GetLocalGPULayers() int
 }
 
 type EmbeddingConfig interface {
@@ -42,5 +87,10 @@ type TelegramConfig interface {
 }
 
 type GlobalState interface {
+	// ChangeModel switches the model of all sessions without their own.
 	ChangeModel(ctx context.Context, model string) error
+	// CheckModel reports whether a "provider/model" can be used.
+	CheckModel(ctx context.Context, model string) error
+	// Capabilities returns what a "provider/model" can do.
+	Capabilities(ctx context.Context, model string) Capabilities
 }
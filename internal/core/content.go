@@ -0,0 +1,73 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Content part types.
+const (
+	PartText  = "text"
+	PartImage = "image"
+	PartFile  = "file"
+	PartAudio = "audio"
+)
+
+// ContentPart is a piece of a message besides its text content, e.g. an
+// image returned by a tool. Binary data is kept in a file in the media
+// directory and read when the message is sent.
+type ContentPart struct {
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	MediaType string `json:"media_type,omitempty"` // e.g. "image/png", "application/pdf"
+	Path      string `json:"path,omitempty"`       // absolute path of the data
+	Data      []byte `json:"-"`                    // the data itself, if already loaded
+}
+
+// PartType returns the part type for a media type.
+func PartType(mediaType string) string {
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return PartImage
+	case strings.HasPrefix(mediaType, "audio/"):
+		return PartAudio
+	default:
+		return PartFile
+	}
+}
+
+// Placeholder describes the part in text, for models that cannot take it.
+func (p ContentPart) Placeholder(reason string) string {
+	if p.Type == PartText {
+		return p.Text
+	}
+	return fmt.Sprintf("[%s %s at %s: %s]", p.Type, p.MediaType, p.Path, reason)
+}
+
+// SaveMedia writes data to a file in dir named after its hash and returns
+// the part referring to it.
+func SaveMedia(dir string, data []byte, mediaType string) (ContentPart, error) {
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+
+	ext := ".bin"
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		ext = exts[0]
+	}
+	sum := sha256.Sum256(data)
+	path := filepath.Join(dir, hex.EncodeToString(sum[:8])+ext)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ContentPart{}, fmt.Errorf("failed to create media directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return ContentPart{}, fmt.Errorf("failed to save %s: %w", mediaType, err)
+	}
+	return ContentPart{Type: PartType(mediaType), MediaType: mediaType, Path: path}, nil
+}
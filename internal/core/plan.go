@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type PlanStatus string
+
+const (
+	PlanActive    PlanStatus = "active"
+	PlanCompleted PlanStatus = "completed"
+	PlanReplaced  PlanStatus = "replaced"
+	PlanCancelled PlanStatus = "cancelled"
+)
+
+type StepStatus string
+
+const (
+	StepPending    StepStatus = "pending"
+	StepInProgress StepStatus = "in_progress"
+	StepDone       StepStatus = "done"
+	StepFailed     StepStatus = "failed"
+	StepSkipped    StepStatus = "skipped"
+)
+
+// Valid reports whether s is one of the known step statuses.
+func (s StepStatus) Valid() bool {
+	switch s {
+	case StepPending, StepInProgress, StepDone, StepFailed, StepSkipped:
+		return true
+	}
+	return false
+}
+
+// PlanRepository stores task plans. A session has at most one active plan.
+type PlanRepository interface {
+	// CreatePlan stores a new active plan, replacing the session's active one.
+	CreatePlan(ctx context.Context, sessionID, title string, steps []string) (Plan, error)
+	// GetActivePlan returns the session's active plan, or nil if there is none.
+	GetActivePlan(ctx context.Context, sessionID string) (*Plan, error)
+	UpdateStep(ctx context.Context, planID int64, position int, status StepStatus, note string) error
+	SetPlanStatus(ctx context.Context, planID int64, status PlanStatus) error
+}
+
+// Plan is a multi-step task of a session. Steps are numbered from 1.
+type Plan struct {
+	ID        int64      `json:"id"`
+	SessionID string     `json:"session_id"`
+	Title     string     `json:"title"`
+	Status    PlanStatus `json:"status"`
+	Steps     []PlanStep `json:"steps"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type PlanStep struct {
+	Position    int        `json:"position"`
+	Description string     `json:"description"`
+	Status      StepStatus `json:"status"`
+	Note        string     `json:"note,omitempty"`
+}
+
+// Done counts the steps that need no more work.
+func (p Plan) Done() int {
+	var n int
+	for _, s := range p.Steps {
+		if s.Status == StepDone || s.Status == StepSkipped {
+			n++
+		}
+	}
+	return n
+}
+
+// Checklist renders the plan as a numbered list with a status mark per step.
+func (p Plan) Checklist() string {
+	marks := map[StepStatus]string{
+		StepPending:    "[ ]",
+		StepInProgress: "[~]",
+		StepDone:       "[x]",
+		StepFailed:     "[!]",
+		StepSkipped:    "[-]",
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%d/%d done)\n", p.Title, p.Done(), len(p.Steps))
+	for _, s := range p.Steps {
+		fmt.Fprintf(&b, "%d. %s %s", s.Position, marks[s.Status], s.Description)
+		if s.Note != "" {
+			fmt.Fprintf(&b, " — %s", s.Note)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
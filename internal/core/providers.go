@@ -1,12 +1,115 @@
 package core
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type AIProvider interface {
 	Chat(ctx context.Context, history []Message, tools []Tool) (Message, error)
 	Models(ctx context.Context) ([]Model, error)
 }
 
+// StreamingProvider is implemented by providers that can deliver a completion
+// incrementally. The returned Message is the fully assembled response.
+type StreamingProvider interface {
+	ChatStream(ctx context.Context, history []Message, tools []Tool, onDelta func(StreamDelta)) (Message, error)
+}
+
+// ChatOptions are generation parameters of a request. Zero values keep the
+// provider defaults, and providers ignore options they do not support.
+type ChatOptions struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	MaxTokens       int      `json:"max_tokens,omitempty"`
+	ReasoningEffort string   `json:"reasoning_effort,omitempty"` // low, medium or high
+}
+
+type chatOptionsKey struct{}
+
+// WithChatOptions returns a context carrying the options for chat requests
+// made with it.
+func WithChatOptions(ctx context.Context, opts ChatOptions) context.Context {
+	return context.WithValue(ctx, chatOptionsKey{}, opts)
+}
+
+// ChatOptionsFromCtx returns the options set by WithChatOptions.
+func ChatOptionsFromCtx(ctx context.Context) ChatOptions {
+	opts, _ := ctx.Value(chatOptionsKey{}).(ChatOptions)
+	return opts
+}
+
+// StreamDelta is an incremental piece of an assistant response.
+type StreamDelta struct {
+	Content   string
+	Reasoning string
+}
+
+// CapabilityProvider reports what the model used for the session of ctx
+// can do.
+type CapabilityProvider interface {
+	SessionCapabilities(ctx context.Context) Capabilities
+}
+
+// Capabilities describe what a model can do. Zero values and nil flags are
+// unknown.
+type Capabilities struct {
+	ContextWindow   int   `json:"context_window,omitempty"`
+	MaxOutputTokens int   `json:"max_output_tokens,omitempty"`
+	Tools           *bool `json:"tools,omitempty"`
+	Vision          *bool `json:"vision,omitempty"`
+	Reasoning       *bool `json:"reasoning,omitempty"`
+}
+
+// Merge returns c with its unknown values taken from other.
+func (c Capabilities) Merge(other Capabilities) Capabilities {
+	if c.ContextWindow == 0 {
+		c.ContextWindow = other.ContextWindow
+	}
+	if c.MaxOutputTokens == 0 {
+		c.MaxOutputTokens = other.MaxOutputTokens
+	}
+	for _, f := range []struct{ dst, src **bool }{
+		{&c.Tools, &other.Tools},
+		{&c.Vision, &other.Vision},
+		{&c.Reasoning, &other.Reasoning},
+	} {
+		if *f.dst == nil {
+			*f.dst = *f.src
+		}
+	}
+	return c
+}
+
+// SupportsTools reports whether the model takes tools natively. Models
+// are assumed to until known otherwise.
+func (c Capabilities) SupportsTools() bool {
+	return c.Tools == nil || *c.Tools
+}
+
+// ModelManager downloads, removes and lists the models of a model server.
+type ModelManager interface {
+	PullModel(ctx context.Context, name string, onProgress func(PullProgress)) error
+	DeleteModel(ctx context.Context, name string) error
+	RunningModels(ctx context.Context) ([]RunningModel, error)
+}
+
+// PullProgress is a step of a model download. Total and Completed are in
+// bytes, 0 for steps that download nothing.
+type PullProgress struct {
+	Status    string
+	Total     int64
+	Completed int64
+}
+
+// RunningModel is a model loaded by the model server.
+type RunningModel struct {
+	Name          string
+	Size          int64 // bytes in memory
+	VRAM          int64 // bytes of Size in GPU memory
+	ContextLength int
+	ExpiresAt     time.Time // when it is unloaded
+}
+
 type Embedder interface {
 	EncodeQuery(ctx context.Context, text string) ([]float32, error)
 	EncodePassage(ctx context.Context, text string) ([][]float32, error)
@@ -21,11 +124,43 @@ type EmbeddingModel interface {
 
 type MCPServer interface {
 	GetTools(ctx context.Context) ([]Tool, error)
-	CallTool(ctx context.Context, name string, args string) (string, error)
+	CallTool(ctx context.Context, name string, args string) (ToolResult, error)
+}
+
+// ToolResult is the output of a tool call. Images, audio and files the tool
+// returned are kept apart from the text, so text cannot make up parts.
+type ToolResult struct {
+	Content string
+	Parts   []ContentPart
 }
 
 type Model struct {
-	ID            string `json:"id"`
-	Name          string `json:"name"`
-	ContextLength int    `json:"context_length"`
+	ID            string        `json:"id"`
+	Name          string        `json:"name"`
+	ContextLength int           `json:"context_length"`
+	Pricing       *ModelPricing `json:"pricing,omitempty"`
+	// Capabilities reported by the provider, if any
+	Capabilities Capabilities `json:"-"`
+}
+
+// ModelPricing is the price of a model in USD per token, in the format of
+// OpenRouter's model list.
+type ModelPricing struct {
+	Prompt         string `json:"prompt"`
+	Completion     string `json:"completion"`
+	InputCacheRead string `json:"input_cache_read,omitempty"`
+}
+
+type backgroundKey struct{}
+
+// WithBackground marks LLM requests made with ctx as background work, which
+// gives way to interactive requests when a provider is rate limited.
+func WithBackground(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+// IsBackground reports whether ctx was marked by WithBackground.
+func IsBackground(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundKey{}).(bool)
+	return background
 }
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// subSessionSep separates the session of a sub-agent from the session that
+// started it, as in "telegram-1/sub-2".
+const subSessionSep = "/sub-"
+
+// SubSessionID returns the ID of the n-th sub-agent session of parent.
+func SubSessionID(parent string, n uint64) string {
+	return fmt.Sprintf("%s%s%d", parent, subSessionSep, n)
+}
+
+// IsSubSession reports whether a session belongs to a sub-agent rather than
+// to a user.
+func IsSubSession(sessionID string) bool {
+	return strings.Contains(sessionID, subSessionSep)
+}
+
+type sessionKey struct{}
+
+type rootSessionKey struct{}
+
+// WithSessionID returns a context carrying the session of the current run,
+// so tools can tell which session called them.
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	if RootSessionIDFromCtx(ctx) == "" {
+		ctx = context.WithValue(ctx, rootSessionKey{}, sessionID)
+	}
+	return context.WithValue(ctx, sessionKey{}, sessionID)
+}
+
+// SessionIDFromCtx returns the session set by WithSessionID, or "".
+func SessionIDFromCtx(ctx context.Context) string {
+	id, _ := ctx.Value(sessionKey{}).(string)
+	return id
+}
+
+// RootSessionIDFromCtx returns the first session set by WithSessionID. For
+// sub-agents it is the session of the user who started the run.
+func RootSessionIDFromCtx(ctx context.Context) string {
+	id, _ := ctx.Value(rootSessionKey{}).(string)
+	return id
+}
+
+// SessionSettings override the model and generation parameters of a
+// session. Empty fields keep the global defaults.
+type SessionSettings struct {
+	SessionID string      `json:"session_id"`
+	Model     string      `json:"model,omitempty"` // provider/model
+	Options   ChatOptions `json:"options"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+type SessionSettingsRepository interface {
+	// GetSessionSettings returns empty settings if the session has none.
+	GetSessionSettings(ctx context.Context, sessionID string) (SessionSettings, error)
+	SaveSessionSettings(ctx context.Context, settings SessionSettings) error
+}
@@ -8,6 +8,7 @@ import (
 type MessagesRepository interface {
 	AddMessage(ctx context.Context, sessionID string, msg Message) error
 	GetMessages(ctx context.Context, sessionID string, limit int) ([]Message, error)
+	GetMessagesSince(ctx context.Context, sessionID string, afterID int64, limit int) ([]Message, error)
 	GetUnembeddedMessages(ctx context.Context, limit int) ([]StoredMessage, error)
 	UpdateMessageEmbedding(ctx context.Context, id int64, embedding []float32) error
 }
@@ -20,6 +21,23 @@ type KnowledgeRepository interface {
 	GetRecentExtractedMessages(ctx context.Context, limit int, before time.Time, threshold time.Duration) ([]StoredMessage, error)
 }
 
+type SummaryRepository interface {
+	GetSummary(ctx context.Context, sessionID string) (SessionSummary, error)
+	SaveSummary(ctx context.Context, summary SessionSummary) error
+	ListSessions(ctx context.Context) ([]string, error)
+	CountMessagesSince(ctx context.Context, sessionID string, afterID int64) (int, error)
+	GetStoredMessagesSince(ctx context.Context, sessionID string, afterID int64, limit int) ([]StoredMessage, error)
+}
+
+// SessionSummary is the running summary of a session's history up to and
+// including LastMessageID.
+type SessionSummary struct {
+	SessionID     string    `json:"session_id"`
+	Summary       string    `json:"summary"`
+	LastMessageID int64     `json:"last_message_id"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
 type StoredMessage struct {
 	ID         int64     `json:"id"`
 	SessionID  string    `json:"session_id"`
@@ -27,6 +27,10 @@ type Function struct {
 type Tool struct {
 	Type     string   `json:"type"`
 	Function Function `json:"function"`
+
+	// Internal
+	Serial bool   `json:"-"` // must not run concurrently with other tool calls
+	Server string `json:"-"` // MCP server providing the tool, empty for native tools
 }
 
 type ToolCall struct {
@@ -41,12 +45,18 @@ type FunctionCall struct {
 }
 
 type Message struct {
-	Role       string     `json:"role"`
-	Content    string     `json:"content"`
-	Reasoning  string     `json:"reasoning,omitempty"`
-	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
-	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Role       string        `json:"role"`
+	Content    string        `json:"content"`
+	Parts      []ContentPart `json:"parts,omitempty"` // images, files or audio besides the text
+	Reasoning  string        `json:"reasoning,omitempty"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
 
 	// Internal
-	Embedding [][]float32 `json:"-"`
+	Embedding     [][]float32 `json:"-"`
+	IsError       bool        `json:"-"` // a tool message reporting a failed call
+	FallbackModel string      `json:"-"` // "provider/model" that answered instead of the main model
+	Usage         *Usage      `json:"-"` // tokens used to generate an assistant message
+	Warning       string      `json:"-"` // shown to the user along with the message
+	CachePoint    bool        `json:"-"` // last message of the stable prompt prefix that providers may cache
 }
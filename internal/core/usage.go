@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// Usage is the token count of a chat request as reported by the provider.
+type Usage struct {
+	Model            string  `json:"model,omitempty"` // provider/model that served the request
+	PromptTokens     int     `json:"prompt_tokens"`   // including cached tokens
+	CompletionTokens int     `json:"completion_tokens"`
+	CachedTokens     int     `json:"cached_tokens,omitempty"`
+	ReasoningTokens  int     `json:"reasoning_tokens,omitempty"` // part of the completion tokens
+	Cost             float64 `json:"cost,omitempty"`             // USD, as reported by the provider or priced by the meter
+}
+
+// Add sums the token counts and costs of two usages.
+func (u Usage) Add(o Usage) Usage {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.CachedTokens += o.CachedTokens
+	u.ReasoningTokens += o.ReasoningTokens
+	u.Cost += o.Cost
+	return u
+}
+
+// Purposes of LLM requests in usage records.
+const (
+	PurposeChat       = "chat"
+	PurposeExtraction = "extraction"
+	PurposeSummary    = "summary"
+)
+
+// UsageRecord is the usage of one chat request.
+type UsageRecord struct {
+	SessionID string    `json:"session_id,omitempty"`
+	RunID     string    `json:"run_id,omitempty"`
+	Purpose   string    `json:"purpose"`
+	Usage     Usage     `json:"usage"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UsageGroup is how usage totals are broken down.
+type UsageGroup string
+
+const (
+	UsageTotal   UsageGroup = ""
+	UsageByDay   UsageGroup = "day"
+	UsageByModel UsageGroup = "model"
+)
+
+// UsageSum is the usage of a group of requests, e.g. of one day.
+type UsageSum struct {
+	Key      string `json:"key"`
+	Requests int    `json:"requests"`
+	Usage    Usage  `json:"usage"`
+}
+
+type UsageRepository interface {
+	AddUsage(ctx context.Context, rec UsageRecord) error
+	// SumUsage returns the usage since a time, broken down by group and
+	// ordered by key.
+	SumUsage(ctx context.Context, since time.Time, group UsageGroup) ([]UsageSum, error)
+}
+
+type runKey struct{}
+
+// WithRunID returns a context carrying the ID of the current agent run.
+func WithRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, runKey{}, runID)
+}
+
+// RunIDFromCtx returns the run set by WithRunID, or "".
+func RunIDFromCtx(ctx context.Context) string {
+	id, _ := ctx.Value(runKey{}).(string)
+	return id
+}
@@ -2,15 +2,23 @@ package llm
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/sandevgo/tuskbot/internal/core"
 )
 
+const (
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 8192
+)
+
 type Anthropic struct {
 	baseProvider
 }
@@ -21,32 +29,62 @@ func NewAnthropic(apiKey, model string) *Anthropic {
 	}
 }
 
-func (a *Anthropic) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
-	type msg struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
-	}
+// anthropicBlock is a content block of the Messages API.
+// Only the fields relevant to the block type are populated.
+type anthropicBlock struct {
+	Type         string                 `json:"type"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
 
-	var messages []msg
-	for _, m := range history {
-		if m.Role == core.RoleSystem {
-			continue
-		}
-		messages = append(messages, msg{Role: m.Role, Content: m.Content})
-	}
+	// text
+	Text string `json:"text,omitempty"`
 
-	payload := map[string]any{
-		"model":      a.model,
-		"max_tokens": 4096,
-		"messages":   messages,
-	}
+	// thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
 
-	headers := map[string]string{
-		"x-api-key":         a.apiKey,
-		"anthropic-version": "2023-06-01",
-	}
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result, the content is a string or a list of blocks
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   any    `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
 
-	resp, err := a.doRequest(ctx, http.MethodPost, "/v1/messages", payload, headers)
+	// image, document
+	Source *anthropicSource `json:"source,omitempty"`
+}
+
+// anthropicSource is the base64 data of an image or document block.
+type anthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description,omitempty"`
+	InputSchema  json.RawMessage        `json:"input_schema"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+// anthropicCacheControl marks a prompt cache breakpoint: the prompt up to
+// and including the marked block is cached for reuse by later requests.
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+var ephemeralCache = &anthropicCacheControl{Type: "ephemeral"}
+
+func (a *Anthropic) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	resp, err := a.doRequest(ctx, http.MethodPost, "/v1/messages", a.buildPayload(ctx, history, tools), a.headers())
 	if err != nil {
 		return core.Message{}, err
 	}
@@ -58,33 +96,335 @@ func (a *Anthropic) Chat(ctx context.Context, history []core.Message, tools []co
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return core.Message{}, fmt.Errorf("http %d: %s", resp.StatusCode, string(data))
+		return core.Message{}, newAPIError(resp.StatusCode, data)
 	}
 
 	var result struct {
-		Content []struct {
-			Type string `json:"type"`
-			Text string `json:"text"`
-		} `json:"content"`
+		Content []anthropicBlock `json:"content"`
+		Usage   anthropicUsage   `json:"usage"`
 	}
 	if err := json.Unmarshal(data, &result); err != nil {
 		return core.Message{}, fmt.Errorf("decode: %w", err)
 	}
 
-	var text string
-	for _, c := range result.Content {
-		if c.Type == "text" {
-			text += c.Text
+	msg := parseAnthropicContent(result.Content)
+	msg.Usage = result.Usage.toUsage()
+	result.Usage.log(ctx, a.model)
+	return msg, nil
+}
+
+// anthropicUsage is the usage block of the Messages API. Input tokens do
+// not include the cached ones.
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// log reports prompt cache reads and writes.
+func (u anthropicUsage) log(ctx context.Context, model string) {
+	logCache(ctx, model, u.toUsage()).
+		Int("cache_write_tokens", u.CacheCreationInputTokens).
+		Msg("prompt cache")
+}
+
+func (u anthropicUsage) toUsage() *core.Usage {
+	return &core.Usage{
+		PromptTokens:     u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		CompletionTokens: u.OutputTokens,
+		CachedTokens:     u.CacheReadInputTokens,
+	}
+}
+
+// ChatStream requests a streamed completion. Text and thinking deltas are
+// reported as they arrive, tool_use inputs are assembled from partial JSON.
+func (a *Anthropic) ChatStream(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	payload := a.buildPayload(ctx, history, tools)
+	payload["stream"] = true
+
+	resp, err := a.doStream(ctx, http.MethodPost, "/v1/messages", payload, a.headers())
+	if err != nil {
+		return core.Message{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return core.Message{}, newAPIError(resp.StatusCode, data)
+	}
+
+	acc := &anthropicStreamAccumulator{}
+	err = readSSE(resp.Body, func(event, data string) error {
+		delta, err := acc.add(event, data)
+		if err != nil {
+			return err
+		}
+		if acc.stopped {
+			return io.EOF
 		}
+		if onDelta != nil && (delta.Content != "" || delta.Reasoning != "") {
+			onDelta(delta)
+		}
+		return nil
+	})
+	if err != nil {
+		return core.Message{}, fmt.Errorf("read stream: %w", err)
 	}
-	return core.Message{Role: core.RoleAssistant, Content: text}, nil
+
+	msg, err := acc.message()
+	if err != nil {
+		return core.Message{}, err
+	}
+	acc.usage.log(ctx, a.model)
+	return msg, nil
 }
 
-func (a *Anthropic) Models(ctx context.Context) ([]core.Model, error) {
-	headers := map[string]string{
+func (a *Anthropic) headers() map[string]string {
+	return map[string]string{
 		"x-api-key":         a.apiKey,
-		"anthropic-version": "2023-06-01",
+		"anthropic-version": anthropicVersion,
 	}
+}
+
+// buildPayload creates a Messages API request. The reasoning effort option
+// is not used, since extended thinking would require sending thinking blocks
+// back with their signatures.
+//
+// Cache breakpoints are placed after the tools and after the stable part of
+// the system prompt, which the API caches in that order. While tool results
+// come in during a run, the conversation so far is cached as well, so the
+// next step reads it from the cache.
+func (a *Anthropic) buildPayload(ctx context.Context, history []core.Message, tools []core.Tool) map[string]any {
+	system, messages := a.toAnthropicMessages(history)
+
+	opts := core.ChatOptionsFromCtx(ctx)
+	maxTokens := anthropicMaxTokens
+	if opts.MaxTokens > 0 {
+		maxTokens = opts.MaxTokens
+	}
+
+	payload := map[string]any{
+		"model":      a.model,
+		"max_tokens": maxTokens,
+		"messages":   messages,
+	}
+	if opts.Temperature != nil {
+		payload["temperature"] = *opts.Temperature
+	}
+	if len(system) > 0 {
+		payload["system"] = system
+	}
+	if len(tools) > 0 {
+		anthropicTools := toAnthropicTools(tools)
+		anthropicTools[len(anthropicTools)-1].CacheControl = ephemeralCache
+		payload["tools"] = anthropicTools
+	}
+	if n := len(messages); n > 0 && len(history) > 0 && history[len(history)-1].Role == core.RoleTool {
+		blocks := messages[n-1].Content
+		blocks[len(blocks)-1].CacheControl = ephemeralCache
+	}
+	return payload
+}
+
+// toAnthropicMessages maps the internal history onto the Messages API.
+// System messages are lifted into the top-level system prompt, tool results
+// become user turns with tool_result blocks, and consecutive turns of the same
+// role are merged because the API requires strict user/assistant alternation.
+func (a *Anthropic) toAnthropicMessages(history []core.Message) ([]anthropicBlock, []anthropicMessage) {
+	var system, stable []string
+	var messages []anthropicMessage
+
+	appendBlocks := func(role string, blocks ...anthropicBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content = append(messages[n-1].Content, blocks...)
+			return
+		}
+		messages = append(messages, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for _, m := range history {
+		switch m.Role {
+		case core.RoleSystem:
+			if content := withPlaceholders(m.Content, m.Parts, "only user messages can carry it"); content != "" {
+				system = append(system, content)
+			}
+			if m.CachePoint {
+				stable, system = append(stable, system...), nil
+			}
+
+		case core.RoleAssistant:
+			var blocks []anthropicBlock
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			if len(m.Parts) > 0 {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: withPlaceholders("", m.Parts, "only user messages can carry it")})
+			}
+			for _, tc := range m.ToolCalls {
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Function.Name,
+					Input: toolInput(tc.Function.Arguments),
+				})
+			}
+			appendBlocks(core.RoleAssistant, blocks...)
+
+		case core.RoleTool:
+			var content any = m.Content
+			if len(m.Parts) > 0 {
+				// The API rejects empty text blocks
+				var blocks []anthropicBlock
+				if m.Content != "" {
+					blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+				}
+				content = append(blocks, a.toAnthropicParts(m.Parts)...)
+			}
+			appendBlocks(core.RoleUser, anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: m.ToolCallID,
+				Content:   content,
+				IsError:   m.IsError,
+			})
+
+		default:
+			if m.Content != "" {
+				appendBlocks(core.RoleUser, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			appendBlocks(core.RoleUser, a.toAnthropicParts(m.Parts)...)
+		}
+	}
+
+	// The conversation must start with a user turn
+	if len(messages) > 0 && messages[0].Role != core.RoleUser {
+		messages = append([]anthropicMessage{{
+			Role:    core.RoleUser,
+			Content: []anthropicBlock{{Type: "text", Text: "(conversation continued)"}},
+		}}, messages...)
+	}
+
+	return systemBlocks(stable, system), messages
+}
+
+// anthropicImageTypes are the image formats the API accepts.
+var anthropicImageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// toAnthropicParts maps content parts onto image and document blocks.
+// Other parts, such as audio, are described in text.
+func (a *Anthropic) toAnthropicParts(parts []core.ContentPart) []anthropicBlock {
+	blocks := make([]anthropicBlock, 0, len(parts))
+	for _, p := range parts {
+		blockType := ""
+		switch {
+		case p.Type == core.PartText:
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: p.Text})
+			continue
+		case slices.Contains(anthropicImageTypes, p.MediaType):
+			blockType = "image"
+		case p.MediaType == "application/pdf":
+			blockType = "document"
+		default:
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: p.Placeholder("the model cannot take it")})
+			continue
+		}
+
+		data, err := a.partData(p)
+		if err != nil {
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: p.Placeholder(err.Error())})
+			continue
+		}
+		blocks = append(blocks, anthropicBlock{
+			Type: blockType,
+			Source: &anthropicSource{
+				Type:      "base64",
+				MediaType: p.MediaType,
+				Data:      base64.StdEncoding.EncodeToString(data),
+			},
+		})
+	}
+	return blocks
+}
+
+// systemBlocks joins the system prompt into a cached block with the stable
+// part and a block with the rest.
+func systemBlocks(stable, rest []string) []anthropicBlock {
+	var blocks []anthropicBlock
+	if len(stable) > 0 {
+		blocks = append(blocks, anthropicBlock{
+			Type:         "text",
+			Text:         strings.Join(stable, "\n\n"),
+			CacheControl: ephemeralCache,
+		})
+	}
+	if len(rest) > 0 {
+		blocks = append(blocks, anthropicBlock{Type: "text", Text: strings.Join(rest, "\n\n")})
+	}
+	return blocks
+}
+
+// toolInput converts stored tool call arguments into a JSON object,
+// since the API rejects empty or non-object inputs.
+func toolInput(args string) json.RawMessage {
+	args = strings.TrimSpace(args)
+	if args == "" || !json.Valid([]byte(args)) || !strings.HasPrefix(args, "{") {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(args)
+}
+
+func toAnthropicTools(tools []core.Tool) []anthropicTool {
+	result := make([]anthropicTool, 0, len(tools))
+	for _, t := range tools {
+		schema := t.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		result = append(result, anthropicTool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	return result
+}
+
+func parseAnthropicContent(blocks []anthropicBlock) core.Message {
+	msg := core.Message{Role: core.RoleAssistant}
+
+	var text, reasoning strings.Builder
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			text.WriteString(b.Text)
+		case "thinking":
+			reasoning.WriteString(b.Thinking)
+		case "tool_use":
+			args := "{}"
+			if len(b.Input) > 0 {
+				args = string(b.Input)
+			}
+			msg.ToolCalls = append(msg.ToolCalls, core.ToolCall{
+				ID:   b.ID,
+				Type: "function",
+				Function: core.FunctionCall{
+					Name:      b.Name,
+					Arguments: args,
+				},
+			})
+		}
+	}
+
+	msg.Content = text.String()
+	msg.Reasoning = reasoning.String()
+	return msg
+}
+
+func (a *Anthropic) Models(ctx context.Context) ([]core.Model, error) {
+	headers := a.headers()
 
 	var models []core.Model
 	afterID := ""
@@ -107,7 +447,7 @@ func (a *Anthropic) Models(ctx context.Context) ([]core.Model, error) {
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("http %d: %s", resp.StatusCode, string(data))
+			return nil, newAPIError(resp.StatusCode, data)
 		}
 
 		var result struct {
@@ -142,3 +482,123 @@ func (a *Anthropic) Models(ctx context.Context) ([]core.Model, error) {
 
 	return models, nil
 }
+
+// anthropicStreamAccumulator assembles Messages API stream events into content blocks.
+type anthropicStreamAccumulator struct {
+	blocks []anthropicBlock
+	inputs []string
+	usage  anthropicUsage
+	// stopped is set by the message_stop event
+	stopped bool
+}
+
+func (a *anthropicStreamAccumulator) add(event, data string) (core.StreamDelta, error) {
+	switch event {
+	case "message_start":
+		var ev struct {
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return core.StreamDelta{}, fmt.Errorf("decode %s: %w", event, err)
+		}
+		a.usage = ev.Message.Usage
+
+	case "message_delta":
+		// Carries the final output token count
+		var ev struct {
+			Usage struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return core.StreamDelta{}, fmt.Errorf("decode %s: %w", event, err)
+		}
+		a.usage.OutputTokens = ev.Usage.OutputTokens
+
+	case "message_stop":
+		a.stopped = true
+
+	case "content_block_start":
+		var ev struct {
+			Index        int            `json:"index"`
+			ContentBlock anthropicBlock `json:"content_block"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return core.StreamDelta{}, fmt.Errorf("decode %s: %w", event, err)
+		}
+		a.grow(ev.Index)
+		block := ev.ContentBlock
+		block.Input = nil // streamed separately via input_json_delta
+		a.blocks[ev.Index] = block
+		return core.StreamDelta{Content: block.Text, Reasoning: block.Thinking}, nil
+
+	case "content_block_delta":
+		var ev struct {
+			Index int `json:"index"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				Thinking    string `json:"thinking"`
+				Signature   string `json:"signature"`
+				PartialJSON string `json:"partial_json"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return core.StreamDelta{}, fmt.Errorf("decode %s: %w", event, err)
+		}
+		a.grow(ev.Index)
+		block := &a.blocks[ev.Index]
+
+		switch ev.Delta.Type {
+		case "text_delta":
+			block.Text += ev.Delta.Text
+			return core.StreamDelta{Content: ev.Delta.Text}, nil
+		case "thinking_delta":
+			block.Thinking += ev.Delta.Thinking
+			return core.StreamDelta{Reasoning: ev.Delta.Thinking}, nil
+		case "signature_delta":
+			block.Signature += ev.Delta.Signature
+		case "input_json_delta":
+			a.inputs[ev.Index] += ev.Delta.PartialJSON
+		}
+
+	case "error":
+		var ev struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return core.StreamDelta{}, fmt.Errorf("decode %s: %w", event, err)
+		}
+		return core.StreamDelta{}, fmt.Errorf("stream error: %s: %s", ev.Error.Type, ev.Error.Message)
+	}
+
+	return core.StreamDelta{}, nil
+}
+
+func (a *anthropicStreamAccumulator) grow(index int) {
+	for len(a.blocks) <= index {
+		a.blocks = append(a.blocks, anthropicBlock{})
+		a.inputs = append(a.inputs, "")
+	}
+}
+
+// message returns the assembled message, or an error if the stream ended
+// without message_stop.
+func (a *anthropicStreamAccumulator) message() (core.Message, error) {
+	if !a.stopped {
+		return core.Message{}, errStreamEnded
+	}
+	for i := range a.blocks {
+		if a.blocks[i].Type == "tool_use" {
+			a.blocks[i].Input = toolInput(a.inputs[i])
+		}
+	}
+	msg := parseAnthropicContent(a.blocks)
+	msg.Usage = a.usage.toUsage()
+	return msg, nil
+}
@@ -0,0 +1,170 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToAnthropicMessages(t *testing.T) {
+	history := []core.Message{
+		{Role: core.RoleSystem, Content: "system prompt"},
+		{Role: core.RoleSystem, Content: "identity"},
+		{Role: core.RoleUser, Content: "list files"},
+		{Role: core.RoleAssistant, Content: "sure", ToolCalls: []core.ToolCall{
+			{ID: "call_1", Type: "function", Function: core.FunctionCall{Name: "list_directory", Arguments: `{"path":"."}`}},
+			{ID: "call_2", Type: "function", Function: core.FunctionCall{Name: "get_file_info", Arguments: ""}},
+		}},
+		{Role: core.RoleTool, ToolCallID: "call_1", Content: "[FILE] a.txt"},
+		{Role: core.RoleTool, ToolCallID: "call_2", Content: "Error: not found", IsError: true},
+		{Role: core.RoleAssistant, Content: "done"},
+	}
+
+	system, messages := NewAnthropic("key", "claude").toAnthropicMessages(history)
+
+	require.Len(t, system, 1)
+	assert.Equal(t, "system prompt\n\nidentity", system[0].Text)
+	assert.Nil(t, system[0].CacheControl)
+	require.Len(t, messages, 4)
+
+	assert.Equal(t, core.RoleUser, messages[0].Role)
+	assert.Equal(t, "list files", messages[0].Content[0].Text)
+
+	assert.Equal(t, core.RoleAssistant, messages[1].Role)
+	require.Len(t, messages[1].Content, 3)
+	assert.Equal(t, "text", messages[1].Content[0].Type)
+	assert.Equal(t, "tool_use", messages[1].Content[1].Type)
+	assert.JSONEq(t, `{"path":"."}`, string(messages[1].Content[1].Input))
+	assert.JSONEq(t, `{}`, string(messages[1].Content[2].Input))
+
+	// Both tool results are merged into a single user turn
+	assert.Equal(t, core.RoleUser, messages[2].Role)
+	require.Len(t, messages[2].Content, 2)
+	assert.Equal(t, "tool_result", messages[2].Content[0].Type)
+	assert.Equal(t, "call_1", messages[2].Content[0].ToolUseID)
+	assert.False(t, messages[2].Content[0].IsError)
+	assert.True(t, messages[2].Content[1].IsError)
+
+	assert.Equal(t, core.RoleAssistant, messages[3].Role)
+}
+
+func TestToAnthropicMessages_StartsWithUser(t *testing.T) {
+	_, messages := NewAnthropic("key", "claude").toAnthropicMessages([]core.Message{
+		{Role: core.RoleAssistant, Content: "hello"},
+	})
+
+	require.Len(t, messages, 2)
+	assert.Equal(t, core.RoleUser, messages[0].Role)
+	assert.Equal(t, core.RoleAssistant, messages[1].Role)
+}
+
+func TestAnthropic_BuildPayload_CacheBreakpoints(t *testing.T) {
+	history := []core.Message{
+		{Role: core.RoleSystem, Content: "system prompt"},
+		{Role: core.RoleSystem, Content: "memory", CachePoint: true},
+		{Role: core.RoleSystem, Content: "rag context"},
+		{Role: core.RoleUser, Content: "list files"},
+		{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{
+			{ID: "call_1", Type: "function", Function: core.FunctionCall{Name: "list_directory", Arguments: `{}`}},
+		}},
+		{Role: core.RoleTool, ToolCallID: "call_1", Content: "[FILE] a.txt"},
+	}
+	tools := []core.Tool{
+		{Type: "function", Function: core.Function{Name: "list_directory"}},
+		{Type: "function", Function: core.Function{Name: "read_file"}},
+	}
+
+	data, err := json.Marshal(NewAnthropic("key", "claude").buildPayload(context.Background(), history, tools))
+	require.NoError(t, err)
+
+	var payload struct {
+		System   []anthropicBlock   `json:"system"`
+		Tools    []anthropicTool    `json:"tools"`
+		Messages []anthropicMessage `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal(data, &payload))
+
+	// The stable system prefix is cached, the RAG context is not
+	require.Len(t, payload.System, 2)
+	assert.Equal(t, "system prompt\n\nmemory", payload.System[0].Text)
+	assert.Equal(t, "ephemeral", payload.System[0].CacheControl.Type)
+	assert.Equal(t, "rag context", payload.System[1].Text)
+	assert.Nil(t, payload.System[1].CacheControl)
+
+	require.Len(t, payload.Tools, 2)
+	assert.Nil(t, payload.Tools[0].CacheControl)
+	assert.Equal(t, "ephemeral", payload.Tools[1].CacheControl.Type)
+
+	// During a run the conversation up to the last tool result is cached
+	last := payload.Messages[len(payload.Messages)-1]
+	assert.Equal(t, "tool_result", last.Content[0].Type)
+	assert.Equal(t, "ephemeral", last.Content[0].CacheControl.Type)
+
+	// A new user message is not cached, it is followed by a different context next run
+	data, err = json.Marshal(NewAnthropic("key", "claude").buildPayload(context.Background(), history[:4], nil))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"tools"`)
+	assert.Equal(t, 1, strings.Count(string(data), "cache_control"))
+}
+
+func TestAnthropic_Chat(t *testing.T) {
+	var payload map[string]any
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
+
+		body, _ := io.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(body, &payload))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"content": [
+				{"type": "thinking", "thinking": "need to look", "signature": "sig"},
+				{"type": "text", "text": "Let me check."},
+				{"type": "tool_use", "id": "toolu_1", "name": "read_file", "input": {"path": "a.txt"}}
+			],
+			"stop_reason": "tool_use"
+		}`))
+	}))
+	defer srv.Close()
+
+	a := &Anthropic{baseProvider: newBaseProvider(srv.URL, "test-key", "claude-test")}
+
+	tools := []core.Tool{{
+		Type: "function",
+		Function: core.Function{
+			Name:        "read_file",
+			Description: "Read a file",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"}}}`),
+		},
+	}}
+
+	msg, err := a.Chat(context.Background(), []core.Message{
+		{Role: core.RoleSystem, Content: "be helpful"},
+		{Role: core.RoleUser, Content: "read a.txt"},
+	}, tools)
+	require.NoError(t, err)
+
+	assert.Equal(t, []any{map[string]any{"type": "text", "text": "be helpful"}}, payload["system"])
+	require.Len(t, payload["tools"], 1)
+	tool := payload["tools"].([]any)[0].(map[string]any)
+	assert.Equal(t, "read_file", tool["name"])
+	assert.NotNil(t, tool["input_schema"])
+
+	assert.Equal(t, core.RoleAssistant, msg.Role)
+	assert.Equal(t, "Let me check.", msg.Content)
+	assert.Equal(t, "need to look", msg.Reasoning)
+	require.Len(t, msg.ToolCalls, 1)
+	assert.Equal(t, "toolu_1", msg.ToolCalls[0].ID)
+	assert.Equal(t, "read_file", msg.ToolCalls[0].Function.Name)
+	assert.JSONEq(t, `{"path":"a.txt"}`, msg.ToolCalls[0].Function.Arguments)
+}
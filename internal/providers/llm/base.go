@@ -7,36 +7,90 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	"github.com/rs/zerolog"
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/log"
+	"github.com/sandevgo/tuskbot/pkg/ratelimit"
 	"github.com/sandevgo/tuskbot/pkg/retry"
 )
 
+const (
+	requestTimeout = 120 * time.Second
+
+	// A stream has no total timeout, it fails only when the provider
+	// stops sending
+	streamFirstByteTimeout = 120 * time.Second
+	streamIdleTimeout      = 120 * time.Second
+)
+
 type baseProvider struct {
-	client  *http.Client
-	baseURL string
-	apiKey  string
-	model   string
-	retrier *retry.Retrier
+	client       *http.Client
+	streamClient *http.Client
+	baseURL      string
+	apiKey       string
+	model        string
+	retrier      *retry.Retrier
+	limiter      *ratelimit.Limiter
+
+	// mediaPath is the only directory content parts are read from
+	mediaPath string
 }
 
 func newBaseProvider(baseURL, apiKey, model string) baseProvider {
 	return baseProvider{
 		client: &http.Client{
-			Timeout: 120 * time.Second,
+			Timeout: requestTimeout,
 		},
-		baseURL: baseURL,
-		apiKey:  apiKey,
-		model:   model,
-		retrier: retry.NewDefaultRetrier(),
+		streamClient: newStreamClient(),
+		baseURL:      baseURL,
+		apiKey:       apiKey,
+		model:        model,
+		retrier:      retry.NewDefaultRetrier(),
+		limiter:      ratelimit.New(ratelimit.Limits{}),
 	}
 }
 
+// setLimiter shares a rate limiter with the other models of the provider.
+func (b *baseProvider) setLimiter(limiter *ratelimit.Limiter) {
+	b.limiter = limiter
+}
+
+// setMediaPath sets the directory content parts may be read from.
+func (b *baseProvider) setMediaPath(path string) {
+	b.mediaPath = path
+}
+
 func (b *baseProvider) GetModel() string {
 	return b.model
 }
 
+func newStreamClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = streamFirstByteTimeout
+	return &http.Client{Transport: transport}
+}
+
 func (b *baseProvider) doRequest(ctx context.Context, method, path string, body any, headers map[string]string) (*http.Response, error) {
+	return b.send(ctx, b.client, method, path, body, headers)
+}
+
+// doStream sends a request whose response is streamed. The request is
+// cancelled when the body stays silent for streamIdleTimeout.
+func (b *baseProvider) doStream(ctx context.Context, method, path string, body any, headers map[string]string) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	resp, err := b.send(ctx, b.streamClient, method, path, body, headers)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = newIdleBody(resp.Body, streamIdleTimeout, cancel)
+	return resp, nil
+}
+
+func (b *baseProvider) send(ctx context.Context, client *http.Client, method, path string, body any, headers map[string]string) (*http.Response, error) {
 	var bodyData []byte
 	if body != nil {
 		var err error
@@ -47,8 +101,21 @@ func (b *baseProvider) doRequest(ctx context.Context, method, path string, body
 	}
 
 	var resp *http.Response
+	priority, tokens := requestPriority(ctx), estimateTokens(bodyData)
 
 	err := b.retrier.Do(ctx, func() error {
+		start := time.Now()
+		release, err := b.limiter.Wait(ctx, priority, tokens)
+		if err != nil {
+			return retry.Permanent(err)
+		}
+		if waited := time.Since(start); waited > time.Second {
+			log.FromCtx(ctx).Debug().
+				Str("model", b.model).
+				Dur("waited", waited).
+				Msg("llm request delayed by rate limit")
+		}
+
 		var bodyReader io.Reader
 		if bodyData != nil {
 			bodyReader = bytes.NewReader(bodyData)
@@ -56,6 +123,7 @@ func (b *baseProvider) doRequest(ctx context.Context, method, path string, body
 
 		req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, bodyReader)
 		if err != nil {
+			release()
 			return fmt.Errorf("create request: %w", err)
 		}
 
@@ -64,18 +132,33 @@ func (b *baseProvider) doRequest(ctx context.Context, method, path string, body
 		}
 		req.Header.Set("Content-Type", "application/json")
 
-		r, err := b.client.Do(req)
+		r, err := client.Do(req)
 		if err != nil {
+			release()
 			return err
 		}
 
+		now := time.Now()
+		b.limiter.Update(parseRateLimit(r.Header, now))
+
 		// Retry on server errors (5xx) and rate limiting (429)
 		if r.StatusCode >= 500 || r.StatusCode == 429 {
 			errBody, _ := io.ReadAll(io.LimitReader(r.Body, 1024))
 			r.Body.Close()
-			return fmt.Errorf("retryable status %d: %s", r.StatusCode, string(errBody))
+			release()
+
+			apiErr := newAPIError(r.StatusCode, errBody)
+			if wait := retryAfter(r.Header, now); wait > 0 {
+				if wait > maxRetryAfter {
+					return retry.Permanent(apiErr)
+				}
+				// Holds back the other requests to the provider as well
+				b.limiter.Pause(now.Add(wait))
+			}
+			return apiErr
 		}
 
+		r.Body = &limitedBody{ReadCloser: r.Body, release: release}
 		resp = r
 		return nil
 	})
@@ -86,3 +169,52 @@ func (b *baseProvider) doRequest(ctx context.Context, method, path string, body
 
 	return resp, nil
 }
+
+// idleBody cancels a streamed request when no data arrives for timeout.
+type idleBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	stalled atomic.Bool
+}
+
+func newIdleBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleBody {
+	b := &idleBody{ReadCloser: body, timeout: timeout, cancel: cancel}
+	b.timer = time.AfterFunc(timeout, func() {
+		b.stalled.Store(true)
+		cancel()
+	})
+	return b
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && b.stalled.Load() {
+		return n, fmt.Errorf("%w: nothing received for %s", errStreamStalled, b.timeout)
+	}
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// logCache starts a debug log entry with the share of the prompt that was
+// read from the provider's prompt cache.
+func logCache(ctx context.Context, model string, u *core.Usage) *zerolog.Event {
+	hit := 0.0
+	if u.PromptTokens > 0 {
+		hit = float64(u.CachedTokens) / float64(u.PromptTokens)
+	}
+	return log.FromCtx(ctx).Debug().
+		Str("model", model).
+		Int("prompt_tokens", u.PromptTokens).
+		Int("cached_tokens", u.CachedTokens).
+		Str("cache_hit", fmt.Sprintf("%.0f%%", hit*100))
+}
@@ -0,0 +1,191 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+// capabilityTable holds model capabilities by "provider/model". A key also
+// matches the models it is a prefix of, and values of longer keys take
+// precedence over those of shorter ones.
+type capabilityTable map[string]core.Capabilities
+
+// defaultCapabilities covers common models of the providers whose model
+// lists do not tell what a model can do.
+var defaultCapabilities = capabilityTable{
+	"anthropic/":                  {ContextWindow: 200000, Tools: flag(true), Vision: flag(true)},
+	"anthropic/claude-3-5-haiku":  {MaxOutputTokens: 8192, Reasoning: flag(false)},
+	"anthropic/claude-3-7-sonnet": {MaxOutputTokens: 64000, Reasoning: flag(true)},
+	"anthropic/claude-sonnet-4":   {MaxOutputTokens: 64000, Reasoning: flag(true)},
+	"anthropic/claude-opus-4":     {MaxOutputTokens: 32000, Reasoning: flag(true)},
+	"anthropic/claude-haiku-4-5":  {MaxOutputTokens: 64000, Reasoning: flag(true)},
+	"openai/":                     {Tools: flag(true)},
+	"openai/gpt-4o":               {ContextWindow: 128000, MaxOutputTokens: 16384, Vision: flag(true), Reasoning: flag(false)},
+	"openai/gpt-4.1":              {ContextWindow: 1047576, MaxOutputTokens: 32768, Vision: flag(true), Reasoning: flag(false)},
+	"openai/gpt-5":                {ContextWindow: 400000, MaxOutputTokens: 128000, Vision: flag(true), Reasoning: flag(true)},
+	"openai/o3":                   {ContextWindow: 200000, MaxOutputTokens: 100000, Vision: flag(true), Reasoning: flag(true)},
+	"openai/o4-mini":              {ContextWindow: 200000, MaxOutputTokens: 100000, Vision: flag(true), Reasoning: flag(true)},
+}
+
+func flag(b bool) *bool {
+	return &b
+}
+
+// loadCapabilities reads the user's capability overrides. The file is
+// optional.
+func loadCapabilities(path string) (capabilityTable, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return capabilityTable{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capabilities: %w", err)
+	}
+
+	var t capabilityTable
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse capabilities: %w", err)
+	}
+	for model, c := range t {
+		if c.ContextWindow < 0 || c.MaxOutputTokens < 0 {
+			return nil, fmt.Errorf("invalid capabilities: %s: token limits must not be negative", model)
+		}
+	}
+	return t, nil
+}
+
+// Match returns the capabilities of a "provider/model", merged from all
+// keys that match it.
+func (t capabilityTable) Match(model string) core.Capabilities {
+	var c core.Capabilities
+	for _, key := range prefixKeys(t, model) {
+		c = c.Merge(t[key])
+	}
+	return c
+}
+
+// prefixKeys returns the keys of table that are a prefix of name, longest
+// first.
+func prefixKeys[T any](table map[string]T, name string) []string {
+	var keys []string
+	for key := range table {
+		if strings.HasPrefix(name, key) {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b string) int { return len(b) - len(a) })
+	return keys
+}
+
+// capabilityReporter is implemented by providers that can look up a single
+// model, when their model list does not tell what a model can do.
+type capabilityReporter interface {
+	ModelCapabilities(ctx context.Context, model string) (core.Capabilities, error)
+}
+
+// reportedCapabilities asks the provider what a model can do, through a
+// model lookup or else its model list.
+func reportedCapabilities(ctx context.Context, provider core.AIProvider, model string) (core.Capabilities, error) {
+	provider = unwrap(provider)
+	if r, ok := provider.(capabilityReporter); ok {
+		return r.ModelCapabilities(ctx, model)
+	}
+
+	models, err := provider.Models(ctx)
+	if err != nil {
+		return core.Capabilities{}, err
+	}
+	for _, m := range models {
+		if m.ID == model {
+			return m.Capabilities.Merge(core.Capabilities{ContextWindow: m.ContextLength}), nil
+		}
+	}
+	return core.Capabilities{}, nil
+}
+
+// capabilityLimits holds back what a model is known not to take: images
+// become text placeholders for models without vision, and models without
+// reasoning are not asked for a reasoning effort.
+type capabilityLimits struct {
+	core.AIProvider
+	caps func(ctx context.Context) core.Capabilities
+}
+
+func newCapabilityLimits(p core.AIProvider, caps func(ctx context.Context) core.Capabilities) *capabilityLimits {
+	return &capabilityLimits{AIProvider: p, caps: caps}
+}
+
+// Unwrap returns the wrapped provider.
+func (p *capabilityLimits) Unwrap() core.AIProvider {
+	return p.AIProvider
+}
+
+func (p *capabilityLimits) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	ctx, history = p.limit(ctx, history)
+	return p.AIProvider.Chat(ctx, history, tools)
+}
+
+func (p *capabilityLimits) ChatStream(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	ctx, history = p.limit(ctx, history)
+	return chatStream(ctx, p.AIProvider, history, tools, onDelta)
+}
+
+// limit asks for the capabilities only when the request has images or a
+// reasoning effort.
+func (p *capabilityLimits) limit(ctx context.Context, history []core.Message) (context.Context, []core.Message) {
+	opts := core.ChatOptionsFromCtx(ctx)
+	hasImages := slices.ContainsFunc(history, func(m core.Message) bool {
+		return slices.ContainsFunc(m.Parts, func(p core.ContentPart) bool { return p.Type == core.PartImage })
+	})
+	if opts.ReasoningEffort == "" && !hasImages {
+		return ctx, history
+	}
+
+	caps := p.caps(ctx)
+	if opts.ReasoningEffort != "" && caps.Reasoning != nil && !*caps.Reasoning {
+		opts.ReasoningEffort = ""
+		ctx = core.WithChatOptions(ctx, opts)
+	}
+	if hasImages && caps.Vision != nil && !*caps.Vision {
+		history = withoutImages(history)
+	}
+	return ctx, history
+}
+
+// withoutImages replaces the images of the history with text placeholders.
+func withoutImages(history []core.Message) []core.Message {
+	result := make([]core.Message, len(history))
+	for i, m := range history {
+		var images []core.ContentPart
+		m.Parts = slices.DeleteFunc(slices.Clone(m.Parts), func(p core.ContentPart) bool {
+			if p.Type != core.PartImage {
+				return false
+			}
+			images = append(images, p)
+			return true
+		})
+		if len(images) > 0 {
+			m.Content = withPlaceholders(m.Content, images, "the model has no vision")
+		}
+		result[i] = m
+	}
+	return result
+}
+
+// unwrap returns the provider under the wrappers of this package.
+func unwrap(p core.AIProvider) core.AIProvider {
+	for {
+		w, ok := p.(interface{ Unwrap() core.AIProvider })
+		if !ok {
+			return p
+		}
+		p = w.Unwrap()
+	}
+}
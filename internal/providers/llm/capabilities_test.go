@@ -0,0 +1,222 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapabilityTable_Match(t *testing.T) {
+	table := capabilityTable{
+		"anthropic/":                {ContextWindow: 200000, Tools: flag(true), Reasoning: flag(false)},
+		"anthropic/claude-sonnet-4": {MaxOutputTokens: 64000, Reasoning: flag(true)},
+	}
+
+	assert.Equal(t, core.Capabilities{
+		ContextWindow:   200000,
+		MaxOutputTokens: 64000,
+		Tools:           flag(true),
+		Reasoning:       flag(true),
+	}, table.Match("anthropic/claude-sonnet-4-5"))
+	assert.Equal(t, core.Capabilities{ContextWindow: 200000, Tools: flag(true), Reasoning: flag(false)}, table.Match("anthropic/claude-3-haiku"))
+	assert.Equal(t, core.Capabilities{}, table.Match("openai/gpt-4o"))
+}
+
+func TestLoadCapabilities(t *testing.T) {
+	dir := t.TempDir()
+
+	table, err := loadCapabilities(filepath.Join(dir, "missing.json"))
+	require.NoError(t, err)
+	assert.Empty(t, table)
+
+	path := filepath.Join(dir, "capabilities.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ollama/gemma": {"tools": false, "context_window": 8192}}`), 0600))
+	table, err = loadCapabilities(path)
+	require.NoError(t, err)
+	assert.Equal(t, core.Capabilities{ContextWindow: 8192, Tools: flag(false)}, table.Match("ollama/gemma:2b"))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"ollama/": {"max_output_tokens": -1}}`), 0600))
+	_, err = loadCapabilities(path)
+	assert.ErrorContains(t, err, "must not be negative")
+}
+
+// capsProvider reports capabilities in its model list.
+type capsProvider struct {
+	scriptedProvider
+	models []core.Model
+}
+
+func (p *capsProvider) Models(ctx context.Context) ([]core.Model, error) {
+	return p.models, nil
+}
+
+func TestDynamicProvider_Capabilities(t *testing.T) {
+	ollama := &capsProvider{models: []core.Model{
+		{ID: "gemma", Capabilities: core.Capabilities{ContextWindow: 8192, Tools: flag(false)}},
+		{ID: "qwen", Capabilities: core.Capabilities{Tools: flag(true), Vision: flag(false)}},
+	}}
+	main := &capsProvider{models: []core.Model{{ID: "main", ContextLength: 100000}}}
+
+	d := newTestDynamic(main, map[string]core.AIProvider{
+		"ollama/gemma": ollama,
+		"ollama/qwen":  ollama,
+		"ollama/phi":   ollama,
+	})
+	d.config = &fallbackConfig{promptTools: []string{"ollama/phi*"}}
+	d.overrides = capabilityTable{"ollama/qwen": {Vision: flag(true), ContextWindow: 32768}}
+
+	tests := []struct {
+		name string
+		spec string
+		want core.Capabilities
+	}{
+		{
+			name: "reported and bundled",
+			spec: "main",
+			want: core.Capabilities{ContextWindow: 100000, Tools: flag(true), Vision: flag(true)},
+		},
+		{
+			name: "reported",
+			spec: "ollama/gemma",
+			want: core.Capabilities{ContextWindow: 8192, Tools: flag(false)},
+		},
+		{
+			name: "overrides win",
+			spec: "ollama/qwen",
+			want: core.Capabilities{ContextWindow: 32768, Tools: flag(true), Vision: flag(true)},
+		},
+		{
+			name: "listed without tools",
+			spec: "ollama/phi",
+			want: core.Capabilities{Tools: flag(false)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, d.Capabilities(context.Background(), tt.spec))
+		})
+	}
+}
+
+// effortModel records the reasoning effort of its requests.
+type effortModel struct {
+	textModel
+	effort string
+}
+
+func (m *effortModel) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	m.effort = core.ChatOptionsFromCtx(ctx).ReasoningEffort
+	return m.textModel.Chat(ctx, history, tools)
+}
+
+func TestCapabilityLimits(t *testing.T) {
+	image := core.ContentPart{Type: core.PartImage, MediaType: "image/png", Path: "/media/a.png"}
+	history := []core.Message{
+		{Role: core.RoleUser, Content: "what is this?", Parts: []core.ContentPart{image, {Type: core.PartFile, Path: "/media/b.pdf"}}},
+	}
+	ctx := core.WithChatOptions(context.Background(), core.ChatOptions{ReasoningEffort: "high"})
+
+	tests := []struct {
+		name       string
+		caps       core.Capabilities
+		wantParts  int
+		wantEffort string
+	}{
+		{name: "unknown", caps: core.Capabilities{}, wantParts: 2, wantEffort: "high"},
+		{name: "capable", caps: core.Capabilities{Vision: flag(true), Reasoning: flag(true)}, wantParts: 2, wantEffort: "high"},
+		{name: "no vision or reasoning", caps: core.Capabilities{Vision: flag(false), Reasoning: flag(false)}, wantParts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &effortModel{}
+			p := newCapabilityLimits(model, func(context.Context) core.Capabilities { return tt.caps })
+
+			_, err := p.Chat(ctx, history, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantEffort, model.effort)
+			require.Len(t, model.gotMessages, 1)
+			assert.Len(t, model.gotMessages[0].Parts, tt.wantParts)
+			if tt.wantParts == 1 {
+				assert.Equal(t, core.PartFile, model.gotMessages[0].Parts[0].Type)
+				assert.Contains(t, model.gotMessages[0].Content, "[image image/png at /media/a.png: the model has no vision]")
+			}
+		})
+	}
+	assert.Len(t, history[0].Parts, 2, "the history of the caller is not changed")
+}
+
+// failingModels fails to list its models.
+type failingModels struct {
+	scriptedProvider
+	lookups int
+}
+
+func (p *failingModels) Models(ctx context.Context) ([]core.Model, error) {
+	p.lookups++
+	return nil, errors.New("connection refused")
+}
+
+func TestDynamicProvider_CapabilitiesFailureCached(t *testing.T) {
+	main := &failingModels{}
+	d := newTestDynamic(main, make(map[string]core.AIProvider))
+
+	assert.Equal(t, core.Capabilities{}, d.reportedCapabilities(context.Background(), "anthropic/main"))
+	assert.Equal(t, core.Capabilities{}, d.reportedCapabilities(context.Background(), "anthropic/main"))
+	assert.Equal(t, 1, main.lookups, "a failed lookup is not repeated right away")
+
+	d.reported["anthropic/main"] = reportedCaps{expires: time.Now().Add(-time.Second)}
+	d.reportedCapabilities(context.Background(), "anthropic/main")
+	assert.Equal(t, 2, main.lookups, "a failed lookup is retried once it expires")
+}
+
+func TestDynamicProvider_EmulatesToolsOfModelsWithoutThem(t *testing.T) {
+	model := &textModel{pieces: []string{`<tool_call>{"name": "read_file", "arguments": {}}</tool_call>`}}
+	t.Cleanup(func() { unregisterProvider("test-caps") })
+	RegisterProvider("test-caps", func(ctx context.Context, name string) (core.AIProvider, error) {
+		return model, nil
+	})
+
+	d := newTestDynamic(&scriptedProvider{}, make(map[string]core.AIProvider))
+	d.overrides = capabilityTable{"test-caps/": {Tools: flag(false)}}
+
+	p, err := d.ModelProvider(context.Background(), "test-caps/tiny")
+	require.NoError(t, err)
+
+	msg, err := p.Chat(context.Background(), nil, []core.Tool{{Function: core.Function{Name: "read_file"}}})
+	require.NoError(t, err)
+	assert.Nil(t, model.gotTools)
+	assert.Equal(t, 1, model.calls, "tools are not tried natively")
+	require.Len(t, msg.ToolCalls, 1)
+}
+
+func TestOpenRouterModel(t *testing.T) {
+	var m openRouterModel
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"id": "qwen/qwen3-32b",
+		"name": "Qwen3 32B",
+		"context_length": 40960,
+		"architecture": {"input_modalities": ["text"]},
+		"top_provider": {"max_completion_tokens": 16384},
+		"supported_parameters": ["tools", "reasoning", "temperature"]
+	}`), &m))
+
+	model := m.model()
+	assert.Equal(t, "qwen/qwen3-32b", model.ID)
+	assert.Equal(t, 40960, model.ContextLength)
+	assert.Equal(t, core.Capabilities{
+		ContextWindow:   40960,
+		MaxOutputTokens: 16384,
+		Tools:           flag(true),
+		Vision:          flag(false),
+		Reasoning:       flag(true),
+	}, model.Capabilities)
+}
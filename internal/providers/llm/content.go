@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+// maxPartBytes is the largest content part sent to a model.
+const maxPartBytes = 20 << 20
+
+// partData returns the data of a content part, reading it from its file.
+// Only files in the media directory are read, so a part cannot send any
+// other file to the provider.
+func (b *baseProvider) partData(p core.ContentPart) ([]byte, error) {
+	if p.Data != nil {
+		return p.Data, nil
+	}
+	if !inDir(b.mediaPath, p.Path) {
+		return nil, fmt.Errorf("file is outside the media directory")
+	}
+
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("file is not available")
+	}
+	if info.Size() > maxPartBytes {
+		return nil, fmt.Errorf("file is larger than %d MB", maxPartBytes>>20)
+	}
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("file is not readable")
+	}
+	return data, nil
+}
+
+// inDir reports whether path is a file in dir, after resolving symlinks.
+func inDir(dir, path string) bool {
+	if dir == "" || !filepath.IsAbs(path) {
+		return false
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+func dataURL(mediaType string, data []byte) string {
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// withPlaceholders appends a text placeholder for each part to content, for
+// messages that cannot carry the parts.
+func withPlaceholders(content string, parts []core.ContentPart, reason string) string {
+	lines := make([]string, 0, len(parts)+1)
+	if content != "" {
+		lines = append(lines, content)
+	}
+	for _, p := range parts {
+		lines = append(lines, p.Placeholder(reason))
+	}
+	return strings.Join(lines, "\n")
+}
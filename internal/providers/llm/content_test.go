@@ -0,0 +1,138 @@
+package llm
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testImage writes an image to a temporary media directory and returns it
+// as a part.
+func testImage(t *testing.T) (core.ContentPart, string) {
+	t.Helper()
+	data := []byte("\x89PNG fake image")
+	path := filepath.Join(t.TempDir(), "shot.png")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return core.ContentPart{Type: core.PartImage, MediaType: "image/png", Path: path},
+		base64.StdEncoding.EncodeToString(data)
+}
+
+func TestToOpenAIMessages(t *testing.T) {
+	image, encoded := testImage(t)
+	missing := core.ContentPart{Type: core.PartImage, MediaType: "image/png", Path: filepath.Join(filepath.Dir(image.Path), "gone.png")}
+	outside, _ := testImage(t)
+	audio := core.ContentPart{Type: core.PartAudio, MediaType: "audio/ogg", Path: image.Path}
+
+	history := []core.Message{
+		{Role: core.RoleUser, Content: "what is this?", Parts: []core.ContentPart{image, missing, outside}},
+		{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{{ID: "call_1"}, {ID: "call_2"}}},
+		{Role: core.RoleTool, ToolCallID: "call_1", Content: "screenshot taken", Parts: []core.ContentPart{image}},
+		{Role: core.RoleTool, ToolCallID: "call_2", Content: "recorded", Parts: []core.ContentPart{audio}},
+		{Role: core.RoleAssistant, Content: "done"},
+	}
+
+	o := NewOpenAICompatible(OpenAICompatibleConfig{Model: "gpt", PartTypes: []string{core.PartImage, core.PartAudio}})
+	o.setMediaPath(filepath.Dir(image.Path))
+	messages := o.toOpenAIMessages(history)
+	require.Len(t, messages, 6)
+
+	user, ok := messages[0].(openAIMessage)
+	require.True(t, ok)
+	require.Len(t, user.Content, 4)
+	assert.Equal(t, openAIPart{Type: "text", Text: "what is this?"}, user.Content[0])
+	assert.Equal(t, "data:image/png;base64,"+encoded, user.Content[1].ImageURL.URL)
+	assert.Equal(t, "text", user.Content[2].Type)
+	assert.Contains(t, user.Content[2].Text, "file is not available")
+	assert.Equal(t, "text", user.Content[3].Type)
+	assert.Contains(t, user.Content[3].Text, "file is outside the media directory")
+
+	// Tool results stay text, their media follows in a user message
+	tool, ok := messages[2].(core.Message)
+	require.True(t, ok)
+	assert.Equal(t, "screenshot taken", tool.Content)
+	assert.Empty(t, tool.Parts)
+
+	attachments, ok := messages[4].(openAIMessage)
+	require.True(t, ok)
+	assert.Equal(t, core.RoleUser, attachments.Role)
+	require.Len(t, attachments.Content, 3)
+	assert.Equal(t, "image_url", attachments.Content[1].Type)
+	assert.Equal(t, "text", attachments.Content[2].Type)
+	assert.Contains(t, attachments.Content[2].Text, "only wav and mp3 audio is supported")
+
+	assert.Equal(t, "done", messages[5].(core.Message).Content)
+}
+
+func TestToOpenAIMessages_TextOnly(t *testing.T) {
+	image, _ := testImage(t)
+	history := []core.Message{
+		{Role: core.RoleUser, Content: "what is this?", Parts: []core.ContentPart{image}},
+		{Role: core.RoleUser, Content: "plain"},
+	}
+
+	messages := NewOpenAICompatible(OpenAICompatibleConfig{Model: "text-only"}).toOpenAIMessages(history)
+
+	require.Len(t, messages, 2)
+	user := messages[0].(core.Message)
+	assert.Equal(t, "what is this?\n[image image/png at "+image.Path+": the model cannot take it]", user.Content)
+	assert.Empty(t, user.Parts)
+	assert.Equal(t, history[1], messages[1])
+}
+
+func TestToAnthropicMessages_Parts(t *testing.T) {
+	image, encoded := testImage(t)
+	pdf := core.ContentPart{Type: core.PartFile, MediaType: "application/pdf", Path: image.Path}
+	audio := core.ContentPart{Type: core.PartAudio, MediaType: "audio/wav", Path: image.Path}
+
+	history := []core.Message{
+		{Role: core.RoleUser, Content: "read these", Parts: []core.ContentPart{image, pdf, audio}},
+		{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{{ID: "call_1"}}},
+		{Role: core.RoleTool, ToolCallID: "call_1", Content: "screenshot taken", Parts: []core.ContentPart{image}},
+	}
+
+	a := NewAnthropic("key", "claude")
+	a.setMediaPath(filepath.Dir(image.Path))
+	_, messages := a.toAnthropicMessages(history)
+	require.Len(t, messages, 3)
+
+	user := messages[0].Content
+	require.Len(t, user, 4)
+	assert.Equal(t, "text", user[0].Type)
+	assert.Equal(t, "image", user[1].Type)
+	assert.Equal(t, &anthropicSource{Type: "base64", MediaType: "image/png", Data: encoded}, user[1].Source)
+	assert.Equal(t, "document", user[2].Type)
+	assert.Equal(t, "text", user[3].Type)
+	assert.Contains(t, user[3].Text, "the model cannot take it")
+
+	result := messages[2].Content[0]
+	assert.Equal(t, "tool_result", result.Type)
+	content, ok := result.Content.([]anthropicBlock)
+	require.True(t, ok)
+	require.Len(t, content, 2)
+	assert.Equal(t, anthropicBlock{Type: "text", Text: "screenshot taken"}, content[0])
+	assert.Equal(t, "image", content[1].Type)
+}
+
+func TestToAnthropicMessages_ToolResultOnlyMedia(t *testing.T) {
+	image, _ := testImage(t)
+	history := []core.Message{
+		{Role: core.RoleUser, Content: "take a screenshot"},
+		{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{{ID: "call_1"}}},
+		{Role: core.RoleTool, ToolCallID: "call_1", Parts: []core.ContentPart{image}},
+	}
+
+	a := NewAnthropic("key", "claude")
+	a.setMediaPath(filepath.Dir(image.Path))
+	_, messages := a.toAnthropicMessages(history)
+	require.Len(t, messages, 3)
+
+	content, ok := messages[2].Content[0].Content.([]anthropicBlock)
+	require.True(t, ok)
+	require.Len(t, content, 1, "no empty text block")
+	assert.Equal(t, "image", content[0].Type)
+}
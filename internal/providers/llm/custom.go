@@ -10,6 +10,7 @@ import (
 	"github.com/sandevgo/tuskbot/internal/core"
 )
 
+// CustomOpenAI is a self-hosted or third-party OpenAI-compatible endpoint.
 type CustomOpenAI struct {
 	*OpenAICompatible
 }
@@ -22,16 +23,13 @@ func NewCustomOpenAI(baseURL, apiKey, model string) *CustomOpenAI {
 			Model:      model,
 			AuthHeader: "Authorization",
 			AuthPrefix: "Bearer ",
+			PartTypes:  []string{core.PartImage},
 		}),
 	}
 }
 
 func (c *CustomOpenAI) Models(ctx context.Context) ([]core.Model, error) {
-	headers := map[string]string{
-		"Authorization": "Bearer " + c.apiKey,
-	}
-
-	resp, err := c.doRequest(ctx, http.MethodGet, "/v1/models", nil, headers)
+	resp, err := c.doRequest(ctx, http.MethodGet, "/v1/models", nil, c.headers())
 	if err != nil {
 		return nil, fmt.Errorf("fetch models: %w", err)
 	}
@@ -43,7 +41,7 @@ func (c *CustomOpenAI) Models(ctx context.Context) ([]core.Model, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http %d: %s", resp.StatusCode, string(data))
+		return nil, newAPIError(resp.StatusCode, data)
 	}
 
 	var apiResp struct {
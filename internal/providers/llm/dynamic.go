@@ -3,27 +3,71 @@ package llm
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/log"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// modelsTimeout bounds the model lookup done for capabilities.
+	modelsTimeout = 10 * time.Second
+
+	// capsRetryAfter is how long a failed capability lookup is not
+	// repeated.
+	capsRetryAfter = time.Minute
 )
 
 type DynamicProvider struct {
-	config  core.ProviderConfig
-	current atomic.Value
-	mu      sync.RWMutex
+	config   core.ProviderConfig
+	settings core.SessionSettingsRepository
+	current  atomic.Value
+	mu       sync.RWMutex
+
+	// User overrides of model capabilities
+	overrides capabilityTable
+
+	// Capabilities by "provider/model" as reported by the providers
+	capsMu     sync.Mutex
+	reported   map[string]reportedCaps
+	capsLookup singleflight.Group
+
+	// Providers of session and fallback models by "provider/model",
+	// created on first use
+	modelsMu sync.Mutex
+	models   map[string]core.AIProvider
+
+	// Rate limiters shared by all models of a provider
+	limiters *limiters
 }
 
+// NewDynamicProvider creates a provider for the configured model. Sessions
+// may choose another model and chat options through settings, which can be
+// nil.
 func NewDynamicProvider(
 	ctx context.Context,
 	config core.ProviderConfig,
+	settings core.SessionSettingsRepository,
 ) (*DynamicProvider, error) {
+	overrides, err := loadCapabilities(config.GetCapabilitiesPath())
+	if err != nil {
+		return nil, err
+	}
+
 	d := &DynamicProvider{
-		config: config,
+		config:    config,
+		settings:  settings,
+		overrides: overrides,
+		reported:  make(map[string]reportedCaps),
+		models:    make(map[string]core.AIProvider),
+		limiters:  newLimiters(config),
 	}
 
-	provider, err := NewProvider(ctx, config)
+	provider, err := d.newProvider(ctx, config.GetProvider(), config.GetModel())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create initial provider: %w", err)
 	}
@@ -33,8 +77,275 @@ func NewDynamicProvider(
 }
 
 func (d *DynamicProvider) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
-	provider := d.current.Load().(core.AIProvider)
-	return provider.Chat(ctx, history, tools)
+	ctx, provider, name := d.forSession(ctx)
+	return d.withFallback(ctx, provider, name, func(provider core.AIProvider) (core.Message, error) {
+		return provider.Chat(ctx, history, tools)
+	}, nil)
+}
+
+// ChatStream streams from the current provider when it supports streaming,
+// otherwise it falls back to Chat and reports the whole response as one delta.
+// Fallback models are only tried while nothing has been streamed yet.
+func (d *DynamicProvider) ChatStream(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	var streamed bool
+	report := func(delta core.StreamDelta) {
+		streamed = true
+		if onDelta != nil {
+			onDelta(delta)
+		}
+	}
+
+	ctx, provider, name := d.forSession(ctx)
+	return d.withFallback(ctx, provider, name, func(provider core.AIProvider) (core.Message, error) {
+		return chatStream(ctx, provider, history, tools, report)
+	}, func() bool { return !streamed })
+}
+
+func chatStream(ctx context.Context, provider core.AIProvider, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	if streamer, ok := provider.(core.StreamingProvider); ok {
+		return streamer.ChatStream(ctx, history, tools, onDelta)
+	}
+
+	msg, err := provider.Chat(ctx, history, tools)
+	if err != nil {
+		return msg, err
+	}
+	if msg.Content != "" || msg.Reasoning != "" {
+		onDelta(core.StreamDelta{Content: msg.Content, Reasoning: msg.Reasoning})
+	}
+	return msg, nil
+}
+
+// forSession returns the provider and "provider/model" name for the session
+// of ctx, with the session's chat options added to ctx. Requests outside of a
+// session use the global model.
+func (d *DynamicProvider) forSession(ctx context.Context) (context.Context, core.AIProvider, string) {
+	provider, name := d.current.Load().(core.AIProvider), d.globalModel()
+
+	sessionID := core.RootSessionIDFromCtx(ctx)
+	if d.settings == nil || sessionID == "" {
+		return ctx, provider, name
+	}
+
+	logger := log.FromCtx(ctx)
+	settings, err := d.settings.GetSessionSettings(ctx, sessionID)
+	if err != nil {
+		logger.Warn().Err(err).Str("session_id", sessionID).Msg("failed to get session settings")
+		return ctx, provider, name
+	}
+	ctx = core.WithChatOptions(ctx, settings.Options)
+
+	if settings.Model == "" || d.qualify(settings.Model) == name {
+		return ctx, provider, name
+	}
+
+	sessionProvider, err := d.ModelProvider(ctx, settings.Model)
+	if err != nil {
+		logger.Warn().Err(err).Str("model", settings.Model).Msg("failed to create session model, using the global one")
+		return ctx, provider, name
+	}
+	return ctx, sessionProvider, d.qualify(settings.Model)
+}
+
+// withFallback runs call on the current provider and, if it fails with a
+// recoverable error, on each fallback model in turn. The answer of a
+// fallback model is marked with its name.
+func (d *DynamicProvider) withFallback(
+	ctx context.Context,
+	primary core.AIProvider,
+	primaryName string,
+	call func(core.AIProvider) (core.Message, error),
+	canRetry func() bool,
+) (core.Message, error) {
+	msg, err := call(primary)
+	if err == nil {
+		return withModel(msg, primaryName), nil
+	}
+
+	logger := log.FromCtx(ctx)
+	for _, spec := range d.config.GetFallbackModels() {
+		class := Classify(err)
+		if ctx.Err() != nil || !class.Recoverable() || (canRetry != nil && !canRetry()) {
+			break
+		}
+
+		name := d.qualify(spec)
+		if name == primaryName {
+			continue
+		}
+
+		logger.Warn().
+			Err(err).
+			Str("class", string(class)).
+			Str("fallback", name).
+			Msg("llm request failed, trying fallback model")
+
+		fallback, ferr := d.ModelProvider(ctx, name)
+		if ferr != nil {
+			logger.Error().Err(ferr).Str("fallback", name).Msg("failed to create fallback provider")
+			continue
+		}
+
+		msg, err = call(fallback)
+		if err == nil {
+			msg.FallbackModel = name
+			return withModel(msg, name), nil
+		}
+		err = fmt.Errorf("fallback %s: %w", name, err)
+	}
+
+	return msg, err
+}
+
+// withModel records the model that answered in the usage of msg.
+func withModel(msg core.Message, name string) core.Message {
+	usage := core.Usage{}
+	if msg.Usage != nil {
+		usage = *msg.Usage
+	}
+	usage.Model = name
+	msg.Usage = &usage
+	return msg
+}
+
+// Pinned returns a provider that always uses the given model, regardless of
+// the global model and session settings.
+func (d *DynamicProvider) Pinned(ctx context.Context, spec string) (core.AIProvider, error) {
+	if _, err := d.ModelProvider(ctx, spec); err != nil {
+		return nil, err
+	}
+	return &pinnedProvider{d: d, name: d.qualify(spec)}, nil
+}
+
+type pinnedProvider struct {
+	d    *DynamicProvider
+	name string
+}
+
+func (p *pinnedProvider) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	provider, err := p.d.ModelProvider(ctx, p.name)
+	if err != nil {
+		return core.Message{}, err
+	}
+	msg, err := provider.Chat(ctx, history, tools)
+	if err != nil {
+		return msg, err
+	}
+	return withModel(msg, p.name), nil
+}
+
+func (p *pinnedProvider) Models(ctx context.Context) ([]core.Model, error) {
+	provider, err := p.d.ModelProvider(ctx, p.name)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Models(ctx)
+}
+
+// ModelProvider returns a provider for any "provider/model", using the
+// configured keys. Providers are cached, and a model without a provider
+// uses the global one.
+func (d *DynamicProvider) ModelProvider(ctx context.Context, spec string) (core.AIProvider, error) {
+	name := d.qualify(spec)
+
+	d.modelsMu.Lock()
+	p, ok := d.models[name]
+	d.modelsMu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	// Creating a provider may be slow, e.g. for local models, so lookups
+	// of other models don't wait for it
+	provider, model := splitModel(name)
+	p, err := d.newProvider(ctx, provider, model)
+	if err != nil {
+		return nil, err
+	}
+
+	d.modelsMu.Lock()
+	defer d.modelsMu.Unlock()
+	if cached, ok := d.models[name]; ok {
+		return cached, nil
+	}
+	d.models[name] = p
+	return p, nil
+}
+
+// CheckModel reports whether a "provider/model" can be used. A provider
+// that lists its models must list the model, and a model that cannot be
+// looked up is refused. A provider that lists no models is taken at its
+// word.
+func (d *DynamicProvider) CheckModel(ctx context.Context, spec string) error {
+	provider, err := d.ModelProvider(ctx, spec)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, modelsTimeout)
+	defer cancel()
+
+	name := d.qualify(spec)
+	models, err := provider.Models(ctx)
+	if err != nil {
+		return fmt.Errorf("could not verify model %s: %w", name, err)
+	}
+	if len(models) == 0 {
+		return nil
+	}
+	_, model := splitModel(name)
+	for _, m := range models {
+		// Ollama lists tags in full, but takes a name without its tag as ":latest"
+		if m.ID == model || m.ID == model+":latest" {
+			return nil
+		}
+	}
+	return fmt.Errorf("model %s is not offered by the provider", name)
+}
+
+// newProvider creates a provider for a model. Tools are described in the
+// prompt for models without native tool calling, and for models that turn
+// out to reject them. Images and reasoning are held back from models known
+// not to take them.
+func (d *DynamicProvider) newProvider(ctx context.Context, provider, model string) (core.AIProvider, error) {
+	p, err := newProvider(ctx, d.config, provider, model, d.limiters.get(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	name := provider + "/" + model
+	limited := newCapabilityLimits(p, func(ctx context.Context) core.Capabilities {
+		return d.Capabilities(ctx, name)
+	})
+	return newPromptTools(limited, func(ctx context.Context) bool {
+		return !d.Capabilities(ctx, name).SupportsTools()
+	}), nil
+}
+
+func (d *DynamicProvider) globalModel() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.config.GetProvider() + "/" + d.config.GetModel()
+}
+
+// qualify adds the global provider to a model spec without one, and the
+// default model to a named provider without a model.
+func (d *DynamicProvider) qualify(spec string) string {
+	if provider, _ := splitModel(spec); provider != "" {
+		return withDefaultModel(spec)
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.config.GetProvider() + "/" + spec
+}
+
+// splitModel splits "provider/model" into its parts. The provider is empty
+// if the spec names only a model.
+func splitModel(spec string) (string, string) {
+	if i := strings.Index(spec, "/"); i > 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return "", spec
 }
 
 func (d *DynamicProvider) Models(ctx context.Context) ([]core.Model, error) {
@@ -42,6 +353,78 @@ func (d *DynamicProvider) Models(ctx context.Context) ([]core.Model, error) {
 	return provider.Models(ctx)
 }
 
+// SessionCapabilities returns what the model of the session of ctx can do.
+func (d *DynamicProvider) SessionCapabilities(ctx context.Context) core.Capabilities {
+	ctx, _, name := d.forSession(ctx)
+	return d.Capabilities(ctx, name)
+}
+
+// Capabilities returns what a "provider/model" can do. The user's
+// overrides take precedence over what the provider reports, which takes
+// precedence over the bundled table.
+func (d *DynamicProvider) Capabilities(ctx context.Context, spec string) core.Capabilities {
+	name := d.qualify(spec)
+
+	caps := d.overrides.Match(name)
+	if caps.Tools == nil && needsPromptTools(d.config.GetPromptToolModels(), name) {
+		caps.Tools = flag(false)
+	}
+	return caps.Merge(d.reportedCapabilities(ctx, name)).Merge(defaultCapabilities.Match(name))
+}
+
+// reportedCaps is a cached capability lookup. Failed lookups expire, so
+// they are retried after a while.
+type reportedCaps struct {
+	caps    core.Capabilities
+	expires time.Time
+}
+
+// reportedCapabilities asks the provider of a "provider/model" what the
+// model can do. Results are cached per model, and concurrent requests for
+// a model share one lookup, done outside the lock.
+func (d *DynamicProvider) reportedCapabilities(ctx context.Context, name string) core.Capabilities {
+	d.capsMu.Lock()
+	cached, ok := d.reported[name]
+	d.capsMu.Unlock()
+	if ok && (cached.expires.IsZero() || time.Now().Before(cached.expires)) {
+		return cached.caps
+	}
+
+	caps, _, _ := d.capsLookup.Do(name, func() (any, error) {
+		entry := reportedCaps{}
+		caps, err := d.lookupCapabilities(ctx, name)
+		if err != nil {
+			log.FromCtx(ctx).Warn().Err(err).Str("model", name).Msg("failed to get model capabilities")
+			entry.expires = time.Now().Add(capsRetryAfter)
+		}
+		entry.caps = caps
+
+		d.capsMu.Lock()
+		d.reported[name] = entry
+		d.capsMu.Unlock()
+		return caps, nil
+	})
+	return caps.(core.Capabilities)
+}
+
+// lookupCapabilities asks the provider of a "provider/model". The lookup is
+// shared by callers, so it does not end with the ctx of the first one.
+func (d *DynamicProvider) lookupCapabilities(ctx context.Context, name string) (core.Capabilities, error) {
+	provider := d.current.Load().(core.AIProvider)
+	if name != d.globalModel() {
+		var err error
+		if provider, err = d.ModelProvider(ctx, name); err != nil {
+			return core.Capabilities{}, fmt.Errorf("failed to create provider: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), modelsTimeout)
+	defer cancel()
+
+	_, model := splitModel(name)
+	return reportedCapabilities(ctx, provider, model)
+}
+
 // GetModel (thread-safe)
 func (d *DynamicProvider) GetModel() string {
 	d.mu.RLock()
@@ -54,12 +437,12 @@ func (d *DynamicProvider) SetModel(ctx context.Context, model string) error {
 	defer d.mu.Unlock()
 
 	// Update config (persist)
-	if err := d.config.SetModel(model); err != nil {
+	if err := d.config.SetModel(withDefaultModel(model)); err != nil {
 		return err
 	}
 
 	// Create new provider
-	newProvider, err := NewProvider(ctx, d.config)
+	newProvider, err := d.newProvider(ctx, d.config.GetProvider(), d.config.GetModel())
 	if err != nil {
 		return fmt.Errorf("failed to create provider: %w", err)
 	}
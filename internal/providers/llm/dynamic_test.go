@@ -0,0 +1,299 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fallbackConfig struct {
+	core.ProviderConfig
+	fallbacks   []string
+	promptTools []string
+}
+
+func (c *fallbackConfig) GetProvider() string           { return "anthropic" }
+func (c *fallbackConfig) GetModel() string              { return "main" }
+func (c *fallbackConfig) GetFallbackModels() []string   { return c.fallbacks }
+func (c *fallbackConfig) GetPromptToolModels() []string { return c.promptTools }
+func (c *fallbackConfig) GetLLMRequestsPerMinute() int  { return 0 }
+func (c *fallbackConfig) GetLLMTokensPerMinute() int    { return 0 }
+func (c *fallbackConfig) GetLLMConcurrency() int        { return 0 }
+func (c *fallbackConfig) GetMediaPath() string          { return "" }
+
+// scriptedProvider answers with a fixed error or content.
+type scriptedProvider struct {
+	content string
+	err     error
+	calls   int
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	p.calls++
+	if p.err != nil {
+		return core.Message{}, p.err
+	}
+	return core.Message{Role: core.RoleAssistant, Content: p.content}, nil
+}
+
+func (p *scriptedProvider) Models(ctx context.Context) ([]core.Model, error) {
+	return nil, nil
+}
+
+func newTestDynamic(primary core.AIProvider, fallbacks map[string]core.AIProvider, order ...string) *DynamicProvider {
+	config := &fallbackConfig{fallbacks: order}
+	d := &DynamicProvider{
+		config:   config,
+		reported: make(map[string]reportedCaps),
+		models:   fallbacks,
+		limiters: newLimiters(config),
+	}
+	d.current.Store(primary)
+	return d
+}
+
+func TestDynamicProvider_Fallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		primaryErr  error
+		secondErr   error
+		wantContent string
+		wantModel   string
+		wantErr     bool
+		wantSecond  int
+		wantThird   int
+	}{
+		{name: "primary answers", wantContent: "main"},
+		{
+			name:        "server error falls back",
+			primaryErr:  newAPIError(529, []byte("overloaded")),
+			wantContent: "second",
+			wantModel:   "openrouter/second",
+			wantSecond:  1,
+		},
+		{
+			name:        "chain continues",
+			primaryErr:  newAPIError(429, nil),
+			secondErr:   newAPIError(500, nil),
+			wantContent: "third",
+			wantModel:   "ollama/third",
+			wantSecond:  1,
+			wantThird:   1,
+		},
+		{
+			name:       "stops at non recoverable fallback error",
+			primaryErr: newAPIError(500, nil),
+			secondErr:  newAPIError(401, nil),
+			wantErr:    true,
+			wantSecond: 1,
+		},
+		{name: "auth error is returned", primaryErr: newAPIError(401, nil), wantErr: true},
+		{name: "context length is returned", primaryErr: newAPIError(400, []byte("prompt is too long")), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			second := &scriptedProvider{content: "second", err: tt.secondErr}
+			third := &scriptedProvider{content: "third"}
+			d := newTestDynamic(
+				&scriptedProvider{content: "main", err: tt.primaryErr},
+				map[string]core.AIProvider{"openrouter/second": second, "ollama/third": third},
+				"anthropic/main", "openrouter/second", "ollama/third",
+			)
+
+			msg, err := d.Chat(context.Background(), nil, nil)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantContent, msg.Content)
+				assert.Equal(t, tt.wantModel, msg.FallbackModel)
+			}
+			assert.Equal(t, tt.wantSecond, second.calls)
+			assert.Equal(t, tt.wantThird, third.calls)
+		})
+	}
+}
+
+// partialStreamer fails after it has streamed part of the answer.
+type partialStreamer struct {
+	scriptedProvider
+}
+
+func (p *partialStreamer) ChatStream(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	onDelta(core.StreamDelta{Content: "Hel"})
+	return core.Message{}, newAPIError(500, nil)
+}
+
+func TestDynamicProvider_ChatStream_NoFallbackAfterOutput(t *testing.T) {
+	fallback := &scriptedProvider{content: "second"}
+	d := newTestDynamic(&partialStreamer{}, map[string]core.AIProvider{"openrouter/second": fallback}, "openrouter/second")
+
+	var deltas []string
+	_, err := d.ChatStream(context.Background(), nil, nil, func(delta core.StreamDelta) {
+		deltas = append(deltas, delta.Content)
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, []string{"Hel"}, deltas)
+	assert.Zero(t, fallback.calls)
+}
+
+func TestDynamicProvider_ChatStream_Fallback(t *testing.T) {
+	d := newTestDynamic(
+		&scriptedProvider{err: newAPIError(503, nil)},
+		map[string]core.AIProvider{"anthropic/other": &scriptedProvider{content: "other"}},
+		"other",
+	)
+
+	var deltas []string
+	msg, err := d.ChatStream(context.Background(), nil, nil, func(delta core.StreamDelta) {
+		deltas = append(deltas, delta.Content)
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"other"}, deltas)
+	assert.Equal(t, "anthropic/other", msg.FallbackModel)
+}
+
+type memorySettings map[string]core.SessionSettings
+
+func (m memorySettings) GetSessionSettings(ctx context.Context, sessionID string) (core.SessionSettings, error) {
+	return m[sessionID], nil
+}
+
+func (m memorySettings) SaveSessionSettings(ctx context.Context, s core.SessionSettings) error {
+	m[s.SessionID] = s
+	return nil
+}
+
+// optionsProvider records the chat options of its requests.
+type optionsProvider struct {
+	name string
+	opts []core.ChatOptions
+}
+
+func (p *optionsProvider) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	p.opts = append(p.opts, core.ChatOptionsFromCtx(ctx))
+	return core.Message{Role: core.RoleAssistant, Content: p.name}, nil
+}
+
+func (p *optionsProvider) Models(ctx context.Context) ([]core.Model, error) {
+	return []core.Model{{ID: "session", ContextLength: 64000}, {ID: "main", ContextLength: 200000}}, nil
+}
+
+func TestDynamicProvider_SessionSettings(t *testing.T) {
+	temperature := 0.2
+	settings := memorySettings{
+		"telegram:1": {SessionID: "telegram:1", Model: "openrouter/session", Options: core.ChatOptions{Temperature: &temperature}},
+		"telegram:2": {SessionID: "telegram:2", Options: core.ChatOptions{ReasoningEffort: "high"}},
+	}
+	main := &optionsProvider{name: "main"}
+	session := &optionsProvider{name: "session"}
+
+	d := newTestDynamic(main, map[string]core.AIProvider{"openrouter/session": session})
+	d.settings = settings
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		want     string
+		wantOpts core.ChatOptions
+		wantCtx  int
+	}{
+		{name: "no session", ctx: context.Background(), want: "main", wantCtx: 200000},
+		{
+			name:     "session model",
+			ctx:      core.WithSessionID(context.Background(), "telegram:1"),
+			want:     "session",
+			wantOpts: core.ChatOptions{Temperature: &temperature},
+			wantCtx:  64000,
+		},
+		{
+			name:     "sub-agent uses the parent's settings",
+			ctx:      core.WithSessionID(core.WithSessionID(context.Background(), "telegram:1"), "telegram:1/sub-1"),
+			want:     "session",
+			wantOpts: core.ChatOptions{Temperature: &temperature},
+			wantCtx:  64000,
+		},
+		{
+			name:     "options only",
+			ctx:      core.WithSessionID(context.Background(), "telegram:2"),
+			want:     "main",
+			wantOpts: core.ChatOptions{ReasoningEffort: "high"},
+			wantCtx:  200000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := d.Chat(tt.ctx, nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, msg.Content)
+			assert.Empty(t, msg.FallbackModel)
+
+			used := main
+			if tt.want == "session" {
+				used = session
+			}
+			assert.Equal(t, tt.wantOpts, used.opts[len(used.opts)-1])
+			assert.Equal(t, tt.wantCtx, d.SessionCapabilities(tt.ctx).ContextWindow)
+		})
+	}
+}
+
+func TestRegisterProvider(t *testing.T) {
+	registered := &scriptedProvider{content: "offline"}
+	var gotModel string
+	t.Cleanup(func() { unregisterProvider("test-local") })
+	RegisterProvider("test-local", func(ctx context.Context, model string) (core.AIProvider, error) {
+		gotModel = model
+		return registered, nil
+	})
+
+	p, err := newProvider(context.Background(), &fallbackConfig{}, "test-local", "qwen", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "qwen", gotModel)
+
+	msg, err := p.Chat(context.Background(), nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "offline", msg.Content)
+
+	_, err = newProvider(context.Background(), &fallbackConfig{}, "unknown", "model", nil)
+	assert.ErrorContains(t, err, "unknown llm provider")
+}
+
+func TestDynamicProvider_CheckModel(t *testing.T) {
+	listed := &capsProvider{models: []core.Model{{ID: "gpt-4o"}, {ID: "llama3:latest"}}}
+	d := newTestDynamic(&scriptedProvider{}, map[string]core.AIProvider{
+		"openai/gpt-4o":         listed,
+		"openai/does-not-exist": listed,
+		"ollama/llama3":         listed,
+		"custom/anything":       &scriptedProvider{},
+		"openrouter/down":       &failingModels{},
+	})
+
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{spec: "openai/gpt-4o"},
+		{spec: "openai/does-not-exist", wantErr: "not offered"},
+		{spec: "ollama/llama3"},
+		{spec: "custom/anything"},
+		{spec: "openrouter/down", wantErr: "could not verify"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			err := d.CheckModel(context.Background(), tt.spec)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
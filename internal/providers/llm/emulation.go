@@ -0,0 +1,314 @@
+package llm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/log"
+)
+
+// Tags around an emulated tool call, the format many open models were
+// trained on.
+const (
+	ToolCallOpen  = "<tool_call>"
+	ToolCallClose = "</tool_call>"
+)
+
+const toolInstructions = `You can call the tools listed below. To call a tool, write a ` + ToolCallOpen + ` block with a JSON object holding the tool name and its arguments, one block per call:
+` + ToolCallOpen + `{"name": "read_file", "arguments": {"path": "notes.txt"}}` + ToolCallClose + `
+Write nothing after the blocks. The results are sent to you in the next message as <tool_result> blocks. Answer in plain text once you need no more tools.
+
+Tools:`
+
+// emulatedCall is a tool call as written by the model.
+type emulatedCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// ToolPrompt describes the tools and how to call them, for models without
+// native tool calling.
+func ToolPrompt(tools []core.Tool) string {
+	var b strings.Builder
+	b.WriteString(toolInstructions)
+	for _, t := range tools {
+		fmt.Fprintf(&b, "\n- %s: %s", t.Function.Name, t.Function.Description)
+		if len(t.Function.Parameters) > 0 {
+			fmt.Fprintf(&b, "\n  parameters: %s", t.Function.Parameters)
+		}
+	}
+	return b.String()
+}
+
+// EmulateToolHistory writes tool calls and results of the history as text:
+// assistant tool calls become tagged JSON, and tool results become user
+// messages, keeping their content parts.
+func EmulateToolHistory(history []core.Message) []core.Message {
+	result := make([]core.Message, 0, len(history))
+	names := make(map[string]string)
+
+	for _, m := range history {
+		switch {
+		case m.Role == core.RoleAssistant && len(m.ToolCalls) > 0:
+			blocks := make([]string, 0, len(m.ToolCalls)+1)
+			if m.Content != "" {
+				blocks = append(blocks, m.Content)
+			}
+			for _, tc := range m.ToolCalls {
+				names[tc.ID] = tc.Function.Name
+				call := marshalCall(emulatedCall{Name: tc.Function.Name, Arguments: toolInput(tc.Function.Arguments)})
+				blocks = append(blocks, ToolCallOpen+call+ToolCallClose)
+			}
+			m.Content = strings.Join(blocks, "\n")
+			m.ToolCalls = nil
+
+		case m.Role == core.RoleTool:
+			m.Content = fmt.Sprintf("<tool_result name=%q>\n%s\n</tool_result>", names[m.ToolCallID], m.Content)
+			m.Role = core.RoleUser
+			m.ToolCallID = ""
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+// marshalCall writes a call as the model would, without escaping HTML.
+func marshalCall(call emulatedCall) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(call)
+	return strings.TrimSpace(b.String())
+}
+
+// ParseToolCalls extracts tagged tool calls from a model's answer and returns
+// the text before them. Calls that are not valid JSON are dropped; if none
+// is valid, the text is returned as it is.
+func ParseToolCalls(text string) (string, []core.ToolCall) {
+	before, rest, found := strings.Cut(text, ToolCallOpen)
+	if !found {
+		return text, nil
+	}
+
+	var calls []core.ToolCall
+	for found {
+		var block string
+		block, rest, _ = strings.Cut(rest, ToolCallClose)
+		if call, ok := parseCall(block); ok {
+			calls = append(calls, call)
+		}
+		_, rest, found = strings.Cut(rest, ToolCallOpen)
+	}
+
+	if len(calls) == 0 {
+		return text, nil
+	}
+	return strings.TrimSpace(before), calls
+}
+
+func parseCall(block string) (core.ToolCall, bool) {
+	var call emulatedCall
+	if err := json.Unmarshal([]byte(strings.TrimSpace(block)), &call); err != nil || call.Name == "" {
+		return core.ToolCall{}, false
+	}
+
+	// Some models write the arguments as a JSON string
+	args := strings.TrimSpace(string(call.Arguments))
+	var encoded string
+	if json.Unmarshal(call.Arguments, &encoded) == nil {
+		args = encoded
+	}
+	if !json.Valid([]byte(args)) || !strings.HasPrefix(args, "{") {
+		args = "{}"
+	}
+
+	return core.ToolCall{
+		ID:       "call_" + rand.Text(),
+		Type:     "function",
+		Function: core.FunctionCall{Name: call.Name, Arguments: args},
+	}, true
+}
+
+// toolsUnsupportedHints are fragments of the errors APIs return for a model
+// that cannot take tools.
+var toolsUnsupportedHints = []string{
+	"does not support tools",
+	"tools are not supported",
+	"tool use is not supported",
+	"tool calling is not supported",
+	"function calling is not supported",
+}
+
+// promptTools lets a model without native tool calling use tools: they are
+// described in the system prompt and calls are parsed from the answer.
+// Tools are sent natively until the model rejects them, unless needed says
+// the model cannot take them. needed is asked once, before the first
+// request with tools.
+type promptTools struct {
+	core.AIProvider
+	needed  func(ctx context.Context) bool
+	once    sync.Once
+	emulate atomic.Bool
+}
+
+func newPromptTools(p core.AIProvider, needed func(ctx context.Context) bool) *promptTools {
+	return &promptTools{AIProvider: p, needed: needed}
+}
+
+// Unwrap returns the wrapped provider.
+func (p *promptTools) Unwrap() core.AIProvider {
+	return p.AIProvider
+}
+
+// emulating reports whether tools are described in the prompt.
+func (p *promptTools) emulating(ctx context.Context) bool {
+	p.once.Do(func() {
+		if p.needed != nil && p.needed(ctx) {
+			p.emulate.Store(true)
+		}
+	})
+	return p.emulate.Load()
+}
+
+func (p *promptTools) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	if len(tools) == 0 || !p.emulating(ctx) {
+		msg, err := p.AIProvider.Chat(ctx, history, tools)
+		if !p.rejectsTools(ctx, tools, err) {
+			return msg, err
+		}
+	}
+	return p.emulated(ctx, history, tools, nil)
+}
+
+// ChatStream streams the text before the first tool call.
+func (p *promptTools) ChatStream(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	if onDelta == nil {
+		onDelta = func(core.StreamDelta) {}
+	}
+	if len(tools) == 0 || !p.emulating(ctx) {
+		msg, err := chatStream(ctx, p.AIProvider, history, tools, onDelta)
+		if !p.rejectsTools(ctx, tools, err) {
+			return msg, err
+		}
+	}
+	return p.emulated(ctx, history, tools, onDelta)
+}
+
+// rejectsTools reports whether err says the model cannot take tools, and
+// switches to emulation if so.
+func (p *promptTools) rejectsTools(ctx context.Context, tools []core.Tool, err error) bool {
+	var apiErr *APIError
+	if len(tools) == 0 || !errors.As(err, &apiErr) || apiErr.Class != ErrBadRequest ||
+		!containsAny(strings.ToLower(apiErr.Body), toolsUnsupportedHints) {
+		return false
+	}
+
+	log.FromCtx(ctx).Warn().Msg("model does not support tools, describing them in the prompt")
+	p.emulate.Store(true)
+	return true
+}
+
+func (p *promptTools) emulated(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	history = withToolPrompt(EmulateToolHistory(history), tools)
+
+	var msg core.Message
+	var err error
+	if onDelta == nil {
+		msg, err = p.AIProvider.Chat(ctx, history, nil)
+	} else {
+		filter := &tagFilter{onDelta: onDelta}
+		msg, err = chatStream(ctx, p.AIProvider, history, nil, filter.add)
+		filter.flush()
+	}
+	if err != nil {
+		return msg, err
+	}
+
+	msg.Content, msg.ToolCalls = ParseToolCalls(msg.Content)
+	return msg, nil
+}
+
+// withToolPrompt adds the tool prompt after the stable system messages, so
+// it is part of the prefix providers cache.
+func withToolPrompt(history []core.Message, tools []core.Tool) []core.Message {
+	at := 0
+	for i, m := range history {
+		if m.Role != core.RoleSystem {
+			break
+		}
+		at = i + 1
+		if m.CachePoint {
+			break
+		}
+	}
+
+	prompt := core.Message{Role: core.RoleSystem, Content: ToolPrompt(tools)}
+	return slices.Insert(slices.Clone(history), at, prompt)
+}
+
+// tagFilter passes on streamed text up to the first tool call tag. Text that
+// may be the beginning of the tag is held back until it is known.
+type tagFilter struct {
+	onDelta func(core.StreamDelta)
+	pending string
+	stopped bool
+}
+
+func (f *tagFilter) add(delta core.StreamDelta) {
+	if delta.Reasoning != "" {
+		f.onDelta(core.StreamDelta{Reasoning: delta.Reasoning})
+	}
+	if f.stopped || delta.Content == "" {
+		return
+	}
+
+	f.pending += delta.Content
+	if i := strings.Index(f.pending, ToolCallOpen); i >= 0 {
+		f.emit(f.pending[:i])
+		f.pending, f.stopped = "", true
+		return
+	}
+
+	keep := 0
+	for n := min(len(f.pending), len(ToolCallOpen)-1); n > 0; n-- {
+		if strings.HasSuffix(f.pending, ToolCallOpen[:n]) {
+			keep = n
+			break
+		}
+	}
+	f.emit(f.pending[:len(f.pending)-keep])
+	f.pending = f.pending[len(f.pending)-keep:]
+}
+
+func (f *tagFilter) flush() {
+	if !f.stopped {
+		f.emit(f.pending)
+		f.pending = ""
+	}
+}
+
+func (f *tagFilter) emit(text string) {
+	if text != "" {
+		f.onDelta(core.StreamDelta{Content: text})
+	}
+}
+
+// needsPromptTools reports whether a "provider/model" matches one of the
+// patterns of models without native tool calling.
+func needsPromptTools(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
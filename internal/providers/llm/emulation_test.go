@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseToolCalls(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		wantContent string
+		wantCalls   []core.FunctionCall
+	}{
+		{
+			name:        "text",
+			text:        "The file has 3 lines.",
+			wantContent: "The file has 3 lines.",
+		},
+		{
+			name: "text and calls",
+			text: "Let me look.\n<tool_call>\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"a.txt\"}}\n</tool_call>\n" +
+				`<tool_call>{"name": "list_directory", "arguments": null}</tool_call>`,
+			wantContent: "Let me look.",
+			wantCalls: []core.FunctionCall{
+				{Name: "read_file", Arguments: `{"path": "a.txt"}`},
+				{Name: "list_directory", Arguments: `{}`},
+			},
+		},
+		{
+			name:      "arguments as string",
+			text:      `<tool_call>{"name": "read_file", "arguments": "{\"path\": \"a.txt\"}"}</tool_call>`,
+			wantCalls: []core.FunctionCall{{Name: "read_file", Arguments: `{"path": "a.txt"}`}},
+		},
+		{
+			name:      "missing close tag",
+			text:      `<tool_call>{"name": "read_file", "arguments": {}}`,
+			wantCalls: []core.FunctionCall{{Name: "read_file", Arguments: `{}`}},
+		},
+		{
+			name:        "cut off",
+			text:        `<tool_call>{"name": "read_file", "argum`,
+			wantContent: `<tool_call>{"name": "read_file", "argum`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, calls := ParseToolCalls(tt.text)
+
+			assert.Equal(t, tt.wantContent, content)
+			require.Len(t, calls, len(tt.wantCalls))
+			ids := make(map[string]bool)
+			for i, call := range calls {
+				assert.Equal(t, tt.wantCalls[i].Name, call.Function.Name)
+				assert.JSONEq(t, tt.wantCalls[i].Arguments, call.Function.Arguments)
+				assert.Equal(t, "function", call.Type)
+				assert.True(t, strings.HasPrefix(call.ID, "call_"))
+				ids[call.ID] = true
+			}
+			assert.Len(t, ids, len(tt.wantCalls))
+		})
+	}
+}
+
+func TestEmulateToolHistory(t *testing.T) {
+	parts := []core.ContentPart{{Type: core.PartImage, MediaType: "image/png", Path: "/media/a.png"}}
+	history := []core.Message{
+		{Role: core.RoleUser, Content: "list files"},
+		{Role: core.RoleAssistant, Content: "Sure.", ToolCalls: []core.ToolCall{
+			{ID: "call_1", Function: core.FunctionCall{Name: "screenshot", Arguments: `{"window":"<main>"}`}},
+		}},
+		{Role: core.RoleTool, ToolCallID: "call_1", Content: "taken", Parts: parts},
+	}
+
+	got := EmulateToolHistory(history)
+
+	assert.Equal(t, []core.Message{
+		{Role: core.RoleUser, Content: "list files"},
+		{Role: core.RoleAssistant, Content: "Sure.\n<tool_call>{\"name\":\"screenshot\",\"arguments\":{\"window\":\"<main>\"}}</tool_call>"},
+		{Role: core.RoleUser, Content: "<tool_result name=\"screenshot\">\ntaken\n</tool_result>", Parts: parts},
+	}, got)
+	assert.Len(t, history[1].ToolCalls, 1, "the history is not modified")
+}
+
+func TestWithToolPrompt(t *testing.T) {
+	tools := []core.Tool{{Function: core.Function{Name: "read_file", Description: "Reads a file"}}}
+
+	cached := withToolPrompt([]core.Message{
+		{Role: core.RoleSystem, Content: "identity"},
+		{Role: core.RoleSystem, Content: "summary", CachePoint: true},
+		{Role: core.RoleSystem, Content: "rag"},
+		{Role: core.RoleUser, Content: "hi"},
+	}, tools)
+	require.Len(t, cached, 5)
+	assert.Contains(t, cached[2].Content, "- read_file: Reads a file")
+
+	plain := withToolPrompt([]core.Message{
+		{Role: core.RoleSystem, Content: "identity"},
+		{Role: core.RoleUser, Content: "hi"},
+	}, tools)
+	require.Len(t, plain, 3)
+	assert.Equal(t, core.RoleSystem, plain[1].Role)
+	assert.Contains(t, plain[1].Content, ToolCallOpen)
+}
+
+// textModel streams a fixed answer in pieces and may reject tools.
+type textModel struct {
+	pieces      []string
+	rejectTools bool
+
+	calls       int
+	gotTools    []core.Tool
+	gotMessages []core.Message
+}
+
+func (m *textModel) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	return m.ChatStream(ctx, history, tools, func(core.StreamDelta) {})
+}
+
+func (m *textModel) ChatStream(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	m.calls++
+	m.gotTools, m.gotMessages = tools, history
+	if m.rejectTools && len(tools) > 0 {
+		return core.Message{}, newAPIError(400, []byte(`{"error":"registry.ollama.ai/library/gemma:2b does not support tools"}`))
+	}
+
+	for _, p := range m.pieces {
+		onDelta(core.StreamDelta{Content: p})
+	}
+	return core.Message{Role: core.RoleAssistant, Content: strings.Join(m.pieces, "")}, nil
+}
+
+func (m *textModel) Models(ctx context.Context) ([]core.Model, error) {
+	return nil, nil
+}
+
+func TestPromptTools_Emulated(t *testing.T) {
+	model := &textModel{pieces: []string{"Let me ", "check.\n<to", "ol_call>{\"name\": \"read_file\", ", "\"arguments\": {}}</tool_call>"}}
+	p := newPromptTools(model, func(context.Context) bool { return true })
+	tools := []core.Tool{{Function: core.Function{Name: "read_file"}}}
+
+	var streamed strings.Builder
+	msg, err := p.ChatStream(context.Background(), []core.Message{{Role: core.RoleUser, Content: "read it"}}, tools, func(d core.StreamDelta) {
+		streamed.WriteString(d.Content)
+	})
+
+	require.NoError(t, err)
+	assert.Nil(t, model.gotTools, "tools are not sent natively")
+	assert.Contains(t, model.gotMessages[0].Content, "- read_file")
+	assert.Equal(t, "Let me check.\n", streamed.String())
+	assert.Equal(t, "Let me check.", msg.Content)
+	require.Len(t, msg.ToolCalls, 1)
+	assert.Equal(t, "read_file", msg.ToolCalls[0].Function.Name)
+}
+
+func TestPromptTools_SwitchesWhenToolsAreRejected(t *testing.T) {
+	model := &textModel{pieces: []string{`<tool_call>{"name": "read_file", "arguments": {}}</tool_call>`}, rejectTools: true}
+	p := newPromptTools(model, nil)
+	tools := []core.Tool{{Function: core.Function{Name: "read_file"}}}
+
+	msg, err := p.Chat(context.Background(), nil, tools)
+	require.NoError(t, err)
+	require.Len(t, msg.ToolCalls, 1)
+	assert.Equal(t, 2, model.calls)
+
+	// Later requests describe the tools right away
+	_, err = p.Chat(context.Background(), nil, tools)
+	require.NoError(t, err)
+	assert.Equal(t, 3, model.calls)
+}
+
+func TestNeedsPromptTools(t *testing.T) {
+	patterns := []string{"ollama/gemma*", "custom/*"}
+
+	assert.True(t, needsPromptTools(patterns, "ollama/gemma:2b"))
+	assert.True(t, needsPromptTools(patterns, "custom/phi-3"))
+	assert.False(t, needsPromptTools(patterns, "ollama/qwen3:8b"))
+	assert.False(t, needsPromptTools(nil, "ollama/gemma:2b"))
+}
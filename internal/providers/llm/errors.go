@@ -0,0 +1,116 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrorClass tells why a provider request failed.
+type ErrorClass string
+
+const (
+	ErrAuth          ErrorClass = "auth"           // invalid or missing credentials
+	ErrQuota         ErrorClass = "quota"          // rate limits, exhausted credits or quota
+	ErrContextLength ErrorClass = "context_length" // the request does not fit the model
+	ErrServer        ErrorClass = "server"         // the provider is down, overloaded or unreachable
+	ErrBadRequest    ErrorClass = "bad_request"    // anything else the provider rejected
+)
+
+// Recoverable reports whether another model may succeed where this one
+// failed. Auth and request errors need the user's attention instead.
+func (c ErrorClass) Recoverable() bool {
+	return c == ErrQuota || c == ErrServer
+}
+
+// contextLengthHints are fragments of the errors providers return when the
+// prompt is longer than the context window.
+var contextLengthHints = []string{
+	"context_length_exceeded",
+	"context length",
+	"context window",
+	"maximum context",
+	"prompt is too long",
+	"too many tokens",
+}
+
+// quotaHints mark client errors that are really about billing.
+var quotaHints = []string{
+	"insufficient_quota",
+	"quota",
+	"credit",
+	"billing",
+}
+
+// errStreamEnded is returned when a stream ends before the provider marked
+// the answer as complete, e.g. when the connection drops midway.
+var errStreamEnded = errors.New("the stream ended before the answer was complete")
+
+// errStreamStalled is returned when a stream stops sending data for too long.
+var errStreamStalled = errors.New("the stream stalled")
+
+// APIError is a failed response of a provider API.
+type APIError struct {
+	Class  ErrorClass
+	Status int
+	Body   string
+}
+
+func newAPIError(status int, body []byte) *APIError {
+	return &APIError{
+		Class:  classifyStatus(status, string(body)),
+		Status: status,
+		Body:   string(body),
+	}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("http %d: %s", e.Status, e.Body)
+}
+
+func classifyStatus(status int, body string) ErrorClass {
+	lower := strings.ToLower(body)
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusPaymentRequired || status == http.StatusTooManyRequests:
+		return ErrQuota
+	case status == http.StatusRequestEntityTooLarge || containsAny(lower, contextLengthHints):
+		return ErrContextLength
+	case status >= 500:
+		return ErrServer
+	case containsAny(lower, quotaHints):
+		return ErrQuota
+	default:
+		return ErrBadRequest
+	}
+}
+
+// Classify returns the class of an error returned by a provider, or "" if
+// the request was cancelled or the error is not about the provider.
+func Classify(err error) ErrorClass {
+	var apiErr *APIError
+	var netErr net.Error
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return ""
+	case errors.As(err, &apiErr):
+		return apiErr.Class
+	case errors.As(err, &netErr), errors.Is(err, errStreamEnded), errors.Is(err, errStreamStalled):
+		return ErrServer
+	default:
+		return ""
+	}
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
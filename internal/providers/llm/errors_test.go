@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"unauthorized", newAPIError(401, []byte(`{"error":"invalid x-api-key"}`)), ErrAuth},
+		{"forbidden", newAPIError(403, nil), ErrAuth},
+		{"rate limited", newAPIError(429, []byte(`rate limit exceeded`)), ErrQuota},
+		{"no credits", newAPIError(402, []byte(`insufficient credits`)), ErrQuota},
+		{"quota as bad request", newAPIError(400, []byte(`{"code":"insufficient_quota"}`)), ErrQuota},
+		{"openai context", newAPIError(400, []byte(`{"code":"context_length_exceeded"}`)), ErrContextLength},
+		{"anthropic context", newAPIError(400, []byte(`prompt is too long: 210000 tokens > 200000 maximum`)), ErrContextLength},
+		{"too large", newAPIError(413, nil), ErrContextLength},
+		{"overloaded", newAPIError(529, []byte(`overloaded_error`)), ErrServer},
+		{"bad gateway", newAPIError(502, nil), ErrServer},
+		{"bad request", newAPIError(400, []byte(`unknown field`)), ErrBadRequest},
+		{"wrapped", fmt.Errorf("fallback x: %w", newAPIError(503, nil)), ErrServer},
+		{"unreachable", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrServer},
+		{"cancelled", context.Canceled, ""},
+		{"other", errors.New("decode: unexpected EOF"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Classify(tt.err))
+		})
+	}
+}
@@ -3,32 +3,78 @@ package llm
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/sandevgo/tuskbot/internal/core"
 	"github.com/sandevgo/tuskbot/pkg/log"
+	"github.com/sandevgo/tuskbot/pkg/ratelimit"
 )
 
-// NewProvider creates the appropriate AIProvider based on configuration.
-func NewProvider(ctx context.Context, cfg core.ProviderConfig) (core.AIProvider, error) {
-	provider, model := cfg.GetProvider(), cfg.GetModel()
+// ProviderFunc creates a provider for a model of a registered provider.
+type ProviderFunc func(ctx context.Context, model string) (core.AIProvider, error)
 
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]ProviderFunc)
+)
+
+// RegisterProvider adds a provider that is built outside of this package,
+// like the local provider, which needs the llama.cpp libraries.
+func RegisterProvider(name string, fn ProviderFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = fn
+}
+
+// newProvider creates a provider for any model using the configured keys.
+// A non-nil limiter is shared with other models of the provider.
+func newProvider(ctx context.Context, cfg core.ProviderConfig, provider, model string, limiter *ratelimit.Limiter) (core.AIProvider, error) {
 	log.FromCtx(ctx).Info().
 		Str("provider", provider).
 		Str("model", model).
 		Msg("starting llm provider")
 
+	var p core.AIProvider
 	switch provider {
 	case "openai":
-		return NewOpenAI(cfg.GetOpenAIAPIKey(), model), nil
+		p = NewOpenAI(cfg.GetOpenAIAPIKey(), model)
 	case "anthropic":
-		return NewAnthropic(cfg.GetAnthropicAPIKey(), model), nil
+		p = NewAnthropic(cfg.GetAnthropicAPIKey(), model)
 	case "openrouter":
-		return NewOpenRouter(cfg.GetOpenRouterAPIKey(), model), nil
+		p = NewOpenRouter(cfg.GetOpenRouterAPIKey(), model)
 	case "ollama":
-		return NewOllama(cfg.GetOllamaBaseURL(), cfg.GetOllamaAPIKey(), model), nil
+		options, err := loadOllamaOptions(cfg.GetOllamaOptionsPath())
+		if err != nil {
+			return nil, err
+		}
+		p = NewOllama(OllamaConfig{
+			BaseURL:       cfg.GetOllamaBaseURL(),
+			APIKey:        cfg.GetOllamaAPIKey(),
+			Model:         model,
+			Options:       options.Match(model),
+			DefaultNumCtx: cfg.GetOllamaNumCtx(),
+		})
 	case "custom":
-		return NewCustomOpenAI(cfg.GetCustomOpenAIBaseURL(), cfg.GetCustomOpenAIAPIKey(), model), nil
+		p = NewCustomOpenAI(cfg.GetCustomOpenAIBaseURL(), cfg.GetCustomOpenAIAPIKey(), model)
 	default:
-		return nil, fmt.Errorf("unknown llm provider: %s", provider)
+		registryMu.RLock()
+		fn, ok := registry[provider]
+		registryMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown llm provider: %s", provider)
+		}
+
+		var err error
+		if p, err = fn(ctx, model); err != nil {
+			return nil, err
+		}
+	}
+
+	if l, ok := p.(interface{ setLimiter(*ratelimit.Limiter) }); ok && limiter != nil {
+		l.setLimiter(limiter)
+	}
+	if m, ok := p.(interface{ setMediaPath(string) }); ok {
+		m.setMediaPath(cfg.GetMediaPath())
 	}
+	return p, nil
 }
@@ -0,0 +1,156 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+// builtinProviders are the provider names handled by newProvider itself.
+var builtinProviders = []string{"openai", "anthropic", "openrouter", "ollama", "custom"}
+
+var providerName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// NamedProvider is an OpenAI-compatible endpoint defined in providers.json,
+// like a vLLM server, LM Studio or a gateway. Its models are addressed as
+// "<name>/<model>".
+type NamedProvider struct {
+	BaseURL string `json:"base_url"`
+	APIKey  string `json:"api_key"`
+
+	// AuthHeader carries the API key, "Authorization" by default.
+	AuthHeader string `json:"auth_header"`
+
+	// AuthPrefix goes before the API key, "Bearer " by default when the key
+	// goes in the Authorization header.
+	AuthPrefix *string `json:"auth_prefix"`
+
+	// Headers are sent with every request.
+	Headers map[string]string `json:"headers"`
+
+	// DefaultModel is used for "<name>/" without a model.
+	DefaultModel string `json:"default_model"`
+}
+
+// LoadNamedProviders reads the named providers by name. The file is
+// optional. Environment variables in API keys and header values are
+// expanded, so secrets can stay in .env.
+func LoadNamedProviders(path string) (map[string]NamedProvider, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]NamedProvider{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read providers: %w", err)
+	}
+
+	var providers map[string]NamedProvider
+	if err := json.Unmarshal(data, &providers); err != nil {
+		return nil, fmt.Errorf("failed to parse providers: %w", err)
+	}
+	for name, p := range providers {
+		switch {
+		case !providerName.MatchString(name):
+			return nil, fmt.Errorf("invalid provider: %q: names are lowercase letters, digits, '.', '_' and '-'", name)
+		case slices.Contains(builtinProviders, name):
+			return nil, fmt.Errorf("invalid provider: %s: the name is taken by a built-in provider", name)
+		case p.BaseURL == "":
+			return nil, fmt.Errorf("invalid provider: %s: base_url is required", name)
+		}
+
+		p.APIKey = os.ExpandEnv(p.APIKey)
+		headers := make(map[string]string, len(p.Headers))
+		for k, v := range p.Headers {
+			headers[k] = os.ExpandEnv(v)
+		}
+		p.Headers = headers
+		providers[name] = p
+	}
+	return providers, nil
+}
+
+// Config returns the client configuration for a model of the provider.
+func (p NamedProvider) Config(model string) OpenAICompatibleConfig {
+	if model == "" {
+		model = p.DefaultModel
+	}
+
+	header, prefix := p.AuthHeader, ""
+	if header == "" {
+		header = "Authorization"
+	}
+	if p.AuthPrefix != nil {
+		prefix = *p.AuthPrefix
+	} else if header == "Authorization" {
+		prefix = "Bearer "
+	}
+
+	return OpenAICompatibleConfig{
+		BaseURL:      p.BaseURL,
+		APIKey:       p.APIKey,
+		Model:        model,
+		AuthHeader:   header,
+		AuthPrefix:   prefix,
+		ExtraHeaders: p.Headers,
+		PartTypes:    []string{core.PartImage},
+	}
+}
+
+// New creates a provider for a model of the endpoint, or its default model
+// if model is empty.
+func (p NamedProvider) New(model string) *CustomOpenAI {
+	return &CustomOpenAI{OpenAICompatible: NewOpenAICompatible(p.Config(model))}
+}
+
+var defaultModels = make(map[string]string)
+
+// RegisterNamedProviders makes the models of the providers available as
+// "<name>/<model>". A name may not be registered twice.
+func RegisterNamedProviders(providers map[string]NamedProvider) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for name, p := range providers {
+		if _, ok := registry[name]; ok {
+			return fmt.Errorf("provider %s is already registered", name)
+		}
+		registry[name] = func(ctx context.Context, model string) (core.AIProvider, error) {
+			return p.New(model), nil
+		}
+		if p.DefaultModel != "" {
+			defaultModels[name] = p.DefaultModel
+		}
+	}
+	return nil
+}
+
+// unregisterProvider removes a provider and its default model.
+func unregisterProvider(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	delete(registry, name)
+	delete(defaultModels, name)
+}
+
+// withDefaultModel completes "<name>/" with the default model of a named
+// provider.
+func withDefaultModel(spec string) string {
+	provider, model := splitModel(spec)
+	if provider == "" || model != "" {
+		return spec
+	}
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if def, ok := defaultModels[provider]; ok {
+		return provider + "/" + def
+	}
+	return spec
+}
@@ -0,0 +1,118 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadNamedProviders(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TEST_GATEWAY_KEY", "secret")
+
+	providers, err := LoadNamedProviders(filepath.Join(dir, "missing.json"))
+	require.NoError(t, err)
+	assert.Empty(t, providers)
+
+	path := filepath.Join(dir, "providers.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"gateway": {
+			"base_url": "https://llm.example.com",
+			"api_key": "${TEST_GATEWAY_KEY}",
+			"auth_header": "X-Api-Key",
+			"headers": {"X-Team": "$TEST_GATEWAY_KEY-team"},
+			"default_model": "qwen3-32b"
+		}
+	}`), 0600))
+	providers, err = LoadNamedProviders(path)
+	require.NoError(t, err)
+	require.Contains(t, providers, "gateway")
+	assert.Equal(t, "secret", providers["gateway"].APIKey)
+	assert.Equal(t, map[string]string{"X-Team": "secret-team"}, providers["gateway"].Headers)
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "slash", data: `{"my/vllm": {"base_url": "http://localhost:8000"}}`, wantErr: "names are lowercase"},
+		{name: "upper case", data: `{"LMStudio": {"base_url": "http://localhost:1234"}}`, wantErr: "names are lowercase"},
+		{name: "built-in", data: `{"openai": {"base_url": "http://localhost:8000"}}`, wantErr: "taken by a built-in provider"},
+		{name: "no base url", data: `{"vllm": {}}`, wantErr: "base_url is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0600))
+			_, err := LoadNamedProviders(path)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestNamedProvider_Config(t *testing.T) {
+	empty := ""
+	tests := []struct {
+		name       string
+		provider   NamedProvider
+		wantHeader string
+		wantPrefix string
+	}{
+		{name: "defaults", provider: NamedProvider{}, wantHeader: "Authorization", wantPrefix: "Bearer "},
+		{name: "other header", provider: NamedProvider{AuthHeader: "api-key"}, wantHeader: "api-key"},
+		{name: "no prefix", provider: NamedProvider{AuthPrefix: &empty}, wantHeader: "Authorization"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.provider.Config("m")
+			assert.Equal(t, tt.wantHeader, cfg.AuthHeader)
+			assert.Equal(t, tt.wantPrefix, cfg.AuthPrefix)
+		})
+	}
+}
+
+func TestDynamicProvider_NamedProvider(t *testing.T) {
+	var gotModel string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+		assert.Equal(t, "platform", r.Header.Get("X-Team"))
+
+		var body struct{ Model string }
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotModel = body.Model
+		fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": "hi"}}]}`)
+	}))
+	defer srv.Close()
+
+	t.Cleanup(func() { unregisterProvider("test-gateway") })
+	require.NoError(t, RegisterNamedProviders(map[string]NamedProvider{
+		"test-gateway": {
+			BaseURL:      srv.URL,
+			APIKey:       "secret",
+			AuthHeader:   "X-Api-Key",
+			Headers:      map[string]string{"X-Team": "platform"},
+			DefaultModel: "qwen3-32b",
+		},
+	}))
+	assert.Error(t, RegisterNamedProviders(map[string]NamedProvider{"test-gateway": {BaseURL: srv.URL}}))
+
+	d := newTestDynamic(&scriptedProvider{}, make(map[string]core.AIProvider))
+	assert.Equal(t, "test-gateway/qwen3-32b", d.qualify("test-gateway/"))
+	assert.Equal(t, "test-gateway/llama", d.qualify("test-gateway/llama"))
+
+	p, err := d.ModelProvider(context.Background(), "test-gateway/")
+	require.NoError(t, err)
+	msg, err := p.Chat(context.Background(), nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", msg.Content)
+	assert.Equal(t, "qwen3-32b", gotModel)
+}
@@ -1,71 +1,586 @@
 package llm
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/log"
 )
 
+// ollamaInfoTimeout bounds requests for model information.
+const ollamaInfoTimeout = 5 * time.Second
+
+// OllamaOptions are settings of an Ollama model.
+type OllamaOptions struct {
+	// NumCtx is the context size the model is run with.
+	NumCtx int `json:"num_ctx,omitempty"`
+	// KeepAlive is how long the model stays loaded after a request, e.g.
+	// "30m". A negative duration keeps it loaded.
+	KeepAlive string `json:"keep_alive,omitempty"`
+	// Think turns thinking on or off with true or false, or sets its level
+	// with "low", "medium" or "high".
+	Think any `json:"think,omitempty"`
+}
+
+// merge returns o with its unset values taken from other.
+func (o OllamaOptions) merge(other OllamaOptions) OllamaOptions {
+	if o.NumCtx == 0 {
+		o.NumCtx = other.NumCtx
+	}
+	if o.KeepAlive == "" {
+		o.KeepAlive = other.KeepAlive
+	}
+	if o.Think == nil {
+		o.Think = other.Think
+	}
+	return o
+}
+
+// ollamaOptionsTable holds options by model name. A key also matches the
+// models it is a prefix of, and values of longer keys take precedence.
+type ollamaOptionsTable map[string]OllamaOptions
+
+// loadOllamaOptions reads the per-model options. The file is optional.
+func loadOllamaOptions(path string) (ollamaOptionsTable, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ollamaOptionsTable{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ollama options: %w", err)
+	}
+
+	var t ollamaOptionsTable
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse ollama options: %w", err)
+	}
+	for model, o := range t {
+		switch think := o.Think.(type) {
+		case nil, bool:
+		case string:
+			if !slices.Contains([]string{"low", "medium", "high"}, think) {
+				return nil, fmt.Errorf("invalid ollama options: %s: think must be true, false, low, medium or high", model)
+			}
+		default:
+			return nil, fmt.Errorf("invalid ollama options: %s: think must be true, false, low, medium or high", model)
+		}
+		if o.NumCtx < 0 {
+			return nil, fmt.Errorf("invalid ollama options: %s: num_ctx must not be negative", model)
+		}
+	}
+	return t, nil
+}
+
+// Match returns the options of a model, merged from all keys that match it.
+func (t ollamaOptionsTable) Match(model string) OllamaOptions {
+	var o OllamaOptions
+	for _, key := range prefixKeys(t, model) {
+		o = o.merge(t[key])
+	}
+	return o
+}
+
+type OllamaConfig struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	Options OllamaOptions
+
+	// DefaultNumCtx is the context size of models without one in Options
+	// or their Modelfile, capped at the size the model was trained with.
+	// 0 uses the trained size.
+	DefaultNumCtx int
+}
+
+// Ollama talks to Ollama's native API, which unlike its OpenAI compatible
+// endpoint takes the context size and other model options.
 type Ollama struct {
-	*OpenAICompatible
+	baseProvider
+	options       OllamaOptions
+	defaultNumCtx int
+
+	// /api/show of the model, fetched once. A failure is kept as well, so
+	// requests do not wait for an unreachable endpoint again.
+	showOnce sync.Once
+	shown    ollamaShow
+	showErr  error
 }
 
-func NewOllama(baseURL, apiKey, model string) *Ollama {
+func NewOllama(cfg OllamaConfig) *Ollama {
 	return &Ollama{
-		OpenAICompatible: NewOpenAICompatible(OpenAICompatibleConfig{
-			BaseURL:    baseURL,
-			APIKey:     apiKey,
-			Model:      model,
-			AuthHeader: "Authorization",
-			AuthPrefix: "Bearer ",
-		}),
+		baseProvider:  newBaseProvider(cfg.BaseURL, cfg.APIKey, cfg.Model),
+		options:       cfg.Options,
+		defaultNumCtx: cfg.DefaultNumCtx,
 	}
 }
 
-func (o *Ollama) Models(ctx context.Context) ([]core.Model, error) {
-	type ollamaTag struct {
-		Name string `json:"name"`
+func (o *Ollama) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	return o.chat(ctx, history, tools, nil)
+}
+
+// ChatStream streams content and thinking as they are generated. Ollama
+// sends tool calls whole, so they are only reported in the returned message.
+func (o *Ollama) ChatStream(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	if onDelta == nil {
+		onDelta = func(core.StreamDelta) {}
+	}
+	return o.chat(ctx, history, tools, onDelta)
+}
+
+func (o *Ollama) chat(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	send := o.doRequest
+	if onDelta != nil {
+		send = o.doStream
+	}
+	resp, err := send(ctx, http.MethodPost, "/api/chat", o.buildPayload(ctx, history, tools, onDelta != nil), o.headers())
+	if err != nil {
+		return core.Message{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return core.Message{}, newAPIError(resp.StatusCode, data)
 	}
-	type ollamaResponse struct {
-		Models []ollamaTag `json:"models"`
+
+	// A streamed answer is a JSON object per line, else a single one
+	var acc ollamaAccumulator
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var chunk ollamaChunk
+		if err := dec.Decode(&chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return core.Message{}, fmt.Errorf("read stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return core.Message{}, fmt.Errorf("ollama: %s", chunk.Error)
+		}
+
+		acc.add(chunk)
+		if onDelta != nil && (chunk.Message.Content != "" || chunk.Message.Thinking != "") {
+			onDelta(core.StreamDelta{Content: chunk.Message.Content, Reasoning: chunk.Message.Thinking})
+		}
+		if chunk.Done {
+			return acc.message(), nil
+		}
 	}
+	return core.Message{}, fmt.Errorf("ollama ended the answer early: %w", errStreamEnded)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", o.baseURL+"/api/tags", nil)
+func (o *Ollama) buildPayload(ctx context.Context, history []core.Message, tools []core.Tool, stream bool) map[string]any {
+	payload := map[string]any{
+		"model":    o.model,
+		"messages": o.toOllamaMessages(history),
+		"stream":   stream,
+	}
+	if len(tools) > 0 {
+		payload["tools"] = tools
+	}
+	if o.options.KeepAlive != "" {
+		payload["keep_alive"] = o.options.KeepAlive
+	}
+	if o.options.Think != nil {
+		payload["think"] = o.options.Think
+	}
+
+	options := make(map[string]any)
+	if n := o.numCtx(ctx); n > 0 {
+		options["num_ctx"] = n
+	}
+	opts := core.ChatOptionsFromCtx(ctx)
+	if opts.Temperature != nil {
+		options["temperature"] = *opts.Temperature
+	}
+	if opts.MaxTokens > 0 {
+		options["num_predict"] = opts.MaxTokens
+	}
+	if len(options) > 0 {
+		payload["options"] = options
+	}
+	return payload
+}
+
+// numCtx returns the context size the model is run with: the configured
+// one, else the one of its Modelfile, else the default capped at the size
+// the model was trained with. It is 0 if Ollama's default applies.
+func (o *Ollama) numCtx(ctx context.Context) int {
+	if o.options.NumCtx > 0 {
+		return o.options.NumCtx
+	}
+
+	show, err := o.show(ctx, o.model)
 	if err != nil {
+		return o.defaultNumCtx
+	}
+	if n := show.numCtx(); n > 0 {
+		return n
+	}
+	if trained := show.contextLength(); trained > 0 && (o.defaultNumCtx == 0 || trained < o.defaultNumCtx) {
+		return trained
+	}
+	return o.defaultNumCtx
+}
+
+func (o *Ollama) headers() map[string]string {
+	if o.apiKey == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + o.apiKey}
+}
+
+// ollamaMessage is a message of Ollama's chat API. Arguments of tool calls
+// are JSON objects, and tool results name the tool instead of the call.
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// toOllamaMessages maps the history onto chat messages. Images of user
+// messages and tool results are sent along; other parts are replaced with
+// placeholders.
+func (o *Ollama) toOllamaMessages(history []core.Message) []ollamaMessage {
+	messages := make([]ollamaMessage, 0, len(history))
+	names := make(map[string]string)
+
+	for _, m := range history {
+		msg := ollamaMessage{Role: m.Role, Content: m.Content}
+
+		for _, tc := range m.ToolCalls {
+			names[tc.ID] = tc.Function.Name
+			var call ollamaToolCall
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = toolInput(tc.Function.Arguments)
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		}
+		if m.Role == core.RoleTool {
+			msg.ToolName = names[m.ToolCallID]
+		}
+
+		var placeholders []core.ContentPart
+		for _, p := range m.Parts {
+			if p.Type != core.PartImage || (m.Role != core.RoleUser && m.Role != core.RoleTool) {
+				placeholders = append(placeholders, p)
+				continue
+			}
+			data, err := o.partData(p)
+			if err != nil {
+				msg.Content = withPlaceholders(msg.Content, []core.ContentPart{p}, err.Error())
+				continue
+			}
+			msg.Images = append(msg.Images, base64.StdEncoding.EncodeToString(data))
+		}
+		if len(placeholders) > 0 {
+			msg.Content = withPlaceholders(msg.Content, placeholders, "the model cannot take it")
+		}
+
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// ollamaChunk is a line of a streamed answer, or the whole answer.
+type ollamaChunk struct {
+	Message struct {
+		Content   string           `json:"content"`
+		Thinking  string           `json:"thinking"`
+		ToolCalls []ollamaToolCall `json:"tool_calls"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+// ollamaAccumulator assembles the chunks of an answer.
+type ollamaAccumulator struct {
+	content   strings.Builder
+	thinking  strings.Builder
+	toolCalls []core.ToolCall
+	usage     *core.Usage
+}
+
+func (a *ollamaAccumulator) add(chunk ollamaChunk) {
+	a.content.WriteString(chunk.Message.Content)
+	a.thinking.WriteString(chunk.Message.Thinking)
+
+	// Ollama does not give calls an ID
+	for _, tc := range chunk.Message.ToolCalls {
+		a.toolCalls = append(a.toolCalls, core.ToolCall{
+			ID:       "call_" + rand.Text(),
+			Type:     "function",
+			Function: core.FunctionCall{Name: tc.Function.Name, Arguments: string(toolInput(string(tc.Function.Arguments)))},
+		})
+	}
+
+	if chunk.Done {
+		a.usage = &core.Usage{
+			PromptTokens:     chunk.PromptEvalCount,
+			CompletionTokens: chunk.EvalCount,
+		}
+	}
+}
+
+func (a *ollamaAccumulator) message() core.Message {
+	return core.Message{
+		Role:      core.RoleAssistant,
+		Content:   a.content.String(),
+		Reasoning: a.thinking.String(),
+		ToolCalls: a.toolCalls,
+		Usage:     a.usage,
+	}
+}
+
+func (o *Ollama) Models(ctx context.Context) ([]core.Model, error) {
+	resp, err := o.api(ctx, ollamaInfoTimeout, http.MethodGet, "/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
 	}
 
-	if o.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	models := make([]core.Model, 0, len(result.Models))
+	for _, m := range result.Models {
+		models = append(models, core.Model{ID: m.Name, Name: m.Name})
 	}
+	return models, nil
+}
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
+// ModelCapabilities looks a model up, since the model list does not tell
+// what a model can do. The context window is the context size the model is
+// run with.
+func (o *Ollama) ModelCapabilities(ctx context.Context, model string) (core.Capabilities, error) {
+	show, err := o.show(ctx, model)
 	if err != nil {
-		return nil, fmt.Errorf("ollama not available: %w", err)
+		return core.Capabilities{}, err
+	}
+
+	caps := core.Capabilities{ContextWindow: show.numCtx()}
+	if model == o.model {
+		caps.ContextWindow = o.numCtx(ctx)
+	}
+	if caps.ContextWindow == 0 {
+		caps.ContextWindow = show.contextLength()
+	}
+
+	// Older servers do not report capabilities
+	if len(show.Capabilities) > 0 {
+		caps.Tools = flag(slices.Contains(show.Capabilities, "tools"))
+		caps.Vision = flag(slices.Contains(show.Capabilities, "vision"))
+		caps.Reasoning = flag(slices.Contains(show.Capabilities, "thinking"))
+	}
+	return caps, nil
+}
+
+// ollamaShow is the part of /api/show that is used.
+type ollamaShow struct {
+	Capabilities []string       `json:"capabilities"`
+	ModelInfo    map[string]any `json:"model_info"`
+	Parameters   string         `json:"parameters"`
+}
+
+// contextLength returns the context size the model was trained with.
+func (s ollamaShow) contextLength() int {
+	for key, v := range s.ModelInfo {
+		if n, ok := v.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+// numCtx returns the num_ctx of the model's parameters, one "name value"
+// pair per line, or 0 if it sets none.
+func (s ollamaShow) numCtx() int {
+	for _, line := range strings.Split(s.Parameters, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "num_ctx" {
+			n, _ := strconv.Atoi(fields[1])
+			return n
+		}
+	}
+	return 0
+}
+
+// show looks a model up. The result for the provider's own model, or the
+// failure to get it, is cached for the lifetime of the provider.
+func (o *Ollama) show(ctx context.Context, model string) (ollamaShow, error) {
+	if model != o.model {
+		return o.fetchShow(ctx, model)
+	}
+
+	o.showOnce.Do(func() {
+		o.shown, o.showErr = o.fetchShow(context.WithoutCancel(ctx), model)
+		if o.showErr != nil {
+			log.FromCtx(ctx).Warn().Err(o.showErr).Str("model", model).Msg("failed to look up ollama model, using the default context size")
+		}
+	})
+	return o.shown, o.showErr
+}
+
+func (o *Ollama) fetchShow(ctx context.Context, model string) (ollamaShow, error) {
+	resp, err := o.api(ctx, ollamaInfoTimeout, http.MethodPost, "/api/show", map[string]string{"model": model})
+	if err != nil {
+		return ollamaShow{}, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("ollama returned status %d", resp.StatusCode)
+	var show ollamaShow
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return ollamaShow{}, err
+	}
+	return show, nil
+}
+
+// PullModel downloads a model, reporting each step of the download.
+func (o *Ollama) PullModel(ctx context.Context, name string, onProgress func(core.PullProgress)) error {
+	// A download may take long, so only ctx bounds it
+	resp, err := o.api(ctx, 0, http.MethodPost, "/api/pull", map[string]any{"model": name, "stream": true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var step struct {
+			Status    string `json:"status"`
+			Total     int64  `json:"total"`
+			Completed int64  `json:"completed"`
+			Error     string `json:"error"`
+		}
+		if err := dec.Decode(&step); err == io.EOF {
+			return fmt.Errorf("ollama ended the download early")
+		} else if err != nil {
+			return fmt.Errorf("read progress: %w", err)
+		}
+
+		if step.Error != "" {
+			return fmt.Errorf("ollama: %s", step.Error)
+		}
+		if step.Status == "success" {
+			return nil
+		}
+		if onProgress != nil {
+			onProgress(core.PullProgress{Status: step.Status, Total: step.Total, Completed: step.Completed})
+		}
+	}
+}
+
+// DeleteModel removes a downloaded model.
+func (o *Ollama) DeleteModel(ctx context.Context, name string) error {
+	resp, err := o.api(ctx, ollamaInfoTimeout, http.MethodDelete, "/api/delete", map[string]string{"model": name})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// RunningModels lists the models Ollama has loaded.
+func (o *Ollama) RunningModels(ctx context.Context) ([]core.RunningModel, error) {
+	resp, err := o.api(ctx, ollamaInfoTimeout, http.MethodGet, "/api/ps", nil)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	var result ollamaResponse
+	var result struct {
+		Models []struct {
+			Name          string    `json:"name"`
+			Size          int64     `json:"size"`
+			SizeVRAM      int64     `json:"size_vram"`
+			ContextLength int       `json:"context_length"`
+			ExpiresAt     time.Time `json:"expires_at"`
+		} `json:"models"`
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
 	}
 
-	models := make([]core.Model, 0, len(result.Models))
+	models := make([]core.RunningModel, 0, len(result.Models))
 	for _, m := range result.Models {
-		models = append(models, core.Model{
-			ID:            m.Name,
+		models = append(models, core.RunningModel{
 			Name:          m.Name,
-			ContextLength: 32768,
+			Size:          m.Size,
+			VRAM:          m.SizeVRAM,
+			ContextLength: m.ContextLength,
+			ExpiresAt:     m.ExpiresAt,
 		})
 	}
 	return models, nil
 }
+
+// api calls an endpoint of the Ollama API other than chat, bypassing the
+// rate limiter. A timeout of 0 leaves the request bounded by ctx alone.
+func (o *Ollama) api(ctx context.Context, timeout time.Duration, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("marshal: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, o.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range o.headers() {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ollama not available: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("ollama returned status %d: %s", resp.StatusCode, apiErr.Error)
+		}
+		return nil, fmt.Errorf("ollama returned status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
@@ -0,0 +1,305 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOllama_ChatStream(t *testing.T) {
+	image := filepath.Join(t.TempDir(), "a.png")
+	require.NoError(t, os.WriteFile(image, []byte("png"), 0600))
+
+	var payload struct {
+		Model     string          `json:"model"`
+		Messages  []ollamaMessage `json:"messages"`
+		Tools     []core.Tool     `json:"tools"`
+		Stream    bool            `json:"stream"`
+		KeepAlive string          `json:"keep_alive"`
+		Think     any             `json:"think"`
+		Options   map[string]any  `json:"options"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/show":
+			fmt.Fprint(w, `{"model_info": {"qwen3.context_length": 40960}}`)
+		case "/api/chat":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+			for _, line := range []string{
+				`{"message": {"role": "assistant", "content": "", "thinking": "The user wants"}, "done": false}`,
+				`{"message": {"role": "assistant", "content": "Let me "}, "done": false}`,
+				`{"message": {"role": "assistant", "content": "look."}, "done": false}`,
+				`{"message": {"role": "assistant", "content": "", "tool_calls": [{"function": {"name": "read_file", "arguments": {"path": "b.txt"}}}]}, "done": false}`,
+				`{"message": {"role": "assistant", "content": ""}, "done": true, "prompt_eval_count": 120, "eval_count": 30}`,
+			} {
+				fmt.Fprintln(w, line)
+			}
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	o := NewOllama(OllamaConfig{
+		BaseURL:       srv.URL,
+		Model:         "qwen3:8b",
+		Options:       OllamaOptions{KeepAlive: "30m", Think: false},
+		DefaultNumCtx: 8192,
+	})
+	o.setMediaPath(filepath.Dir(image))
+	history := []core.Message{
+		{Role: core.RoleUser, Content: "what is in the picture?", Parts: []core.ContentPart{{Type: core.PartImage, MediaType: "image/png", Path: image}}},
+		{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{{ID: "call_1", Function: core.FunctionCall{Name: "read_file", Arguments: `{"path":"a.txt"}`}}}},
+		{Role: core.RoleTool, ToolCallID: "call_1", Content: "hello", Parts: []core.ContentPart{{Type: core.PartAudio, MediaType: "audio/wav", Path: "/media/a.wav"}}},
+	}
+	tools := []core.Tool{{Type: "function", Function: core.Function{Name: "read_file"}}}
+
+	var content, reasoning strings.Builder
+	msg, err := o.ChatStream(context.Background(), history, tools, func(d core.StreamDelta) {
+		content.WriteString(d.Content)
+		reasoning.WriteString(d.Reasoning)
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "qwen3:8b", payload.Model)
+	assert.True(t, payload.Stream)
+	assert.Equal(t, "30m", payload.KeepAlive)
+	assert.Equal(t, false, payload.Think)
+	assert.Equal(t, float64(8192), payload.Options["num_ctx"], "the default is below the trained size")
+	require.Len(t, payload.Tools, 1)
+
+	require.Len(t, payload.Messages, 3)
+	assert.Equal(t, []string{"cG5n"}, payload.Messages[0].Images)
+	assert.JSONEq(t, `{"path":"a.txt"}`, string(payload.Messages[1].ToolCalls[0].Function.Arguments))
+	assert.Equal(t, "read_file", payload.Messages[2].ToolName)
+	assert.Equal(t, "hello\n[audio audio/wav at /media/a.wav: the model cannot take it]", payload.Messages[2].Content)
+
+	assert.Equal(t, "Let me look.", content.String())
+	assert.Equal(t, "The user wants", reasoning.String())
+	assert.Equal(t, "Let me look.", msg.Content)
+	assert.Equal(t, "The user wants", msg.Reasoning)
+	require.Len(t, msg.ToolCalls, 1)
+	assert.Equal(t, "read_file", msg.ToolCalls[0].Function.Name)
+	assert.JSONEq(t, `{"path": "b.txt"}`, msg.ToolCalls[0].Function.Arguments)
+	assert.NotEmpty(t, msg.ToolCalls[0].ID)
+	assert.Equal(t, &core.Usage{PromptTokens: 120, CompletionTokens: 30}, msg.Usage)
+}
+
+func TestOllama_Chat_RejectedTools(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/show" {
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error": "registry.ollama.ai/library/gemma:2b does not support tools"}`)
+	}))
+	defer srv.Close()
+
+	_, err := NewOllama(OllamaConfig{BaseURL: srv.URL, Model: "gemma:2b"}).Chat(context.Background(), nil, nil)
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrBadRequest, apiErr.Class)
+}
+
+func TestOllama_Chat_ShowFailureCached(t *testing.T) {
+	var shows int
+	var numCtx []any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/show":
+			shows++
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/api/chat":
+			var payload struct {
+				Options map[string]any `json:"options"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+			numCtx = append(numCtx, payload.Options["num_ctx"])
+			fmt.Fprint(w, `{"message": {"role": "assistant", "content": "hi"}, "done": true}`)
+		}
+	}))
+	defer srv.Close()
+
+	o := NewOllama(OllamaConfig{BaseURL: srv.URL, Model: "qwen3:8b", DefaultNumCtx: 8192})
+	for range 2 {
+		_, err := o.Chat(context.Background(), nil, nil)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, shows, "a failed lookup is not repeated")
+	assert.Equal(t, []any{float64(8192), float64(8192)}, numCtx)
+}
+
+func TestOllama_ChatStream_EndedEarly(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/show" {
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": "Let me "}, "done": false}`)
+	}))
+	defer srv.Close()
+
+	o := NewOllama(OllamaConfig{BaseURL: srv.URL, Model: "qwen3:8b"})
+	_, err := o.ChatStream(context.Background(), nil, nil, nil)
+	assert.ErrorContains(t, err, "ended the answer early")
+}
+
+func TestOllama_ModelCapabilities(t *testing.T) {
+	tests := []struct {
+		name          string
+		show          string
+		defaultNumCtx int
+		want          core.Capabilities
+	}{
+		{
+			name: "trained context",
+			show: `{"capabilities": ["completion", "tools", "thinking"], "model_info": {"general.architecture": "qwen3", "qwen3.context_length": 40960}}`,
+			want: core.Capabilities{ContextWindow: 40960, Tools: flag(true), Vision: flag(false), Reasoning: flag(true)},
+		},
+		{
+			name:          "default context",
+			show:          `{"capabilities": ["completion", "tools"], "model_info": {"qwen3.context_length": 40960}}`,
+			defaultNumCtx: 8192,
+			want:          core.Capabilities{ContextWindow: 8192, Tools: flag(true), Vision: flag(false), Reasoning: flag(false)},
+		},
+		{
+			name:          "num_ctx",
+			show:          `{"capabilities": ["completion", "vision"], "parameters": "stop \"<end_of_turn>\"\nnum_ctx 16384", "model_info": {"gemma3.context_length": 131072}}`,
+			defaultNumCtx: 8192,
+			want:          core.Capabilities{ContextWindow: 16384, Tools: flag(false), Vision: flag(true), Reasoning: flag(false)},
+		},
+		{
+			name: "old server",
+			show: `{"model_info": {"llama.context_length": 4096}}`,
+			want: core.Capabilities{ContextWindow: 4096},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotModel string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/show", r.URL.Path)
+				var body struct{ Model string }
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				gotModel = body.Model
+				fmt.Fprint(w, tt.show)
+			}))
+			defer srv.Close()
+
+			o := NewOllama(OllamaConfig{BaseURL: srv.URL, Model: "qwen3:8b", DefaultNumCtx: tt.defaultNumCtx})
+			caps, err := o.ModelCapabilities(context.Background(), "qwen3:8b")
+			require.NoError(t, err)
+			assert.Equal(t, "qwen3:8b", gotModel)
+			assert.Equal(t, tt.want, caps)
+		})
+	}
+}
+
+func TestOllama_PullModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		wantErr string
+		want    []core.PullProgress
+	}{
+		{
+			name: "success",
+			lines: []string{
+				`{"status": "pulling manifest"}`,
+				`{"status": "pulling 6a0746a1ec1a", "digest": "sha256:6a0746a1ec1a", "total": 1000, "completed": 250}`,
+				`{"status": "pulling 6a0746a1ec1a", "digest": "sha256:6a0746a1ec1a", "total": 1000, "completed": 1000}`,
+				`{"status": "success"}`,
+			},
+			want: []core.PullProgress{
+				{Status: "pulling manifest"},
+				{Status: "pulling 6a0746a1ec1a", Total: 1000, Completed: 250},
+				{Status: "pulling 6a0746a1ec1a", Total: 1000, Completed: 1000},
+			},
+		},
+		{
+			name:    "error",
+			lines:   []string{`{"status": "pulling manifest"}`, `{"error": "pull model manifest: file does not exist"}`},
+			wantErr: "file does not exist",
+			want:    []core.PullProgress{{Status: "pulling manifest"}},
+		},
+		{
+			name:    "cut off",
+			lines:   []string{`{"status": "pulling manifest"}`},
+			wantErr: "ended the download early",
+			want:    []core.PullProgress{{Status: "pulling manifest"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/pull", r.URL.Path)
+				for _, line := range tt.lines {
+					fmt.Fprintln(w, line)
+				}
+			}))
+			defer srv.Close()
+
+			var got []core.PullProgress
+			err := NewOllama(OllamaConfig{BaseURL: srv.URL}).PullModel(context.Background(), "qwen3:8b", func(p core.PullProgress) {
+				got = append(got, p)
+			})
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestOllama_DeleteModel_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error": "model 'qwen3:8b' not found"}`)
+	}))
+	defer srv.Close()
+
+	err := NewOllama(OllamaConfig{BaseURL: srv.URL}).DeleteModel(context.Background(), "qwen3:8b")
+	assert.EqualError(t, err, "ollama returned status 404: model 'qwen3:8b' not found")
+}
+
+func TestLoadOllamaOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	table, err := loadOllamaOptions(filepath.Join(dir, "missing.json"))
+	require.NoError(t, err)
+	assert.Empty(t, table)
+
+	path := filepath.Join(dir, "ollama.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"": {"keep_alive": "10m", "num_ctx": 8192},
+		"qwen3": {"num_ctx": 32768, "think": false},
+		"gpt-oss": {"think": "high"}
+	}`), 0600))
+	table, err = loadOllamaOptions(path)
+	require.NoError(t, err)
+	assert.Equal(t, OllamaOptions{NumCtx: 32768, KeepAlive: "10m", Think: false}, table.Match("qwen3:8b"))
+	assert.Equal(t, OllamaOptions{NumCtx: 8192, KeepAlive: "10m", Think: "high"}, table.Match("gpt-oss:20b"))
+	assert.Equal(t, OllamaOptions{NumCtx: 8192, KeepAlive: "10m"}, table.Match("gemma3"))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"qwen3": {"think": "max"}}`), 0600))
+	_, err = loadOllamaOptions(path)
+	assert.ErrorContains(t, err, "think must be")
+}
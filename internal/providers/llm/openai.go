@@ -24,6 +24,7 @@ func NewOpenAI(apiKey, model string) *OpenAI {
 			Model:      model,
 			AuthHeader: "Authorization",
 			AuthPrefix: "Bearer ",
+			PartTypes:  []string{core.PartImage, core.PartAudio, core.PartFile},
 		}),
 	}
 }
@@ -45,7 +46,7 @@ func (o *OpenAI) Models(ctx context.Context) ([]core.Model, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http %d: %s", resp.StatusCode, string(data))
+		return nil, newAPIError(resp.StatusCode, data)
 	}
 
 	var apiResp struct {
@@ -2,19 +2,25 @@ package llm
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
 
 	"github.com/sandevgo/tuskbot/internal/core"
 )
 
 type OpenAICompatible struct {
 	baseProvider
-	authHeader   string
-	authPrefix   string
-	extraHeaders map[string]string
+	authHeader      string
+	authPrefix      string
+	extraHeaders    map[string]string
+	nestedReasoning bool
+	partTypes       []string
 }
 
 type OpenAICompatibleConfig struct {
@@ -24,26 +30,255 @@ type OpenAICompatibleConfig struct {
 	AuthHeader   string // e.g., "Authorization"
 	AuthPrefix   string // e.g., "Bearer "
 	ExtraHeaders map[string]string
+
+	// NestedReasoning sends the reasoning effort as {"reasoning": {"effort": ...}}
+	// instead of "reasoning_effort", as OpenRouter expects.
+	NestedReasoning bool
+
+	// PartTypes are the content part types the API accepts besides text.
+	// Other parts are replaced with a text placeholder.
+	PartTypes []string
 }
 
 func NewOpenAICompatible(cfg OpenAICompatibleConfig) *OpenAICompatible {
 	return &OpenAICompatible{
-		baseProvider: newBaseProvider(cfg.BaseURL, cfg.APIKey, cfg.Model),
-		authHeader:   cfg.AuthHeader,
-		authPrefix:   cfg.AuthPrefix,
-		extraHeaders: cfg.ExtraHeaders,
+		baseProvider:    newBaseProvider(cfg.BaseURL, cfg.APIKey, cfg.Model),
+		authHeader:      cfg.AuthHeader,
+		authPrefix:      cfg.AuthPrefix,
+		extraHeaders:    cfg.ExtraHeaders,
+		nestedReasoning: cfg.NestedReasoning,
+		partTypes:       cfg.PartTypes,
 	}
 }
 
 func (o *OpenAICompatible) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	resp, err := o.doRequest(ctx, http.MethodPost, "/v1/chat/completions", o.buildPayload(ctx, history, tools), o.headers())
+	if err != nil {
+		return core.Message{}, err
+	}
+	defer resp.Body.Close()
+
+	msg, err := parseOpenAIResponse(resp)
+	if err != nil {
+		return core.Message{}, err
+	}
+	o.logCache(ctx, msg)
+	return msg, nil
+}
+
+// ChatStream requests a streamed completion and reports content as it arrives.
+// Tool call arguments are assembled from their fragments before returning.
+func (o *OpenAICompatible) ChatStream(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	payload := o.buildPayload(ctx, history, tools)
+	payload["stream"] = true
+	payload["stream_options"] = map[string]any{"include_usage": true}
+
+	resp, err := o.doStream(ctx, http.MethodPost, "/v1/chat/completions", payload, o.headers())
+	if err != nil {
+		return core.Message{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return core.Message{}, newAPIError(resp.StatusCode, data)
+	}
+
+	acc := newOpenAIStreamAccumulator()
+	err = readSSE(resp.Body, func(_, data string) error {
+		if data == "[DONE]" {
+			return io.EOF
+		}
+
+		delta, err := acc.add(data)
+		if err != nil {
+			return err
+		}
+		if onDelta != nil && (delta.Content != "" || delta.Reasoning != "") {
+			onDelta(delta)
+		}
+		return nil
+	})
+	if err != nil {
+		return core.Message{}, fmt.Errorf("read stream: %w", err)
+	}
+
+	msg, err := acc.message()
+	if err != nil {
+		return core.Message{}, err
+	}
+	o.logCache(ctx, msg)
+	return msg, nil
+}
+
+// logCache reports prompt cache hits. OpenAI and OpenRouter cache long
+// prompt prefixes automatically, which requires the system prompt and the
+// tools to be sent in the same order with every request.
+func (o *OpenAICompatible) logCache(ctx context.Context, msg core.Message) {
+	if msg.Usage != nil {
+		logCache(ctx, o.model, msg.Usage).Msg("prompt cache")
+	}
+}
+
+func (o *OpenAICompatible) buildPayload(ctx context.Context, history []core.Message, tools []core.Tool) map[string]any {
 	payload := map[string]any{
 		"model":    o.model,
-		"messages": history,
+		"messages": o.toOpenAIMessages(history),
 	}
 	if len(tools) > 0 {
 		payload["tools"] = tools
 	}
 
+	opts := core.ChatOptionsFromCtx(ctx)
+	if opts.Temperature != nil {
+		payload["temperature"] = *opts.Temperature
+	}
+	if opts.MaxTokens > 0 {
+		payload["max_tokens"] = opts.MaxTokens
+	}
+	if opts.ReasoningEffort != "" {
+		if o.nestedReasoning {
+			payload["reasoning"] = map[string]any{"effort": opts.ReasoningEffort}
+		} else {
+			payload["reasoning_effort"] = opts.ReasoningEffort
+		}
+	}
+	return payload
+}
+
+// openAIMessage is a chat message with content parts.
+type openAIMessage struct {
+	Role       string          `json:"role"`
+	Content    []openAIPart    `json:"content"`
+	ToolCalls  []core.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+type openAIPart struct {
+	Type       string            `json:"type"`
+	Text       string            `json:"text,omitempty"`
+	ImageURL   *openAIImageURL   `json:"image_url,omitempty"`
+	InputAudio *openAIInputAudio `json:"input_audio,omitempty"`
+	File       *openAIFile       `json:"file,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAIInputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"`
+}
+
+type openAIFile struct {
+	Filename string `json:"filename"`
+	FileData string `json:"file_data"`
+}
+
+// openAIAudioFormats are the audio formats of input_audio parts.
+var openAIAudioFormats = map[string]string{
+	"audio/wav":   "wav",
+	"audio/x-wav": "wav",
+	"audio/wave":  "wav",
+	"audio/mpeg":  "mp3",
+	"audio/mp3":   "mp3",
+}
+
+// toOpenAIMessages maps the history onto chat messages. Messages without
+// content parts are sent as they are. Only user messages may carry media,
+// so the parts of tool results follow them in a user message.
+func (o *OpenAICompatible) toOpenAIMessages(history []core.Message) []any {
+	messages := make([]any, 0, len(history))
+	var attachments []openAIPart
+	flush := func() {
+		if len(attachments) > 0 {
+			messages = append(messages, openAIMessage{
+				Role:    core.RoleUser,
+				Content: append([]openAIPart{{Type: "text", Text: "Attachments of the tool results above:"}}, attachments...),
+			})
+			attachments = nil
+		}
+	}
+
+	for _, m := range history {
+		if m.Role != core.RoleTool {
+			flush()
+		}
+		if len(m.Parts) == 0 {
+			messages = append(messages, m)
+			continue
+		}
+
+		switch {
+		case len(o.partTypes) == 0:
+			m.Content = withPlaceholders(m.Content, m.Parts, "the model cannot take it")
+		case m.Role == core.RoleUser:
+			messages = append(messages, openAIMessage{Role: m.Role, Content: o.toOpenAIParts(m.Content, m.Parts)})
+			continue
+		case m.Role == core.RoleTool:
+			attachments = append(attachments, o.toOpenAIParts("", m.Parts)...)
+		default:
+			m.Content = withPlaceholders(m.Content, m.Parts, "only user messages can carry it")
+		}
+		m.Parts = nil
+		messages = append(messages, m)
+	}
+	flush()
+
+	return messages
+}
+
+func (o *OpenAICompatible) toOpenAIParts(text string, parts []core.ContentPart) []openAIPart {
+	var result []openAIPart
+	if text != "" {
+		result = append(result, openAIPart{Type: "text", Text: text})
+	}
+	for _, p := range parts {
+		result = append(result, o.toOpenAIPart(p))
+	}
+	return result
+}
+
+// toOpenAIPart encodes a part, or describes it in text when the API does
+// not accept it.
+func (o *OpenAICompatible) toOpenAIPart(p core.ContentPart) openAIPart {
+	placeholder := func(reason string) openAIPart {
+		return openAIPart{Type: "text", Text: p.Placeholder(reason)}
+	}
+
+	if p.Type == core.PartText {
+		return openAIPart{Type: "text", Text: p.Text}
+	}
+	if !slices.Contains(o.partTypes, p.Type) {
+		return placeholder("the model cannot take it")
+	}
+	data, err := o.partData(p)
+	if err != nil {
+		return placeholder(err.Error())
+	}
+
+	switch p.Type {
+	case core.PartImage:
+		return openAIPart{Type: "image_url", ImageURL: &openAIImageURL{URL: dataURL(p.MediaType, data)}}
+	case core.PartAudio:
+		format, ok := openAIAudioFormats[p.MediaType]
+		if !ok {
+			return placeholder("only wav and mp3 audio is supported")
+		}
+		return openAIPart{Type: "input_audio", InputAudio: &openAIInputAudio{
+			Data:   base64.StdEncoding.EncodeToString(data),
+			Format: format,
+		}}
+	default:
+		return openAIPart{Type: "file", File: &openAIFile{
+			Filename: filepath.Base(p.Path),
+			FileData: dataURL(p.MediaType, data),
+		}}
+	}
+}
+
+func (o *OpenAICompatible) headers() map[string]string {
 	headers := make(map[string]string)
 	if o.authHeader != "" && o.apiKey != "" {
 		headers[o.authHeader] = o.authPrefix + o.apiKey
@@ -51,14 +286,7 @@ func (o *OpenAICompatible) Chat(ctx context.Context, history []core.Message, too
 	for k, v := range o.extraHeaders {
 		headers[k] = v
 	}
-
-	resp, err := o.doRequest(ctx, http.MethodPost, "/v1/chat/completions", payload, headers)
-	if err != nil {
-		return core.Message{}, err
-	}
-	defer resp.Body.Close()
-
-	return parseOpenAIResponse(resp)
+	return headers
 }
 
 func parseOpenAIResponse(resp *http.Response) (core.Message, error) {
@@ -68,13 +296,14 @@ func parseOpenAIResponse(resp *http.Response) (core.Message, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return core.Message{}, fmt.Errorf("http %d: %s", resp.StatusCode, string(data))
+		return core.Message{}, newAPIError(resp.StatusCode, data)
 	}
 
 	var result struct {
 		Choices []struct {
 			Message core.Message `json:"message"`
 		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
 	}
 	if err := json.Unmarshal(data, &result); err != nil {
 		return core.Message{}, fmt.Errorf("decode: %w", err)
@@ -82,5 +311,144 @@ func parseOpenAIResponse(resp *http.Response) (core.Message, error) {
 	if len(result.Choices) == 0 {
 		return core.Message{}, fmt.Errorf("empty choices: %s", string(data))
 	}
-	return result.Choices[0].Message, nil
+
+	msg := result.Choices[0].Message
+	msg.Usage = result.Usage.toUsage()
+	return msg, nil
+}
+
+// openAIUsage is the usage block of chat completions. OpenRouter adds the
+// cost of the request.
+type openAIUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	CompletionTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details"`
+	Cost float64 `json:"cost"`
+}
+
+func (u *openAIUsage) toUsage() *core.Usage {
+	if u == nil {
+		return nil
+	}
+	return &core.Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		CachedTokens:     u.PromptTokensDetails.CachedTokens,
+		ReasoningTokens:  u.CompletionTokensDetails.ReasoningTokens,
+		Cost:             u.Cost,
+	}
+}
+
+// openAIStreamAccumulator assembles chat completion chunks into a message.
+type openAIStreamAccumulator struct {
+	content   []byte
+	reasoning []byte
+	toolCalls map[int]*core.ToolCall
+	usage     *openAIUsage
+	// finished is set by the chunk with a finish reason
+	finished bool
+}
+
+func newOpenAIStreamAccumulator() *openAIStreamAccumulator {
+	return &openAIStreamAccumulator{
+		toolCalls: make(map[int]*core.ToolCall),
+	}
+}
+
+func (a *openAIStreamAccumulator) add(data string) (core.StreamDelta, error) {
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content          string `json:"content"`
+				Reasoning        string `json:"reasoning"`
+				ReasoningContent string `json:"reasoning_content"`
+				ToolCalls        []struct {
+					Index    int    `json:"index"`
+					ID       string `json:"id"`
+					Type     string `json:"type"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"delta"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return core.StreamDelta{}, fmt.Errorf("decode chunk: %w", err)
+	}
+	if chunk.Error != nil {
+		return core.StreamDelta{}, fmt.Errorf("stream error: %s", chunk.Error.Message)
+	}
+	if chunk.Usage != nil {
+		// Sent with the last chunk when include_usage is set
+		a.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return core.StreamDelta{}, nil
+	}
+
+	if chunk.Choices[0].FinishReason != "" {
+		a.finished = true
+	}
+	d := chunk.Choices[0].Delta
+	delta := core.StreamDelta{
+		Content:   d.Content,
+		Reasoning: d.Reasoning + d.ReasoningContent,
+	}
+	a.content = append(a.content, delta.Content...)
+	a.reasoning = append(a.reasoning, delta.Reasoning...)
+
+	for _, tc := range d.ToolCalls {
+		call, ok := a.toolCalls[tc.Index]
+		if !ok {
+			call = &core.ToolCall{Type: "function"}
+			a.toolCalls[tc.Index] = call
+		}
+		if tc.ID != "" {
+			call.ID = tc.ID
+		}
+		if tc.Type != "" {
+			call.Type = tc.Type
+		}
+		call.Function.Name += tc.Function.Name
+		call.Function.Arguments += tc.Function.Arguments
+	}
+
+	return delta, nil
+}
+
+// message returns the assembled message, or an error if the stream ended
+// without a finish reason.
+func (a *openAIStreamAccumulator) message() (core.Message, error) {
+	if !a.finished {
+		return core.Message{}, errStreamEnded
+	}
+	msg := core.Message{
+		Role:      core.RoleAssistant,
+		Content:   string(a.content),
+		Reasoning: string(a.reasoning),
+		Usage:     a.usage.toUsage(),
+	}
+
+	indexes := make([]int, 0, len(a.toolCalls))
+	for i := range a.toolCalls {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	for _, i := range indexes {
+		msg.ToolCalls = append(msg.ToolCalls, *a.toolCalls[i])
+	}
+	return msg, nil
 }
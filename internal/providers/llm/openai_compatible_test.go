@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildPayload_ChatOptions(t *testing.T) {
+	temperature := 0.3
+	ctx := core.WithChatOptions(context.Background(), core.ChatOptions{
+		Temperature:     &temperature,
+		MaxTokens:       1024,
+		ReasoningEffort: "high",
+	})
+
+	openai := NewOpenAICompatible(OpenAICompatibleConfig{Model: "gpt"}).buildPayload(ctx, nil, nil)
+	assert.Equal(t, 0.3, openai["temperature"])
+	assert.Equal(t, 1024, openai["max_tokens"])
+	assert.Equal(t, "high", openai["reasoning_effort"])
+
+	openrouter := NewOpenRouter("key", "model").buildPayload(ctx, nil, nil)
+	assert.Equal(t, map[string]any{"effort": "high"}, openrouter["reasoning"])
+	assert.NotContains(t, openrouter, "reasoning_effort")
+
+	anthropic := NewAnthropic("key", "claude").buildPayload(ctx, nil, nil)
+	assert.Equal(t, 0.3, anthropic["temperature"])
+	assert.Equal(t, 1024, anthropic["max_tokens"])
+
+	defaults := NewAnthropic("key", "claude").buildPayload(context.Background(), nil, nil)
+	assert.Equal(t, anthropicMaxTokens, defaults["max_tokens"])
+	assert.NotContains(t, defaults, "temperature")
+}
+
+func TestBuildPayload_FailedToolResult(t *testing.T) {
+	history := []core.Message{
+		{Role: core.RoleUser, Content: "list files"},
+		{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{{ID: "call_1", Type: "function", Function: core.FunctionCall{Name: "ls", Arguments: "{}"}}}},
+		{Role: core.RoleTool, ToolCallID: "call_1", Content: "Error: permission denied", IsError: true},
+	}
+
+	payload := NewOpenAICompatible(OpenAICompatibleConfig{Model: "gpt"}).buildPayload(context.Background(), history, nil)
+	data, err := json.Marshal(payload)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "is_error")
+	assert.Contains(t, string(data), "permission denied")
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 
 	"github.com/sandevgo/tuskbot/internal/core"
 )
@@ -26,6 +27,8 @@ func NewOpenRouter(apiKey, model string) *OpenRouter {
 				"HTTP-Referer": core.TuskRepositoryURL,
 				"X-Title":      core.TuskName,
 			},
+			NestedReasoning: true,
+			PartTypes:       []string{core.PartImage, core.PartAudio, core.PartFile},
 		}),
 	}
 }
@@ -49,10 +52,44 @@ func (o *OpenRouter) Models(ctx context.Context) ([]core.Model, error) {
 	}
 
 	var result struct {
-		Data []core.Model `json:"data"`
+		Data []openRouterModel `json:"data"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, fmt.Errorf("decode: %w", err)
 	}
-	return result.Data, nil
+
+	models := make([]core.Model, 0, len(result.Data))
+	for _, m := range result.Data {
+		models = append(models, m.model())
+	}
+	return models, nil
+}
+
+// openRouterModel is an entry of OpenRouter's model list.
+type openRouterModel struct {
+	core.Model
+	TopProvider struct {
+		MaxCompletionTokens int `json:"max_completion_tokens"`
+	} `json:"top_provider"`
+	Architecture struct {
+		InputModalities []string `json:"input_modalities"`
+	} `json:"architecture"`
+	SupportedParameters []string `json:"supported_parameters"`
+}
+
+// model adds the capabilities the entry tells of to the model.
+func (m openRouterModel) model() core.Model {
+	model := m.Model
+	model.Capabilities = core.Capabilities{
+		ContextWindow:   m.ContextLength,
+		MaxOutputTokens: m.TopProvider.MaxCompletionTokens,
+	}
+	if len(m.SupportedParameters) > 0 {
+		model.Capabilities.Tools = flag(slices.Contains(m.SupportedParameters, "tools"))
+		model.Capabilities.Reasoning = flag(slices.Contains(m.SupportedParameters, "reasoning"))
+	}
+	if len(m.Architecture.InputModalities) > 0 {
+		model.Capabilities.Vision = flag(slices.Contains(m.Architecture.InputModalities, "image"))
+	}
+	return model
 }
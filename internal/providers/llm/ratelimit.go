@@ -0,0 +1,156 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/ratelimit"
+)
+
+// maxRetryAfter is the longest Retry-After that is waited for. Longer waits,
+// e.g. for a daily quota, fail the request so a fallback model can answer.
+const maxRetryAfter = time.Minute
+
+// limiters shares one rate limiter per provider between all of its models.
+type limiters struct {
+	cfg core.ProviderConfig
+
+	mu sync.Mutex
+	m  map[string]*ratelimit.Limiter
+}
+
+func newLimiters(cfg core.ProviderConfig) *limiters {
+	return &limiters{cfg: cfg, m: make(map[string]*ratelimit.Limiter)}
+}
+
+func (l *limiters) get(provider string) *ratelimit.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limiter, ok := l.m[provider]
+	if !ok {
+		limiter = ratelimit.New(ratelimit.Limits{
+			RequestsPerMinute: l.cfg.GetLLMRequestsPerMinute(),
+			TokensPerMinute:   l.cfg.GetLLMTokensPerMinute(),
+			Concurrency:       l.cfg.GetLLMConcurrency(),
+		})
+		l.m[provider] = limiter
+	}
+	return limiter
+}
+
+// rateLimitHeaders are the quota headers of a provider: remaining requests,
+// their reset, remaining tokens and their reset.
+var rateLimitHeaders = [][4]string{
+	// OpenAI and most compatible APIs, resets are durations like "6m0s"
+	{"x-ratelimit-remaining-requests", "x-ratelimit-reset-requests", "x-ratelimit-remaining-tokens", "x-ratelimit-reset-tokens"},
+	// Anthropic, resets are RFC 3339 times
+	{"anthropic-ratelimit-requests-remaining", "anthropic-ratelimit-requests-reset", "anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-tokens-reset"},
+	// OpenRouter, the reset is a Unix time in milliseconds
+	{"x-ratelimit-remaining", "x-ratelimit-reset", "", ""},
+}
+
+// parseRateLimit reads the quota a provider reports with a response.
+func parseRateLimit(h http.Header, now time.Time) ratelimit.State {
+	var state ratelimit.State
+	for _, names := range rateLimitHeaders {
+		if q := parseQuota(h, names[0], names[1], now); q != nil && state.Requests == nil {
+			state.Requests = q
+		}
+		if q := parseQuota(h, names[2], names[3], now); q != nil && state.Tokens == nil {
+			state.Tokens = q
+		}
+	}
+	return state
+}
+
+func parseQuota(h http.Header, remainingName, resetName string, now time.Time) *ratelimit.Quota {
+	if remainingName == "" {
+		return nil
+	}
+	remaining, err := strconv.Atoi(h.Get(remainingName))
+	if err != nil {
+		return nil
+	}
+	reset, ok := parseReset(h.Get(resetName), now)
+	if !ok {
+		return nil
+	}
+	return &ratelimit.Quota{Remaining: remaining, Reset: reset}
+}
+
+// parseReset accepts a duration, an RFC 3339 time or a Unix time in
+// milliseconds.
+func parseReset(value string, now time.Time) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d), true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), true
+	}
+	return time.Time{}, false
+}
+
+// retryAfter returns how long the provider asks to wait before retrying,
+// 0 if it does not say.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.Atoi(h.Get("retry-after-ms")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+
+	value := strings.TrimSpace(h.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if s, err := strconv.ParseFloat(value, 64); err == nil && s > 0 {
+		return time.Duration(s * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// base64String matches JSON strings holding base64 media, plain or as a
+// data URL.
+var base64String = regexp.MustCompile(`"(data:[^"]*;base64,)?[A-Za-z0-9+/=]{256,}"`)
+
+// estimateTokens roughly counts the tokens of a request body for the
+// tokens per minute limit. Media is left out, since its size says little
+// about the tokens it takes.
+func estimateTokens(body []byte) int {
+	return len(base64String.ReplaceAll(body, []byte(`""`))) / 4
+}
+
+// requestPriority lets interactive requests go before background work.
+func requestPriority(ctx context.Context) ratelimit.Priority {
+	if core.IsBackground(ctx) {
+		return ratelimit.Low
+	}
+	return ratelimit.High
+}
+
+// limitedBody frees the limiter slot of a request once its response,
+// possibly a stream, has been read.
+type limitedBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *limitedBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,178 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		wantRequests int
+		wantReset    time.Time
+		wantTokens   int
+	}{
+		{
+			name: "openai",
+			headers: map[string]string{
+				"x-ratelimit-remaining-requests": "59",
+				"x-ratelimit-reset-requests":     "1s",
+				"x-ratelimit-remaining-tokens":   "149000",
+				"x-ratelimit-reset-tokens":       "6m0s",
+			},
+			wantRequests: 59,
+			wantReset:    now.Add(time.Second),
+			wantTokens:   149000,
+		},
+		{
+			name: "anthropic",
+			headers: map[string]string{
+				"anthropic-ratelimit-requests-remaining": "49",
+				"anthropic-ratelimit-requests-reset":     "2026-01-01T12:00:30Z",
+				"anthropic-ratelimit-tokens-remaining":   "20000",
+				"anthropic-ratelimit-tokens-reset":       "2026-01-01T12:00:10Z",
+			},
+			wantRequests: 49,
+			wantReset:    now.Add(30 * time.Second),
+			wantTokens:   20000,
+		},
+		{
+			name: "openrouter",
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     "1767268860000",
+			},
+			wantRequests: 0,
+			wantReset:    now.Add(time.Minute),
+			wantTokens:   -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+
+			state := parseRateLimit(h, now)
+			require.NotNil(t, state.Requests)
+			assert.Equal(t, tt.wantRequests, state.Requests.Remaining)
+			assert.True(t, tt.wantReset.Equal(state.Requests.Reset), state.Requests.Reset)
+			if tt.wantTokens < 0 {
+				assert.Nil(t, state.Tokens)
+			} else {
+				require.NotNil(t, state.Tokens)
+				assert.Equal(t, tt.wantTokens, state.Tokens.Remaining)
+			}
+		})
+	}
+
+	assert.Nil(t, parseRateLimit(http.Header{}, now).Requests)
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+	}{
+		{"seconds", map[string]string{"Retry-After": "20"}, 20 * time.Second},
+		{"milliseconds", map[string]string{"retry-after-ms": "1500", "Retry-After": "2"}, 1500 * time.Millisecond},
+		{"http date", map[string]string{"Retry-After": "Thu, 01 Jan 2026 12:01:00 GMT"}, time.Minute},
+		{"missing", nil, 0},
+		{"invalid", map[string]string{"Retry-After": "soon"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			assert.Equal(t, tt.want, retryAfter(h, now))
+		})
+	}
+}
+
+func TestDoRequest_RetryAfter(t *testing.T) {
+	var calls []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, time.Now())
+		if len(calls) == 1 {
+			w.Header().Set("Retry-After", "0.5")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	b := newBaseProvider(srv.URL, "key", "model")
+	resp, err := b.doRequest(context.Background(), http.MethodGet, "/", nil, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Len(t, calls, 2)
+	assert.GreaterOrEqual(t, calls[1].Sub(calls[0]), 500*time.Millisecond)
+}
+
+func TestDoRequest_LongRetryAfterFails(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":"daily quota exceeded"}`))
+	}))
+	defer srv.Close()
+
+	b := newBaseProvider(srv.URL, "key", "model")
+	_, err := b.doRequest(context.Background(), http.MethodGet, "/", nil, nil)
+
+	require.Error(t, err)
+	assert.Equal(t, ErrQuota, Classify(err))
+	assert.Equal(t, 1, calls)
+}
+
+func TestEstimateTokens_SkipsMedia(t *testing.T) {
+	image := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 100_000))
+	text := strings.Repeat("describe this screenshot ", 40)
+
+	bodies := map[string]any{
+		"anthropic": map[string]any{"content": []any{
+			map[string]any{"type": "text", "text": text},
+			map[string]any{"type": "image", "source": map[string]any{"type": "base64", "media_type": "image/png", "data": image}},
+		}},
+		"openai": map[string]any{"content": []any{
+			map[string]any{"type": "text", "text": text},
+			map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/png;base64," + image}},
+		}},
+		"ollama": map[string]any{"content": text, "images": []string{image}},
+	}
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(body)
+			require.NoError(t, err)
+
+			tokens := estimateTokens(data)
+			assert.GreaterOrEqual(t, tokens, len(text)/4)
+			assert.Less(t, tokens, len(text)/4+100)
+		})
+	}
+}
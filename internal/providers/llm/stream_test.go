@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sseServer(t *testing.T, events []string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range events {
+			fmt.Fprint(w, ev+"\n\n")
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+func TestReadSSE(t *testing.T) {
+	input := ": keep-alive\n\nevent: ping\ndata: {}\n\ndata: line1\ndata: line2\n\ndata: tail"
+
+	type ev struct{ event, data string }
+	var got []ev
+	err := readSSE(strings.NewReader(input), func(event, data string) error {
+		got = append(got, ev{event, data})
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []ev{
+		{"ping", "{}"},
+		{"", "line1\nline2"},
+		{"", "tail"},
+	}, got)
+}
+
+func TestOpenAICompatible_ChatStream(t *testing.T) {
+	srv := sseServer(t, []string{
+		`data: {"choices":[{"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`data: {"choices":[{"delta":{"content":"lo","reasoning":"hmm"}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read_file","arguments":""}}]}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"list_directory","arguments":"{\"path\":"}}]}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"path\":\"a.txt\"}"}}]}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":1,"function":{"arguments":"\".\"}"}}]}}]}`,
+		`data: {"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+		`data: [DONE]`,
+	})
+	defer srv.Close()
+
+	p := NewOpenAICompatible(OpenAICompatibleConfig{BaseURL: srv.URL, Model: "test"})
+
+	var deltas []string
+	msg, err := p.ChatStream(context.Background(), []core.Message{{Role: core.RoleUser, Content: "hi"}}, nil,
+		func(d core.StreamDelta) { deltas = append(deltas, d.Content) })
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Hel", "lo"}, deltas)
+	assert.Equal(t, "Hello", msg.Content)
+	assert.Equal(t, "hmm", msg.Reasoning)
+	require.Len(t, msg.ToolCalls, 2)
+	assert.Equal(t, "call_1", msg.ToolCalls[0].ID)
+	assert.Equal(t, `{"path":"a.txt"}`, msg.ToolCalls[0].Function.Arguments)
+	assert.Equal(t, "list_directory", msg.ToolCalls[1].Function.Name)
+	assert.Equal(t, `{"path":"."}`, msg.ToolCalls[1].Function.Arguments)
+}
+
+func TestAnthropic_ChatStream(t *testing.T) {
+	srv := sseServer(t, []string{
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{}}",
+		"event: content_block_start\ndata: {\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}",
+		"event: content_block_delta\ndata: {\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Checking\"}}",
+		"event: content_block_stop\ndata: {\"index\":0}",
+		"event: content_block_start\ndata: {\"index\":1,\"content_block\":{\"type\":\"tool_use\",\"id\":\"toolu_1\",\"name\":\"read_file\",\"input\":{}}}",
+		"event: content_block_delta\ndata: {\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"path\\\": \"}}",
+		"event: content_block_delta\ndata: {\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"\\\"a.txt\\\"}\"}}",
+		"event: content_block_stop\ndata: {\"index\":1}",
+		"event: message_delta\ndata: {\"delta\":{\"stop_reason\":\"tool_use\"}}",
+		"event: message_stop\ndata: {}",
+	})
+	defer srv.Close()
+
+	a := &Anthropic{baseProvider: newBaseProvider(srv.URL, "key", "claude-test")}
+
+	var streamed strings.Builder
+	msg, err := a.ChatStream(context.Background(), []core.Message{{Role: core.RoleUser, Content: "hi"}}, nil,
+		func(d core.StreamDelta) { streamed.WriteString(d.Content) })
+	require.NoError(t, err)
+
+	assert.Equal(t, "Checking", streamed.String())
+	assert.Equal(t, "Checking", msg.Content)
+	require.Len(t, msg.ToolCalls, 1)
+	assert.Equal(t, "toolu_1", msg.ToolCalls[0].ID)
+	assert.JSONEq(t, `{"path":"a.txt"}`, msg.ToolCalls[0].Function.Arguments)
+}
+
+func TestAnthropic_ChatStream_Error(t *testing.T) {
+	srv := sseServer(t, []string{
+		"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}",
+	})
+	defer srv.Close()
+
+	a := &Anthropic{baseProvider: newBaseProvider(srv.URL, "key", "claude-test")}
+
+	_, err := a.ChatStream(context.Background(), []core.Message{{Role: core.RoleUser, Content: "hi"}}, nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "overloaded_error")
+}
+
+func TestChatStream_EndedEarly(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		stream func(url string) (core.Message, error)
+	}{
+		{
+			name:   "openai compatible",
+			events: []string{`data: {"choices":[{"delta":{"content":"Hel"}}]}`},
+			stream: func(url string) (core.Message, error) {
+				p := NewOpenAICompatible(OpenAICompatibleConfig{BaseURL: url, Model: "test"})
+				return p.ChatStream(context.Background(), nil, nil, nil)
+			},
+		},
+		{
+			name: "anthropic",
+			events: []string{
+				"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{}}",
+				"event: content_block_start\ndata: {\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"Hel\"}}",
+			},
+			stream: func(url string) (core.Message, error) {
+				a := &Anthropic{baseProvider: newBaseProvider(url, "key", "claude-test")}
+				return a.ChatStream(context.Background(), nil, nil, nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := sseServer(t, tt.events)
+			defer srv.Close()
+
+			_, err := tt.stream(srv.URL)
+			require.ErrorIs(t, err, errStreamEnded)
+			assert.Equal(t, ErrServer, Classify(err), "another model may answer")
+		})
+	}
+}
+
+func TestIdleBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Steady chunks outlast the idle timeout, then the stream stalls
+		for range 10 {
+			fmt.Fprint(w, "data: x\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	body := newIdleBody(resp.Body, 100*time.Millisecond, cancel)
+	defer body.Close()
+
+	var events int
+	err = readSSE(body, func(event, data string) error {
+		events++
+		return nil
+	})
+	assert.Equal(t, 10, events)
+	require.ErrorIs(t, err, errStreamStalled)
+	assert.Equal(t, ErrServer, Classify(err), "another model may answer")
+}
@@ -0,0 +1,93 @@
+package local
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/internal/providers/llm"
+	"github.com/sandevgo/tuskbot/pkg/llamacpp"
+)
+
+// toChatMessages maps the history onto the messages of a chat template.
+// Tool calls and results are written as text in the format of emulated tool
+// calling, system messages are merged into one at the start, and
+// consecutive messages of the same role are merged, since many templates
+// require users and the assistant to alternate.
+func toChatMessages(history []core.Message, tools []core.Tool) []llamacpp.ChatMessage {
+	var system []string
+	var messages []llamacpp.ChatMessage
+
+	add := func(role, content string) {
+		if content == "" {
+			return
+		}
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content += "\n\n" + content
+			return
+		}
+		messages = append(messages, llamacpp.ChatMessage{Role: role, Content: content})
+	}
+
+	for _, m := range llm.EmulateToolHistory(history) {
+		content := m.Content
+		for _, p := range m.Parts {
+			content = strings.TrimPrefix(content+"\n"+p.Placeholder("local models cannot take it"), "\n")
+		}
+
+		switch m.Role {
+		case core.RoleSystem:
+			if content != "" {
+				system = append(system, content)
+			}
+		case core.RoleAssistant:
+			add(core.RoleAssistant, content)
+		default:
+			add(core.RoleUser, content)
+		}
+	}
+
+	if len(tools) > 0 {
+		system = append(system, llm.ToolPrompt(tools))
+	}
+
+	// The conversation must start with a user turn
+	if len(messages) == 0 || messages[0].Role != core.RoleUser {
+		messages = append([]llamacpp.ChatMessage{{Role: core.RoleUser, Content: "(conversation continued)"}}, messages...)
+	}
+	if len(system) > 0 {
+		messages = append([]llamacpp.ChatMessage{{Role: core.RoleSystem, Content: strings.Join(system, "\n\n")}}, messages...)
+	}
+	return messages
+}
+
+// toolGrammar is a GBNF grammar that accepts either a text answer, which
+// must not start with "<", or tool call blocks calling the given tools.
+// Arguments are any JSON object.
+func toolGrammar(tools []core.Tool) string {
+	names := make([]string, 0, len(tools))
+	for _, t := range tools {
+		names = append(names, fmt.Sprintf(`"\"%s\""`, t.Function.Name))
+	}
+
+	return `root   ::= text | calls
+text   ::= [^<] [^\x00]*
+calls  ::= ("` + llm.ToolCallOpen + `" ws call ws "` + llm.ToolCallClose + `" ws)+
+call   ::= "{" ws "\"name\"" ws ":" ws name ws "," ws "\"arguments\"" ws ":" ws object ws "}"
+name   ::= ` + strings.Join(names, " | ") + `
+value  ::= object | array | string | number | ("true" | "false" | "null")
+object ::= "{" ws ( string ws ":" ws value ( ws "," ws string ws ":" ws value )* )? ws "}"
+array  ::= "[" ws ( value ( ws "," ws value )* )? ws "]"
+string ::= "\"" ( [^"\\\x7F\x00-\x1F] | "\\" (["\\/bfnrt] | "u" [0-9a-fA-F]{4}) )* "\""
+number ::= "-"? ([0-9] | [1-9] [0-9]*) ("." [0-9]+)? ([eE] [-+]? [0-9]+)?
+ws     ::= [ \t\n]{0,20}
+`
+}
+
+// parseOutput turns the generated text into a message. Tool calls that
+// cannot be parsed, e.g. because the output was cut off, are returned as
+// text.
+func parseOutput(text string) core.Message {
+	content, calls := llm.ParseToolCalls(text)
+	return core.Message{Role: core.RoleAssistant, Content: content, ToolCalls: calls}
+}
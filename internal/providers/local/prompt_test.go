@@ -0,0 +1,72 @@
+package local
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/llamacpp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToChatMessages(t *testing.T) {
+	history := []core.Message{
+		{Role: core.RoleSystem, Content: "system prompt"},
+		{Role: core.RoleSystem, Content: "memory"},
+		{Role: core.RoleUser, Content: "list files", Parts: []core.ContentPart{
+			{Type: core.PartImage, MediaType: "image/png", Path: "/media/a.png"},
+		}},
+		{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{
+			{ID: "call_1", Function: core.FunctionCall{Name: "list_directory", Arguments: `{"path":"<dir>"}`}},
+			{ID: "call_2", Function: core.FunctionCall{Name: "get_file_info", Arguments: ""}},
+		}},
+		{Role: core.RoleTool, ToolCallID: "call_1", Content: "[FILE] a.txt"},
+		{Role: core.RoleTool, ToolCallID: "call_2", Content: "Error: not found"},
+		{Role: core.RoleAssistant, Content: "done"},
+	}
+	tools := []core.Tool{{Function: core.Function{Name: "list_directory", Description: "Lists a directory"}}}
+
+	messages := toChatMessages(history, tools)
+
+	require.Len(t, messages, 5)
+	assert.Equal(t, core.RoleSystem, messages[0].Role)
+	assert.True(t, strings.HasPrefix(messages[0].Content, "system prompt\n\nmemory\n\nYou can call the tools"))
+	assert.Contains(t, messages[0].Content, "- list_directory: Lists a directory")
+
+	assert.Equal(t, llamacpp.ChatMessage{
+		Role:    core.RoleUser,
+		Content: "list files\n[image image/png at /media/a.png: local models cannot take it]",
+	}, messages[1])
+
+	assert.Equal(t, llamacpp.ChatMessage{
+		Role: core.RoleAssistant,
+		Content: `<tool_call>{"name":"list_directory","arguments":{"path":"<dir>"}}</tool_call>` + "\n" +
+			`<tool_call>{"name":"get_file_info","arguments":{}}</tool_call>`,
+	}, messages[2])
+
+	// Both results are merged into a single user turn
+	assert.Equal(t, core.RoleUser, messages[3].Role)
+	assert.Equal(t, "<tool_result name=\"list_directory\">\n[FILE] a.txt\n</tool_result>\n\n"+
+		"<tool_result name=\"get_file_info\">\nError: not found\n</tool_result>", messages[3].Content)
+
+	assert.Equal(t, llamacpp.ChatMessage{Role: core.RoleAssistant, Content: "done"}, messages[4])
+}
+
+func TestToChatMessages_StartsWithUser(t *testing.T) {
+	messages := toChatMessages([]core.Message{{Role: core.RoleAssistant, Content: "hello"}}, nil)
+
+	require.Len(t, messages, 2)
+	assert.Equal(t, core.RoleUser, messages[0].Role)
+	assert.Equal(t, core.RoleAssistant, messages[1].Role)
+}
+
+func TestToolGrammar(t *testing.T) {
+	grammar := toolGrammar([]core.Tool{
+		{Function: core.Function{Name: "read_file"}},
+		{Function: core.Function{Name: "write_file"}},
+	})
+
+	assert.Contains(t, grammar, `name   ::= "\"read_file\"" | "\"write_file\""`)
+	assert.Contains(t, grammar, `calls  ::= ("<tool_call>" ws call ws "</tool_call>" ws)+`)
+}
@@ -0,0 +1,79 @@
+package local
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/llamacpp"
+)
+
+// defaultTemperature is used when the session sets none.
+const defaultTemperature = 0.7
+
+// Provider runs a GGUF chat model in process through llama.cpp. Tools are
+// described in the system prompt and calls are constrained by a grammar.
+type Provider struct {
+	runtime *Runtime
+	model   string
+}
+
+func (p *Provider) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	return p.ChatStream(ctx, history, tools, nil)
+}
+
+// ChatStream generates a completion and reports text as it is generated.
+// Tool calls are only reported in the returned message.
+func (p *Provider) ChatStream(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	chat, release, err := p.runtime.acquire(ctx, p.model)
+	if err != nil {
+		return core.Message{}, err
+	}
+	defer release()
+
+	prompt, err := chat.ApplyTemplate(toChatMessages(history, tools))
+	if err != nil {
+		return core.Message{}, fmt.Errorf("failed to apply chat template: %w", err)
+	}
+
+	opts := core.ChatOptionsFromCtx(ctx)
+	params := llamacpp.GenerateParams{
+		MaxTokens:   opts.MaxTokens,
+		Temperature: defaultTemperature,
+	}
+	if opts.Temperature != nil {
+		params.Temperature = float32(*opts.Temperature)
+	}
+	if len(tools) > 0 {
+		params.Grammar = toolGrammar(tools)
+	}
+
+	// The grammar keeps text answers from starting with "<", so the first
+	// piece tells a tool call from text
+	var calling, started bool
+	onPiece := func(piece string) {
+		if !started {
+			started = true
+			calling = len(tools) > 0 && piece[0] == '<'
+		}
+		if !calling && onDelta != nil {
+			onDelta(core.StreamDelta{Content: piece})
+		}
+	}
+
+	result, err := chat.Generate(ctx, prompt, params, onPiece)
+	if err != nil {
+		return core.Message{}, fmt.Errorf("local generation failed: %w", err)
+	}
+
+	msg := parseOutput(result.Text)
+	msg.Usage = &core.Usage{
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+	}
+	return msg, nil
+}
+
+func (p *Provider) Models(ctx context.Context) ([]core.Model, error) {
+	return p.runtime.Models()
+}
@@ -0,0 +1,164 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/llamacpp"
+	"github.com/sandevgo/tuskbot/pkg/log"
+)
+
+// ProviderName is the provider of "local/<model>" specs.
+const ProviderName = "local"
+
+const modelExt = ".gguf"
+
+// chatModel is the part of llamacpp.LlamaChat the provider uses.
+type chatModel interface {
+	ApplyTemplate(messages []llamacpp.ChatMessage) (string, error)
+	Generate(ctx context.Context, prompt string, params llamacpp.GenerateParams, onPiece func(string)) (llamacpp.GenerateResult, error)
+	ContextSize() int
+	Free()
+}
+
+// Runtime loads GGUF chat models from the models directory. Only one model
+// is kept in memory. Switching to another one waits until the loaded model
+// has no generation in progress, then unloads it.
+type Runtime struct {
+	cfg  core.LocalModelConfig
+	load func(path string) (chatModel, error)
+
+	mu     sync.Mutex
+	name   string
+	loaded chatModel
+	users  int           // requests holding the loaded model
+	idle   chan struct{} // closed when users drops to zero
+}
+
+func NewRuntime(cfg core.LocalModelConfig) *Runtime {
+	return &Runtime{
+		cfg: cfg,
+		load: func(path string) (chatModel, error) {
+			return llamacpp.NewLlamaChat(path, llamacpp.ChatParams{
+				ContextSize: cfg.GetLocalContextSize(),
+				Threads:     cfg.GetLocalThreads(),
+				GPULayers:   cfg.GetLocalGPULayers(),
+			})
+		},
+	}
+}
+
+// Provider creates a provider for a model in the models directory. The
+// model is loaded on its first request.
+func (r *Runtime) Provider(ctx context.Context, model string) (core.AIProvider, error) {
+	model = strings.TrimSuffix(model, modelExt)
+	if _, err := os.Stat(r.modelPath(model)); err != nil {
+		return nil, fmt.Errorf("local model %s not found in %s: %w", model, r.cfg.GetModelsPath(), err)
+	}
+	return &Provider{runtime: r, model: model}, nil
+}
+
+func (r *Runtime) modelPath(model string) string {
+	return filepath.Join(r.cfg.GetModelsPath(), model+modelExt)
+}
+
+// acquire returns the model, loading it first if needed, and keeps it
+// loaded until release is called. While another model is in use, it waits
+// for that model to become idle.
+func (r *Runtime) acquire(ctx context.Context, model string) (chatModel, func(), error) {
+	for {
+		r.mu.Lock()
+		if r.loaded != nil && r.name == model {
+			r.users++
+			r.mu.Unlock()
+			return r.loaded, r.release, nil
+		}
+		if r.loaded == nil || r.users == 0 {
+			break
+		}
+
+		idle := r.idle
+		r.mu.Unlock()
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+	defer r.mu.Unlock()
+
+	if r.loaded != nil {
+		log.FromCtx(ctx).Info().Str("model", r.name).Msg("unloading local model")
+		r.loaded.Free()
+		r.loaded = nil
+	}
+
+	log.FromCtx(ctx).Info().Str("model", model).Msg("loading local model")
+	chat, err := r.load(r.modelPath(model))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load local model: %w", err)
+	}
+
+	r.name, r.loaded = model, chat
+	r.users, r.idle = 1, make(chan struct{})
+	return chat, r.release, nil
+}
+
+func (r *Runtime) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.users--
+	if r.users == 0 {
+		close(r.idle)
+	}
+}
+
+// Models lists the chat models in the models directory.
+func (r *Runtime) Models() ([]core.Model, error) {
+	entries, err := os.ReadDir(r.cfg.GetModelsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read models directory: %w", err)
+	}
+
+	contextLength := r.cfg.GetLocalContextSize()
+	r.mu.Lock()
+	if r.loaded != nil {
+		contextLength = r.loaded.ContextSize()
+	}
+	r.mu.Unlock()
+
+	var models []core.Model
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, modelExt) || name == r.cfg.GetEmbeddingModel() {
+			continue
+		}
+		id := strings.TrimSuffix(name, modelExt)
+		models = append(models, core.Model{ID: id, Name: id, ContextLength: contextLength})
+	}
+
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+// Shutdown unloads the model.
+func (r *Runtime) Shutdown() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.loaded != nil {
+		r.loaded.Free()
+		r.loaded = nil
+	}
+	return nil
+}
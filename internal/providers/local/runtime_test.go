@@ -0,0 +1,129 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/llamacpp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	dir string
+}
+
+func (c testConfig) GetModelsPath() string     { return c.dir }
+func (c testConfig) GetEmbeddingModel() string { return "" }
+func (c testConfig) GetLocalContextSize() int  { return 4096 }
+func (c testConfig) GetLocalThreads() int      { return 1 }
+func (c testConfig) GetLocalGPULayers() int    { return 0 }
+
+type fakeModel struct {
+	name   string
+	live   *atomic.Int32
+	mu     sync.Mutex
+	freed  bool
+	active atomic.Int32
+}
+
+func (m *fakeModel) ApplyTemplate(messages []llamacpp.ChatMessage) (string, error) {
+	return messages[len(messages)-1].Content, nil
+}
+
+func (m *fakeModel) Generate(ctx context.Context, prompt string, params llamacpp.GenerateParams, onPiece func(string)) (llamacpp.GenerateResult, error) {
+	m.active.Add(1)
+	defer m.active.Add(-1)
+
+	// Hold the model the way a long generation would
+	time.Sleep(2 * time.Millisecond)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.freed {
+		return llamacpp.GenerateResult{}, errors.New("model already freed")
+	}
+	return llamacpp.GenerateResult{Text: m.name}, nil
+}
+
+func (m *fakeModel) ContextSize() int { return 4096 }
+
+func (m *fakeModel) Free() {
+	if m.active.Load() > 0 {
+		panic("model freed during generation")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.freed = true
+	m.live.Add(-1)
+}
+
+func TestRuntime_ConcurrentModels(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+modelExt), nil, 0600))
+	}
+
+	var live, loads atomic.Int32
+	r := NewRuntime(testConfig{dir: dir})
+	r.load = func(path string) (chatModel, error) {
+		if live.Add(1) > 1 {
+			t.Error("two models loaded at once")
+		}
+		loads.Add(1)
+		return &fakeModel{name: filepath.Base(path), live: &live}, nil
+	}
+	defer r.Shutdown()
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b", "a", "b"} {
+		p, err := r.Provider(ctx, name)
+		require.NoError(t, err)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				msg, err := p.Chat(ctx, []core.Message{{Role: core.RoleUser, Content: "hi"}}, nil)
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, name+modelExt, msg.Content)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Positive(t, loads.Load())
+	assert.LessOrEqual(t, live.Load(), int32(1))
+}
+
+func TestRuntime_SwitchWaitHonoursContext(t *testing.T) {
+	dir := t.TempDir()
+	var live atomic.Int32
+	r := NewRuntime(testConfig{dir: dir})
+	r.load = func(path string) (chatModel, error) {
+		live.Add(1)
+		return &fakeModel{name: filepath.Base(path), live: &live}, nil
+	}
+	defer r.Shutdown()
+
+	_, release, err := r.acquire(context.Background(), "a")
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, _, err = r.acquire(ctx, "b")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(1), live.Load())
+}
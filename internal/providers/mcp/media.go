@@ -0,0 +1,61 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	mcpproto "github.com/mark3labs/mcp-go/mcp"
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+// mediaDir is the directory of the runtime path that keeps images, audio
+// and files returned by tools, so the messages referring to them can be
+// sent to the model again later.
+const mediaDir = "media"
+
+// mediaContent converts non-text tool content: text resources into text,
+// binary data into a content part after saving it to the media directory.
+func (s *Service) mediaContent(content mcpproto.Content) (text string, part *core.ContentPart, err error) {
+	switch c := content.(type) {
+	case mcpproto.ImageContent:
+		part, err = s.saveMedia(c.Data, c.MIMEType)
+	case *mcpproto.ImageContent:
+		part, err = s.saveMedia(c.Data, c.MIMEType)
+	case mcpproto.AudioContent:
+		part, err = s.saveMedia(c.Data, c.MIMEType)
+	case *mcpproto.AudioContent:
+		part, err = s.saveMedia(c.Data, c.MIMEType)
+	case mcpproto.EmbeddedResource:
+		return s.resourceContent(c.Resource)
+	case *mcpproto.EmbeddedResource:
+		return s.resourceContent(c.Resource)
+	}
+	return "", part, err
+}
+
+func (s *Service) resourceContent(resource mcpproto.ResourceContents) (text string, part *core.ContentPart, err error) {
+	switch r := resource.(type) {
+	case mcpproto.TextResourceContents:
+		text = r.Text
+	case *mcpproto.TextResourceContents:
+		text = r.Text
+	case mcpproto.BlobResourceContents:
+		part, err = s.saveMedia(r.Blob, r.MIMEType)
+	case *mcpproto.BlobResourceContents:
+		part, err = s.saveMedia(r.Blob, r.MIMEType)
+	}
+	return text, part, err
+}
+
+// saveMedia decodes base64 data and saves it to the media directory.
+func (s *Service) saveMedia(data, mediaType string) (*core.ContentPart, error) {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s data: %w", mediaType, err)
+	}
+	part, err := core.SaveMedia(s.mediaPath, raw, mediaType)
+	if err != nil {
+		return nil, err
+	}
+	return &part, nil
+}
@@ -0,0 +1,60 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mcpproto "github.com/mark3labs/mcp-go/mcp"
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_MediaContent(t *testing.T) {
+	s := &Service{mediaPath: filepath.Join(t.TempDir(), mediaDir)}
+	png := []byte("\x89PNG fake image")
+	encoded := base64.StdEncoding.EncodeToString(png)
+
+	tests := []struct {
+		name          string
+		content       mcpproto.Content
+		wantText      string
+		wantMediaType string
+	}{
+		{"image", mcpproto.ImageContent{Type: "image", Data: encoded, MIMEType: "image/png"}, "", "image/png"},
+		{"image pointer", &mcpproto.ImageContent{Type: "image", Data: encoded, MIMEType: "image/png"}, "", "image/png"},
+		{"audio", mcpproto.AudioContent{Type: "audio", Data: encoded, MIMEType: "audio/wav"}, "", "audio/wav"},
+		{"blob resource", mcpproto.EmbeddedResource{Type: "resource", Resource: mcpproto.BlobResourceContents{
+			URI: "file:///a.pdf", MIMEType: "application/pdf", Blob: encoded,
+		}}, "", "application/pdf"},
+		{"text resource", mcpproto.EmbeddedResource{Type: "resource", Resource: mcpproto.TextResourceContents{
+			URI: "file:///a.txt", Text: "hello",
+		}}, "hello", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, part, err := s.mediaContent(tt.content)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantText, text)
+			if tt.wantMediaType == "" {
+				assert.Nil(t, part)
+				return
+			}
+
+			require.NotNil(t, part)
+			assert.Equal(t, tt.wantMediaType, part.MediaType)
+			assert.Equal(t, core.PartType(tt.wantMediaType), part.Type)
+			assert.Equal(t, s.mediaPath, filepath.Dir(part.Path))
+
+			data, err := os.ReadFile(part.Path)
+			require.NoError(t, err)
+			assert.Equal(t, png, data)
+		})
+	}
+
+	_, _, err := s.mediaContent(mcpproto.ImageContent{Type: "image", Data: "not base64!", MIMEType: "image/png"})
+	assert.Error(t, err)
+}
@@ -1,10 +1,13 @@
 package mcp
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -49,6 +52,9 @@ type Service struct {
 
 	// Tool name mapping: sanitized -> original
 	toolNameMap map[string]string
+
+	// Directory for media returned by tools
+	mediaPath string
 }
 
 func NewService(
@@ -68,9 +74,21 @@ func NewService(
 		nativeToolDefs: nativeToolDefs,
 		activeConfigs:  make(map[string]ServerConfig),
 		toolNameMap:    make(map[string]string),
+		mediaPath:      filepath.Join(runtimePath, mediaDir),
 	}, nil
 }
 
+// RegisterNativeTool adds a native tool that is built outside this package,
+// e.g. one depending on the agent. It must be called before the first tool call.
+func (s *Service) RegisterNativeTool(def core.Tool, handler NativeHandler) {
+	s.mu.Lock()
+	s.nativeTools[def.Function.Name] = handler
+	s.nativeToolDefs = append(s.nativeToolDefs, def)
+	s.mu.Unlock()
+
+	s.cache.Invalidate()
+}
+
 func (s *Service) Start(ctx context.Context) error {
 	// Load initial config
 	if err := s.registry.Load(ctx); err != nil {
@@ -189,6 +207,14 @@ func (s *Service) GetTools(ctx context.Context) ([]core.Tool, error) {
 		allTools = append(allTools, tools...)
 	}
 
+	// A stable order keeps the tool list cacheable by providers' prompt caches
+	slices.SortStableFunc(allTools, func(a, b core.Tool) int {
+		return cmp.Or(
+			cmp.Compare(a.Server, b.Server),
+			cmp.Compare(a.Function.Name, b.Function.Name),
+		)
+	})
+
 	// Update Cache
 	s.cache.Update(allTools, routing)
 
@@ -264,6 +290,7 @@ func (s *Service) listToolsFromServer(ctx context.Context, name string, cli *Man
 				Description: t.Description,
 				Parameters:  schemaBytes,
 			},
+			Server: name,
 		})
 
 		// Store mapping for reverse lookup during tool execution
@@ -274,19 +301,20 @@ func (s *Service) listToolsFromServer(ctx context.Context, name string, cli *Man
 	return tools, nil
 }
 
-func (s *Service) CallTool(ctx context.Context, name string, args string) (string, error) {
+func (s *Service) CallTool(ctx context.Context, name string, args string) (core.ToolResult, error) {
 	log.FromCtx(ctx).Info().Str("tool", name).Str("args", args).Msg("executing tool")
 
 	// 1. Check Native Tools first
 	if handler, ok := s.nativeTools[name]; ok {
-		return handler(ctx, json.RawMessage(args))
+		out, err := handler(ctx, json.RawMessage(args))
+		return core.ToolResult{Content: out}, err
 	}
 
 	// 2. Resolve Server using sanitized name (what AI sends)
 	_, routing, _ := s.cache.Get()
 	serverName, ok := routing[name]
 	if !ok {
-		return "", fmt.Errorf("tool not found: %s", name)
+		return core.ToolResult{}, fmt.Errorf("tool not found: %s", name)
 	}
 
 	// 3. Resolve original name for MCP call
@@ -302,14 +330,14 @@ func (s *Service) CallTool(ctx context.Context, name string, args string) (strin
 	// 4. Get Client from Pool
 	cli, ok := s.pool.Get(serverName)
 	if !ok {
-		return "", fmt.Errorf("server %s is not available", serverName)
+		return core.ToolResult{}, fmt.Errorf("server %s is not available", serverName)
 	}
 
 	// 5. Execute using original name
 	argsMap := make(map[string]any)
 	if args != "" {
 		if err := json.Unmarshal([]byte(args), &argsMap); err != nil {
-			return "", fmt.Errorf("invalid json arguments: %w", err)
+			return core.ToolResult{}, fmt.Errorf("invalid json arguments: %w", err)
 		}
 	}
 
@@ -323,21 +351,27 @@ func (s *Service) CallTool(ctx context.Context, name string, args string) (strin
 
 	res, err := cli.CallTool(tCtx, req)
 	if err != nil {
-		return "", err
+		return core.ToolResult{}, err
 	}
 
-	var output string
+	var result core.ToolResult
 	for _, content := range res.Content {
 		if text, ok := content.(mcpproto.TextContent); ok {
-			output += text.Text + "\n"
+			result.Content += text.Text + "\n"
 		} else if textPtr, ok := content.(*mcpproto.TextContent); ok {
-			output += textPtr.Text + "\n"
+			result.Content += textPtr.Text + "\n"
+		} else if text, part, err := s.mediaContent(content); err != nil {
+			log.FromCtx(ctx).Warn().Err(err).Str("tool", name).Msg("failed to keep tool content")
+		} else if part != nil {
+			result.Parts = append(result.Parts, *part)
+		} else if text != "" {
+			result.Content += text + "\n"
 		}
 	}
 
 	if res.IsError {
-		return "", fmt.Errorf("tool execution failed: %s", output)
+		return core.ToolResult{}, fmt.Errorf("tool execution failed: %s", result.Content)
 	}
 
-	return output, nil
+	return result, nil
 }
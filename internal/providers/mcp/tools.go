@@ -13,6 +13,7 @@ type tool interface {
 		Description string
 		Schema      string
 		Handler     func(context.Context, json.RawMessage) (string, error)
+		Serial      bool
 	}
 }
 
@@ -23,14 +24,7 @@ func RegisterNativeTools(runtimePath string) (map[string]NativeHandler, []core.T
 	register := func(t tool) {
 		for name, def := range t.GetDefinitions() {
 			handlers[name] = def.Handler
-			defs = append(defs, core.Tool{
-				Type: "function",
-				Function: core.Function{
-					Name:        name,
-					Description: def.Description,
-					Parameters:  json.RawMessage(def.Schema),
-				},
-			})
+			defs = append(defs, nativeTool(name, def.Description, def.Schema, def.Serial))
 		}
 	}
 
@@ -41,3 +35,23 @@ func RegisterNativeTools(runtimePath string) (map[string]NativeHandler, []core.T
 
 	return handlers, defs
 }
+
+// RegisterTools adds a set of native tools that depend on services created
+// after the MCP service, e.g. storage.
+func (s *Service) RegisterTools(t tool) {
+	for name, def := range t.GetDefinitions() {
+		s.RegisterNativeTool(nativeTool(name, def.Description, def.Schema, def.Serial), def.Handler)
+	}
+}
+
+func nativeTool(name, description, schema string, serial bool) core.Tool {
+	return core.Tool{
+		Type: "function",
+		Function: core.Function{
+			Name:        name,
+			Description: description,
+			Parameters:  json.RawMessage(schema),
+		},
+		Serial: serial,
+	}
+}
@@ -99,12 +99,14 @@ func (f *Fetch) GetDefinitions() map[string]struct {
 	Description string
 	Schema      string
 	Handler     func(context.Context, json.RawMessage) (string, error)
+	Serial      bool
 } {
 	return map[string]struct {
 		Description string
 		Schema      string
 		Handler     func(context.Context, json.RawMessage) (string, error)
+		Serial      bool
 	}{
-		"fetch_url": {"Fetch content from a URL (HTTP GET)", fetchURLSchema, f.FetchURL},
+		"fetch_url": {"Fetch content from a URL (HTTP GET)", fetchURLSchema, f.FetchURL, false},
 	}
 }
@@ -16,7 +16,9 @@ const readFileSchema = `
 {
   "type": "object",
   "properties": {
-    "path": { "type": "string", "description": "The path to the file to read" }
+    "path": { "type": "string", "description": "The path to the file to read", "minLength": 1 },
+    "offset": { "type": "integer", "description": "Line number to start reading from, starting at 1 (optional)", "minimum": 1 },
+    "limit": { "type": "integer", "description": "Maximum number of lines to read (optional)", "minimum": 1 }
   },
   "required": ["path"]
 }
@@ -26,7 +28,7 @@ const writeFileSchema = `
 {
   "type": "object",
   "properties": {
-    "path": { "type": "string", "description": "The path to the file to write" },
+    "path": { "type": "string", "description": "The path to the file to write", "minLength": 1 },
     "content": { "type": "string", "description": "The content to write to the file" }
   },
   "required": ["path", "content"]
@@ -37,8 +39,8 @@ const editFileSchema = `
 {
   "type": "object",
   "properties": {
-    "path": { "type": "string", "description": "The path to the file to edit" },
-    "find": { "type": "string", "description": "The exact string to find in the file" },
+    "path": { "type": "string", "description": "The path to the file to edit", "minLength": 1 },
+    "find": { "type": "string", "description": "The exact string to find in the file", "minLength": 1 },
     "replace": { "type": "string", "description": "The string to replace it with" }
   },
   "required": ["path", "find", "replace"]
@@ -96,7 +98,9 @@ func (fs *Filesystem) resolvePath(p string) string {
 
 func (fs *Filesystem) ReadFile(ctx context.Context, args json.RawMessage) (string, error) {
 	var input struct {
-		Path string `json:"path"`
+		Path   string `json:"path"`
+		Offset int    `json:"offset"`
+		Limit  int    `json:"limit"`
 	}
 	if err := json.Unmarshal(args, &input); err != nil {
 		return "", fmt.Errorf("invalid arguments: %w", err)
@@ -107,7 +111,35 @@ func (fs *Filesystem) ReadFile(ctx context.Context, args json.RawMessage) (strin
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %w", err)
 	}
-	return string(content), nil
+	if input.Offset <= 1 && input.Limit <= 0 {
+		return string(content), nil
+	}
+
+	return readLines(string(content), input.Offset, input.Limit)
+}
+
+// readLines returns limit lines of content starting at line offset (1-based),
+// noting where to continue if lines remain.
+func readLines(content string, offset, limit int) (string, error) {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	start := max(offset, 1)
+	if start > len(lines) {
+		return "", fmt.Errorf("offset %d is past the end of the file (%d lines)", start, len(lines))
+	}
+	end := len(lines)
+	if limit > 0 {
+		end = min(start-1+limit, len(lines))
+	}
+
+	out := strings.Join(lines[start-1:end], "")
+	if end < len(lines) {
+		out += fmt.Sprintf("\n... [lines %d-%d of %d, continue with offset %d]", start, end, len(lines), end+1)
+	}
+	return out, nil
 }
 
 func (fs *Filesystem) WriteFile(ctx context.Context, args json.RawMessage) (string, error) {
@@ -320,17 +352,19 @@ func (fs *Filesystem) GetDefinitions() map[string]struct {
 	Description string
 	Schema      string
 	Handler     func(context.Context, json.RawMessage) (string, error)
+	Serial      bool
 } {
 	return map[string]struct {
 		Description string
 		Schema      string
 		Handler     func(context.Context, json.RawMessage) (string, error)
+		Serial      bool
 	}{
-		"read_file":      {"Read a file from the local filesystem", readFileSchema, fs.ReadFile},
-		"write_file":     {"Write content to a file on the local filesystem", writeFileSchema, fs.WriteFile},
-		"edit_file":      {"Edit a file by replacing an exact string with a new one", editFileSchema, fs.EditFile},
-		"list_directory": {"List contents of a directory", listDirSchema, fs.ListDir},
-		"search_files":   {"Search for a string in files recursively", searchFilesSchema, fs.SearchFiles},
-		"get_file_info":  {"Get metadata about a file (size, mode, modtime)", getFileInfoSchema, fs.GetFileInfo},
+		"read_file":      {"Read a file from the local filesystem, large files in parts with offset and limit", readFileSchema, fs.ReadFile, false},
+		"write_file":     {"Write content to a file on the local filesystem", writeFileSchema, fs.WriteFile, true},
+		"edit_file":      {"Edit a file by replacing an exact string with a new one", editFileSchema, fs.EditFile, true},
+		"list_directory": {"List contents of a directory", listDirSchema, fs.ListDir, false},
+		"search_files":   {"Search for a string in files recursively", searchFilesSchema, fs.SearchFiles, false},
+		"get_file_info":  {"Get metadata about a file (size, mode, modtime)", getFileInfoSchema, fs.GetFileInfo, false},
 	}
 }
@@ -0,0 +1,44 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesystem_ReadFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "f.txt"), []byte("one\ntwo\nthree\nfour\n"), 0644))
+	fs := NewFilesystem(dir)
+
+	tests := []struct {
+		name    string
+		args    string
+		want    string
+		wantErr string
+	}{
+		{name: "whole file", args: `{"path":"f.txt"}`, want: "one\ntwo\nthree\nfour\n"},
+		{name: "offset", args: `{"path":"f.txt","offset":3}`, want: "three\nfour\n"},
+		{name: "limit", args: `{"path":"f.txt","limit":2}`, want: "one\ntwo\n\n... [lines 1-2 of 4, continue with offset 3]"},
+		{name: "offset and limit", args: `{"path":"f.txt","offset":2,"limit":2}`, want: "two\nthree\n\n... [lines 2-3 of 4, continue with offset 4]"},
+		{name: "limit past the end", args: `{"path":"f.txt","offset":4,"limit":10}`, want: "four\n"},
+		{name: "offset past the end", args: `{"path":"f.txt","offset":5}`, wantErr: "past the end of the file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := fs.ReadFile(context.Background(), json.RawMessage(tt.args))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+const planCreateSchema = `
+{
+  "type": "object",
+  "properties": {
+    "title": { "type": "string", "description": "Short name of the task" },
+    "steps": {
+      "type": "array",
+      "items": { "type": "string" },
+      "description": "Ordered steps, each small enough to finish in a few tool calls"
+    }
+  },
+  "required": ["title", "steps"]
+}
+`
+
+const planUpdateStepSchema = `
+{
+  "type": "object",
+  "properties": {
+    "step": { "type": "integer", "description": "Step number, starting at 1", "minimum": 1 },
+    "status": { "type": "string", "enum": ["pending", "in_progress", "done", "failed", "skipped"] },
+    "note": { "type": "string", "description": "Optional result or reason, e.g. what failed" }
+  },
+  "required": ["step", "status"]
+}
+`
+
+const planShowSchema = `
+{
+  "type": "object",
+  "properties": {}
+}
+`
+
+var errNoActivePlan = errors.New("there is no active plan, create one with plan_create")
+
+// Plan lets the agent keep a multi-step task in storage, so it survives
+// long conversations and restarts. Plans belong to the calling session.
+type Plan struct {
+	repo core.PlanRepository
+}
+
+func NewPlan(repo core.PlanRepository) *Plan {
+	return &Plan{repo: repo}
+}
+
+func (p *Plan) Create(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Title string   `json:"title"`
+		Steps []string `json:"steps"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	var steps []string
+	for _, s := range input.Steps {
+		if s = strings.TrimSpace(s); s != "" {
+			steps = append(steps, s)
+		}
+	}
+	if strings.TrimSpace(input.Title) == "" || len(steps) == 0 {
+		return "", fmt.Errorf("a plan needs a title and at least one step")
+	}
+
+	sessionID, err := planSession(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	plan, err := p.repo.CreatePlan(ctx, sessionID, strings.TrimSpace(input.Title), steps)
+	if err != nil {
+		return "", err
+	}
+	return "Plan created:\n" + plan.Checklist(), nil
+}
+
+func (p *Plan) UpdateStep(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Step   int             `json:"step"`
+		Status core.StepStatus `json:"status"`
+		Note   string          `json:"note"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if !input.Status.Valid() {
+		return "", fmt.Errorf("unknown step status: %q", input.Status)
+	}
+
+	plan, err := p.activePlan(ctx)
+	if err != nil {
+		return "", err
+	}
+	if input.Step < 1 || input.Step > len(plan.Steps) {
+		return "", fmt.Errorf("step must be between 1 and %d", len(plan.Steps))
+	}
+
+	if err := p.repo.UpdateStep(ctx, plan.ID, input.Step, input.Status, input.Note); err != nil {
+		return "", err
+	}
+	step := &plan.Steps[input.Step-1]
+	step.Status, step.Note = input.Status, input.Note
+
+	if plan.Done() < len(plan.Steps) {
+		return plan.Checklist(), nil
+	}
+
+	if err := p.repo.SetPlanStatus(ctx, plan.ID, core.PlanCompleted); err != nil {
+		return "", err
+	}
+	return plan.Checklist() + "\nAll steps are finished, the plan is completed.", nil
+}
+
+func (p *Plan) Show(ctx context.Context, args json.RawMessage) (string, error) {
+	plan, err := p.activePlan(ctx)
+	if err != nil {
+		return "", err
+	}
+	return plan.Checklist(), nil
+}
+
+func (p *Plan) activePlan(ctx context.Context) (*core.Plan, error) {
+	sessionID, err := planSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := p.repo.GetActivePlan(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return nil, errNoActivePlan
+	}
+	return plan, nil
+}
+
+func planSession(ctx context.Context) (string, error) {
+	sessionID := core.SessionIDFromCtx(ctx)
+	if sessionID == "" {
+		return "", fmt.Errorf("plans are only available inside a session")
+	}
+	return sessionID, nil
+}
+
+func (p *Plan) GetDefinitions() map[string]struct {
+	Description string
+	Schema      string
+	Handler     func(context.Context, json.RawMessage) (string, error)
+	Serial      bool
+} {
+	return map[string]struct {
+		Description string
+		Schema      string
+		Handler     func(context.Context, json.RawMessage) (string, error)
+		Serial      bool
+	}{
+		"plan_create":      {"Create a step-by-step plan for a long task. It replaces the current plan and stays in your context until all steps are finished", planCreateSchema, p.Create, true},
+		"plan_update_step": {"Set the status of a plan step; mark a step in_progress when starting it and done when finished", planUpdateStepSchema, p.UpdateStep, true},
+		"plan_show":        {"Show the current plan and the status of its steps", planShowSchema, p.Show, false},
+	}
+}
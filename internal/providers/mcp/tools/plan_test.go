@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryPlanRepo keeps plans in memory, one active plan per session.
+type memoryPlanRepo struct {
+	plans []core.Plan
+}
+
+func (r *memoryPlanRepo) CreatePlan(ctx context.Context, sessionID, title string, steps []string) (core.Plan, error) {
+	for i := range r.plans {
+		if r.plans[i].SessionID == sessionID && r.plans[i].Status == core.PlanActive {
+			r.plans[i].Status = core.PlanReplaced
+		}
+	}
+
+	plan := core.Plan{ID: int64(len(r.plans) + 1), SessionID: sessionID, Title: title, Status: core.PlanActive}
+	for i, s := range steps {
+		plan.Steps = append(plan.Steps, core.PlanStep{Position: i + 1, Description: s, Status: core.StepPending})
+	}
+	r.plans = append(r.plans, plan)
+	return plan, nil
+}
+
+func (r *memoryPlanRepo) GetActivePlan(ctx context.Context, sessionID string) (*core.Plan, error) {
+	for i := range r.plans {
+		if r.plans[i].SessionID == sessionID && r.plans[i].Status == core.PlanActive {
+			plan := r.plans[i]
+			plan.Steps = append([]core.PlanStep(nil), plan.Steps...)
+			return &plan, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryPlanRepo) UpdateStep(ctx context.Context, planID int64, position int, status core.StepStatus, note string) error {
+	step := &r.plans[planID-1].Steps[position-1]
+	step.Status, step.Note = status, note
+	return nil
+}
+
+func (r *memoryPlanRepo) SetPlanStatus(ctx context.Context, planID int64, status core.PlanStatus) error {
+	r.plans[planID-1].Status = status
+	return nil
+}
+
+func TestPlan_Lifecycle(t *testing.T) {
+	repo := &memoryPlanRepo{}
+	p := NewPlan(repo)
+	ctx := core.WithSessionID(context.Background(), "s1")
+
+	out, err := p.Create(ctx, json.RawMessage(`{"title":"Migrate files","steps":["list files"," ","convert","verify"]}`))
+	require.NoError(t, err)
+	assert.Contains(t, out, "Migrate files (0/3 done)")
+	assert.Contains(t, out, "2. [ ] convert")
+
+	out, err = p.UpdateStep(ctx, json.RawMessage(`{"step":1,"status":"done","note":"40 files"}`))
+	require.NoError(t, err)
+	assert.Contains(t, out, "1. [x] list files — 40 files")
+
+	_, err = p.UpdateStep(ctx, json.RawMessage(`{"step":2,"status":"in_progress"}`))
+	require.NoError(t, err)
+
+	out, err = p.Show(ctx, json.RawMessage(`{}`))
+	require.NoError(t, err)
+	assert.Contains(t, out, "(1/3 done)")
+	assert.Contains(t, out, "2. [~] convert")
+
+	// Other sessions do not see the plan
+	_, err = p.Show(core.WithSessionID(context.Background(), "s2"), json.RawMessage(`{}`))
+	assert.ErrorIs(t, err, errNoActivePlan)
+
+	_, err = p.UpdateStep(ctx, json.RawMessage(`{"step":2,"status":"done"}`))
+	require.NoError(t, err)
+	out, err = p.UpdateStep(ctx, json.RawMessage(`{"step":3,"status":"skipped"}`))
+	require.NoError(t, err)
+	assert.Contains(t, out, "the plan is completed")
+	assert.Equal(t, core.PlanCompleted, repo.plans[0].Status)
+
+	_, err = p.Show(ctx, json.RawMessage(`{}`))
+	assert.ErrorIs(t, err, errNoActivePlan)
+}
+
+func TestPlan_CreateReplacesActive(t *testing.T) {
+	repo := &memoryPlanRepo{}
+	p := NewPlan(repo)
+	ctx := core.WithSessionID(context.Background(), "s1")
+
+	_, err := p.Create(ctx, json.RawMessage(`{"title":"first","steps":["a"]}`))
+	require.NoError(t, err)
+	_, err = p.Create(ctx, json.RawMessage(`{"title":"second","steps":["b"]}`))
+	require.NoError(t, err)
+
+	out, err := p.Show(ctx, json.RawMessage(`{}`))
+	require.NoError(t, err)
+	assert.Contains(t, out, "second")
+	assert.Equal(t, core.PlanReplaced, repo.plans[0].Status)
+}
+
+func TestPlan_Errors(t *testing.T) {
+	p := NewPlan(&memoryPlanRepo{})
+	ctx := core.WithSessionID(context.Background(), "s1")
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		handler func(context.Context, json.RawMessage) (string, error)
+		args    string
+		wantErr string
+	}{
+		{"no steps", ctx, p.Create, `{"title":"x","steps":[]}`, "at least one step"},
+		{"no session", context.Background(), p.Create, `{"title":"x","steps":["a"]}`, "only available inside a session"},
+		{"no plan", ctx, p.UpdateStep, `{"step":1,"status":"done"}`, "no active plan"},
+		{"bad status", ctx, p.UpdateStep, `{"step":1,"status":"finished"}`, "unknown step status"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.handler(tt.ctx, json.RawMessage(tt.args))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	_, err := p.Create(ctx, json.RawMessage(`{"title":"x","steps":["a"]}`))
+	require.NoError(t, err)
+	_, err = p.UpdateStep(ctx, json.RawMessage(`{"step":2,"status":"done"}`))
+	assert.ErrorContains(t, err, "step must be between 1 and 1")
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
 	"runtime"
@@ -22,8 +23,13 @@ const executeCommandSchema = `
 `
 
 const (
-	maxOutputLines     = 200
+	// maxOutputLines keeps the end of very long outputs; the output policy
+	// decides how much of it reaches the model
+	maxOutputLines     = 5000
 	defaultExecTimeout = 5 * time.Minute
+
+	// waitDelay bounds how long output pipes are drained after the process is killed
+	waitDelay = 5 * time.Second
 )
 
 type Shell struct {
@@ -43,6 +49,7 @@ func (s *Shell) ExecuteCommand(ctx context.Context, args json.RawMessage) (strin
 	}
 
 	// Create a child context with a timeout to prevent hanging commands
+	parent := ctx
 	ctx, cancel := context.WithTimeout(ctx, defaultExecTimeout)
 	defer cancel()
 
@@ -56,6 +63,8 @@ func (s *Shell) ExecuteCommand(ctx context.Context, args json.RawMessage) (strin
 	if s.WorkDir != "" {
 		cmd.Dir = s.WorkDir
 	}
+	killProcessGroup(cmd)
+	cmd.WaitDelay = waitDelay
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -67,8 +76,12 @@ func (s *Shell) ExecuteCommand(ctx context.Context, args json.RawMessage) (strin
 	errOutput := s.truncateOutput(stderr.String())
 
 	if err != nil {
+		// The run was stopped or reached its time limit
+		if parent.Err() != nil {
+			return "", fmt.Errorf("command cancelled: %w", context.Cause(parent))
+		}
 		// Check if it was a timeout
-		if ctx.Err() == context.DeadlineExceeded {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			return fmt.Sprintf("Command timed out after %v\nSTDOUT:\n%s\nSTDERR:\n%s", defaultExecTimeout, output, errOutput), nil
 		}
 		return fmt.Sprintf("Command failed: %v\nSTDOUT:\n%s\nSTDERR:\n%s", err, output, errOutput), nil
@@ -96,12 +109,14 @@ func (s *Shell) GetDefinitions() map[string]struct {
 	Description string
 	Schema      string
 	Handler     func(context.Context, json.RawMessage) (string, error)
+	Serial      bool
 } {
 	return map[string]struct {
 		Description string
 		Schema      string
 		Handler     func(context.Context, json.RawMessage) (string, error)
+		Serial      bool
 	}{
-		"execute_command": {"Execute a shell command", executeCommandSchema, s.ExecuteCommand},
+		"execute_command": {"Execute a shell command", executeCommandSchema, s.ExecuteCommand, true},
 	}
 }
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShell_ExecuteCommand_Cancel(t *testing.T) {
+	s := NewShell(t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	// The background child keeps the output pipe open unless the whole
+	// process group is killed
+	args, _ := json.Marshal(map[string]string{"command": "sleep 30 & sleep 30"})
+
+	start := time.Now()
+	_, err := s.ExecuteCommand(ctx, args)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "command cancelled")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestShell_ExecuteCommand_RunDeadline(t *testing.T) {
+	s := NewShell(t.TempDir())
+
+	limit := errors.New("time limit of the run reached")
+	ctx, cancel := context.WithTimeoutCause(context.Background(), 100*time.Millisecond, limit)
+	defer cancel()
+
+	args, _ := json.Marshal(map[string]string{"command": "sleep 30"})
+	out, err := s.ExecuteCommand(ctx, args)
+
+	require.ErrorIs(t, err, limit)
+	assert.NotContains(t, out, "timed out after")
+}
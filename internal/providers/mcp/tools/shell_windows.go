@@ -0,0 +1,9 @@
+//go:build windows
+
+package tools
+
+import "os/exec"
+
+// killProcessGroup is a no-op on Windows, where cancellation kills the
+// shell process only.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -2,15 +2,10 @@ package rag
 
 import (
 	"strings"
-	"sync"
 	"unicode"
 
 	"github.com/pkoukk/tiktoken-go"
-)
-
-var (
-	tk     *tiktoken.Tiktoken
-	tkOnce sync.Once
+	"github.com/sandevgo/tuskbot/pkg/tokenizer"
 )
 
 type Chunk struct {
@@ -206,13 +201,10 @@ func splitParagraphs(text string) []string {
 }
 
 func getTokenizer() *tiktoken.Tiktoken {
-	tkOnce.Do(func() {
-		var err error
-		tk, err = tiktoken.GetEncoding("cl100k_base")
-		if err != nil {
-			panic("failed to load tiktoken: " + err.Error())
-		}
-	})
+	tk, err := tokenizer.Encoding()
+	if err != nil {
+		panic("failed to load tiktoken: " + err.Error())
+	}
 	return tk
 }
 
@@ -2,7 +2,11 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/sandevgo/tuskbot/internal/core"
@@ -11,11 +15,24 @@ import (
 
 const ChatTimeout = 2 * time.Minute
 
+// ErrStopped is the cancellation cause of a run stopped with Stop.
+var ErrStopped = errors.New("cancelled by the user")
+
 type Agent struct {
-	ai       core.AIProvider
-	mcp      core.MCPServer
-	memory   core.Memory
-	executor *Executor
+	ai        core.AIProvider
+	mcp       core.MCPServer
+	memory    core.Memory
+	executor  *Executor
+	budget    Budget
+	queueMode QueueMode
+
+	mu       sync.Mutex
+	runs     map[string][]*activeRun
+	sessions map[string]*sessionQueue
+}
+
+type activeRun struct {
+	cancel context.CancelCauseFunc
 }
 
 func NewAgent(
@@ -23,25 +40,111 @@ func NewAgent(
 	mcp core.MCPServer,
 	memory core.Memory,
 	executor *Executor,
+	budget Budget,
+	queueMode QueueMode,
 ) *Agent {
 	return &Agent{
-		ai:       ai,
-		mcp:      mcp,
-		memory:   memory,
-		executor: executor,
+		ai:        ai,
+		mcp:       mcp,
+		memory:    memory,
+		executor:  executor,
+		budget:    budget,
+		queueMode: queueMode,
+		runs:      make(map[string][]*activeRun),
+		sessions:  make(map[string]*sessionQueue),
+	}
+}
+
+// Callbacks report the progress of a run. All of them are optional.
+type Callbacks struct {
+	// OnDelta receives response tokens as they arrive, when the provider
+	// supports streaming.
+	OnDelta func(core.StreamDelta)
+	// OnUpdate receives every assistant message of the run.
+	OnUpdate func(core.Message)
+	// OnQueued is called when the session is busy and the input has to
+	// wait, or was merged into the active run.
+	OnQueued func(merged bool)
+}
+
+// Stop cancels the active run of the session. It reports whether there
+// was a run to stop.
+func (a *Agent) Stop(sessionID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	runs := a.runs[sessionID]
+	for _, run := range runs {
+		run.cancel(ErrStopped)
+	}
+	return len(runs) > 0
+}
+
+// Track registers work of the session outside of a run, like a long
+// command, so that Stop cancels it as well. It returns the cancellable
+// context of the work and a function to call when it is done.
+func (a *Agent) Track(ctx context.Context, sessionID string) (context.Context, func()) {
+	return a.track(ctx, sessionID)
+}
+
+// track registers a run of the session and returns its cancellable context.
+func (a *Agent) track(ctx context.Context, sessionID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	run := &activeRun{cancel: cancel}
+
+	a.mu.Lock()
+	a.runs[sessionID] = append(a.runs[sessionID], run)
+	a.mu.Unlock()
+
+	return ctx, func() {
+		a.mu.Lock()
+		a.runs[sessionID] = slices.DeleteFunc(a.runs[sessionID], func(r *activeRun) bool { return r == run })
+		if len(a.runs[sessionID]) == 0 {
+			delete(a.runs, sessionID)
+		}
+		a.mu.Unlock()
+		cancel(nil)
 	}
 }
 
 func (a *Agent) Run(ctx context.Context, sessionID string, input string, onUpdate func(core.Message)) (string, error) {
+	return a.RunStream(ctx, sessionID, input, Callbacks{OnUpdate: onUpdate})
+}
+
+// RunStream works like Run but reports progress through callbacks. Runs of
+// the same session never overlap: input arriving during a run waits for it,
+// or is merged into it in QueueMerge mode, and then "" is returned.
+func (a *Agent) RunStream(ctx context.Context, sessionID string, input string, cb Callbacks) (string, error) {
 	logger := log.FromCtx(ctx)
+	onDelta, onUpdate := cb.OnDelta, cb.OnUpdate
 
 	logger.Debug().
 		Str("session_id", sessionID).
 		Msg("agent received user request")
 
+	merged, err := a.acquire(ctx, sessionID, input, cb.OnQueued)
+	if err != nil {
+		return "", fmt.Errorf("waiting for the previous run: %w", err)
+	}
+	if merged {
+		return "", nil
+	}
+	defer a.release(sessionID)
+
+	ctx, untrack := a.track(ctx, sessionID)
+	defer untrack()
+	ctx = core.WithSessionID(ctx, sessionID)
+	if core.RunIDFromCtx(ctx) == "" {
+		// Sub-agents count towards the run that started them
+		ctx = core.WithRunID(ctx, newRunID())
+	}
+
+	// History is saved even after the run is stopped, so it stays consistent
+	store := context.WithoutCancel(ctx)
+
 	// 1. Record the User Input
 	userMsg := core.Message{Role: core.RoleUser, Content: input}
-	if err := a.memory.SaveMessage(ctx, sessionID, userMsg); err != nil {
+	if err := a.memory.SaveMessage(store, sessionID, userMsg); err != nil {
 		return "", fmt.Errorf("failed to save user message: %w", err)
 	}
 
@@ -62,27 +165,60 @@ func (a *Agent) Run(ctx context.Context, sessionID string, input string, onUpdat
 	}
 
 	var finalContent string
+	tracker := newRunTracker(a.budget)
+
+	// Chat and tool calls are cut off at the time limit, not only checked
+	// against it between steps
+	stepCtx := ctx
+	if a.budget.MaxDuration > 0 {
+		deadline := tracker.started.Add(a.budget.MaxDuration)
+		ctx = withRunDeadline(ctx, deadline)
+		var cancel context.CancelFunc
+		stepCtx, cancel = context.WithDeadlineCause(ctx, deadline, errTimeLimit)
+		defer cancel()
+	}
 
 	// 4. ReAct Loop
 	for {
+		if stopped(ctx) {
+			return a.stop(store, sessionID, ErrStopped.Error(), nil, onUpdate)
+		}
+		if reason := tracker.exceeded(); reason != "" {
+			return a.stop(store, sessionID, reason, nil, onUpdate)
+		}
+
+		// Pick up messages the user sent while the run was busy
+		for _, followUp := range a.takeFollowUps(sessionID) {
+			msg := core.Message{Role: core.RoleUser, Content: followUp}
+			if err := a.memory.SaveMessage(store, sessionID, msg); err != nil {
+				return "", fmt.Errorf("failed to save user message: %w", err)
+			}
+			messages = append(messages, msg)
+		}
+
 		logger.Debug().
 			Str("session_id", sessionID).
 			Msg("agent sending request to llm")
 
-		chatCtx, cancel := context.WithTimeout(ctx, ChatTimeout)
-		responseMsg, err := a.ai.Chat(chatCtx, messages, tools)
-		cancel()
+		responseMsg, err := a.chat(stepCtx, messages, tools, onDelta)
 
+		if stopped(ctx) {
+			return a.stop(store, sessionID, ErrStopped.Error(), nil, onUpdate)
+		}
+		if err != nil && errors.Is(context.Cause(stepCtx), errTimeLimit) {
+			return a.stop(store, sessionID, tracker.exceeded(), nil, onUpdate)
+		}
 		if err != nil {
 			return "", fmt.Errorf("ai chat error: %w", err)
 		}
+		tracker.addStep(messages, responseMsg)
 
 		logger.Debug().
 			Str("session_id", sessionID).
 			Msg("agent received llm response")
 
 		// Save Assistant Response and update local context
-		if err := a.memory.SaveMessage(ctx, sessionID, responseMsg); err != nil {
+		if err := a.memory.SaveMessage(store, sessionID, responseMsg); err != nil {
 			return "", fmt.Errorf("failed to save assistant message: %w", err)
 		}
 		messages = append(messages, responseMsg)
@@ -100,20 +236,29 @@ func (a *Agent) Run(ctx context.Context, sessionID string, input string, onUpdat
 			break
 		}
 
+		// Stop a model that is stuck calling the same tool
+		if reason := tracker.addCalls(responseMsg.ToolCalls); reason != "" {
+			return a.stop(store, sessionID, reason, responseMsg.ToolCalls, onUpdate)
+		}
+
 		// 5. Execute Tool Calls
 		logger.Debug().
 			Str("session_id", sessionID).
 			Msg("agent called mcp tool")
 
-		toolResults := a.executor.Execute(ctx, responseMsg.ToolCalls)
+		toolResults := a.executor.Execute(stepCtx, responseMsg.ToolCalls)
 
 		for _, toolMsg := range toolResults {
-			if err := a.memory.SaveMessage(ctx, sessionID, toolMsg); err != nil {
+			if err := a.memory.SaveMessage(store, sessionID, toolMsg); err != nil {
 				return "", fmt.Errorf("failed to save tool message: %w", err)
 			}
 			messages = append(messages, toolMsg)
 		}
 
+		if stopped(ctx) {
+			return a.stop(store, sessionID, ErrStopped.Error(), nil, onUpdate)
+		}
+
 		// Update tool set (if model added new tools)
 		tools, err = a.mcp.GetTools(ctx)
 		if err != nil {
@@ -124,6 +269,71 @@ func (a *Agent) Run(ctx context.Context, sessionID string, input string, onUpdat
 	return finalContent, nil
 }
 
+// stop ends a run that exhausted its budget or was cancelled. Pending tool
+// calls get a synthetic result so the saved history stays valid, and the
+// user is told why the run ended.
+func (a *Agent) stop(
+	ctx context.Context,
+	sessionID string,
+	reason string,
+	pending []core.ToolCall,
+	onUpdate func(core.Message),
+) (string, error) {
+	log.FromCtx(ctx).Warn().
+		Str("session_id", sessionID).
+		Str("reason", reason).
+		Msg("agent run stopped")
+
+	for _, tc := range pending {
+		toolMsg := core.Message{
+			Role:       core.RoleTool,
+			Content:    fmt.Sprintf("Error: not executed, the run was stopped: %s", reason),
+			ToolCallID: tc.ID,
+			IsError:    true,
+		}
+		if err := a.memory.SaveMessage(ctx, sessionID, toolMsg); err != nil {
+			return "", fmt.Errorf("failed to save tool message: %w", err)
+		}
+	}
+
+	stopMsg := core.Message{
+		Role: core.RoleAssistant,
+		Content: fmt.Sprintf(
+			"⚠️ Run stopped: %s. Progress so far has been saved, send a message to continue.",
+			reason,
+		),
+	}
+	if err := a.memory.SaveMessage(ctx, sessionID, stopMsg); err != nil {
+		return "", fmt.Errorf("failed to save assistant message: %w", err)
+	}
+
+	if onUpdate != nil {
+		onUpdate(stopMsg)
+	}
+	return stopMsg.Content, nil
+}
+
+// newRunID returns a short ID that tells runs apart in usage records.
+func newRunID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+func stopped(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrStopped)
+}
+
+// chat requests the next step. Only unstreamed requests are bounded by
+// ChatTimeout, a stream fails once the provider stops sending.
+func (a *Agent) chat(ctx context.Context, messages []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	if streamer, ok := a.ai.(core.StreamingProvider); ok && onDelta != nil {
+		return streamer.ChatStream(ctx, messages, tools, onDelta)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ChatTimeout)
+	defer cancel()
+	return a.ai.Chat(ctx, messages, tools)
+}
+
 // sanitizeToolCalls ensures the message history is valid for LLM consumption.
 // It removes Tool messages that do not have a corresponding preceding Assistant tool call.
 func sanitizeToolCalls(ctx context.Context, messages []core.Message) []core.Message {
@@ -4,8 +4,11 @@ import (
 	"context"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSanitizeToolCalls(t *testing.T) {
@@ -112,3 +115,78 @@ func TestSanitizeToolCalls(t *testing.T) {
 		})
 	}
 }
+
+// blockingMCP runs tools until their context is cancelled.
+type blockingMCP struct {
+	started chan struct{}
+	tools   []core.Tool
+}
+
+func (m *blockingMCP) GetTools(ctx context.Context) ([]core.Tool, error) {
+	return m.tools, nil
+}
+
+func (m *blockingMCP) CallTool(ctx context.Context, name string, args string) (core.ToolResult, error) {
+	close(m.started)
+	<-ctx.Done()
+	return core.ToolResult{}, ctx.Err()
+}
+
+func TestAgent_Stop(t *testing.T) {
+	ai := &scriptedAI{responses: []core.Message{{
+		Role: core.RoleAssistant,
+		ToolCalls: []core.ToolCall{
+			{ID: "1", Function: core.FunctionCall{Name: "execute_command", Arguments: `{}`}},
+		},
+	}}}
+	mcp := &blockingMCP{started: make(chan struct{})}
+	mem := &stubMemory{}
+
+	a := NewAgent(ai, mcp, mem, NewExecutor(mcp, 1), Budget{}, QueueWait)
+	assert.False(t, a.Stop("s1"))
+
+	go func() {
+		<-mcp.started
+		assert.True(t, a.Stop("s1"))
+	}()
+
+	done := make(chan string)
+	go func() {
+		out, err := a.Run(context.Background(), "s1", "go", nil)
+		assert.NoError(t, err)
+		done <- out
+	}()
+
+	select {
+	case out := <-done:
+		assert.Contains(t, out, "cancelled by the user")
+	case <-time.After(5 * time.Second):
+		t.Fatal("run was not stopped")
+	}
+
+	// The interrupted call is closed with a cancelled result
+	require.Len(t, mem.saved, 4)
+	assert.Equal(t, core.RoleTool, mem.saved[2].Role)
+	assert.Equal(t, "1", mem.saved[2].ToolCallID)
+	assert.Contains(t, mem.saved[2].Content, "cancelled")
+	assert.Equal(t, 1, ai.calls)
+	assert.False(t, a.Stop("s1"))
+}
+
+func TestAgent_Track(t *testing.T) {
+	a := NewAgent(&scriptedAI{}, &blockingMCP{}, &stubMemory{}, NewExecutor(nil, 1), Budget{}, QueueWait)
+
+	first, untrackFirst := a.Track(context.Background(), "s1")
+	second, untrackSecond := a.Track(context.Background(), "s1")
+	other, untrackOther := a.Track(context.Background(), "s2")
+	defer untrackOther()
+
+	assert.True(t, a.Stop("s1"))
+	assert.ErrorIs(t, context.Cause(first), ErrStopped)
+	assert.ErrorIs(t, context.Cause(second), ErrStopped)
+	assert.NoError(t, other.Err(), "other sessions keep running")
+
+	untrackFirst()
+	untrackSecond()
+	assert.False(t, a.Stop("s1"))
+}
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/jsonschema"
+)
+
+// maxSchemaInError caps the schema quoted back to the model on errors.
+const maxSchemaInError = 2000
+
+// prepareArguments repairs common formatting mistakes in the arguments of a
+// tool call and validates them against the tool's schema. It returns the
+// arguments to dispatch, which are unchanged if nothing was repaired.
+func prepareArguments(tool core.Tool, args string) (string, error) {
+	text := stripFences(strings.TrimSpace(args))
+	if text == "" {
+		text = "{}"
+	}
+
+	value, err := decodeArguments(text)
+	if err != nil {
+		text = removeTrailingCommas(text)
+		var err2 error
+		if value, err2 = decodeArguments(text); err2 != nil {
+			return "", fmt.Errorf("arguments for %s are not valid JSON: %w", tool.Function.Name, err)
+		}
+	}
+
+	schema, err := jsonschema.Parse(tool.Function.Parameters)
+	if err != nil {
+		// A broken schema is the server's problem, not the model's
+		return text, nil
+	}
+
+	value, coerced := schema.Coerce(value)
+	if violations := schema.Validate(value); len(violations) > 0 {
+		return "", argumentsError(tool, violations)
+	}
+
+	if !coerced && text == args {
+		return args, nil
+	}
+	repaired, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode arguments: %w", err)
+	}
+	return string(repaired), nil
+}
+
+// decodeArguments decodes numbers as json.Number, so integer IDs beyond the
+// precision of a float64 survive a repair.
+func decodeArguments(text string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the arguments")
+	}
+	return value, nil
+}
+
+func argumentsError(tool core.Tool, violations []jsonschema.Violation) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid arguments for %s:", tool.Function.Name)
+	for _, v := range violations {
+		b.WriteString("\n- ")
+		b.WriteString(v.String())
+	}
+	if schema := string(tool.Function.Parameters); len(schema) <= maxSchemaInError {
+		b.WriteString("\nExpected schema: ")
+		b.WriteString(strings.Join(strings.Fields(schema), " "))
+	}
+	return fmt.Errorf("%s", b.String())
+}
+
+// stripFences removes a markdown code fence around the arguments.
+func stripFences(s string) string {
+	if !strings.HasPrefix(s, "```") || !strings.HasSuffix(s, "```") || len(s) < 6 {
+		return s
+	}
+	s = strings.TrimSuffix(s[3:], "```")
+	// Drop the language tag, e.g. ```json
+	if i := strings.IndexAny(s, "\n{["); i >= 0 && !strings.ContainsAny(s[:i], "{[\"") {
+		s = s[i:]
+	}
+	return strings.TrimSpace(s)
+}
+
+// removeTrailingCommas drops commas directly before a closing bracket,
+// outside of strings.
+func removeTrailingCommas(s string) string {
+	var b strings.Builder
+	inString, escaped := false, false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ',':
+			j := i + 1
+			for j < len(s) && strings.IndexByte(" \t\r\n", s[j]) >= 0 {
+				j++
+			}
+			if j < len(s) && (s[j] == '}' || s[j] == ']') {
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
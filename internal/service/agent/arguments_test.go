@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func schemaTool(name, schema string) core.Tool {
+	return core.Tool{
+		Type:     "function",
+		Function: core.Function{Name: name, Parameters: json.RawMessage(schema)},
+	}
+}
+
+const readFileSchema = `{
+  "type": "object",
+  "properties": {
+    "path": { "type": "string", "minLength": 1 },
+    "limit": { "type": "integer", "minimum": 1 }
+  },
+  "required": ["path"]
+}`
+
+func TestPrepareArguments(t *testing.T) {
+	readFile := schemaTool("read_file", readFileSchema)
+
+	tests := []struct {
+		name    string
+		args    string
+		want    string
+		wantErr []string
+	}{
+		{name: "valid is unchanged", args: `{"path": "a.txt"}`, want: `{"path": "a.txt"}`},
+		{name: "code fence", args: "```json\n{\"path\":\"a.txt\"}\n```", want: `{"path":"a.txt"}`},
+		{name: "trailing comma", args: `{"path":"a.txt",}`, want: `{"path":"a.txt"}`},
+		{name: "string number", args: `{"path":"a.txt","limit":"20"}`, want: `{"limit":20,"path":"a.txt"}`},
+		{name: "large integer keeps its precision", args: `{"path":"a.txt","limit":"9007199254740993",}`, want: `{"limit":9007199254740993,"path":"a.txt"}`},
+		{name: "comma inside string is kept", args: `{"path":"a,}.txt"}`, want: `{"path":"a,}.txt"}`},
+		{
+			name:    "missing required",
+			args:    `{"limit":5}`,
+			wantErr: []string{"invalid arguments for read_file", "- path: required property is missing", "Expected schema:"},
+		},
+		{
+			name:    "empty arguments",
+			args:    "",
+			wantErr: []string{"- path: required property is missing"},
+		},
+		{
+			name:    "out of range",
+			args:    `{"path":"a.txt","limit":0}`,
+			wantErr: []string{"- limit: must be >= 1"},
+		},
+		{
+			name:    "not json",
+			args:    `path=a.txt`,
+			wantErr: []string{"arguments for read_file are not valid JSON"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := prepareArguments(readFile, tt.args)
+			if len(tt.wantErr) > 0 {
+				require.Error(t, err)
+				for _, want := range tt.wantErr {
+					assert.Contains(t, err.Error(), want)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPrepareArguments_NoSchema(t *testing.T) {
+	got, err := prepareArguments(tool("fetch_url", false), "")
+	require.NoError(t, err)
+	assert.Equal(t, "{}", got)
+}
+
+func TestExecutor_Execute_InvalidArguments(t *testing.T) {
+	mcp := &concurrencyMCP{
+		tools:    []core.Tool{schemaTool("read_file", readFileSchema)},
+		overlaps: make(map[string]bool),
+	}
+	e := NewExecutor(mcp, 4)
+
+	results := e.Execute(context.Background(), []core.ToolCall{
+		{ID: "call_0", Function: core.FunctionCall{Name: "read_file", Arguments: `{}`}},
+		{ID: "call_1", Function: core.FunctionCall{Name: "read_file", Arguments: `{"path":"a.txt","limit":"3"}`}},
+	})
+
+	require.Len(t, results, 2)
+	assert.Contains(t, results[0].Content, "Error: invalid arguments for read_file")
+	assert.True(t, results[0].IsError)
+	assert.Equal(t, `result {"limit":3,"path":"a.txt"}`, results[1].Content)
+	assert.False(t, results[1].IsError)
+	// The invalid call never reaches the server
+	assert.Equal(t, []string{"read_file:start", "read_file:end"}, mcp.order)
+}
@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+// Budget limits a single agent run. Zero values disable the corresponding limit.
+type Budget struct {
+	MaxSteps         int
+	MaxDuration      time.Duration
+	MaxTokens        int
+	MaxRepeatedCalls int
+}
+
+func NewBudget(cfg core.AgentConfig) Budget {
+	return Budget{
+		MaxSteps:         cfg.GetAgentMaxSteps(),
+		MaxDuration:      cfg.GetAgentMaxDuration(),
+		MaxTokens:        cfg.GetAgentMaxTokens(),
+		MaxRepeatedCalls: cfg.GetAgentMaxRepeatedCalls(),
+	}
+}
+
+// errTimeLimit is the cancellation cause of chat and tool calls still
+// running when the time limit of the run is reached.
+var errTimeLimit = errors.New("time limit of the run reached")
+
+type runDeadlineKey struct{}
+
+// withRunDeadline records the time a run with a duration limit must stop
+// by, so the sub-agents it starts stop by then as well.
+func withRunDeadline(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, runDeadlineKey{}, deadline)
+}
+
+func runDeadline(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Value(runDeadlineKey{}).(time.Time)
+	return deadline, ok
+}
+
+// runTracker accounts the resources consumed by a run against its budget.
+type runTracker struct {
+	budget  Budget
+	started time.Time
+	steps   int
+	tokens  int
+	calls   map[string]int
+}
+
+func newRunTracker(budget Budget) *runTracker {
+	return &runTracker{
+		budget:  budget,
+		started: time.Now(),
+		calls:   make(map[string]int),
+	}
+}
+
+// addStep records one LLM round trip. The tokens the provider reports are
+// counted, and estimated only when it reports none.
+func (t *runTracker) addStep(request []core.Message, response core.Message) {
+	t.steps++
+	if u := response.Usage; u != nil && u.PromptTokens+u.CompletionTokens > 0 {
+		t.tokens += u.PromptTokens + u.CompletionTokens
+		return
+	}
+	t.tokens += estimateTokens(request...) + estimateTokens(response)
+}
+
+// exceeded returns the reason the run must stop before the next step, or "".
+func (t *runTracker) exceeded() string {
+	b := t.budget
+	switch {
+	case b.MaxSteps > 0 && t.steps >= b.MaxSteps:
+		return fmt.Sprintf("step limit of %d reached", b.MaxSteps)
+	case b.MaxDuration > 0 && time.Since(t.started) >= b.MaxDuration:
+		return fmt.Sprintf("time limit of %s reached", b.MaxDuration)
+	case b.MaxTokens > 0 && t.tokens >= b.MaxTokens:
+		return fmt.Sprintf("token limit of %d reached (~%d used)", b.MaxTokens, t.tokens)
+	}
+	return ""
+}
+
+// addCalls records tool calls and returns a reason if the model keeps
+// repeating an identical call, or "".
+func (t *runTracker) addCalls(calls []core.ToolCall) string {
+	for _, tc := range calls {
+		key := tc.Function.Name + "\x00" + tc.Function.Arguments
+		t.calls[key]++
+
+		if max := t.budget.MaxRepeatedCalls; max > 0 && t.calls[key] > max {
+			return fmt.Sprintf("tool %s was called %d times with identical arguments", tc.Function.Name, t.calls[key])
+		}
+	}
+	return ""
+}
+
+// estimateTokens approximates the token count of messages (~4 bytes per token).
+func estimateTokens(messages ...core.Message) int {
+	var size int
+	for _, m := range messages {
+		size += len(m.Content) + len(m.Reasoning)
+		for _, tc := range m.ToolCalls {
+			size += len(tc.Function.Name) + len(tc.Function.Arguments)
+		}
+	}
+	return size / 4
+}
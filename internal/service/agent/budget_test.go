@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedAI returns the next response of the script on every Chat call,
+// repeating the last one when the script is exhausted.
+type scriptedAI struct {
+	mu        sync.Mutex
+	responses []core.Message
+	calls     int
+}
+
+func (s *scriptedAI) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.calls
+	if i >= len(s.responses) {
+		i = len(s.responses) - 1
+	}
+	s.calls++
+	return s.responses[i], nil
+}
+
+func (s *scriptedAI) Models(ctx context.Context) ([]core.Model, error) {
+	return nil, nil
+}
+
+type stubMCP struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (s *stubMCP) GetTools(ctx context.Context) ([]core.Tool, error) {
+	return nil, nil
+}
+
+func (s *stubMCP) CallTool(ctx context.Context, name string, args string) (core.ToolResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, name)
+	return core.ToolResult{Content: "ok"}, nil
+}
+
+type stubMemory struct {
+	mu    sync.Mutex
+	saved []core.Message
+}
+
+func (s *stubMemory) GetFullContext(ctx context.Context, sessionID, userQuery string) ([]core.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]core.Message(nil), s.saved...), nil
+}
+
+func (s *stubMemory) SaveMessage(ctx context.Context, sessionID string, msg core.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, msg)
+	return nil
+}
+
+func toolCallMsg(id, name, args string) core.Message {
+	return core.Message{
+		Role: core.RoleAssistant,
+		ToolCalls: []core.ToolCall{{
+			ID:       id,
+			Type:     "function",
+			Function: core.FunctionCall{Name: name, Arguments: args},
+		}},
+	}
+}
+
+func TestRunTracker_Exceeded(t *testing.T) {
+	t.Run("steps", func(t *testing.T) {
+		tr := newRunTracker(Budget{MaxSteps: 2})
+		tr.addStep(nil, core.Message{})
+		assert.Empty(t, tr.exceeded())
+		tr.addStep(nil, core.Message{})
+		assert.Contains(t, tr.exceeded(), "step limit")
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		tr := newRunTracker(Budget{MaxDuration: time.Minute})
+		assert.Empty(t, tr.exceeded())
+		tr.started = time.Now().Add(-2 * time.Minute)
+		assert.Contains(t, tr.exceeded(), "time limit")
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		tr := newRunTracker(Budget{MaxTokens: 10})
+		tr.addStep([]core.Message{{Content: "short"}}, core.Message{})
+		assert.Empty(t, tr.exceeded())
+		tr.addStep([]core.Message{{Content: string(make([]byte, 100))}}, core.Message{})
+		assert.Contains(t, tr.exceeded(), "token limit")
+	})
+
+	t.Run("reported tokens", func(t *testing.T) {
+		tr := newRunTracker(Budget{MaxTokens: 1000})
+		long := []core.Message{{Content: string(make([]byte, 8000))}}
+		tr.addStep(long, core.Message{Usage: &core.Usage{PromptTokens: 400, CompletionTokens: 100}})
+		assert.Empty(t, tr.exceeded(), "the estimate of the request is not used")
+		tr.addStep(nil, core.Message{Usage: &core.Usage{PromptTokens: 450, CompletionTokens: 50}})
+		assert.Contains(t, tr.exceeded(), "~1000 used")
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		tr := newRunTracker(Budget{})
+		for i := 0; i < 100; i++ {
+			tr.addStep([]core.Message{{Content: "text"}}, core.Message{})
+		}
+		assert.Empty(t, tr.exceeded())
+	})
+}
+
+func TestRunTracker_AddCalls(t *testing.T) {
+	tr := newRunTracker(Budget{MaxRepeatedCalls: 2})
+	same := toolCallMsg("1", "read_file", `{"path":"a"}`).ToolCalls
+	other := toolCallMsg("2", "read_file", `{"path":"b"}`).ToolCalls
+
+	assert.Empty(t, tr.addCalls(same))
+	assert.Empty(t, tr.addCalls(other))
+	assert.Empty(t, tr.addCalls(same))
+	assert.Contains(t, tr.addCalls(same), "identical arguments")
+}
+
+func TestAgent_Run_StopsOnRepeatedCalls(t *testing.T) {
+	ai := &scriptedAI{responses: []core.Message{toolCallMsg("call", "fetch_url", `{"url":"x"}`)}}
+	mcp := &stubMCP{}
+	mem := &stubMemory{}
+
+	a := NewAgent(ai, mcp, mem, NewExecutor(mcp, 1), Budget{MaxSteps: 50, MaxRepeatedCalls: 3}, QueueWait)
+
+	var updates []core.Message
+	out, err := a.Run(context.Background(), "s1", "go", func(m core.Message) {
+		updates = append(updates, m)
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, out, "Run stopped")
+	assert.Len(t, mcp.calls, 3)
+	assert.Equal(t, out, updates[len(updates)-1].Content)
+
+	// The unexecuted call is closed with a synthetic result
+	last := mem.saved[len(mem.saved)-2]
+	assert.Equal(t, core.RoleTool, last.Role)
+	assert.Contains(t, last.Content, "not executed")
+}
+
+func TestAgent_Run_StopsOnStepLimit(t *testing.T) {
+	ai := &scriptedAI{responses: []core.Message{
+		toolCallMsg("1", "fetch_url", `{"url":"a"}`),
+		toolCallMsg("2", "fetch_url", `{"url":"b"}`),
+		toolCallMsg("3", "fetch_url", `{"url":"c"}`),
+	}}
+	mcp := &stubMCP{}
+
+	a := NewAgent(ai, mcp, &stubMemory{}, NewExecutor(mcp, 1), Budget{MaxSteps: 2}, QueueWait)
+
+	out, err := a.Run(context.Background(), "s1", "go", nil)
+	require.NoError(t, err)
+
+	assert.Contains(t, out, "step limit of 2")
+	assert.Equal(t, 2, ai.calls)
+}
+
+// blockingAI answers only when its context ends.
+type blockingAI struct{}
+
+func (blockingAI) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	<-ctx.Done()
+	return core.Message{}, ctx.Err()
+}
+
+func (blockingAI) Models(ctx context.Context) ([]core.Model, error) {
+	return nil, nil
+}
+
+func TestAgent_Run_TimeLimitCutsOffCalls(t *testing.T) {
+	tests := []struct {
+		name string
+		ai   core.AIProvider
+		mcp  core.MCPServer
+	}{
+		{name: "chat", ai: blockingAI{}, mcp: &stubMCP{}},
+		{
+			name: "tool",
+			ai:   &scriptedAI{responses: []core.Message{toolCallMsg("1", "execute_command", `{}`)}},
+			mcp:  &blockingMCP{started: make(chan struct{})},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := &stubMemory{}
+			a := NewAgent(tt.ai, tt.mcp, mem, NewExecutor(tt.mcp, 1), Budget{MaxDuration: 50 * time.Millisecond}, QueueWait)
+
+			start := time.Now()
+			out, err := a.Run(context.Background(), "s1", "go", nil)
+			require.NoError(t, err)
+
+			assert.Less(t, time.Since(start), 5*time.Second)
+			assert.Contains(t, out, "time limit of 50ms reached")
+			assert.Equal(t, out, mem.saved[len(mem.saved)-1].Content)
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/log"
+)
+
+const (
+	DelegateToolName = "delegate_task"
+
+	defaultDelegateSteps = 15
+
+	// nativeServer is the server name that selects built-in tools in the
+	// tools argument, matching the approval policy.
+	nativeServer = "native"
+)
+
+const delegateTaskSchema = `
+{
+  "type": "object",
+  "properties": {
+    "task": { "type": "string", "description": "Complete, self-contained instructions for the sub-agent. It does not see this conversation." },
+    "tools": {
+      "type": "array",
+      "items": { "type": "string" },
+      "description": "Tool names or MCP server names the sub-agent may use (\"native\" for built-in tools). Omit to allow all tools."
+    },
+    "max_steps": { "type": "integer", "description": "Maximum LLM steps of the sub-agent (default 15)" }
+  },
+  "required": ["task"]
+}
+`
+
+const subAgentPrompt = `You are a sub-agent working on a single task delegated by another agent.
+Use the available tools to complete the task on your own, without asking questions.
+When done, reply with a concise final answer with everything the delegating agent needs: results, file paths, and anything that failed.
+Only this final answer is returned, your intermediate steps are not.`
+
+// Delegator runs tasks on child agents. A child gets an ephemeral session,
+// a subset of the parent's tools and its own step budget; only its final
+// answer goes back to the parent.
+type Delegator struct {
+	parent *Agent
+	seq    atomic.Uint64
+}
+
+func NewDelegator(parent *Agent) *Delegator {
+	return &Delegator{parent: parent}
+}
+
+// Definition describes the delegate_task tool.
+func (d *Delegator) Definition() core.Tool {
+	return core.Tool{
+		Type: "function",
+		Function: core.Function{
+			Name:        DelegateToolName,
+			Description: "Delegate a self-contained task to a sub-agent with its own context and optionally a restricted set of tools. Returns the sub-agent's final answer. Independent tasks can be delegated in parallel.",
+			Parameters:  json.RawMessage(delegateTaskSchema),
+		},
+	}
+}
+
+// Handle runs the delegated task. The child run uses ctx, so stopping the
+// parent run stops the child as well. The child shares the parent's
+// execution slots; the delegate_task call gives its own slot up meanwhile.
+func (d *Delegator) Handle(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Task     string   `json:"task"`
+		Tools    []string `json:"tools"`
+		MaxSteps int      `json:"max_steps"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if strings.TrimSpace(input.Task) == "" {
+		return "", fmt.Errorf("task is required")
+	}
+
+	parentID := core.SessionIDFromCtx(ctx)
+	sessionID := core.SubSessionID(parentID, d.seq.Add(1))
+
+	scoped := &scopedMCP{next: d.parent.mcp, allow: input.Tools}
+	if len(input.Tools) > 0 {
+		tools, err := scoped.GetTools(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to get tools: %w", err)
+		}
+		if len(tools) == 0 {
+			return "", fmt.Errorf("none of the requested tools are available: %s", strings.Join(input.Tools, ", "))
+		}
+	}
+
+	budget, err := d.budget(ctx, input.MaxSteps)
+	if err != nil {
+		return "", err
+	}
+	child := NewAgent(
+		d.parent.ai,
+		scoped,
+		newScratchMemory(subAgentPrompt),
+		d.parent.executor.share(scoped),
+		budget,
+		QueueWait,
+	)
+
+	logger := log.FromCtx(ctx).With().
+		Str("parent_session", parentID).
+		Str("sub_session", sessionID).
+		Logger()
+	ctx = logger.WithContext(ctx)
+
+	logger.Info().
+		Strs("tools", input.Tools).
+		Str("task", input.Task).
+		Msg("sub-agent started")
+
+	resume := core.Pause(ctx)
+	answer, err := child.Run(ctx, sessionID, input.Task, func(msg core.Message) {
+		for _, tc := range msg.ToolCalls {
+			logger.Debug().Str("tool", tc.Function.Name).Msg("sub-agent called tool")
+		}
+	})
+	if err := resume(ctx); err != nil {
+		return "", err
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("sub-agent failed")
+		return "", fmt.Errorf("sub-agent failed: %w", err)
+	}
+
+	logger.Info().Msg("sub-agent finished")
+
+	if answer == "" {
+		return "The sub-agent finished without an answer.", nil
+	}
+	return answer, nil
+}
+
+// budget derives the child budget from the parent's. The step limit can
+// be chosen per task but never exceeds the parent's, and the child only
+// gets the time the parent run has left.
+func (d *Delegator) budget(ctx context.Context, steps int) (Budget, error) {
+	b := d.parent.budget
+	if deadline, ok := runDeadline(ctx); ok {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return Budget{}, fmt.Errorf("the time limit of the run is reached")
+		}
+		b.MaxDuration = left
+	}
+	if steps <= 0 {
+		steps = defaultDelegateSteps
+	}
+	if b.MaxSteps > 0 {
+		steps = min(steps, b.MaxSteps)
+	}
+	b.MaxSteps = steps
+	return b, nil
+}
+
+// scopedMCP exposes the tools matching allow, by tool or server name, or
+// all tools if allow is empty. delegate_task itself is never exposed, so
+// sub-agents cannot delegate further.
+type scopedMCP struct {
+	next  core.MCPServer
+	allow []string
+}
+
+func (s *scopedMCP) GetTools(ctx context.Context) ([]core.Tool, error) {
+	tools, err := s.next.GetTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(slices.Clone(tools), func(t core.Tool) bool {
+		return !s.allowed(t)
+	}), nil
+}
+
+func (s *scopedMCP) CallTool(ctx context.Context, name string, args string) (core.ToolResult, error) {
+	tools, err := s.GetTools(ctx)
+	if err != nil {
+		return core.ToolResult{}, fmt.Errorf("failed to get tools: %w", err)
+	}
+	if !slices.ContainsFunc(tools, func(t core.Tool) bool { return t.Function.Name == name }) {
+		return core.ToolResult{}, fmt.Errorf("tool %s is not available to this sub-agent", name)
+	}
+	return s.next.CallTool(ctx, name, args)
+}
+
+func (s *scopedMCP) allowed(t core.Tool) bool {
+	if t.Function.Name == DelegateToolName {
+		return false
+	}
+	if len(s.allow) == 0 {
+		return true
+	}
+
+	server := t.Server
+	if server == "" {
+		server = nativeServer
+	}
+	return slices.Contains(s.allow, t.Function.Name) || slices.Contains(s.allow, server)
+}
+
+// scratchMemory keeps the history of a sub-agent session in memory. It is
+// discarded with the sub-agent.
+type scratchMemory struct {
+	system string
+
+	mu       sync.Mutex
+	messages []core.Message
+}
+
+func newScratchMemory(system string) *scratchMemory {
+	return &scratchMemory{system: system}
+}
+
+func (m *scratchMemory) GetFullContext(ctx context.Context, sessionID, userQuery string) ([]core.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]core.Message, 0, len(m.messages)+1)
+	messages = append(messages, core.Message{Role: core.RoleSystem, Content: m.system, CachePoint: true})
+	return append(messages, m.messages...), nil
+}
+
+func (m *scratchMemory) SaveMessage(ctx context.Context, sessionID string, msg core.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopedMCP_GetTools(t *testing.T) {
+	github := tool("github_list_issues", false)
+	github.Server = "github"
+
+	next := &concurrencyMCP{
+		tools: []core.Tool{
+			tool("read_file", false),
+			tool("execute_command", true),
+			tool(DelegateToolName, false),
+			github,
+		},
+		overlaps: make(map[string]bool),
+	}
+
+	tests := []struct {
+		name  string
+		allow []string
+		want  []string
+	}{
+		{name: "all tools", allow: nil, want: []string{"read_file", "execute_command", "github_list_issues"}},
+		{name: "by name", allow: []string{"read_file"}, want: []string{"read_file"}},
+		{name: "by server", allow: []string{"github"}, want: []string{"github_list_issues"}},
+		{name: "native", allow: []string{"native"}, want: []string{"read_file", "execute_command"}},
+		{name: "no recursion", allow: []string{DelegateToolName}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &scopedMCP{next: next, allow: tt.allow}
+			tools, err := s.GetTools(context.Background())
+			require.NoError(t, err)
+
+			var names []string
+			for _, tool := range tools {
+				names = append(names, tool.Function.Name)
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestScopedMCP_CallTool(t *testing.T) {
+	next := &concurrencyMCP{
+		tools:    []core.Tool{tool("read_file", false), tool("execute_command", true)},
+		overlaps: make(map[string]bool),
+	}
+	s := &scopedMCP{next: next, allow: []string{"read_file"}}
+
+	res, err := s.CallTool(context.Background(), "read_file", "x")
+	require.NoError(t, err)
+	assert.Equal(t, "result x", res.Content)
+
+	_, err = s.CallTool(context.Background(), "execute_command", "{}")
+	assert.ErrorContains(t, err, "not available to this sub-agent")
+}
+
+func TestDelegator_Handle(t *testing.T) {
+	ai := &scriptedAI{responses: []core.Message{
+		toolCallMsg("1", "read_file", `{"path":"a.txt"}`),
+		{Role: core.RoleAssistant, Content: "the file says hello"},
+	}}
+	mcp := &concurrencyMCP{
+		tools:    []core.Tool{tool("read_file", false), tool("execute_command", true)},
+		overlaps: make(map[string]bool),
+	}
+	mem := &stubMemory{}
+	parent := NewAgent(ai, mcp, mem, NewExecutor(mcp, 2), Budget{}, QueueWait)
+
+	ctx := core.WithSessionID(context.Background(), "s1")
+	out, err := NewDelegator(parent).Handle(ctx, json.RawMessage(`{"task":"read a.txt","tools":["read_file"]}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "the file says hello", out)
+	assert.Equal(t, []string{"read_file:start", "read_file:end"}, mcp.order)
+	assert.Empty(t, mem.saved, "the sub-agent must not write to the parent's memory")
+}
+
+func TestDelegator_Handle_Errors(t *testing.T) {
+	mcp := &concurrencyMCP{tools: []core.Tool{tool("read_file", false)}, overlaps: make(map[string]bool)}
+	parent := NewAgent(&scriptedAI{}, mcp, &stubMemory{}, NewExecutor(mcp, 1), Budget{}, QueueWait)
+	d := NewDelegator(parent)
+
+	_, err := d.Handle(context.Background(), json.RawMessage(`{"task":" "}`))
+	assert.ErrorContains(t, err, "task is required")
+
+	_, err = d.Handle(context.Background(), json.RawMessage(`{"task":"x","tools":["missing"]}`))
+	assert.ErrorContains(t, err, "none of the requested tools are available")
+}
+
+func TestDelegator_Handle_StepLimit(t *testing.T) {
+	ai := &scriptedAI{responses: []core.Message{toolCallMsg("1", "read_file", `{}`)}}
+	mcp := &concurrencyMCP{tools: []core.Tool{tool("read_file", false)}, overlaps: make(map[string]bool)}
+	parent := NewAgent(ai, mcp, &stubMemory{}, NewExecutor(mcp, 1), Budget{MaxSteps: 5}, QueueWait)
+
+	out, err := NewDelegator(parent).Handle(context.Background(), json.RawMessage(`{"task":"loop","max_steps":2}`))
+	require.NoError(t, err)
+	assert.Contains(t, out, "step limit of 2 reached")
+	assert.Equal(t, 2, ai.calls)
+}
+
+func TestDelegator_Handle_Stopped(t *testing.T) {
+	ai := &scriptedAI{responses: []core.Message{toolCallMsg("1", "execute_command", `{}`)}}
+	mcp := &blockingMCP{started: make(chan struct{}), tools: []core.Tool{tool("execute_command", true)}}
+	parent := NewAgent(ai, mcp, &stubMemory{}, NewExecutor(mcp, 1), Budget{}, QueueWait)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	go func() {
+		<-mcp.started
+		cancel(ErrStopped)
+	}()
+
+	done := make(chan string)
+	go func() {
+		out, err := NewDelegator(parent).Handle(ctx, json.RawMessage(`{"task":"run forever"}`))
+		assert.NoError(t, err)
+		done <- out
+	}()
+
+	select {
+	case out := <-done:
+		assert.Contains(t, out, "cancelled by the user")
+	case <-time.After(5 * time.Second):
+		t.Fatal("sub-agent was not stopped with its parent")
+	}
+}
+
+func TestDelegator_Budget(t *testing.T) {
+	parent := &Agent{budget: Budget{MaxSteps: 10, MaxRepeatedCalls: 3}}
+	d := NewDelegator(parent)
+
+	budget := func(ctx context.Context, steps int) Budget {
+		b, err := d.budget(ctx, steps)
+		require.NoError(t, err)
+		return b
+	}
+	ctx := context.Background()
+
+	assert.Equal(t, Budget{MaxSteps: 10, MaxRepeatedCalls: 3}, budget(ctx, 0))
+	assert.Equal(t, Budget{MaxSteps: 4, MaxRepeatedCalls: 3}, budget(ctx, 4))
+	assert.Equal(t, Budget{MaxSteps: 10, MaxRepeatedCalls: 3}, budget(ctx, 50))
+
+	parent.budget = Budget{}
+	assert.Equal(t, defaultDelegateSteps, budget(ctx, 0).MaxSteps)
+	assert.Equal(t, 50, budget(ctx, 50).MaxSteps)
+
+	parent.budget = Budget{MaxDuration: time.Hour}
+	left := budget(withRunDeadline(ctx, time.Now().Add(time.Minute)), 0).MaxDuration
+	assert.Greater(t, left, 50*time.Second)
+	assert.LessOrEqual(t, left, time.Minute)
+
+	_, err := d.budget(withRunDeadline(ctx, time.Now().Add(-time.Second)), 0)
+	assert.ErrorContains(t, err, "time limit")
+}
+
+func TestDelegator_Handle_SharesSlots(t *testing.T) {
+	ai := &scriptedAI{responses: []core.Message{
+		toolCallMsg("1", "read_file", `{}`),
+		{Role: core.RoleAssistant, Content: "done"},
+	}}
+	mcp := &concurrencyMCP{tools: []core.Tool{tool("read_file", false)}, overlaps: make(map[string]bool)}
+	executor := NewExecutor(mcp, 1)
+	parent := NewAgent(ai, mcp, &stubMemory{}, executor, Budget{}, QueueWait)
+	d := NewDelegator(parent)
+
+	// Handle runs in the only slot, as it does under the executor
+	executor.sem <- struct{}{}
+	ctx := core.WithPause(context.Background(), func() func(context.Context) error {
+		<-executor.sem
+		return executor.acquire
+	})
+
+	out, err := d.Handle(ctx, json.RawMessage(`{"task":"read a.txt"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "done", out)
+	assert.Equal(t, []string{"read_file:start", "read_file:end"}, mcp.order)
+	assert.Len(t, executor.sem, 1, "the slot is taken back after the sub-agent")
+}
@@ -3,44 +3,152 @@ package agent
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/log"
 )
 
 type Executor struct {
 	mcp core.MCPServer
+
+	// sem caps the number of tool calls running at once across all sessions
+	sem chan struct{}
 }
 
-func NewExecutor(mcp core.MCPServer) *Executor {
+// NewExecutor creates an executor running at most concurrency tool calls
+// at a time. Values below 1 run calls sequentially.
+func NewExecutor(mcp core.MCPServer, concurrency int) *Executor {
+	if concurrency < 1 {
+		concurrency = 1
+	}
 	return &Executor{
 		mcp: mcp,
+		sem: make(chan struct{}, concurrency),
 	}
 }
 
+// Execute runs the tool calls of one assistant turn. Independent calls run
+// concurrently; a serial tool waits for the calls before it and blocks the
+// ones after it. Results are returned in the order of toolCalls.
 func (e *Executor) Execute(ctx context.Context, toolCalls []core.ToolCall) []core.Message {
-	var results []core.Message
-	for _, tc := range toolCalls {
-		res, err := e.mcp.CallTool(ctx, tc.Function.Name, tc.Function.Arguments)
-		if err != nil {
-			res = fmt.Sprintf("Error: %v", err)
+	tools, err := e.tools(ctx)
+	if err != nil {
+		log.FromCtx(ctx).Warn().Err(err).Msg("failed to get tools, executing calls sequentially")
+	}
+	results := make([]core.Message, len(toolCalls))
+
+	var wg sync.WaitGroup
+	for i, tc := range toolCalls {
+		tool, known := tools[tc.Function.Name]
+		if err != nil || tool.Serial {
+			wg.Wait()
+			results[i] = e.call(ctx, tc, tool, known)
+			continue
 		}
 
-		results = append(results, core.Message{
-			Role:       core.RoleTool,
-			Content:    res, // TODO: enable truncate only for specific tools
-			ToolCallID: tc.ID,
-		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = e.call(ctx, tc, tool, known)
+		}()
 	}
+	wg.Wait()
+
 	return results
 }
 
-func (e *Executor) truncate(input string) string {
-	const maxLen = 2000
-	if len(input) <= maxLen {
-		return input
+// call validates the arguments of a known tool and runs it. Invalid
+// arguments are reported back to the model without running the tool.
+func (e *Executor) call(ctx context.Context, tc core.ToolCall, tool core.Tool, known bool) core.Message {
+	var (
+		res core.ToolResult
+		err error
+	)
+	if known {
+		var args string
+		args, err = prepareArguments(tool, tc.Function.Arguments)
+		if err == nil && args != tc.Function.Arguments {
+			log.FromCtx(ctx).Debug().
+				Str("tool", tc.Function.Name).
+				Str("args", tc.Function.Arguments).
+				Str("repaired", args).
+				Msg("repaired tool call arguments")
+		}
+		tc.Function.Arguments = args
+	}
+	if err == nil {
+		res, err = e.acquireAndCall(ctx, tc)
+	}
+
+	if err != nil && ctx.Err() != nil {
+		res = core.ToolResult{Content: fmt.Sprintf("Error: tool call was cancelled: %v", context.Cause(ctx))}
+	} else if err != nil {
+		res = core.ToolResult{Content: fmt.Sprintf("Error: %v", err)}
+	}
+
+	return core.Message{
+		Role:       core.RoleTool,
+		Content:    res.Content,
+		Parts:      res.Parts,
+		ToolCallID: tc.ID,
+		IsError:    err != nil,
+	}
+}
+
+// acquireAndCall runs the call in an execution slot. A call waiting for
+// approval gives its slot up meanwhile, so unanswered prompts do not block
+// the tools of other sessions.
+func (e *Executor) acquireAndCall(ctx context.Context, tc core.ToolCall) (core.ToolResult, error) {
+	if err := e.acquire(ctx); err != nil {
+		return core.ToolResult{}, err
 	}
+	held := true
+	defer func() {
+		if held {
+			<-e.sem
+		}
+	}()
+
+	ctx = core.WithPause(ctx, func() func(context.Context) error {
+		<-e.sem
+		held = false
+		return func(ctx context.Context) error {
+			if err := e.acquire(ctx); err != nil {
+				return err
+			}
+			held = true
+			return nil
+		}
+	})
+	return e.mcp.CallTool(ctx, tc.Function.Name, tc.Function.Arguments)
+}
+
+// share returns an executor calling tools on mcp in the execution slots of
+// e, so its calls count against the same concurrency limit.
+func (e *Executor) share(mcp core.MCPServer) *Executor {
+	return &Executor{mcp: mcp, sem: e.sem}
+}
 
-	head := input[:500]
-	tail := input[len(input)-(maxLen-500):]
-	return fmt.Sprintf("%s\n\n... [TRUNCATED %d bytes] ...\n\n%s", head, len(input)-maxLen, tail)
+func (e *Executor) acquire(ctx context.Context) error {
+	select {
+	case e.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tools returns the available tools by name.
+func (e *Executor) tools(ctx context.Context) (map[string]core.Tool, error) {
+	tools, err := e.mcp.GetTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]core.Tool, len(tools))
+	for _, t := range tools {
+		byName[t.Function.Name] = t
+	}
+	return byName, nil
 }
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"slices"
+)
+
+// QueueMode controls what happens to a message that arrives while the
+// session is busy with another run.
+type QueueMode string
+
+const (
+	// QueueWait runs the message after the current run finishes.
+	QueueWait QueueMode = "queue"
+	// QueueMerge hands the message to the current run as a follow-up,
+	// falling back to QueueWait if the run ends before picking it up.
+	QueueMerge QueueMode = "merge"
+)
+
+// sessionQueue serializes the runs of one session. Waiting runs are
+// resumed in arrival order.
+type sessionQueue struct {
+	running   bool
+	waiters   []chan struct{}
+	followUps []*followUp
+}
+
+type followUp struct {
+	input string
+	taken chan struct{}
+}
+
+// acquire waits until the session is free. It returns merged=true if the
+// input was taken over by the active run instead, in which case there is
+// nothing to release.
+func (a *Agent) acquire(ctx context.Context, sessionID, input string, onQueued func(merged bool)) (merged bool, err error) {
+	a.mu.Lock()
+	q, ok := a.sessions[sessionID]
+	if !ok {
+		q = &sessionQueue{}
+		a.sessions[sessionID] = q
+	}
+	if !q.running {
+		q.running = true
+		a.mu.Unlock()
+		return false, nil
+	}
+
+	turn := make(chan struct{})
+	q.waiters = append(q.waiters, turn)
+
+	var f *followUp
+	if a.queueMode == QueueMerge {
+		f = &followUp{input: input, taken: make(chan struct{})}
+		q.followUps = append(q.followUps, f)
+	}
+	a.mu.Unlock()
+
+	if onQueued != nil {
+		onQueued(f != nil)
+	}
+
+	var taken <-chan struct{}
+	if f != nil {
+		taken = f.taken
+	}
+
+	select {
+	case <-turn:
+	case <-taken:
+	case <-ctx.Done():
+	}
+
+	a.mu.Lock()
+	q.followUps = slices.DeleteFunc(q.followUps, func(x *followUp) bool { return x == f })
+	a.mu.Unlock()
+
+	// The input went to the active run, so the turn is not needed
+	if f != nil && isClosed(f.taken) {
+		a.leaveQueue(sessionID, q, turn)
+		return true, nil
+	}
+	if isClosed(turn) {
+		return false, nil
+	}
+	a.leaveQueue(sessionID, q, turn)
+	return false, ctx.Err()
+}
+
+// leaveQueue gives up a place in the queue. If the turn was already handed
+// over, it is passed on to the next waiter.
+func (a *Agent) leaveQueue(sessionID string, q *sessionQueue, turn chan struct{}) {
+	a.mu.Lock()
+	i := slices.Index(q.waiters, turn)
+	if i >= 0 {
+		q.waiters = slices.Delete(q.waiters, i, i+1)
+	}
+	a.mu.Unlock()
+
+	if i < 0 {
+		a.release(sessionID)
+	}
+}
+
+// release ends the active run of the session and wakes the next waiter.
+func (a *Agent) release(sessionID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	q, ok := a.sessions[sessionID]
+	if !ok {
+		return
+	}
+	if len(q.waiters) > 0 {
+		next := q.waiters[0]
+		q.waiters = q.waiters[1:]
+		close(next)
+		return
+	}
+	delete(a.sessions, sessionID)
+}
+
+// takeFollowUps returns the inputs merged into the active run since the
+// last call.
+func (a *Agent) takeFollowUps(sessionID string) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	q, ok := a.sessions[sessionID]
+	if !ok || len(q.followUps) == 0 {
+		return nil
+	}
+
+	inputs := make([]string, 0, len(q.followUps))
+	for _, f := range q.followUps {
+		inputs = append(inputs, f.input)
+		close(f.taken)
+	}
+	q.followUps = nil
+	return inputs
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
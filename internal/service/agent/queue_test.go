@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedAI blocks every Chat call until the test lets it through.
+type gatedAI struct {
+	entered chan []core.Message
+	release chan core.Message
+}
+
+func newGatedAI() *gatedAI {
+	return &gatedAI{entered: make(chan []core.Message), release: make(chan core.Message)}
+}
+
+func (g *gatedAI) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	g.entered <- history
+	return <-g.release, nil
+}
+
+func (g *gatedAI) Models(ctx context.Context) ([]core.Model, error) {
+	return nil, nil
+}
+
+func waitFor[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+		panic("unreachable")
+	}
+}
+
+func contents(messages []core.Message) []string {
+	var out []string
+	for _, m := range messages {
+		out = append(out, m.Role+":"+m.Content)
+	}
+	return out
+}
+
+func TestAgent_Queue_Wait(t *testing.T) {
+	ai := newGatedAI()
+	mcp := &stubMCP{}
+	mem := &stubMemory{}
+	a := NewAgent(ai, mcp, mem, NewExecutor(mcp, 1), Budget{}, QueueWait)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		out, err := a.Run(context.Background(), "s1", "first", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "one", out)
+	}()
+	waitFor(t, ai.entered)
+
+	queued := make(chan bool, 1)
+	go func() {
+		defer wg.Done()
+		out, err := a.RunStream(context.Background(), "s1", "second", Callbacks{
+			OnQueued: func(merged bool) { queued <- merged },
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "two", out)
+	}()
+	assert.False(t, waitFor(t, queued))
+
+	ai.release <- core.Message{Role: core.RoleAssistant, Content: "one"}
+	waitFor(t, ai.entered)
+	ai.release <- core.Message{Role: core.RoleAssistant, Content: "two"}
+	wg.Wait()
+
+	assert.Equal(t, []string{"user:first", "assistant:one", "user:second", "assistant:two"}, contents(mem.saved))
+}
+
+func TestAgent_Queue_Merge(t *testing.T) {
+	ai := newGatedAI()
+	mcp := &stubMCP{}
+	mem := &stubMemory{}
+	a := NewAgent(ai, mcp, mem, NewExecutor(mcp, 1), Budget{}, QueueMerge)
+
+	done := make(chan string)
+	go func() {
+		out, err := a.Run(context.Background(), "s1", "first", nil)
+		assert.NoError(t, err)
+		done <- out
+	}()
+	waitFor(t, ai.entered)
+
+	queued := make(chan bool, 1)
+	merged := make(chan string)
+	go func() {
+		out, err := a.RunStream(context.Background(), "s1", "also this", Callbacks{
+			OnQueued: func(merged bool) { queued <- merged },
+		})
+		assert.NoError(t, err)
+		merged <- out
+	}()
+	assert.True(t, waitFor(t, queued))
+
+	// The follow-up is injected after the tool results of the first step
+	ai.release <- toolCallMsg("1", "fetch_url", `{}`)
+	history := waitFor(t, ai.entered)
+	assert.Equal(t, "user:also this", contents(history)[len(history)-1])
+	assert.Equal(t, "", waitFor(t, merged))
+
+	ai.release <- core.Message{Role: core.RoleAssistant, Content: "both done"}
+	assert.Equal(t, "both done", waitFor(t, done))
+
+	assert.Equal(t, []string{
+		"user:first", "assistant:", "tool:ok", "user:also this", "assistant:both done",
+	}, contents(mem.saved))
+}
+
+func TestAgent_Queue_MergeFallsBackToWait(t *testing.T) {
+	ai := newGatedAI()
+	mcp := &stubMCP{}
+	mem := &stubMemory{}
+	a := NewAgent(ai, mcp, mem, NewExecutor(mcp, 1), Budget{}, QueueMerge)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := a.Run(context.Background(), "s1", "first", nil)
+		assert.NoError(t, err)
+	}()
+	waitFor(t, ai.entered)
+
+	queued := make(chan bool, 1)
+	go func() {
+		defer wg.Done()
+		out, err := a.RunStream(context.Background(), "s1", "second", Callbacks{
+			OnQueued: func(merged bool) { queued <- merged },
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "two", out)
+	}()
+	waitFor(t, queued)
+
+	// The first run finishes without another step, so the input runs on its own
+	ai.release <- core.Message{Role: core.RoleAssistant, Content: "one"}
+	waitFor(t, ai.entered)
+	ai.release <- core.Message{Role: core.RoleAssistant, Content: "two"}
+	wg.Wait()
+
+	assert.Equal(t, []string{"user:first", "assistant:one", "user:second", "assistant:two"}, contents(mem.saved))
+}
+
+func TestAgent_Queue_SessionsRunInParallel(t *testing.T) {
+	ai := newGatedAI()
+	mcp := &stubMCP{}
+	a := NewAgent(ai, mcp, &stubMemory{}, NewExecutor(mcp, 1), Budget{}, QueueWait)
+
+	var wg sync.WaitGroup
+	for _, session := range []string{"s1", "s2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := a.RunStream(context.Background(), session, "hi", Callbacks{
+				OnQueued: func(bool) { t.Error("different sessions must not queue") },
+			})
+			assert.NoError(t, err)
+		}()
+	}
+
+	// Both runs reach the model before either is released
+	waitFor(t, ai.entered)
+	waitFor(t, ai.entered)
+	ai.release <- core.Message{Role: core.RoleAssistant, Content: "a"}
+	ai.release <- core.Message{Role: core.RoleAssistant, Content: "b"}
+	wg.Wait()
+}
+
+func TestAgent_Queue_CancelWhileWaiting(t *testing.T) {
+	ai := newGatedAI()
+	mcp := &stubMCP{}
+	a := NewAgent(ai, mcp, &stubMemory{}, NewExecutor(mcp, 1), Budget{}, QueueWait)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = a.Run(context.Background(), "s1", "first", nil)
+	}()
+	waitFor(t, ai.entered)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := make(chan bool, 1)
+	errs := make(chan error)
+	go func() {
+		_, err := a.RunStream(ctx, "s1", "second", Callbacks{OnQueued: func(m bool) { queued <- m }})
+		errs <- err
+	}()
+	waitFor(t, queued)
+	cancel()
+	require.ErrorIs(t, waitFor(t, errs), context.Canceled)
+
+	ai.release <- core.Message{Role: core.RoleAssistant, Content: "one"}
+	waitFor(t, done)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	assert.Empty(t, a.sessions)
+}
@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/service/replay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Replay(t *testing.T) {
+	r, err := replay.LoadReplayer("testdata/replay_notes.jsonl")
+	require.NoError(t, err)
+
+	ai, mcp := r.AIProvider(), r.MCPServer()
+	a := NewAgent(ai, mcp, &stubMemory{}, NewExecutor(mcp, 4), Budget{}, QueueWait)
+
+	out, err := a.Run(context.Background(), "telegram:42", "What do my notes link to?", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "The notes mention example.com, which is a placeholder domain.", out)
+	assert.Empty(t, r.Divergences())
+	assert.Zero(t, r.Remaining())
+}
+
+func TestAgent_Replay_Divergence(t *testing.T) {
+	r, err := replay.LoadReplayer("testdata/replay_notes.jsonl")
+	require.NoError(t, err)
+	r.Strict = true
+
+	ai, mcp := r.AIProvider(), r.MCPServer()
+	a := NewAgent(ai, mcp, &stubMemory{}, NewExecutor(mcp, 4), Budget{}, QueueWait)
+
+	_, err = a.Run(context.Background(), "telegram:42", "What does my todo list say?", nil)
+	assert.ErrorContains(t, err, "replay diverged")
+}
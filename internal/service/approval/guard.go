@@ -0,0 +1,142 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/log"
+)
+
+var _ core.MCPServer = (*Guard)(nil)
+
+// Guard enforces the approval policy in front of an MCP server.
+type Guard struct {
+	next    core.MCPServer
+	path    string
+	timeout time.Duration
+
+	mu       sync.RWMutex
+	policy   *Policy
+	approver core.Approver
+}
+
+func NewGuard(next core.MCPServer, cfg core.ApprovalConfig) (*Guard, error) {
+	policy, err := LoadPolicy(cfg.GetApprovalsPath())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Guard{
+		next:    next,
+		path:    cfg.GetApprovalsPath(),
+		timeout: cfg.GetApprovalTimeout(),
+		policy:  policy,
+	}, nil
+}
+
+// SetApprover sets who is asked when a rule requires approval. Without an
+// approver such calls are denied.
+func (g *Guard) SetApprover(approver core.Approver) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.approver = approver
+}
+
+func (g *Guard) GetTools(ctx context.Context) ([]core.Tool, error) {
+	return g.next.GetTools(ctx)
+}
+
+func (g *Guard) CallTool(ctx context.Context, name string, args string) (core.ToolResult, error) {
+	server, err := g.serverOf(ctx, name)
+	if err != nil {
+		return core.ToolResult{}, err
+	}
+
+	g.mu.RLock()
+	action := g.policy.Decide(name, server, args)
+	g.mu.RUnlock()
+
+	switch action {
+	case ActionDeny:
+		return core.ToolResult{}, fmt.Errorf("tool %s is denied by the approval policy", name)
+	case ActionAsk:
+		if err := g.ask(ctx, core.ApprovalRequest{Tool: name, Server: server, Args: args}); err != nil {
+			return core.ToolResult{}, err
+		}
+	}
+
+	return g.next.CallTool(ctx, name, args)
+}
+
+func (g *Guard) ask(ctx context.Context, req core.ApprovalRequest) error {
+	g.mu.RLock()
+	approver := g.approver
+	g.mu.RUnlock()
+
+	if approver == nil {
+		return fmt.Errorf("tool %s requires approval, but no approver is available", req.Tool)
+	}
+
+	askCtx := ctx
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		askCtx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	// The execution slot is free for other calls while the owner decides
+	resume := core.Pause(ctx)
+	decision, err := approver.RequestApproval(askCtx, req)
+	if err := resume(ctx); err != nil {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("tool %s was not approved in time", req.Tool)
+	}
+	if err != nil {
+		return fmt.Errorf("approval request failed: %w", err)
+	}
+
+	switch decision {
+	case core.ApprovalAlwaysAllow:
+		g.allowAlways(ctx, req)
+		return nil
+	case core.ApprovalApprove:
+		return nil
+	default:
+		return fmt.Errorf("tool %s was denied by the owner", req.Tool)
+	}
+}
+
+func (g *Guard) allowAlways(ctx context.Context, req core.ApprovalRequest) {
+	server := req.Server
+	if server == "" {
+		server = NativeServer
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.policy.AllowTool(req.Tool, server)
+	if err := g.policy.Save(g.path); err != nil {
+		log.FromCtx(ctx).Error().Err(err).Str("tool", req.Tool).Msg("failed to save approval policy")
+	}
+}
+
+// serverOf returns the MCP server providing the tool, or "" for native tools.
+func (g *Guard) serverOf(ctx context.Context, name string) (string, error) {
+	tools, err := g.next.GetTools(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get tools: %w", err)
+	}
+	for _, t := range tools {
+		if t.Function.Name == name {
+			return t.Server, nil
+		}
+	}
+	return "", fmt.Errorf("tool not found: %s", name)
+}
@@ -0,0 +1,121 @@
+package approval
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubConfig struct {
+	path    string
+	timeout time.Duration
+}
+
+func (c stubConfig) GetApprovalsPath() string          { return c.path }
+func (c stubConfig) GetApprovalTimeout() time.Duration { return c.timeout }
+
+type stubMCP struct {
+	calls []string
+}
+
+func (s *stubMCP) GetTools(ctx context.Context) ([]core.Tool, error) {
+	return []core.Tool{
+		{Function: core.Function{Name: "read_file"}},
+		{Function: core.Function{Name: "write_file"}},
+		{Function: core.Function{Name: "search"}, Server: "remote"},
+	}, nil
+}
+
+func (s *stubMCP) CallTool(ctx context.Context, name string, args string) (core.ToolResult, error) {
+	s.calls = append(s.calls, name)
+	return core.ToolResult{Content: "ok"}, nil
+}
+
+type stubApprover struct {
+	decision core.ApprovalDecision
+	wait     bool
+	requests []core.ApprovalRequest
+}
+
+func (s *stubApprover) RequestApproval(ctx context.Context, req core.ApprovalRequest) (core.ApprovalDecision, error) {
+	s.requests = append(s.requests, req)
+	if s.wait {
+		<-ctx.Done()
+		return core.ApprovalDeny, ctx.Err()
+	}
+	return s.decision, nil
+}
+
+func newTestGuard(t *testing.T, timeout time.Duration) (*Guard, *stubMCP) {
+	t.Helper()
+	next := &stubMCP{}
+	g, err := NewGuard(next, stubConfig{path: filepath.Join(t.TempDir(), "approvals.json"), timeout: timeout})
+	require.NoError(t, err)
+	return g, next
+}
+
+func TestGuard_CallTool(t *testing.T) {
+	tests := []struct {
+		name     string
+		tool     string
+		approver *stubApprover
+		wantErr  string
+		asked    bool
+	}{
+		{name: "allowed without asking", tool: "read_file", approver: &stubApprover{}},
+		{name: "approved", tool: "write_file", approver: &stubApprover{decision: core.ApprovalApprove}, asked: true},
+		{name: "denied", tool: "write_file", approver: &stubApprover{decision: core.ApprovalDeny}, wantErr: "denied by the owner", asked: true},
+		{name: "timeout denies", tool: "search", approver: &stubApprover{wait: true}, wantErr: "not approved in time", asked: true},
+		{name: "no approver", tool: "write_file", wantErr: "no approver"},
+		{name: "unknown tool", tool: "missing", approver: &stubApprover{}, wantErr: "tool not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, next := newTestGuard(t, 10*time.Millisecond)
+			if tt.approver != nil {
+				g.SetApprover(tt.approver)
+			}
+
+			out, err := g.CallTool(context.Background(), tt.tool, `{}`)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Empty(t, next.calls)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "ok", out.Content)
+				assert.Equal(t, []string{tt.tool}, next.calls)
+			}
+
+			if tt.approver != nil {
+				assert.Equal(t, tt.asked, len(tt.approver.requests) == 1)
+			}
+		})
+	}
+}
+
+func TestGuard_AlwaysAllow(t *testing.T) {
+	g, next := newTestGuard(t, time.Second)
+	approver := &stubApprover{decision: core.ApprovalAlwaysAllow}
+	g.SetApprover(approver)
+
+	for i := 0; i < 2; i++ {
+		_, err := g.CallTool(context.Background(), "search", `{"q":"x"}`)
+		require.NoError(t, err)
+	}
+
+	assert.Len(t, approver.requests, 1)
+	assert.Equal(t, core.ApprovalRequest{Tool: "search", Server: "remote", Args: `{"q":"x"}`}, approver.requests[0])
+	assert.Len(t, next.calls, 2)
+
+	// The rule survives a restart
+	reloaded, err := LoadPolicy(g.path)
+	require.NoError(t, err)
+	assert.Equal(t, ActionAllow, reloaded.Decide("search", "remote", `{}`))
+}
@@ -0,0 +1,153 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+)
+
+type Action string
+
+const (
+	ActionAllow Action = "allow"
+	ActionDeny  Action = "deny"
+	ActionAsk   Action = "ask"
+)
+
+// NativeServer is the server name rules use to match built-in tools.
+const NativeServer = "native"
+
+// Rule matches a tool call. Empty fields match anything; Tool and Server
+// are glob patterns, Args is a regular expression over the raw JSON arguments.
+type Rule struct {
+	Tool   string `json:"tool,omitempty"`
+	Server string `json:"server,omitempty"`
+	Args   string `json:"args,omitempty"`
+	Action Action `json:"action"`
+
+	args *regexp.Regexp
+}
+
+// Policy decides what happens to a tool call. The first matching rule wins,
+// Default applies when none match.
+type Policy struct {
+	Default Action `json:"default"`
+	Rules   []Rule `json:"rules"`
+}
+
+// DefaultPolicy asks before running shell commands, file changes and any
+// tool from an external MCP server.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Default: ActionAsk,
+		Rules: []Rule{
+			{Tool: "execute_command", Action: ActionAsk},
+			{Tool: "write_file", Action: ActionAsk},
+			{Tool: "edit_file", Action: ActionAsk},
+			{Server: NativeServer, Action: ActionAllow},
+		},
+	}
+}
+
+// LoadPolicy reads the policy file, creating it with DefaultPolicy if missing.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		p := DefaultPolicy()
+		if err := p.Save(path); err != nil {
+			return nil, fmt.Errorf("failed to create default approval policy: %w", err)
+		}
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approval policy: %w", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse approval policy: %w", err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, fmt.Errorf("invalid approval policy: %w", err)
+	}
+	return &p, nil
+}
+
+func (p *Policy) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal approval policy: %w", err)
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func (p *Policy) compile() error {
+	if p.Default == "" {
+		p.Default = ActionAsk
+	}
+	if !p.Default.valid() {
+		return fmt.Errorf("unknown default action %q", p.Default)
+	}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if !r.Action.valid() {
+			return fmt.Errorf("rule %d: unknown action %q", i, r.Action)
+		}
+		for _, pattern := range []string{r.Tool, r.Server} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d: bad pattern %q: %w", i, pattern, err)
+			}
+		}
+		if r.Args != "" {
+			re, err := regexp.Compile(r.Args)
+			if err != nil {
+				return fmt.Errorf("rule %d: bad args pattern: %w", i, err)
+			}
+			r.args = re
+		}
+	}
+	return nil
+}
+
+// Decide returns the action for a call of tool from server with args.
+// An empty server means a native tool.
+func (p *Policy) Decide(tool, server, args string) Action {
+	if server == "" {
+		server = NativeServer
+	}
+	for _, r := range p.Rules {
+		if r.matches(tool, server, args) {
+			return r.Action
+		}
+	}
+	return p.Default
+}
+
+// AllowTool puts an allow rule for tool in front of all other rules.
+func (p *Policy) AllowTool(tool, server string) {
+	rule := Rule{Tool: tool, Server: server, Action: ActionAllow}
+	p.Rules = append([]Rule{rule}, p.Rules...)
+}
+
+func (r Rule) matches(tool, server, args string) bool {
+	if !glob(r.Tool, tool) || !glob(r.Server, server) {
+		return false
+	}
+	return r.args == nil || r.args.MatchString(args)
+}
+
+func glob(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+func (a Action) valid() bool {
+	return a == ActionAllow || a == ActionDeny || a == ActionAsk
+}
@@ -0,0 +1,95 @@
+package approval
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Decide(t *testing.T) {
+	p := &Policy{
+		Default: ActionAsk,
+		Rules: []Rule{
+			{Tool: "execute_command", Args: `rm\s+-rf`, Action: ActionDeny},
+			{Tool: "execute_command", Args: `^\{"command":"ls`, Action: ActionAllow},
+			{Server: "github", Tool: "github_get_*", Action: ActionAllow},
+			{Server: NativeServer, Tool: "read_file", Action: ActionAllow},
+		},
+	}
+	require.NoError(t, p.compile())
+
+	tests := []struct {
+		name   string
+		tool   string
+		server string
+		args   string
+		want   Action
+	}{
+		{"denied by args", "execute_command", "", `{"command":"rm -rf /"}`, ActionDeny},
+		{"allowed by args", "execute_command", "", `{"command":"ls -la"}`, ActionAllow},
+		{"no args match", "execute_command", "", `{"command":"make"}`, ActionAsk},
+		{"server glob", "github_get_issue", "github", `{}`, ActionAllow},
+		{"server mismatch", "github_get_issue", "gitlab", `{}`, ActionAsk},
+		{"native tool", "read_file", "", `{}`, ActionAllow},
+		{"mcp tool with native name", "read_file", "fs", `{}`, ActionAsk},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, p.Decide(tt.tool, tt.server, tt.args))
+		})
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	p := DefaultPolicy()
+	require.NoError(t, p.compile())
+
+	assert.Equal(t, ActionAsk, p.Decide("execute_command", "", `{}`))
+	assert.Equal(t, ActionAsk, p.Decide("write_file", "", `{}`))
+	assert.Equal(t, ActionAllow, p.Decide("read_file", "", `{}`))
+	assert.Equal(t, ActionAsk, p.Decide("fetch", "remote", `{}`))
+}
+
+func TestLoadPolicy(t *testing.T) {
+	t.Run("creates default", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "approvals.json")
+
+		p, err := LoadPolicy(path)
+		require.NoError(t, err)
+		assert.Equal(t, DefaultPolicy(), p)
+		assert.FileExists(t, path)
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "approvals.json")
+		p := DefaultPolicy()
+		p.AllowTool("write_file", NativeServer)
+		require.NoError(t, p.Save(path))
+
+		loaded, err := LoadPolicy(path)
+		require.NoError(t, err)
+		assert.Equal(t, ActionAllow, loaded.Decide("write_file", "", `{}`))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		tests := map[string]string{
+			"bad action":  `{"rules":[{"tool":"x","action":"maybe"}]}`,
+			"bad regexp":  `{"rules":[{"args":"(","action":"deny"}]}`,
+			"bad pattern": `{"rules":[{"tool":"[","action":"deny"}]}`,
+			"bad json":    `{`,
+		}
+		for name, content := range tests {
+			t.Run(name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "approvals.json")
+				require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+				_, err := LoadPolicy(path)
+				assert.Error(t, err)
+			})
+		}
+	})
+}
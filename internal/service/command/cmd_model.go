@@ -3,6 +3,9 @@ package command
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sandevgo/tuskbot/internal/core"
 )
@@ -10,16 +13,28 @@ import (
 type ModelCommand struct {
 	cfg       core.ProviderConfig
 	state     core.GlobalState
+	models    core.ModelManager
+	settings  core.SessionSettingsRepository
+	runs      core.RunTracker
 	formatter *ResponseFormatter
 }
 
+// NewModelCommand creates the /model command. models manages the Ollama
+// models of the pull, rm and ps subcommands; a pull can be stopped through
+// runs.
 func NewModelCommand(
 	cfg core.ProviderConfig,
 	state core.GlobalState,
+	models core.ModelManager,
+	settings core.SessionSettingsRepository,
+	runs core.RunTracker,
 ) *ModelCommand {
 	return &ModelCommand{
 		cfg:       cfg,
 		state:     state,
+		models:    models,
+		settings:  settings,
+		runs:      runs,
 		formatter: NewResponseFormatter(),
 	}
 }
@@ -29,29 +44,296 @@ func (c *ModelCommand) Name() string {
 }
 
 func (c *ModelCommand) Description() string {
-	return "Show or change current model"
+	return "Show or change the model and its parameters for this chat"
 }
 
 func (c *ModelCommand) Execute(ctx context.Context, sessionID string, args []string) (string, error) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "pull", "rm":
+			if len(args) != 2 {
+				return "", fmt.Errorf("usage: /model %s [model]", args[0])
+			}
+			name := strings.TrimPrefix(args[1], "ollama/")
+			if args[0] == "pull" {
+				return c.pull(ctx, sessionID, name)
+			}
+			return c.remove(ctx, name)
+		case "ps":
+			return c.running(ctx)
+		}
+	}
+
+	settings, err := c.settings.GetSessionSettings(ctx, sessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get session settings: %w", err)
+	}
+
 	if len(args) == 0 {
+		return c.show(ctx, settings), nil
+	}
+
+	var global, reset bool
+	var model string
+	var params []string
+	for _, arg := range args {
+		switch {
+		case arg == "--global":
+			global = true
+		case arg == "reset":
+			reset = true
+		case strings.Contains(arg, "="):
+			params = append(params, arg)
+		default:
+			model = arg
+		}
+	}
+
+	if global {
+		if model == "" || len(params) > 0 || reset {
+			return "", fmt.Errorf("--global only changes the model: /model --global [provider]/[model]")
+		}
+		if err := c.state.ChangeModel(ctx, model); err != nil {
+			return "", fmt.Errorf("failed to set model: %w", err)
+		}
+		name := fmt.Sprintf("%s/%s", c.cfg.GetProvider(), c.cfg.GetModel())
 		return c.formatter.Combine(
-			c.formatter.Info("Current Model"),
-			c.formatter.Label("Provider", c.cfg.GetProvider()),
-			c.formatter.Label("Model", c.cfg.GetModel()),
-			c.formatter.Usage("/model [provider]/[model]"),
-			c.formatter.Examples([]string{
-				"/model openai/gpt-4",
-				"/model anthropic/claude-3-sonnet",
-				"/model openrouter/openai/gpt-3.5-turbo",
-			}),
+			c.formatter.Success(fmt.Sprintf("Global model changed to: `%s`", name)),
+			c.toolWarning(ctx, name),
 		), nil
 	}
 
-	if err := c.state.ChangeModel(ctx, args[0]); err != nil {
-		return "", fmt.Errorf("failed to set model: %w", err)
+	if reset {
+		settings = core.SessionSettings{SessionID: sessionID}
+	}
+	if model != "" {
+		if err := c.state.CheckModel(ctx, model); err != nil {
+			return "", fmt.Errorf("invalid model: %w", err)
+		}
+		settings.Model = model
+	}
+	for _, param := range params {
+		if err := setParam(&settings.Options, param); err != nil {
+			return "", err
+		}
+	}
+
+	if err := c.settings.SaveSessionSettings(ctx, settings); err != nil {
+		return "", fmt.Errorf("failed to save session settings: %w", err)
+	}
+	return c.formatter.Combine(
+		c.formatter.Success("Settings of this chat updated"),
+		c.toolWarning(ctx, model),
+		c.describe(ctx, settings),
+	), nil
+}
+
+// toolWarning warns that a model cannot take tools natively. It is empty
+// for other models and when no model was given.
+func (c *ModelCommand) toolWarning(ctx context.Context, model string) string {
+	if model == "" || c.state.Capabilities(ctx, model).SupportsTools() {
+		return ""
+	}
+	return c.formatter.Warning(fmt.Sprintf(
+		"`%s` does not support tool calls, tools will be described in the prompt. Tool use may be unreliable.", model))
+}
+
+func (c *ModelCommand) show(ctx context.Context, settings core.SessionSettings) string {
+	return c.formatter.Combine(
+		c.formatter.Info("Current Model"),
+		c.describe(ctx, settings),
+		c.formatter.Usage("/model [--global] [provider]/[model] [temperature=0.7] [max_tokens=4096] [reasoning=low|medium|high]\n/model pull|rm [ollama model]\n/model ps"),
+		c.formatter.Examples([]string{
+			"/model openai/gpt-4",
+			"/model anthropic/claude-3-sonnet temperature=0.2",
+			"/model reasoning=high max_tokens=default",
+			"/model --global openrouter/openai/gpt-3.5-turbo",
+			"/model vllm/ (default model of a provider from providers.json)",
+			"/model reset",
+			"/model pull qwen3:8b",
+			"/model ps",
+		}),
+		c.formatter.Tip("Without --global the change applies to this chat only"),
+	)
+}
+
+func (c *ModelCommand) describe(ctx context.Context, settings core.SessionSettings) string {
+	global := fmt.Sprintf("%s/%s", c.cfg.GetProvider(), c.cfg.GetModel())
+
+	model, name := global+" (global)", global
+	if settings.Model != "" {
+		model, name = settings.Model, settings.Model
+	}
+
+	opts := settings.Options
+	temperature, maxTokens, reasoning := "default", "default", "default"
+	if opts.Temperature != nil {
+		temperature = strconv.FormatFloat(*opts.Temperature, 'f', -1, 64)
+	}
+	if opts.MaxTokens > 0 {
+		maxTokens = strconv.Itoa(opts.MaxTokens)
+	}
+	if opts.ReasoningEffort != "" {
+		reasoning = opts.ReasoningEffort
+	}
+
+	return c.formatter.Combine(
+		c.formatter.Label("Model", model),
+		c.formatter.Label("Temperature", temperature),
+		c.formatter.Label("Max tokens", maxTokens),
+		c.formatter.Label("Reasoning", reasoning),
+		c.formatter.Label("Capabilities", describeCapabilities(c.state.Capabilities(ctx, name))),
+	)
+}
+
+// describeCapabilities lists what is known about a model, e.g.
+// "200k context, 64k output, tools, vision".
+func describeCapabilities(caps core.Capabilities) string {
+	var known []string
+	if caps.ContextWindow > 0 {
+		known = append(known, fmt.Sprintf("%dk context", caps.ContextWindow/1000))
+	}
+	if caps.MaxOutputTokens > 0 {
+		known = append(known, fmt.Sprintf("%dk output", caps.MaxOutputTokens/1000))
+	}
+	if !caps.SupportsTools() {
+		known = append(known, "tools in prompt")
+	}
+	for _, f := range []struct {
+		name string
+		has  *bool
+	}{
+		{"tools", caps.Tools},
+		{"vision", caps.Vision},
+		{"reasoning", caps.Reasoning},
+	} {
+		if f.has != nil && *f.has {
+			known = append(known, f.name)
+		}
+	}
+
+	if len(known) == 0 {
+		return "unknown"
+	}
+	return strings.Join(known, ", ")
+}
+
+// setParam applies a "key=value" argument. The value "default" removes
+// the override.
+func setParam(opts *core.ChatOptions, param string) error {
+	key, value, _ := strings.Cut(param, "=")
+	reset := value == "default"
+
+	switch key {
+	case "temperature":
+		if reset {
+			opts.Temperature = nil
+			return nil
+		}
+		t, err := strconv.ParseFloat(value, 64)
+		if err != nil || t < 0 || t > 2 {
+			return fmt.Errorf("temperature must be a number between 0 and 2")
+		}
+		opts.Temperature = &t
+
+	case "max_tokens":
+		if reset {
+			opts.MaxTokens = 0
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("max_tokens must be a positive number")
+		}
+		opts.MaxTokens = n
+
+	case "reasoning":
+		switch value {
+		case "default":
+			opts.ReasoningEffort = ""
+		case "low", "medium", "high":
+			opts.ReasoningEffort = value
+		default:
+			return fmt.Errorf("reasoning must be low, medium or high")
+		}
+
+	default:
+		return fmt.Errorf("unknown parameter: %s", key)
 	}
+	return nil
+}
 
+// pull downloads an Ollama model, reporting the progress of the download.
+// The download stops with the session's runs, on /stop or the Stop button.
+func (c *ModelCommand) pull(ctx context.Context, sessionID, name string) (string, error) {
+	ctx, untrack := c.runs.Track(ctx, sessionID)
+	defer untrack()
+
+	err := c.models.PullModel(ctx, name, func(p core.PullProgress) {
+		core.ReportProgress(ctx, fmt.Sprintf("⬇️ Pulling %s: %s", name, describePull(p)))
+	})
+	if err != nil && ctx.Err() != nil {
+		return c.formatter.Warning(fmt.Sprintf("Stopped pulling `ollama/%s`", name)), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to pull %s: %w", name, err)
+	}
 	return c.formatter.Combine(
-		c.formatter.Success(fmt.Sprintf("Model changed to: `%s/%s`", c.cfg.GetProvider(), c.cfg.GetModel())),
+		c.formatter.Success(fmt.Sprintf("Pulled `ollama/%s`", name)),
+		c.formatter.Tip(fmt.Sprintf("Use it in this chat with /model ollama/%s", name)),
 	), nil
 }
+
+func (c *ModelCommand) remove(ctx context.Context, name string) (string, error) {
+	if err := c.models.DeleteModel(ctx, name); err != nil {
+		return "", fmt.Errorf("failed to remove %s: %w", name, err)
+	}
+	return c.formatter.Success(fmt.Sprintf("Removed `ollama/%s`", name)), nil
+}
+
+// running lists the Ollama models that are loaded.
+func (c *ModelCommand) running(ctx context.Context) (string, error) {
+	models, err := c.models.RunningModels(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list loaded models: %w", err)
+	}
+	if len(models) == 0 {
+		return c.formatter.Info("No Ollama models are loaded"), nil
+	}
+
+	items := make([]string, 0, len(models))
+	for _, m := range models {
+		item := fmt.Sprintf("`%s` %s", m.Name, formatBytes(m.Size))
+		if m.Size > 0 {
+			item += fmt.Sprintf(", %d%% GPU", m.VRAM*100/m.Size)
+		}
+		if m.ContextLength > 0 {
+			item += fmt.Sprintf(", %d context", m.ContextLength)
+		}
+		switch until := time.Until(m.ExpiresAt); {
+		case m.ExpiresAt.IsZero():
+		case until > 365*24*time.Hour:
+			item += ", stays loaded"
+		default:
+			item += fmt.Sprintf(", unloads in %s", until.Round(time.Minute))
+		}
+		items = append(items, item)
+	}
+	return c.formatter.Combine(c.formatter.Info("Loaded Ollama Models"), c.formatter.List(items)), nil
+}
+
+// describePull describes a step of a download, e.g.
+// "pulling 6a0746a1ec1a 1.2 GB of 4.7 GB (25%)".
+func describePull(p core.PullProgress) string {
+	if p.Total <= 0 {
+		return p.Status
+	}
+	return fmt.Sprintf("%s %s of %s (%d%%)", p.Status, formatBytes(p.Completed), formatBytes(p.Total), p.Completed*100/p.Total)
+}
+
+func formatBytes(n int64) string {
+	if n >= 1e9 {
+		return fmt.Sprintf("%.1f GB", float64(n)/1e9)
+	}
+	return fmt.Sprintf("%d MB", n/1e6)
+}
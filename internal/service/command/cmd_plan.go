@@ -0,0 +1,75 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+type PlanCommand struct {
+	plans     core.PlanRepository
+	formatter *ResponseFormatter
+}
+
+func NewPlanCommand(plans core.PlanRepository) core.Command {
+	return &PlanCommand{
+		plans:     plans,
+		formatter: NewResponseFormatter(),
+	}
+}
+
+func (c *PlanCommand) Name() string {
+	return "plan"
+}
+
+func (c *PlanCommand) Description() string {
+	return "Show the progress of the current plan"
+}
+
+func (c *PlanCommand) Execute(ctx context.Context, sessionID string, args []string) (string, error) {
+	plan, err := c.plans.GetActivePlan(ctx, sessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get plan: %w", err)
+	}
+	if plan == nil {
+		return c.formatter.Combine(
+			c.formatter.Info("Plan"),
+			c.formatter.Label("Status", "No active plan"),
+			c.formatter.Tip("Ask the agent to make a plan for a long task"),
+		), nil
+	}
+
+	if len(args) > 0 && args[0] == "clear" {
+		if err := c.plans.SetPlanStatus(ctx, plan.ID, core.PlanCancelled); err != nil {
+			return "", fmt.Errorf("failed to clear plan: %w", err)
+		}
+		return c.formatter.Success(fmt.Sprintf("Plan cleared: %s", plan.Title)), nil
+	}
+
+	marks := map[core.StepStatus]string{
+		core.StepPending:    "⬜",
+		core.StepInProgress: "🔄",
+		core.StepDone:       "✅",
+		core.StepFailed:     "❌",
+		core.StepSkipped:    "⏭",
+	}
+
+	var steps strings.Builder
+	for _, s := range plan.Steps {
+		fmt.Fprintf(&steps, "%s %d. %s\n", marks[s.Status], s.Position, s.Description)
+		if s.Note != "" {
+			fmt.Fprintf(&steps, "      _%s_\n", s.Note)
+		}
+	}
+
+	return c.formatter.Combine(
+		c.formatter.Info("Plan"),
+		c.formatter.Label("Task", plan.Title),
+		c.formatter.Label("Progress", fmt.Sprintf("%d/%d", plan.Done(), len(plan.Steps))),
+		"",
+		steps.String(),
+		c.formatter.Usage("/plan clear"),
+	), nil
+}
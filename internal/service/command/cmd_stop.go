@@ -0,0 +1,37 @@
+package command
+
+import (
+	"context"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+type StopCommand struct {
+	runs      core.RunStopper
+	formatter *ResponseFormatter
+}
+
+func NewStopCommand(runs core.RunStopper) core.Command {
+	return &StopCommand{
+		runs:      runs,
+		formatter: NewResponseFormatter(),
+	}
+}
+
+func (c *StopCommand) Name() string {
+	return "stop"
+}
+
+func (c *StopCommand) Description() string {
+	return "Stop the running task"
+}
+
+func (c *StopCommand) Execute(ctx context.Context, sessionID string, args []string) (string, error) {
+	if !c.runs.Stop(sessionID) {
+		return c.formatter.Combine(
+			c.formatter.Info("Stop"),
+			c.formatter.Label("Status", "Nothing is running"),
+		), nil
+	}
+	return c.formatter.Success("Stopping the current task"), nil
+}
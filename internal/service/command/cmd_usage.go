@@ -0,0 +1,143 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+type UsageCommand struct {
+	usage     core.UsageRepository
+	budget    float64
+	now       func() time.Time
+	formatter *ResponseFormatter
+}
+
+func NewUsageCommand(usage core.UsageRepository, budget float64) *UsageCommand {
+	return &UsageCommand{
+		usage:     usage,
+		budget:    budget,
+		now:       time.Now,
+		formatter: NewResponseFormatter(),
+	}
+}
+
+func (c *UsageCommand) Name() string {
+	return "usage"
+}
+
+func (c *UsageCommand) Description() string {
+	return "Show token usage and LLM costs"
+}
+
+func (c *UsageCommand) Execute(ctx context.Context, sessionID string, args []string) (string, error) {
+	now := c.now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	view := ""
+	if len(args) > 0 {
+		view = args[0]
+	}
+
+	switch view {
+	case "daily":
+		days, err := c.usage.SumUsage(ctx, today.AddDate(0, 0, -6), core.UsageByDay)
+		if err != nil {
+			return "", fmt.Errorf("failed to get usage: %w", err)
+		}
+		return c.formatter.Combine(
+			c.formatter.Info("Usage by Day"),
+			c.list(days, "No requests in the last 7 days"),
+		), nil
+
+	case "models":
+		models, err := c.usage.SumUsage(ctx, today.AddDate(0, 0, -29), core.UsageByModel)
+		if err != nil {
+			return "", fmt.Errorf("failed to get usage: %w", err)
+		}
+		return c.formatter.Combine(
+			c.formatter.Info("Usage by Model (30 days)"),
+			c.list(models, "No requests in the last 30 days"),
+		), nil
+
+	case "":
+	default:
+		return "", fmt.Errorf("unknown view %q, use daily or models", view)
+	}
+
+	periods := []struct {
+		label string
+		since time.Time
+	}{
+		{"Today", today},
+		{"Last 7 days", today.AddDate(0, 0, -6)},
+		{"This month", month},
+	}
+
+	var totals []string
+	var monthCost float64
+	for _, p := range periods {
+		sums, err := c.usage.SumUsage(ctx, p.since, core.UsageTotal)
+		if err != nil {
+			return "", fmt.Errorf("failed to get usage: %w", err)
+		}
+		var sum core.UsageSum
+		if len(sums) > 0 {
+			sum = sums[0]
+		}
+		totals = append(totals, fmt.Sprintf("**%s**: %s", p.label, formatSum(sum)))
+		monthCost = sum.Usage.Cost
+	}
+
+	models, err := c.usage.SumUsage(ctx, month, core.UsageByModel)
+	if err != nil {
+		return "", fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	budget := "none"
+	if c.budget > 0 {
+		budget = fmt.Sprintf("$%.2f of $%.2f (%.0f%%)", monthCost, c.budget, 100*monthCost/c.budget)
+	}
+
+	return c.formatter.Combine(
+		c.formatter.Info("Usage"),
+		c.formatter.List(totals),
+		c.formatter.Label("Monthly budget", budget),
+		c.formatter.Section("🧮", "This month by model", c.list(models, "No requests this month")),
+		c.formatter.Usage("/usage [daily|models]"),
+		c.formatter.Tip("Prices of models that do not report costs are set in prices.json"),
+	), nil
+}
+
+func (c *UsageCommand) list(sums []core.UsageSum, empty string) string {
+	if len(sums) == 0 {
+		return empty + "\n"
+	}
+	items := make([]string, len(sums))
+	for i, s := range sums {
+		items[i] = fmt.Sprintf("`%s`: %s", s.Key, formatSum(s))
+	}
+	return c.formatter.List(items)
+}
+
+func formatSum(s core.UsageSum) string {
+	text := fmt.Sprintf("%d requests, %s in / %s out", s.Requests, formatTokens(s.Usage.PromptTokens), formatTokens(s.Usage.CompletionTokens))
+	if s.Usage.CachedTokens > 0 {
+		text += fmt.Sprintf(" (%s cached)", formatTokens(s.Usage.CachedTokens))
+	}
+	return text + fmt.Sprintf(", $%.4f", s.Usage.Cost)
+}
+
+func formatTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
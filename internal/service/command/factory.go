@@ -7,10 +7,19 @@ import (
 func NewCommands(
 	cfg core.ProviderConfig,
 	state core.GlobalState,
+	models core.ModelManager,
 	mcp core.MCPServer,
+	runs core.RunTracker,
+	plans core.PlanRepository,
+	settings core.SessionSettingsRepository,
+	usage core.UsageRepository,
+	budget float64,
 ) []core.Command {
 	return []core.Command{
-		NewModelCommand(cfg, state),
+		NewModelCommand(cfg, state, models, settings, runs),
 		NewMCPCommand(mcp),
+		NewStopCommand(runs),
+		NewPlanCommand(plans),
+		NewUsageCommand(usage, budget),
 	}
 }
@@ -23,6 +23,10 @@ func (f *ResponseFormatter) Error(operation string, err error) string {
 	return fmt.Sprintf("❌ **Command Error**\n\n**Issue**: %s\n", err.Error())
 }
 
+func (f *ResponseFormatter) Warning(message string) string {
+	return fmt.Sprintf("⚠️ %s\n", message)
+}
+
 func (f *ResponseFormatter) Label(label, value string) string {
 	return fmt.Sprintf("**%s**  ›  `%s`\n", label, value)
 }
@@ -15,6 +15,13 @@ import (
 
 type modelInitMsg struct{}
 
+// namedModelsMsg carries the result of fetching the models of a provider
+// of providers.json together with the provider.
+type namedModelsMsg struct {
+	named llm.NamedProvider
+	msg   tea.Msg
+}
+
 // ModelStep allows selection of the AI model based on provider
 type ModelStep struct {
 	list       list.Model
@@ -24,6 +31,9 @@ type ModelStep struct {
 	provider   string
 	manualMode bool
 	input      textinput.Model
+
+	// named is set for a provider of providers.json
+	named *llm.NamedProvider
 }
 
 func NewModelStep() Step {
@@ -72,6 +82,10 @@ func (s *ModelStep) Update(msg tea.Msg, state *InstallState, width, height int)
 	}
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
+	case namedModelsMsg:
+		s.named = &msg.named
+		return s.Update(msg.msg, state, width, height)
+
 	case modelsMsg:
 		s.list.SetItems(msg)
 		s.loading = false
@@ -79,7 +93,7 @@ func (s *ModelStep) Update(msg tea.Msg, state *InstallState, width, height int)
 		return s, nil
 
 	case errMsg:
-		if s.provider == "ollama" || s.provider == "custom" {
+		if s.provider == "ollama" || s.provider == "custom" || s.named != nil {
 			s.manualMode = true
 			s.loading = false
 			s.fetching = false
@@ -90,6 +104,9 @@ func (s *ModelStep) Update(msg tea.Msg, state *InstallState, width, height int)
 			s.input.CharLimit = 100
 			s.input.Width = 40
 			s.input.Placeholder = "llama3.2, mistral, codellama..."
+			if s.named != nil && s.named.DefaultModel != "" {
+				s.input.SetValue(s.named.DefaultModel)
+			}
 			return s, textinput.Blink
 		}
 		s.loading = false
@@ -147,30 +164,42 @@ func (s *ModelStep) fetchModels(state *InstallState) tea.Cmd {
 		case "ollama":
 			baseURL := state.EnvVars["TUSK_OLLAMA_BASE_URL"]
 			apiKey := state.EnvVars["TUSK_OLLAMA_API_KEY"]
-			provider = llm.NewOllama(baseURL, apiKey, "")
+			provider = llm.NewOllama(llm.OllamaConfig{BaseURL: baseURL, APIKey: apiKey})
 		case "custom":
 			baseURL := state.EnvVars["TUSK_CUSTOM_OPENAI_BASE_URL"]
 			apiKey := state.EnvVars["TUSK_CUSTOM_OPENAI_API_KEY"]
 			provider = llm.NewCustomOpenAI(baseURL, apiKey, "")
 		default:
-			return errMsg(fmt.Errorf("unknown provider: %s", s.provider))
+			providers, err := llm.LoadNamedProviders(providersPath())
+			if err != nil {
+				return errMsg(err)
+			}
+			named, ok := providers[s.provider]
+			if !ok {
+				return errMsg(fmt.Errorf("unknown provider: %s", s.provider))
+			}
+			return namedModelsMsg{named: named, msg: listModels(ctx, named.New(""))}
 		}
+		return listModels(ctx, provider)
+	}
+}
 
-		models, err := provider.Models(ctx)
-		if err != nil {
-			return errMsg(err)
-		}
+// listModels returns the models of the provider as list items.
+func listModels(ctx context.Context, provider core.AIProvider) tea.Msg {
+	models, err := provider.Models(ctx)
+	if err != nil {
+		return errMsg(err)
+	}
 
-		items := make([]list.Item, 0, len(models))
-		for _, m := range models {
-			items = append(items, item{
-				id:    m.ID,
-				title: m.Name,
-				desc:  fmt.Sprintf("ID: %s | Context: %d", m.ID, m.ContextLength),
-			})
+	items := make([]list.Item, 0, len(models))
+	for _, m := range models {
+		desc := "ID: " + m.ID
+		if m.ContextLength > 0 {
+			desc += fmt.Sprintf(" | Context: %d", m.ContextLength)
 		}
-		return modelsMsg(items)
+		items = append(items, item{id: m.ID, title: m.Name, desc: desc})
 	}
+	return modelsMsg(items)
 }
 
 func (s *ModelStep) View(state *InstallState) string {
@@ -2,22 +2,44 @@ package installer
 
 import (
 	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sandevgo/tuskbot/internal/config"
+	"github.com/sandevgo/tuskbot/internal/providers/llm"
 )
 
-// ProviderStep allows selection of the AI provider
+// ProviderStep allows selection of the AI provider, including the named
+// providers of runtime/providers.json
 type ProviderStep struct {
 	choices []string
 	cursor  int
+	err     error
 }
 
 func NewProviderStep() Step {
-	return &ProviderStep{
+	s := &ProviderStep{
 		choices: []string{"Anthropic", "OpenAI", "OpenRouter", "Ollama", "Custom"},
 		cursor:  0,
 	}
+
+	providers, err := llm.LoadNamedProviders(providersPath())
+	if err != nil {
+		s.err = err
+	}
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	s.choices = append(s.choices, names...)
+	return s
+}
+
+func providersPath() string {
+	return filepath.Join(config.GetRuntimePath(), "providers.json")
 }
 
 func (s *ProviderStep) Init() tea.Cmd {
@@ -47,6 +69,9 @@ func (s *ProviderStep) Update(msg tea.Msg, state *InstallState, width, height in
 func (s *ProviderStep) View(state *InstallState) string {
 	var b strings.Builder
 	b.WriteString("Select your AI Provider:\n\n")
+	if s.err != nil {
+		b.WriteString(errorStyle.Render(s.err.Error()) + "\n\n")
+	}
 	for i, choice := range s.choices {
 		cursor := " "
 		if s.cursor == i {
@@ -0,0 +1,212 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+const (
+	// defaultContextTokens is used when neither the config nor the provider
+	// knows the context length of the model.
+	defaultContextTokens = 32768
+
+	// maxResponseReserve caps the part of the window kept free for the
+	// response.
+	maxResponseReserve = 8192
+
+	// Shares of the input budget
+	systemShare     = 0.25
+	ragShare        = 0.10
+	summaryShare    = 0.10
+	planShare       = 0.05
+	toolOutputShare = 0.25
+
+	// minToolTokens is how far tool outputs of older turns are shrunk
+	// before whole turns are dropped.
+	minToolTokens = 256
+
+	// messageOverhead accounts for role and formatting tokens per message.
+	messageOverhead = 4
+)
+
+// contextBudget splits a model's context window between system prompt
+// files, RAG context and history.
+type contextBudget struct {
+	input int
+	count func(string) int
+}
+
+// newContextBudget keeps part of the window free for the response, less
+// for models with a lower output limit. maxOutput is 0 if it is unknown.
+func newContextBudget(contextLength, maxOutput int, count func(string) int) contextBudget {
+	reserve := min(contextLength/4, maxResponseReserve)
+	if maxOutput > 0 {
+		reserve = min(reserve, maxOutput)
+	}
+	return contextBudget{
+		input: contextLength - reserve,
+		count: count,
+	}
+}
+
+// withTools takes the tool definitions sent with every request out of the
+// input budget.
+func (b contextBudget) withTools(tools []core.Tool) contextBudget {
+	if len(tools) == 0 {
+		return b
+	}
+	data, err := json.Marshal(tools)
+	if err != nil {
+		return b
+	}
+	b.input = max(b.input-b.count(string(data)), 0)
+	return b
+}
+
+func (b contextBudget) tokens(messages ...core.Message) int {
+	var n int
+	for _, m := range messages {
+		n += messageOverhead + b.count(m.Content)
+		for _, tc := range m.ToolCalls {
+			n += b.count(tc.Function.Name) + b.count(tc.Function.Arguments)
+		}
+	}
+	return n
+}
+
+// fitSystem shrinks system prompt files proportionally to their size when
+// together they exceed their share.
+func (b contextBudget) fitSystem(messages []core.Message) []core.Message {
+	limit := int(float64(b.input) * systemShare)
+	total := b.tokens(messages...)
+	if total <= limit {
+		return messages
+	}
+
+	fitted := make([]core.Message, len(messages))
+	for i, m := range messages {
+		allowed := b.tokens(m)*limit/total - messageOverhead
+		m.Content = b.shrink(m.Content, allowed)
+		fitted[i] = m
+	}
+	return fitted
+}
+
+func (b contextBudget) fitRAG(text string) string {
+	return b.shrink(text, int(float64(b.input)*ragShare))
+}
+
+func (b contextBudget) fitSummary(text string) string {
+	return b.shrink(text, int(float64(b.input)*summaryShare))
+}
+
+func (b contextBudget) fitPlan(text string) string {
+	return b.shrink(text, int(float64(b.input)*planShare))
+}
+
+// fitHistory trims history to the budget. Oversized tool outputs are
+// shrunk first, then the oldest turns are dropped. A turn starts with a
+// user message, so tool calls are never separated from their results. The
+// last turn is always kept.
+func (b contextBudget) fitHistory(history []core.Message, budget int) []core.Message {
+	turns := splitTurns(history)
+	if len(turns) == 0 {
+		return nil
+	}
+
+	// 1. Cap every tool output
+	maxTool := max(int(float64(budget)*toolOutputShare), minToolTokens)
+	for _, turn := range turns {
+		b.shrinkToolOutputs(turn, maxTool)
+	}
+
+	size := 0
+	for _, turn := range turns {
+		size += b.tokens(turn...)
+	}
+
+	// 2. Shrink tool outputs of older turns further, oldest first
+	for i := 0; i < len(turns)-1 && size > budget; i++ {
+		before := b.tokens(turns[i]...)
+		b.shrinkToolOutputs(turns[i], minToolTokens)
+		size -= before - b.tokens(turns[i]...)
+	}
+
+	// 3. Drop the oldest turns
+	for len(turns) > 1 && size > budget {
+		size -= b.tokens(turns[0]...)
+		turns = turns[1:]
+	}
+
+	// 4. Make the remaining turn fit by shrinking its tool outputs
+	if size > budget {
+		last := turns[len(turns)-1]
+		var fixed, outputs int
+		for _, m := range last {
+			if m.Role == core.RoleTool {
+				outputs++
+			} else {
+				fixed += b.tokens(m)
+			}
+		}
+		if outputs > 0 {
+			b.shrinkToolOutputs(last, max((budget-fixed)/outputs, messageOverhead))
+		}
+	}
+
+	fitted := make([]core.Message, 0, len(history))
+	for _, turn := range turns {
+		fitted = append(fitted, turn...)
+	}
+	return fitted
+}
+
+func (b contextBudget) shrinkToolOutputs(turn []core.Message, maxTokens int) {
+	for i := range turn {
+		if turn[i].Role == core.RoleTool {
+			turn[i].Content = b.shrink(turn[i].Content, maxTokens)
+		}
+	}
+}
+
+// shrink cuts text to about maxTokens, keeping its head and tail.
+func (b contextBudget) shrink(text string, maxTokens int) string {
+	tokens := b.count(text)
+	if tokens <= maxTokens {
+		return text
+	}
+
+	marker := fmt.Sprintf("\n\n... [truncated %d of %d tokens] ...\n\n", tokens-maxTokens, tokens)
+	keep := len(text)*maxTokens/tokens - len(marker)
+	if keep <= 0 {
+		return fmt.Sprintf("[truncated %d tokens]", tokens)
+	}
+
+	head := runeBoundary(text, keep*2/3)
+	tail := runeBoundary(text, len(text)-(keep-head))
+	return text[:head] + marker + text[tail:]
+}
+
+// splitTurns groups history into turns, each starting at a user message.
+// Messages before the first user message form a turn of their own.
+func splitTurns(history []core.Message) [][]core.Message {
+	var turns [][]core.Message
+	for i, m := range history {
+		if m.Role == core.RoleUser || i == 0 {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], m)
+	}
+	return turns
+}
+
+// runeBoundary moves i forward to the start of a UTF-8 sequence.
+func runeBoundary(s string, i int) int {
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,163 @@
+package memory
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/tokenizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBudget(contextLength int) contextBudget {
+	return newContextBudget(contextLength, 0, tokenizer.Estimate)
+}
+
+func user(content string) core.Message {
+	return core.Message{Role: core.RoleUser, Content: content}
+}
+
+func assistant(content string, calls ...string) core.Message {
+	m := core.Message{Role: core.RoleAssistant, Content: content}
+	for _, id := range calls {
+		m.ToolCalls = append(m.ToolCalls, core.ToolCall{ID: id, Function: core.FunctionCall{Name: "fetch_url", Arguments: "{}"}})
+	}
+	return m
+}
+
+func toolResult(id, content string) core.Message {
+	return core.Message{Role: core.RoleTool, Content: content, ToolCallID: id}
+}
+
+func roles(messages []core.Message) string {
+	var out []string
+	for _, m := range messages {
+		out = append(out, m.Role)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestContextBudget_New(t *testing.T) {
+	assert.Equal(t, 6000, testBudget(8000).input)
+	assert.Equal(t, 128000-8192, testBudget(128000).input)
+	assert.Equal(t, 128000-4096, newContextBudget(128000, 4096, tokenizer.Estimate).input, "output limit")
+
+	tools := []core.Tool{{Type: "function", Function: core.Function{Name: "fetch_url", Description: strings.Repeat("abcd", 1000)}}}
+	assert.Less(t, testBudget(8000).withTools(tools).input, 6000-1000, "tool definitions")
+	assert.Equal(t, 6000, testBudget(8000).withTools(nil).input)
+	assert.Zero(t, testBudget(1000).withTools(tools).input)
+}
+
+func TestContextBudget_Shrink(t *testing.T) {
+	b := testBudget(8000)
+	text := strings.Repeat("abcdefgh", 1000) // 2000 tokens
+
+	assert.Equal(t, "short", b.shrink("short", 100))
+
+	out := b.shrink(text, 500)
+	assert.LessOrEqual(t, b.count(out), 500)
+	assert.Contains(t, out, "[truncated 1500 of 2000 tokens]")
+	assert.True(t, strings.HasPrefix(out, "abcdefgh"))
+
+	// Cuts never split a multi-byte rune
+	out = b.shrink(strings.Repeat("привет ", 500), 100)
+	assert.True(t, strings.ToValidUTF8(out, "") == out)
+}
+
+func TestContextBudget_FitHistory(t *testing.T) {
+	big := strings.Repeat("x", 40000) // 10000 tokens
+
+	tests := []struct {
+		name      string
+		history   []core.Message
+		budget    int
+		wantRoles string
+		check     func(t *testing.T, got []core.Message)
+	}{
+		{
+			name:      "fits unchanged",
+			history:   []core.Message{user("hi"), assistant("hello"), user("bye")},
+			budget:    1000,
+			wantRoles: "user,assistant,user",
+		},
+		{
+			name: "oversized tool output is shrunk instead of dropping turns",
+			history: []core.Message{
+				user("read it"), assistant("", "1"), toolResult("1", big), assistant("done"),
+				user("thanks"),
+			},
+			budget:    4000,
+			wantRoles: "user,assistant,tool,assistant,user",
+			check: func(t *testing.T, got []core.Message) {
+				assert.Contains(t, got[2].Content, "truncated")
+			},
+		},
+		{
+			name: "oldest turns are dropped whole",
+			history: []core.Message{
+				user(strings.Repeat("a", 4000)), assistant(strings.Repeat("b", 4000)),
+				user("second"), assistant("", "1", "2"), toolResult("1", "r1"), toolResult("2", "r2"), assistant("ok"),
+				user("third"),
+			},
+			budget:    200,
+			wantRoles: "user,assistant,tool,tool,assistant,user",
+		},
+		{
+			name: "leading fragment without user message is dropped first",
+			history: []core.Message{
+				toolResult("0", strings.Repeat("z", 2000)), assistant("earlier"),
+				user("now"),
+			},
+			budget:    100,
+			wantRoles: "user",
+		},
+		{
+			name: "last turn is kept and its tool outputs shrunk",
+			history: []core.Message{
+				user("go"), assistant("", "1"), toolResult("1", big),
+			},
+			budget:    1000,
+			wantRoles: "user,assistant,tool",
+			check: func(t *testing.T, got []core.Message) {
+				assert.LessOrEqual(t, testBudget(8000).tokens(got...), 1000)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBudget(32000)
+			got := b.fitHistory(tt.history, tt.budget)
+
+			assert.Equal(t, tt.wantRoles, roles(got))
+			assert.LessOrEqual(t, b.tokens(got...), tt.budget)
+			if tt.check != nil {
+				tt.check(t, got)
+			}
+		})
+	}
+}
+
+func TestContextBudget_FitHistory_DoesNotModifyInput(t *testing.T) {
+	history := []core.Message{user("go"), assistant("", "1"), toolResult("1", strings.Repeat("x", 40000))}
+
+	testBudget(32000).fitHistory(history, 500)
+	assert.Len(t, history[2].Content, 40000)
+}
+
+func TestContextBudget_FitSystem(t *testing.T) {
+	b := testBudget(8000) // 6000 input tokens, 1500 for system files
+
+	small := []core.Message{{Role: core.RoleSystem, Content: "rules"}}
+	assert.Equal(t, small, b.fitSystem(small))
+
+	large := []core.Message{
+		{Role: core.RoleSystem, Content: strings.Repeat("s", 8000)},
+		{Role: core.RoleSystem, Content: strings.Repeat("m", 24000)},
+	}
+	got := b.fitSystem(large)
+	require.Len(t, got, 2)
+	assert.LessOrEqual(t, b.tokens(got...), 1500)
+	assert.Less(t, b.tokens(got[0]), b.tokens(got[1]))
+}
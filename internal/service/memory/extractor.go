@@ -44,6 +44,9 @@ func (e *Extractor) Start(ctx context.Context) error {
 	logger := log.FromCtx(ctx)
 	logger.Info().Msg("starting knowledge extractor")
 
+	// Gives way to chat requests when the provider is rate limited
+	ctx = core.WithBackground(ctx)
+
 	ticker := time.NewTicker(e.Interval)
 	defer ticker.Stop()
 
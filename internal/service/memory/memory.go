@@ -3,53 +3,154 @@ package memory
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/sandevgo/tuskbot/internal/core"
 	"github.com/sandevgo/tuskbot/pkg/log"
+	"github.com/sandevgo/tuskbot/pkg/tokenizer"
 )
 
 type Memory struct {
-	cfg      core.AppConfig
-	msgRepo  core.MessagesRepository
-	knowRepo core.KnowledgeRepository
-	embedder core.Embedder
-	prompter *SysPrompt
+	cfg       core.AppConfig
+	msgRepo   core.MessagesRepository
+	knowRepo  core.KnowledgeRepository
+	summaries core.SummaryRepository
+	plans     core.PlanRepository
+	embedder  core.Embedder
+	prompter  *SysPrompt
+	models    core.CapabilityProvider
+	tools     core.MCPServer
+
+	// countTokens is replaceable in tests
+	countTokens func(string) int
 }
 
 func NewMemory(
 	cfg core.AppConfig,
 	msgRepo core.MessagesRepository,
 	knowRepo core.KnowledgeRepository,
+	summaries core.SummaryRepository,
+	plans core.PlanRepository,
 	embedder core.Embedder,
 	prompter *SysPrompt,
+	models core.CapabilityProvider,
+	tools core.MCPServer,
 ) *Memory {
 	return &Memory{
-		cfg:      cfg,
-		msgRepo:  msgRepo,
-		knowRepo: knowRepo,
-		embedder: embedder,
-		prompter: prompter,
+		cfg:         cfg,
+		msgRepo:     msgRepo,
+		knowRepo:    knowRepo,
+		summaries:   summaries,
+		plans:       plans,
+		embedder:    embedder,
+		prompter:    prompter,
+		models:      models,
+		tools:       tools,
+		countTokens: tokenizer.Count,
 	}
 }
 
+// GetFullContext assembles the prompt within the model's context window:
+// system prompt files, RAG context, the session summary and the active plan
+// are capped at their share of the budget, and the history not yet
+// summarized fills the rest.
+//
+// The prompt files and the summary rarely change and come first, marked as
+// a cache point, so providers can reuse them from their prompt cache. The
+// plan and the RAG context, which change with every run, follow them.
 func (s *Memory) GetFullContext(ctx context.Context, sessionID, userQuery string) ([]core.Message, error) {
-	messages := s.prompter.Build()
+	contextLength, maxOutput := s.contextSize(ctx)
+	budget := newContextBudget(contextLength, maxOutput, s.countTokens).withTools(s.toolDefinitions(ctx))
+
+	messages := budget.fitSystem(s.prompter.Build())
+
+	summary, err := s.summaries.GetSummary(ctx, sessionID)
+	if err != nil {
+		log.FromCtx(ctx).Warn().Err(err).Msg("failed to get session summary")
+	}
+	if summary.Summary != "" {
+		messages = append(messages, core.Message{
+			Role:    core.RoleSystem,
+			Content: "### Summary of Earlier Conversation\n" + budget.fitSummary(summary.Summary),
+		})
+	}
+	if n := len(messages); n > 0 {
+		messages[n-1].CachePoint = true
+	}
+
+	plan, err := s.plans.GetActivePlan(ctx, sessionID)
+	if err != nil {
+		log.FromCtx(ctx).Warn().Err(err).Msg("failed to get active plan")
+	}
+	if plan != nil {
+		messages = append(messages, core.Message{
+			Role:    core.RoleSystem,
+			Content: budget.fitPlan(planPrompt(*plan)),
+		})
+	}
 
 	if rag := s.getContext(ctx, sessionID, userQuery); rag != "" {
 		messages = append(messages, core.Message{
 			Role:    core.RoleSystem,
-			Content: rag,
+			Content: budget.fitRAG(rag),
 		})
 	}
 
-	history, err := s.msgRepo.GetMessages(ctx, sessionID, s.cfg.GetContextWindowSize())
+	history, err := s.msgRepo.GetMessagesSince(ctx, sessionID, summary.LastMessageID, s.cfg.GetHistoryMessages())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get history: %w", err)
 	}
-	messages = append(messages, history...)
 
-	return messages, nil
+	remaining := budget.input - budget.tokens(messages...)
+	fitted := budget.fitHistory(history, remaining)
+
+	log.FromCtx(ctx).Debug().
+		Int("input_budget", budget.input).
+		Int("history_budget", remaining).
+		Int("history_loaded", len(history)).
+		Int("history_kept", len(fitted)).
+		Msg("assembled context")
+
+	return append(messages, fitted...), nil
+}
+
+// contextSize returns the context window and the output limit of the
+// active model, 0 if the limit is unknown. A configured context size takes
+// precedence over the model's window.
+func (s *Memory) contextSize(ctx context.Context) (int, int) {
+	var caps core.Capabilities
+	if s.models != nil {
+		caps = s.models.SessionCapabilities(ctx)
+	}
+
+	window := caps.ContextWindow
+	if n := s.cfg.GetContextTokens(); n > 0 {
+		window = n
+	}
+	if window <= 0 {
+		window = defaultContextTokens
+	}
+	return window, caps.MaxOutputTokens
+}
+
+// toolDefinitions returns the tools sent with every request, so their
+// definitions are counted against the budget.
+func (s *Memory) toolDefinitions(ctx context.Context) []core.Tool {
+	if s.tools == nil {
+		return nil
+	}
+	tools, err := s.tools.GetTools(ctx)
+	if err != nil {
+		log.FromCtx(ctx).Warn().Err(err).Msg("failed to get tools for the context budget")
+		return nil
+	}
+	return tools
+}
+
+func planPrompt(plan core.Plan) string {
+	return "### Active Plan\n" + plan.Checklist() +
+		"\nContinue with the first unfinished step and keep the plan updated with plan_update_step."
 }
 
 // GetContext retrieves relevant knowledge and messages.
@@ -103,6 +204,20 @@ func (s *Memory) getContext(ctx context.Context, sessionID, userQuery string) st
 	return sb.String()
 }
 
+// SaveMessage persists a message. Only the paths of content parts are
+// stored, so parts that carry their data are saved to the media directory
+// first.
 func (s *Memory) SaveMessage(ctx context.Context, sessionID string, msg core.Message) error {
+	msg.Parts = slices.Clone(msg.Parts)
+	for i, p := range msg.Parts {
+		if p.Data == nil || p.Path != "" {
+			continue
+		}
+		saved, err := core.SaveMedia(s.cfg.GetMediaPath(), p.Data, p.MediaType)
+		if err != nil {
+			return fmt.Errorf("failed to save content part: %w", err)
+		}
+		msg.Parts[i].Path, msg.Parts[i].MediaType = saved.Path, saved.MediaType
+	}
 	return s.msgRepo.AddMessage(ctx, sessionID, msg)
 }
@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mediaConfig struct {
+	core.AppConfig
+	dir string
+}
+
+func (c mediaConfig) GetMediaPath() string { return c.dir }
+
+type fakeMessagesRepo struct {
+	core.MessagesRepository
+	saved []core.Message
+}
+
+func (r *fakeMessagesRepo) AddMessage(ctx context.Context, sessionID string, msg core.Message) error {
+	r.saved = append(r.saved, msg)
+	return nil
+}
+
+func TestMemory_SaveMessage_PartData(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "media")
+	repo := &fakeMessagesRepo{}
+	m := &Memory{cfg: mediaConfig{dir: dir}, msgRepo: repo}
+
+	kept := core.ContentPart{Type: core.PartImage, MediaType: "image/png", Path: filepath.Join(dir, "a1b2.png")}
+	parts := []core.ContentPart{kept, {Type: core.PartImage, MediaType: "image/png", Data: []byte("png")}}
+	require.NoError(t, m.SaveMessage(context.Background(), "s1", core.Message{Role: core.RoleTool, Parts: parts}))
+
+	assert.Empty(t, parts[1].Path, "the message of the caller is not changed")
+	require.Len(t, repo.saved, 1)
+	saved := repo.saved[0].Parts
+	assert.Equal(t, kept, saved[0])
+	assert.Equal(t, dir, filepath.Dir(saved[1].Path))
+
+	data, err := os.ReadFile(saved[1].Path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("png"), data)
+}
@@ -0,0 +1,207 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/log"
+)
+
+const (
+	defaultSummaryInterval   = 10 * time.Minute
+	defaultSummaryKeepRecent = 40
+	defaultSummaryMinBatch   = 20
+	defaultSummaryMaxBatch   = 200
+	maxSummaryToolOutput     = 500
+)
+
+// Summarizer compacts the older part of each session's history into a
+// running summary, which Memory injects ahead of the recent raw messages.
+type Summarizer struct {
+	repo core.SummaryRepository
+	ai   core.AIProvider
+
+	Interval time.Duration
+	// KeepRecent messages at the end of a session are never summarized
+	KeepRecent int
+	// MinBatch is how many messages must be pending before a refresh
+	MinBatch int
+	// MaxBatch limits the messages folded into the summary per refresh
+	MaxBatch int
+}
+
+func NewSummarizer(repo core.SummaryRepository, ai core.AIProvider) *Summarizer {
+	return &Summarizer{
+		repo:       repo,
+		ai:         ai,
+		Interval:   defaultSummaryInterval,
+		KeepRecent: defaultSummaryKeepRecent,
+		MinBatch:   defaultSummaryMinBatch,
+		MaxBatch:   defaultSummaryMaxBatch,
+	}
+}
+
+func (s *Summarizer) Start(ctx context.Context) error {
+	logger := log.FromCtx(ctx)
+	logger.Info().Msg("starting session summarizer")
+
+	// Gives way to chat requests when the provider is rate limited
+	ctx = core.WithBackground(ctx)
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := s.processSessions(ctx); err != nil {
+				logger.Error().Err(err).Msg("summarization failed")
+			}
+		}
+	}
+}
+
+func (s *Summarizer) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (s *Summarizer) processSessions(ctx context.Context) error {
+	sessions, err := s.repo.ListSessions(ctx)
+	if err != nil {
+		return fmt.Errorf("list sessions: %w", err)
+	}
+
+	for _, sessionID := range sessions {
+		// Sub-agent sessions are not conversations with the user
+		if core.IsSubSession(sessionID) {
+			continue
+		}
+		if err := s.summarizeSession(ctx, sessionID); err != nil {
+			log.FromCtx(ctx).Error().Err(err).Str("session_id", sessionID).Msg("failed to summarize session")
+		}
+	}
+	return nil
+}
+
+// summarizeSession folds the messages that left the recent window into the
+// session's summary. It cuts right before a user message, so a tool call
+// sequence is never split between the summary and the raw history.
+func (s *Summarizer) summarizeSession(ctx context.Context, sessionID string) error {
+	summary, err := s.repo.GetSummary(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	pending, err := s.repo.CountMessagesSince(ctx, sessionID, summary.LastMessageID)
+	if err != nil {
+		return err
+	}
+	if pending < s.KeepRecent+s.MinBatch {
+		return nil
+	}
+
+	limit := min(pending-s.KeepRecent, s.MaxBatch)
+	msgs, err := s.repo.GetStoredMessagesSince(ctx, sessionID, summary.LastMessageID, limit+1)
+	if err != nil {
+		return err
+	}
+
+	cut := turnBoundary(msgs, limit)
+	if cut == 0 {
+		return nil
+	}
+	batch := msgs[:cut]
+
+	updated, err := s.summarize(ctx, summary.Summary, batch)
+	if err != nil {
+		return err
+	}
+
+	summary.Summary = updated
+	summary.LastMessageID = batch[len(batch)-1].ID
+	if err := s.repo.SaveSummary(ctx, summary); err != nil {
+		return err
+	}
+
+	log.FromCtx(ctx).Info().
+		Str("session_id", sessionID).
+		Int("messages", len(batch)).
+		Msg("session summary updated")
+	return nil
+}
+
+func (s *Summarizer) summarize(ctx context.Context, previous string, msgs []core.StoredMessage) (string, error) {
+	const systemPrompt = "You maintain a running summary of a conversation between a user and an AI assistant. Output only the summary text."
+
+	resp, err := s.ai.Chat(ctx, []core.Message{
+		{Role: core.RoleSystem, Content: systemPrompt},
+		{Role: core.RoleUser, Content: buildSummaryPrompt(previous, formatForSummary(msgs))},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("llm chat: %w", err)
+	}
+
+	content := strings.TrimSpace(resp.Content)
+	if content == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return content, nil
+}
+
+// turnBoundary returns the largest index <= limit at which msgs[index] is a
+// user message, or 0 if there is none.
+func turnBoundary(msgs []core.StoredMessage, limit int) int {
+	for i := min(limit, len(msgs)-1); i > 0; i-- {
+		if msgs[i].Role == core.RoleUser {
+			return i
+		}
+	}
+	return 0
+}
+
+func formatForSummary(msgs []core.StoredMessage) string {
+	var b strings.Builder
+	for _, m := range msgs {
+		content := m.Content
+		switch {
+		case m.Role == core.RoleSystem:
+			continue
+		case m.Role == core.RoleTool:
+			if len(content) > maxSummaryToolOutput {
+				content = strings.ToValidUTF8(content[:maxSummaryToolOutput], "") + "…"
+			}
+		case m.ToolCalls != "" && content == "":
+			content = "(called tools: " + m.ToolCalls + ")"
+		}
+		if content == "" {
+			continue
+		}
+
+		b.WriteString(strings.ToUpper(m.Role))
+		b.WriteString(": ")
+		b.WriteString(content)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func buildSummaryPrompt(previous, conversation string) string {
+	if previous == "" {
+		previous = "(none yet)"
+	}
+	return fmt.Sprintf(
+		`Update the summary with the new messages. Keep goals, decisions, facts about the user and the project, names of files, commands and URLs, and open tasks. Drop small talk and details that no longer matter. Write at most 400 words.
+
+Current summary:
+%s
+
+New messages:
+%s`,
+		previous, conversation,
+	)
+}
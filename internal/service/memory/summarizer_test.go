@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSummaryRepo struct {
+	sessions []string
+	messages []core.StoredMessage
+	summary  core.SessionSummary
+}
+
+func (r *fakeSummaryRepo) GetSummary(ctx context.Context, sessionID string) (core.SessionSummary, error) {
+	return r.summary, nil
+}
+
+func (r *fakeSummaryRepo) SaveSummary(ctx context.Context, s core.SessionSummary) error {
+	r.summary = s
+	return nil
+}
+
+func (r *fakeSummaryRepo) ListSessions(ctx context.Context) ([]string, error) {
+	if r.sessions != nil {
+		return r.sessions, nil
+	}
+	return []string{"s1"}, nil
+}
+
+func (r *fakeSummaryRepo) since(afterID int64) []core.StoredMessage {
+	var out []core.StoredMessage
+	for _, m := range r.messages {
+		if m.ID > afterID {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func (r *fakeSummaryRepo) CountMessagesSince(ctx context.Context, sessionID string, afterID int64) (int, error) {
+	return len(r.since(afterID)), nil
+}
+
+func (r *fakeSummaryRepo) GetStoredMessagesSince(ctx context.Context, sessionID string, afterID int64, limit int) ([]core.StoredMessage, error) {
+	msgs := r.since(afterID)
+	return msgs[:min(limit, len(msgs))], nil
+}
+
+// recordingAI returns a fixed response and remembers the prompts it got.
+type recordingAI struct {
+	response string
+	prompts  []string
+}
+
+func (a *recordingAI) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	a.prompts = append(a.prompts, history[len(history)-1].Content)
+	return core.Message{Role: core.RoleAssistant, Content: a.response}, nil
+}
+
+func (a *recordingAI) Models(ctx context.Context) ([]core.Model, error) {
+	return nil, nil
+}
+
+// conversation builds n turns of user, assistant with a tool call, tool result, assistant.
+func conversation(turns int) []core.StoredMessage {
+	var msgs []core.StoredMessage
+	add := func(role, content, toolCalls string) {
+		msgs = append(msgs, core.StoredMessage{ID: int64(len(msgs) + 1), Role: role, Content: content, ToolCalls: toolCalls})
+	}
+	for i := 0; i < turns; i++ {
+		add(core.RoleUser, fmt.Sprintf("question %d", i), "")
+		add(core.RoleAssistant, "", `[{"function":{"name":"fetch_url"}}]`)
+		add(core.RoleTool, fmt.Sprintf("result %d", i), "")
+		add(core.RoleAssistant, fmt.Sprintf("answer %d", i), "")
+	}
+	return msgs
+}
+
+func TestSummarizer_SummarizeSession(t *testing.T) {
+	repo := &fakeSummaryRepo{messages: conversation(10)} // 40 messages
+	ai := &recordingAI{response: "summary v1"}
+
+	s := NewSummarizer(repo, ai)
+	s.KeepRecent = 10
+	s.MinBatch = 8
+
+	require.NoError(t, s.summarizeSession(context.Background(), "s1"))
+
+	// 30 messages may be summarized; the cut moves back to the user
+	// message of turn 7 (ID 29)
+	assert.Equal(t, "summary v1", repo.summary.Summary)
+	assert.Equal(t, int64(28), repo.summary.LastMessageID)
+	require.Len(t, ai.prompts, 1)
+	assert.Contains(t, ai.prompts[0], "(none yet)")
+	assert.Contains(t, ai.prompts[0], "USER: question 0")
+	assert.Contains(t, ai.prompts[0], "TOOL: result 6")
+	assert.NotContains(t, ai.prompts[0], "question 7")
+
+	// Not enough new messages for another refresh
+	require.NoError(t, s.summarizeSession(context.Background(), "s1"))
+	assert.Len(t, ai.prompts, 1)
+
+	// New messages are folded into the existing summary
+	repo.messages = conversation(20)
+	ai.response = "summary v2"
+	require.NoError(t, s.summarizeSession(context.Background(), "s1"))
+
+	require.Len(t, ai.prompts, 2)
+	assert.Contains(t, ai.prompts[1], "summary v1")
+	assert.Contains(t, ai.prompts[1], "USER: question 7")
+	assert.NotContains(t, ai.prompts[1], "question 6")
+	assert.Equal(t, "summary v2", repo.summary.Summary)
+	assert.Equal(t, int64(68), repo.summary.LastMessageID)
+}
+
+func TestTurnBoundary(t *testing.T) {
+	msgs := conversation(3)
+
+	assert.Equal(t, 8, turnBoundary(msgs, 10))
+	assert.Equal(t, 8, turnBoundary(msgs, 8))
+	assert.Equal(t, 4, turnBoundary(msgs, 7))
+	assert.Equal(t, 0, turnBoundary(msgs, 3))
+	assert.Equal(t, 8, turnBoundary(msgs, 100))
+}
+
+func TestSummarizer_ProcessSessions_SkipsSubSessions(t *testing.T) {
+	sub := core.SubSessionID("s1", 1)
+	repo := &fakeSummaryRepo{sessions: []string{sub}, messages: conversation(10)}
+	ai := &recordingAI{response: "summary"}
+
+	s := NewSummarizer(repo, ai)
+	s.KeepRecent = 10
+	s.MinBatch = 8
+
+	require.NoError(t, s.processSessions(context.Background()))
+	assert.Empty(t, ai.prompts)
+
+	repo.sessions = []string{"s1"}
+	require.NoError(t, s.processSessions(context.Background()))
+	assert.Len(t, ai.prompts, 1)
+}
@@ -0,0 +1,185 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/log"
+	"github.com/sandevgo/tuskbot/pkg/tokenizer"
+)
+
+// spillRetention is how long spilled outputs are kept in the workspace.
+const spillRetention = 7 * 24 * time.Hour
+
+var _ core.MCPServer = (*Limiter)(nil)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// Limiter applies the output policy to the results of an MCP server, so
+// huge outputs never reach the history in full.
+type Limiter struct {
+	next     core.MCPServer
+	policy   *Policy
+	workDir  string
+	spillDir string
+	seq      atomic.Uint64
+
+	// count is replaceable in tests
+	count func(string) int
+}
+
+func NewLimiter(next core.MCPServer, cfg core.OutputConfig) (*Limiter, error) {
+	policy, err := LoadPolicy(cfg.GetOutputPolicyPath())
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Limiter{
+		next:     next,
+		policy:   policy,
+		workDir:  cfg.GetRuntimePath(),
+		spillDir: cfg.GetToolOutputsPath(),
+		count:    tokenizer.Count,
+	}
+	l.removeExpired()
+	return l, nil
+}
+
+func (l *Limiter) GetTools(ctx context.Context) ([]core.Tool, error) {
+	return l.next.GetTools(ctx)
+}
+
+func (l *Limiter) CallTool(ctx context.Context, name string, args string) (core.ToolResult, error) {
+	res, err := l.next.CallTool(ctx, name, args)
+	if err != nil {
+		return res, err
+	}
+	res.Content = l.apply(ctx, name, l.policy.Match(name, l.serverOf(ctx, name)), res.Content)
+	return res, nil
+}
+
+func (l *Limiter) apply(ctx context.Context, tool string, rule Rule, out string) string {
+	limit := l.limit(rule, out)
+	if limit <= 0 || len(out) <= limit {
+		return out
+	}
+
+	switch rule.Strategy {
+	case StrategyHead:
+		return fmt.Sprintf("%s\n\n... [output truncated, showing the first %d of %d bytes]", head(out, limit), limit, len(out))
+	case StrategyTail:
+		return fmt.Sprintf("... [output truncated, showing the last %d of %d bytes]\n\n%s", limit, len(out), tail(out, limit))
+	case StrategySpill:
+		path, err := l.spill(tool, out)
+		if err != nil {
+			log.FromCtx(ctx).Warn().Err(err).Str("tool", tool).Msg("failed to spill tool output")
+			return headTail(out, limit)
+		}
+		return fmt.Sprintf(
+			"%s\n\n[Full output (%d bytes) saved to %s. Use read_file with offset and limit, or search_files, to see the rest.]",
+			headTail(out, limit), len(out), path,
+		)
+	default:
+		return headTail(out, limit)
+	}
+}
+
+// limit converts the rule's limits into a byte limit for out, or 0 if out
+// is not limited.
+func (l *Limiter) limit(rule Rule, out string) int {
+	limit := rule.MaxBytes
+	if rule.MaxTokens > 0 {
+		if tokens := l.count(out); tokens > rule.MaxTokens {
+			byTokens := len(out) * rule.MaxTokens / tokens
+			if limit == 0 || byTokens < limit {
+				limit = max(byTokens, 1)
+			}
+		}
+	}
+	return limit
+}
+
+// spill writes out to a new file and returns its path relative to the
+// workspace, where the filesystem tools resolve it.
+func (l *Limiter) spill(tool, out string) (string, error) {
+	if err := os.MkdirAll(l.spillDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s-%d.txt",
+		time.Now().Format("20060102-150405"),
+		unsafeFileChars.ReplaceAllString(tool, "_"),
+		l.seq.Add(1),
+	)
+	path := filepath.Join(l.spillDir, name)
+	if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if rel, err := filepath.Rel(l.workDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel, nil
+	}
+	return path, nil
+}
+
+// removeExpired deletes spilled outputs older than spillRetention.
+func (l *Limiter) removeExpired() {
+	entries, err := os.ReadDir(l.spillDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() {
+			continue
+		}
+		if time.Since(info.ModTime()) > spillRetention {
+			_ = os.Remove(filepath.Join(l.spillDir, e.Name()))
+		}
+	}
+}
+
+// serverOf returns the server of a tool, or "" for native and unknown tools.
+func (l *Limiter) serverOf(ctx context.Context, name string) string {
+	tools, err := l.next.GetTools(ctx)
+	if err != nil {
+		return ""
+	}
+	for _, t := range tools {
+		if t.Function.Name == name {
+			return t.Server
+		}
+	}
+	return ""
+}
+
+func head(s string, n int) string {
+	return s[:runeStart(s, n)]
+}
+
+func tail(s string, n int) string {
+	return s[runeStart(s, len(s)-n):]
+}
+
+// headTail keeps two thirds of the limit from the start of s and the rest
+// from its end.
+func headTail(s string, n int) string {
+	h := n * 2 / 3
+	return fmt.Sprintf("%s\n\n... [truncated %d of %d bytes] ...\n\n%s", head(s, h), len(s)-n, len(s), tail(s, n-h))
+}
+
+// runeStart moves i back to the start of a UTF-8 sequence.
+func runeStart(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
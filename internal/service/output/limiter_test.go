@@ -0,0 +1,152 @@
+package output
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubConfig struct {
+	dir string
+}
+
+func (c stubConfig) GetRuntimePath() string      { return c.dir }
+func (c stubConfig) GetOutputPolicyPath() string { return filepath.Join(c.dir, "output_policy.json") }
+func (c stubConfig) GetToolOutputsPath() string  { return filepath.Join(c.dir, "tool_outputs") }
+
+type stubMCP struct {
+	output string
+}
+
+func (s *stubMCP) GetTools(ctx context.Context) ([]core.Tool, error) {
+	return []core.Tool{
+		{Function: core.Function{Name: "execute_command"}},
+		{Function: core.Function{Name: "search"}, Server: "remote"},
+	}, nil
+}
+
+func (s *stubMCP) CallTool(ctx context.Context, name string, args string) (core.ToolResult, error) {
+	return core.ToolResult{Content: s.output}, nil
+}
+
+func newTestLimiter(t *testing.T, output string, rules ...Rule) (*Limiter, string) {
+	dir := t.TempDir()
+	l, err := NewLimiter(&stubMCP{output: output}, stubConfig{dir: dir})
+	require.NoError(t, err)
+	l.policy = &Policy{Default: Rule{Strategy: StrategyHeadTail}, Rules: rules}
+	return l, dir
+}
+
+func TestLimiter_CallTool(t *testing.T) {
+	output := "HEAD" + strings.Repeat(".", 100) + "TAIL"
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "under the limit",
+			rule: Rule{MaxBytes: 200, Strategy: StrategyHead},
+			want: []string{output},
+		},
+		{
+			name:    "head",
+			rule:    Rule{MaxBytes: 20, Strategy: StrategyHead},
+			want:    []string{"HEAD", "showing the first 20 of 108 bytes"},
+			notWant: []string{"TAIL"},
+		},
+		{
+			name:    "tail",
+			rule:    Rule{MaxBytes: 20, Strategy: StrategyTail},
+			want:    []string{"TAIL", "showing the last 20 of 108 bytes"},
+			notWant: []string{"HEAD"},
+		},
+		{
+			name: "head and tail",
+			rule: Rule{MaxBytes: 30, Strategy: StrategyHeadTail},
+			want: []string{"HEAD", "TAIL", "truncated 78 of 108 bytes"},
+		},
+		{
+			name: "tokens",
+			rule: Rule{MaxTokens: 5, Strategy: StrategyHead},
+			want: []string{"showing the first 20 of 108 bytes"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newTestLimiter(t, output, tt.rule)
+			l.count = func(s string) int { return len(s) / 4 }
+
+			res, err := l.CallTool(context.Background(), "execute_command", "{}")
+			require.NoError(t, err)
+			for _, s := range tt.want {
+				assert.Contains(t, res.Content, s)
+			}
+			for _, s := range tt.notWant {
+				assert.NotContains(t, res.Content, s)
+			}
+		})
+	}
+}
+
+func TestLimiter_Spill(t *testing.T) {
+	output := "HEAD" + strings.Repeat("line\n", 100) + "TAIL"
+	l, dir := newTestLimiter(t, output, Rule{Server: "remote", MaxBytes: 40, Strategy: StrategySpill})
+
+	res, err := l.CallTool(context.Background(), "search", "{}")
+	require.NoError(t, err)
+	out := res.Content
+	assert.Contains(t, out, "HEAD")
+	assert.Contains(t, out, "TAIL")
+
+	m := regexp.MustCompile(`saved to (\S+)\.`).FindStringSubmatch(out)
+	require.Len(t, m, 2, out)
+	assert.True(t, strings.HasPrefix(m[1], "tool_outputs"+string(filepath.Separator)), m[1])
+
+	saved, err := os.ReadFile(filepath.Join(dir, m[1]))
+	require.NoError(t, err)
+	assert.Equal(t, output, string(saved))
+
+	// The native tool is not matched by the server rule
+	res, err = l.CallTool(context.Background(), "execute_command", "{}")
+	require.NoError(t, err)
+	assert.Equal(t, output, res.Content)
+}
+
+func TestLimiter_RemoveExpired(t *testing.T) {
+	dir := t.TempDir()
+	cfg := stubConfig{dir: dir}
+	require.NoError(t, os.MkdirAll(cfg.GetToolOutputsPath(), 0755))
+
+	old := filepath.Join(cfg.GetToolOutputsPath(), "old.txt")
+	recent := filepath.Join(cfg.GetToolOutputsPath(), "recent.txt")
+	require.NoError(t, os.WriteFile(old, []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(recent, []byte("x"), 0644))
+	past := time.Now().Add(-spillRetention - time.Hour)
+	require.NoError(t, os.Chtimes(old, past, past))
+
+	_, err := NewLimiter(&stubMCP{}, cfg)
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, old)
+	assert.FileExists(t, recent)
+}
+
+func TestHeadTail_RuneBoundaries(t *testing.T) {
+	s := strings.Repeat("é", 50)
+	out := headTail(s, 21)
+	assert.True(t, strings.HasPrefix(out, strings.Repeat("é", 7)))
+	assert.True(t, utf8.ValidString(out))
+}
@@ -0,0 +1,146 @@
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+)
+
+// Strategy is how an output over the limit is cut.
+type Strategy string
+
+const (
+	// StrategyHeadTail keeps the beginning and the end of the output.
+	StrategyHeadTail Strategy = "head_tail"
+	StrategyHead     Strategy = "head"
+	StrategyTail     Strategy = "tail"
+	// StrategySpill saves the full output to a workspace file and returns
+	// a head and tail preview with the file path.
+	StrategySpill Strategy = "spill"
+)
+
+// NativeServer is the server name rules use to match built-in tools.
+const NativeServer = "native"
+
+// Rule limits the output of matching tools. Empty Tool and Server match
+// anything and are glob patterns otherwise. Zero limits disable the rule's
+// limit; when both are set the stricter one applies.
+type Rule struct {
+	Tool      string   `json:"tool,omitempty"`
+	Server    string   `json:"server,omitempty"`
+	MaxBytes  int      `json:"max_bytes,omitempty"`
+	MaxTokens int      `json:"max_tokens,omitempty"`
+	Strategy  Strategy `json:"strategy"`
+}
+
+// Policy limits tool outputs. The first matching rule wins, Default
+// applies when none match.
+type Policy struct {
+	Default Rule   `json:"default"`
+	Rules   []Rule `json:"rules"`
+}
+
+// DefaultPolicy spills large outputs to files, except for read_file, which
+// can page through a file with offset and limit instead.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Default: Rule{MaxBytes: 16384, Strategy: StrategySpill},
+		Rules: []Rule{
+			{Tool: "read_file", MaxBytes: 32768, Strategy: StrategyHead},
+			{Tool: "execute_command", MaxBytes: 16384, Strategy: StrategySpill},
+			{Tool: "fetch_url", MaxBytes: 16384, Strategy: StrategySpill},
+		},
+	}
+}
+
+// LoadPolicy reads the policy file, creating it with DefaultPolicy if missing.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		p := DefaultPolicy()
+		if err := p.Save(path); err != nil {
+			return nil, fmt.Errorf("failed to create default output policy: %w", err)
+		}
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output policy: %w", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse output policy: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid output policy: %w", err)
+	}
+	return &p, nil
+}
+
+func (p *Policy) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output policy: %w", err)
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func (p *Policy) validate() error {
+	if p.Default.Strategy == "" {
+		p.Default.Strategy = StrategyHeadTail
+	}
+	if !p.Default.Strategy.valid() {
+		return fmt.Errorf("unknown default strategy %q", p.Default.Strategy)
+	}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Strategy == "" {
+			r.Strategy = StrategyHeadTail
+		}
+		if !r.Strategy.valid() {
+			return fmt.Errorf("rule %d: unknown strategy %q", i, r.Strategy)
+		}
+		if r.MaxBytes < 0 || r.MaxTokens < 0 {
+			return fmt.Errorf("rule %d: limits must not be negative", i)
+		}
+		for _, pattern := range []string{r.Tool, r.Server} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d: bad pattern %q: %w", i, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Match returns the rule for the output of tool from server. An empty
+// server means a native tool.
+func (p *Policy) Match(tool, server string) Rule {
+	if server == "" {
+		server = NativeServer
+	}
+	for _, r := range p.Rules {
+		if glob(r.Tool, tool) && glob(r.Server, server) {
+			return r
+		}
+	}
+	return p.Default
+}
+
+func glob(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+func (s Strategy) valid() bool {
+	switch s {
+	case StrategyHeadTail, StrategyHead, StrategyTail, StrategySpill:
+		return true
+	}
+	return false
+}
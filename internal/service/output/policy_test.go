@@ -0,0 +1,69 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Match(t *testing.T) {
+	p := &Policy{
+		Default: Rule{MaxBytes: 100, Strategy: StrategySpill},
+		Rules: []Rule{
+			{Tool: "read_file", MaxBytes: 10, Strategy: StrategyHead},
+			{Server: "github", Tool: "github_get_*", MaxTokens: 5, Strategy: StrategyTail},
+			{Server: NativeServer, MaxBytes: 50, Strategy: StrategyHeadTail},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		tool   string
+		server string
+		want   Rule
+	}{
+		{"by tool", "read_file", "", p.Rules[0]},
+		{"by server and tool", "github_get_issue", "github", p.Rules[1]},
+		{"other tool of server", "github_create_issue", "github", p.Default},
+		{"native", "execute_command", "", p.Rules[2]},
+		{"default", "search", "remote", p.Default},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, p.Match(tt.tool, tt.server))
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	t.Run("creates default", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "output_policy.json")
+
+		p, err := LoadPolicy(path)
+		require.NoError(t, err)
+		assert.Equal(t, DefaultPolicy(), p)
+		assert.FileExists(t, path)
+	})
+
+	t.Run("fills in strategy", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "output_policy.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"default":{"max_bytes":10},"rules":[{"tool":"x","max_tokens":5}]}`), 0600))
+
+		p, err := LoadPolicy(path)
+		require.NoError(t, err)
+		assert.Equal(t, StrategyHeadTail, p.Default.Strategy)
+		assert.Equal(t, StrategyHeadTail, p.Rules[0].Strategy)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "output_policy.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"tool":"x","strategy":"compress"}]}`), 0600))
+
+		_, err := LoadPolicy(path)
+		assert.ErrorContains(t, err, "unknown strategy")
+	})
+}
@@ -0,0 +1,107 @@
+// Package replay records the LLM and tool traffic of agent runs to JSONL
+// fixtures and plays it back, so a run can be reproduced offline.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+type Kind string
+
+const (
+	KindChat  Kind = "chat"
+	KindTool  Kind = "tool"
+	KindTools Kind = "tools"
+)
+
+// Entry is one line of a fixture: an LLM request and its response, a tool
+// call and its output, or the tool list offered to the model.
+type Entry struct {
+	Seq     int       `json:"seq"`
+	Kind    Kind      `json:"kind"`
+	Session string    `json:"session,omitempty"`
+	At      time.Time `json:"at"`
+
+	// KindChat
+	Messages  []core.Message `json:"messages,omitempty"`
+	ToolNames []string       `json:"tool_names,omitempty"`
+	Response  *core.Message  `json:"response,omitempty"`
+
+	// KindTool
+	Tool   string             `json:"tool,omitempty"`
+	Args   string             `json:"args,omitempty"`
+	Output string             `json:"output,omitempty"`
+	Parts  []core.ContentPart `json:"parts,omitempty"`
+
+	// KindTools
+	Tools []Tool `json:"tools,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Tool is a core.Tool with the fields that are not sent to the model.
+type Tool struct {
+	core.Tool
+	Serial bool   `json:"serial,omitempty"`
+	Server string `json:"server,omitempty"`
+}
+
+func toFixtureTools(tools []core.Tool) []Tool {
+	out := make([]Tool, len(tools))
+	for i, t := range tools {
+		out[i] = Tool{Tool: t, Serial: t.Serial, Server: t.Server}
+	}
+	return out
+}
+
+func fromFixtureTools(tools []Tool) []core.Tool {
+	out := make([]core.Tool, len(tools))
+	for i, t := range tools {
+		out[i] = t.Tool
+		out[i].Serial, out[i].Server = t.Serial, t.Server
+	}
+	return out
+}
+
+func toolNames(tools []core.Tool) []string {
+	names := make([]string, len(tools))
+	for i, t := range tools {
+		names[i] = t.Function.Name
+	}
+	slices.Sort(names)
+	return names
+}
+
+// LoadFixture reads the entries of a fixture file.
+func LoadFixture(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fixture: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("fixture line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,162 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/log"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// Recorder appends the traffic of the wrapped provider and MCP server to
+// one fixture file per session in dir.
+type Recorder struct {
+	dir string
+
+	mu        sync.Mutex
+	seq       int
+	lastTools map[string][]string
+}
+
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create record directory: %w", err)
+	}
+	return &Recorder{dir: dir, lastTools: make(map[string][]string)}, nil
+}
+
+// AIProvider wraps ai so that every chat request is recorded.
+func (r *Recorder) AIProvider(ai core.AIProvider) core.AIProvider {
+	return &recordingAI{rec: r, next: ai}
+}
+
+// MCPServer wraps mcp so that tool calls and tool list changes are recorded.
+func (r *Recorder) MCPServer(mcp core.MCPServer) core.MCPServer {
+	return &recordingMCP{rec: r, next: mcp}
+}
+
+func (r *Recorder) write(ctx context.Context, e Entry) {
+	e.Session = core.SessionIDFromCtx(ctx)
+	e.At = time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	e.Seq = r.seq
+
+	if err := r.append(e); err != nil {
+		log.FromCtx(ctx).Warn().Err(err).Msg("failed to record replay entry")
+	}
+}
+
+func (r *Recorder) append(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	name := unsafeFileChars.ReplaceAllString(e.Session, "_")
+	if name == "" {
+		name = "default"
+	}
+	f, err := os.OpenFile(filepath.Join(r.dir, name+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// toolsChanged reports whether the session got a different tool list than
+// the one recorded last.
+func (r *Recorder) toolsChanged(ctx context.Context, tools []core.Tool) bool {
+	session := core.SessionIDFromCtx(ctx)
+	names := toolNames(tools)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if last, ok := r.lastTools[session]; ok && slices.Equal(last, names) {
+		return false
+	}
+	r.lastTools[session] = names
+	return true
+}
+
+type recordingAI struct {
+	rec  *Recorder
+	next core.AIProvider
+}
+
+func (a *recordingAI) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	msg, err := a.next.Chat(ctx, history, tools)
+	a.record(ctx, history, tools, msg, err)
+	return msg, err
+}
+
+// ChatStream streams when the wrapped provider can, and records the
+// assembled response.
+func (a *recordingAI) ChatStream(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	streamer, ok := a.next.(core.StreamingProvider)
+	if !ok {
+		msg, err := a.Chat(ctx, history, tools)
+		if err == nil && onDelta != nil && (msg.Content != "" || msg.Reasoning != "") {
+			onDelta(core.StreamDelta{Content: msg.Content, Reasoning: msg.Reasoning})
+		}
+		return msg, err
+	}
+
+	msg, err := streamer.ChatStream(ctx, history, tools, onDelta)
+	a.record(ctx, history, tools, msg, err)
+	return msg, err
+}
+
+func (a *recordingAI) Models(ctx context.Context) ([]core.Model, error) {
+	return a.next.Models(ctx)
+}
+
+func (a *recordingAI) record(ctx context.Context, history []core.Message, tools []core.Tool, msg core.Message, err error) {
+	e := Entry{Kind: KindChat, Messages: history, ToolNames: toolNames(tools)}
+	if err != nil {
+		e.Error = err.Error()
+	} else {
+		e.Response = &msg
+	}
+	a.rec.write(ctx, e)
+}
+
+type recordingMCP struct {
+	rec  *Recorder
+	next core.MCPServer
+}
+
+func (m *recordingMCP) GetTools(ctx context.Context) ([]core.Tool, error) {
+	tools, err := m.next.GetTools(ctx)
+	if err == nil && m.rec.toolsChanged(ctx, tools) {
+		m.rec.write(ctx, Entry{Kind: KindTools, Tools: toFixtureTools(tools)})
+	}
+	return tools, err
+}
+
+func (m *recordingMCP) CallTool(ctx context.Context, name string, args string) (core.ToolResult, error) {
+	res, err := m.next.CallTool(ctx, name, args)
+
+	e := Entry{Kind: KindTool, Tool: name, Args: args, Output: res.Content, Parts: res.Parts}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	m.rec.write(ctx, e)
+	return res, err
+}
@@ -0,0 +1,183 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAI struct {
+	responses []core.Message
+	calls     int
+}
+
+func (a *fakeAI) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	msg := a.responses[a.calls]
+	a.calls++
+	return msg, nil
+}
+
+func (a *fakeAI) Models(ctx context.Context) ([]core.Model, error) {
+	return nil, nil
+}
+
+type fakeMCP struct{}
+
+func (m *fakeMCP) GetTools(ctx context.Context) ([]core.Tool, error) {
+	return []core.Tool{
+		{Type: "function", Function: core.Function{Name: "read_file"}},
+		{Type: "function", Function: core.Function{Name: "write_file"}, Serial: true},
+	}, nil
+}
+
+func (m *fakeMCP) CallTool(ctx context.Context, name string, args string) (core.ToolResult, error) {
+	if name == "write_file" {
+		return core.ToolResult{}, errors.New("read-only")
+	}
+	return core.ToolResult{Content: "content of " + args, Parts: []core.ContentPart{imagePart}}, nil
+}
+
+var (
+	imagePart = core.ContentPart{Type: core.PartImage, MediaType: "image/png", Path: "/runtime/media/a1b2.png"}
+	userMsg   = core.Message{Role: core.RoleUser, Content: "summarize a.txt"}
+	callMsg   = core.Message{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{{ID: "c1", Function: core.FunctionCall{Name: "read_file", Arguments: "a.txt"}}}}
+	toolMsg   = core.Message{Role: core.RoleTool, Content: "content of a.txt", ToolCallID: "c1"}
+	finalMsg  = core.Message{Role: core.RoleAssistant, Content: "It says hello."}
+)
+
+// record runs a fixed two-step exchange through a recorder and returns the
+// fixture path.
+func record(t *testing.T) string {
+	dir := t.TempDir()
+	rec, err := NewRecorder(dir)
+	require.NoError(t, err)
+
+	ctx := core.WithSessionID(context.Background(), "chat:1")
+	ai := rec.AIProvider(&fakeAI{responses: []core.Message{callMsg, finalMsg}})
+	mcp := rec.MCPServer(&fakeMCP{})
+
+	system := core.Message{Role: core.RoleSystem, Content: "recorded system prompt"}
+	tools, err := mcp.GetTools(ctx)
+	require.NoError(t, err)
+
+	_, err = ai.Chat(ctx, []core.Message{system, userMsg}, tools)
+	require.NoError(t, err)
+	_, err = mcp.CallTool(ctx, "read_file", "a.txt")
+	require.NoError(t, err)
+	_, err = mcp.CallTool(ctx, "write_file", "b.txt")
+	require.Error(t, err)
+
+	// An unchanged tool list is not recorded again
+	tools, err = mcp.GetTools(ctx)
+	require.NoError(t, err)
+	_, err = ai.Chat(ctx, []core.Message{system, userMsg, callMsg, toolMsg}, tools)
+	require.NoError(t, err)
+
+	return filepath.Join(dir, "chat_1.jsonl")
+}
+
+func TestRecorder(t *testing.T) {
+	entries, err := LoadFixture(record(t))
+	require.NoError(t, err)
+
+	var kinds []Kind
+	for i, e := range entries {
+		kinds = append(kinds, e.Kind)
+		assert.Equal(t, i+1, e.Seq)
+		assert.Equal(t, "chat:1", e.Session)
+	}
+	assert.Equal(t, []Kind{KindTools, KindChat, KindTool, KindTool, KindChat}, kinds)
+
+	assert.True(t, entries[0].Tools[1].Serial, "internal tool fields are kept")
+	assert.Equal(t, []string{"read_file", "write_file"}, entries[1].ToolNames)
+	assert.Equal(t, callMsg, *entries[1].Response)
+	assert.Equal(t, "read-only", entries[3].Error)
+}
+
+func TestReplayer(t *testing.T) {
+	r, err := LoadReplayer(record(t))
+	require.NoError(t, err)
+	ai, mcp := r.AIProvider(), r.MCPServer()
+	ctx := context.Background()
+
+	tools, err := mcp.GetTools(ctx)
+	require.NoError(t, err)
+	require.Len(t, tools, 2)
+	assert.True(t, tools[1].Serial)
+
+	// A different system prompt is not a divergence
+	system := core.Message{Role: core.RoleSystem, Content: "another system prompt"}
+	msg, err := ai.Chat(ctx, []core.Message{system, userMsg}, tools)
+	require.NoError(t, err)
+	assert.Equal(t, callMsg, msg)
+
+	// Tool calls may arrive in any order
+	_, err = mcp.CallTool(ctx, "write_file", "b.txt")
+	assert.EqualError(t, err, "read-only")
+	res, err := mcp.CallTool(ctx, "read_file", "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, core.ToolResult{Content: "content of a.txt", Parts: []core.ContentPart{imagePart}}, res)
+
+	msg, err = ai.Chat(ctx, []core.Message{system, userMsg, callMsg, toolMsg}, tools)
+	require.NoError(t, err)
+	assert.Equal(t, finalMsg, msg)
+
+	assert.Empty(t, r.Divergences())
+	assert.Zero(t, r.Remaining())
+}
+
+func TestReplayer_Divergences(t *testing.T) {
+	path := record(t)
+	ctx := context.Background()
+
+	t.Run("lenient", func(t *testing.T) {
+		r, err := LoadReplayer(path)
+		require.NoError(t, err)
+		tools, _ := r.MCPServer().GetTools(ctx)
+
+		other := core.Message{Role: core.RoleUser, Content: "summarize b.txt"}
+		msg, err := r.AIProvider().Chat(ctx, []core.Message{other}, tools)
+		require.NoError(t, err)
+		assert.Equal(t, callMsg, msg, "the recorded response is still returned")
+
+		_, err = r.MCPServer().CallTool(ctx, "read_file", "b.txt")
+		require.NoError(t, err)
+		_, err = r.MCPServer().CallTool(ctx, "execute_command", "ls")
+		assert.Error(t, err)
+
+		divergences := r.Divergences()
+		require.Len(t, divergences, 3)
+		assert.Contains(t, divergences[0].String(), `content "summarize b.txt", recorded "summarize a.txt"`)
+		assert.Contains(t, divergences[1].String(), "read_file called with b.txt, recorded a.txt")
+		assert.Contains(t, divergences[2].String(), "unexpected call of execute_command")
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		r, err := LoadReplayer(path)
+		require.NoError(t, err)
+		r.Strict = true
+
+		_, err = r.AIProvider().Chat(ctx, []core.Message{userMsg}, nil)
+		assert.ErrorContains(t, err, "replay diverged at seq 2 (chat): tools []")
+	})
+
+	t.Run("no responses left", func(t *testing.T) {
+		r := NewReplayer(nil)
+		_, err := r.AIProvider().Chat(ctx, []core.Message{userMsg}, nil)
+		assert.ErrorContains(t, err, "no recorded responses left")
+	})
+}
+
+func TestLoadFixture_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{\"seq\":1}\n\nnot json\n"), 0600))
+
+	_, err := LoadFixture(path)
+	assert.ErrorContains(t, err, "fixture line 3")
+}
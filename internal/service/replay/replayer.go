@@ -0,0 +1,262 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+const maxDiffContent = 80
+
+// Divergence is a request that does not match the recording.
+type Divergence struct {
+	Seq    int
+	Kind   Kind
+	Reason string
+}
+
+func (d Divergence) String() string {
+	return fmt.Sprintf("seq %d (%s): %s", d.Seq, d.Kind, d.Reason)
+}
+
+// Replayer answers chat requests and tool calls from a recording.
+//
+// Chat requests are replayed in order. Only the messages of the current
+// turn, from the last user message on, are compared with the recording,
+// since the system prompt and older history depend on the environment.
+// Tool calls are matched by name and arguments, so concurrent calls may
+// arrive in any order.
+type Replayer struct {
+	// Strict fails divergent requests instead of answering them with the
+	// recorded response.
+	Strict bool
+
+	mu          sync.Mutex
+	chats       []Entry
+	next        int
+	toolLists   []Entry
+	calls       []Entry
+	used        []bool
+	divergences []Divergence
+}
+
+func NewReplayer(entries []Entry) *Replayer {
+	r := &Replayer{}
+	for _, e := range entries {
+		switch e.Kind {
+		case KindChat:
+			r.chats = append(r.chats, e)
+		case KindTools:
+			r.toolLists = append(r.toolLists, e)
+		case KindTool:
+			r.calls = append(r.calls, e)
+		}
+	}
+	r.used = make([]bool, len(r.calls))
+	return r
+}
+
+// LoadReplayer reads a fixture file into a Replayer.
+func LoadReplayer(path string) (*Replayer, error) {
+	entries, err := LoadFixture(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(entries), nil
+}
+
+func (r *Replayer) AIProvider() core.AIProvider {
+	return &replayAI{r: r}
+}
+
+func (r *Replayer) MCPServer() core.MCPServer {
+	return &replayMCP{r: r}
+}
+
+// Divergences returns the requests that did not match the recording.
+func (r *Replayer) Divergences() []Divergence {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.divergences)
+}
+
+// Remaining returns how many recorded chat responses were not replayed.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.chats) - r.next
+}
+
+// diverge records a divergence and returns the error to fail the request
+// with in strict mode, or nil.
+func (r *Replayer) diverge(seq int, kind Kind, reason string) error {
+	d := Divergence{Seq: seq, Kind: kind, Reason: reason}
+	r.divergences = append(r.divergences, d)
+	if r.Strict {
+		return fmt.Errorf("replay diverged at %s", d)
+	}
+	return nil
+}
+
+func (r *Replayer) chat(history []core.Message, tools []core.Tool) (core.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next >= len(r.chats) {
+		d := Divergence{Kind: KindChat, Reason: "unexpected chat request, no recorded responses left"}
+		r.divergences = append(r.divergences, d)
+		return core.Message{}, fmt.Errorf("replay diverged at %s", d)
+	}
+	e := r.chats[r.next]
+	r.next++
+
+	reason := diffMessages(currentTurn(e.Messages), currentTurn(history))
+	if reason == "" && !slices.Equal(e.ToolNames, toolNames(tools)) {
+		reason = fmt.Sprintf("tools %v, recorded %v", toolNames(tools), e.ToolNames)
+	}
+	if reason != "" {
+		if err := r.diverge(e.Seq, KindChat, reason); err != nil {
+			return core.Message{}, err
+		}
+	}
+
+	if e.Error != "" {
+		return core.Message{}, errors.New(e.Error)
+	}
+	if e.Response == nil {
+		return core.Message{}, fmt.Errorf("replay: chat entry %d has no response", e.Seq)
+	}
+	return *e.Response, nil
+}
+
+func (r *Replayer) getTools() []core.Tool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The tool list in effect before the next chat request
+	upTo := int(^uint(0) >> 1)
+	if r.next < len(r.chats) {
+		upTo = r.chats[r.next].Seq
+	}
+
+	var tools []Tool
+	for _, e := range r.toolLists {
+		if e.Seq > upTo && tools != nil {
+			break
+		}
+		tools = e.Tools
+	}
+	return fromFixtureTools(tools)
+}
+
+func (r *Replayer) callTool(name, args string) (core.ToolResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.findCall(func(e Entry) bool { return e.Tool == name && e.Args == args })
+	if i < 0 {
+		i = r.findCall(func(e Entry) bool { return e.Tool == name })
+		if i < 0 {
+			d := Divergence{Kind: KindTool, Reason: fmt.Sprintf("unexpected call of %s", name)}
+			r.divergences = append(r.divergences, d)
+			return core.ToolResult{}, fmt.Errorf("replay diverged at %s", d)
+		}
+		reason := fmt.Sprintf("%s called with %s, recorded %s", name, truncate(args), truncate(r.calls[i].Args))
+		if err := r.diverge(r.calls[i].Seq, KindTool, reason); err != nil {
+			return core.ToolResult{}, err
+		}
+	}
+
+	r.used[i] = true
+	e := r.calls[i]
+	res := core.ToolResult{Content: e.Output, Parts: e.Parts}
+	if e.Error != "" {
+		return res, errors.New(e.Error)
+	}
+	return res, nil
+}
+
+func (r *Replayer) findCall(match func(Entry) bool) int {
+	for i, e := range r.calls {
+		if !r.used[i] && match(e) {
+			return i
+		}
+	}
+	return -1
+}
+
+// currentTurn returns the messages from the last user message on.
+func currentTurn(messages []core.Message) []core.Message {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == core.RoleUser {
+			return messages[i:]
+		}
+	}
+	return messages
+}
+
+// diffMessages describes the first difference between the recorded and
+// the actual messages, or returns "".
+func diffMessages(want, got []core.Message) string {
+	for i := range min(len(want), len(got)) {
+		w, g := want[i], got[i]
+		switch {
+		case w.Role != g.Role:
+			return fmt.Sprintf("message %d has role %s, recorded %s", i, g.Role, w.Role)
+		case w.Content != g.Content:
+			return fmt.Sprintf("message %d has content %q, recorded %q", i, truncate(g.Content), truncate(w.Content))
+		case w.ToolCallID != g.ToolCallID:
+			return fmt.Sprintf("message %d answers tool call %s, recorded %s", i, g.ToolCallID, w.ToolCallID)
+		case !slices.Equal(w.ToolCalls, g.ToolCalls):
+			return fmt.Sprintf("message %d has different tool calls", i)
+		}
+	}
+	if len(want) != len(got) {
+		return fmt.Sprintf("turn has %d messages, recorded %d", len(got), len(want))
+	}
+	return ""
+}
+
+func truncate(s string) string {
+	if len(s) <= maxDiffContent {
+		return s
+	}
+	return strings.ToValidUTF8(s[:maxDiffContent], "") + "…"
+}
+
+type replayAI struct {
+	r *Replayer
+}
+
+func (a *replayAI) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	return a.r.chat(history, tools)
+}
+
+func (a *replayAI) ChatStream(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	msg, err := a.r.chat(history, tools)
+	if err == nil && onDelta != nil && (msg.Content != "" || msg.Reasoning != "") {
+		onDelta(core.StreamDelta{Content: msg.Content, Reasoning: msg.Reasoning})
+	}
+	return msg, err
+}
+
+func (a *replayAI) Models(ctx context.Context) ([]core.Model, error) {
+	return nil, nil
+}
+
+type replayMCP struct {
+	r *Replayer
+}
+
+func (m *replayMCP) GetTools(ctx context.Context) ([]core.Tool, error) {
+	return m.r.getTools(), nil
+}
+
+func (m *replayMCP) CallTool(ctx context.Context, name string, args string) (core.ToolResult, error) {
+	return m.r.callTool(name, args)
+}
@@ -2,10 +2,14 @@ package state
 
 import (
 	"context"
+
+	"github.com/sandevgo/tuskbot/internal/core"
 )
 
 type provider interface {
 	SetModel(ctx context.Context, model string) error
+	CheckModel(ctx context.Context, model string) error
+	Capabilities(ctx context.Context, model string) core.Capabilities
 }
 
 type GlobalState struct {
@@ -21,5 +25,16 @@ func NewGlobalState(
 }
 
 func (s *GlobalState) ChangeModel(ctx context.Context, model string) error {
+	if err := s.provider.CheckModel(ctx, model); err != nil {
+		return err
+	}
 	return s.provider.SetModel(ctx, model)
 }
+
+func (s *GlobalState) CheckModel(ctx context.Context, model string) error {
+	return s.provider.CheckModel(ctx, model)
+}
+
+func (s *GlobalState) Capabilities(ctx context.Context, model string) core.Capabilities {
+	return s.provider.Capabilities(ctx, model)
+}
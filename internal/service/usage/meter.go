@@ -0,0 +1,273 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/log"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// budgetWarnShare is the share of the monthly budget after which users
+	// are warned.
+	budgetWarnShare = 0.8
+	// priceRefresh is how often a provider's model list is checked for
+	// prices of unknown models.
+	priceRefresh = time.Hour
+	// storeTimeout bounds writing a usage record and looking up prices.
+	storeTimeout = 10 * time.Second
+)
+
+// ErrBudgetExceeded is returned instead of a response once the monthly
+// budget is used up.
+var ErrBudgetExceeded = errors.New("monthly LLM budget is used up")
+
+// ModelSource gives access to the provider of any "provider/model", whose
+// model list may contain prices.
+type ModelSource interface {
+	ModelProvider(ctx context.Context, spec string) (core.AIProvider, error)
+}
+
+// Meter records the token usage and cost of chat requests and enforces the
+// monthly budget.
+type Meter struct {
+	repo   core.UsageRepository
+	prices Prices
+	models ModelSource
+	budget float64
+	now    func() time.Time
+
+	mu      sync.Mutex
+	auto    Prices               // prices from provider model lists
+	fetched map[string]time.Time // last model list lookup by provider
+	warned  string               // month of the last budget warning
+
+	// lookups shares a model list lookup between requests to a provider
+	lookups singleflight.Group
+}
+
+// NewMeter loads the price table. models may be nil, then only the price
+// table and costs reported by providers are used.
+func NewMeter(repo core.UsageRepository, cfg core.UsageConfig, models ModelSource) (*Meter, error) {
+	prices, err := LoadPrices(cfg.GetPricesPath())
+	if err != nil {
+		return nil, err
+	}
+	return &Meter{
+		repo:    repo,
+		prices:  prices,
+		models:  models,
+		budget:  cfg.GetMonthlyBudget(),
+		now:     time.Now,
+		auto:    make(Prices),
+		fetched: make(map[string]time.Time),
+	}, nil
+}
+
+// Budget returns the monthly budget in USD, 0 if there is none.
+func (m *Meter) Budget() float64 {
+	return m.budget
+}
+
+// Provider wraps ai so that its requests are metered under purpose.
+func (m *Meter) Provider(ai core.AIProvider, purpose string) core.AIProvider {
+	return &meteredAI{meter: m, next: ai, purpose: purpose}
+}
+
+// MonthStart returns the start of the current budget month in UTC.
+func (m *Meter) MonthStart() time.Time {
+	now := m.now().UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// spent returns the cost of the current month.
+func (m *Meter) spent(ctx context.Context) (float64, error) {
+	sums, err := m.repo.SumUsage(ctx, m.MonthStart(), core.UsageTotal)
+	if err != nil {
+		return 0, err
+	}
+	if len(sums) == 0 {
+		return 0, nil
+	}
+	return sums[0].Usage.Cost, nil
+}
+
+// check blocks requests once the budget is used up.
+func (m *Meter) check(ctx context.Context) error {
+	if m.budget <= 0 {
+		return nil
+	}
+	spent, err := m.spent(ctx)
+	if err != nil {
+		log.FromCtx(ctx).Warn().Err(err).Msg("failed to check LLM budget")
+		return nil
+	}
+	if spent >= m.budget {
+		return fmt.Errorf("%w: $%.2f of $%.2f spent this month", ErrBudgetExceeded, spent, m.budget)
+	}
+	return nil
+}
+
+// record stores the usage of a response and returns a warning for the
+// user when the budget is nearly used up.
+func (m *Meter) record(ctx context.Context, purpose string, usage core.Usage) string {
+	logger := log.FromCtx(ctx)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+
+	usage.Cost = m.cost(ctx, usage)
+	rec := core.UsageRecord{
+		SessionID: core.SessionIDFromCtx(ctx),
+		RunID:     core.RunIDFromCtx(ctx),
+		Purpose:   purpose,
+		Usage:     usage,
+		CreatedAt: m.now(),
+	}
+	if err := m.repo.AddUsage(ctx, rec); err != nil {
+		logger.Warn().Err(err).Msg("failed to record LLM usage")
+		return ""
+	}
+
+	if m.budget <= 0 {
+		return ""
+	}
+	spent, err := m.spent(ctx)
+	if err != nil || spent < budgetWarnShare*m.budget {
+		return ""
+	}
+
+	month := m.MonthStart().Format("2006-01")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.warned == month {
+		return ""
+	}
+	m.warned = month
+	return fmt.Sprintf("$%.2f of the $%.2f monthly LLM budget is spent. Requests are blocked once it is used up.", spent, m.budget)
+}
+
+// cost prefers the cost reported by the provider, then the price of the
+// exact model from the price table or the provider's model list, then the
+// price table entry the model starts with. Unknown models are free.
+func (m *Meter) cost(ctx context.Context, usage core.Usage) float64 {
+	if usage.Cost > 0 {
+		return usage.Cost
+	}
+	if price, ok := m.prices[usage.Model]; ok {
+		return price.Cost(usage)
+	}
+	if price, ok := m.autoPrice(ctx, usage.Model); ok {
+		return price.Cost(usage)
+	}
+	if price, ok := m.prices.Match(usage.Model); ok {
+		return price.Cost(usage)
+	}
+
+	log.FromCtx(ctx).Debug().Str("model", usage.Model).Msg("no price for model, counting it as free")
+	return 0
+}
+
+// autoPrice looks the exact model up in its provider's model list, which
+// OpenRouter publishes with prices. The list is fetched outside the lock,
+// at most once per priceRefresh and provider, and its prices are cached.
+func (m *Meter) autoPrice(ctx context.Context, model string) (Price, bool) {
+	provider, _, ok := strings.Cut(model, "/")
+	if !ok || provider == "" || m.models == nil {
+		return Price{}, false
+	}
+
+	m.mu.Lock()
+	price, ok := m.auto[model]
+	stale := m.now().Sub(m.fetched[provider]) >= priceRefresh
+	m.mu.Unlock()
+	if ok || !stale {
+		return price, ok
+	}
+
+	prices, _, _ := m.lookups.Do(provider, func() (any, error) {
+		prices := m.fetchPrices(ctx, provider, model)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.fetched[provider] = m.now()
+		for name, price := range prices {
+			m.auto[name] = price
+		}
+		return prices, nil
+	})
+	price, ok = prices.(Prices)[model]
+	return price, ok
+}
+
+// fetchPrices returns the prices in the model list of the provider of
+// model, or none if it cannot be fetched.
+func (m *Meter) fetchPrices(ctx context.Context, provider, model string) Prices {
+	ai, err := m.models.ModelProvider(ctx, model)
+	if err != nil {
+		return nil
+	}
+	models, err := ai.Models(ctx)
+	if err != nil {
+		log.FromCtx(ctx).Warn().Err(err).Str("provider", provider).Msg("failed to get model prices")
+		return nil
+	}
+	return pricesFromModels(provider, models)
+}
+
+type meteredAI struct {
+	meter   *Meter
+	next    core.AIProvider
+	purpose string
+}
+
+func (a *meteredAI) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	if err := a.meter.check(ctx); err != nil {
+		return core.Message{}, err
+	}
+	msg, err := a.next.Chat(ctx, history, tools)
+	if err == nil {
+		a.record(ctx, &msg)
+	}
+	return msg, err
+}
+
+// ChatStream streams when the wrapped provider can, and meters the
+// assembled response.
+func (a *meteredAI) ChatStream(ctx context.Context, history []core.Message, tools []core.Tool, onDelta func(core.StreamDelta)) (core.Message, error) {
+	streamer, ok := a.next.(core.StreamingProvider)
+	if !ok {
+		msg, err := a.Chat(ctx, history, tools)
+		if err == nil && onDelta != nil && (msg.Content != "" || msg.Reasoning != "") {
+			onDelta(core.StreamDelta{Content: msg.Content, Reasoning: msg.Reasoning})
+		}
+		return msg, err
+	}
+
+	if err := a.meter.check(ctx); err != nil {
+		return core.Message{}, err
+	}
+	msg, err := streamer.ChatStream(ctx, history, tools, onDelta)
+	if err == nil {
+		a.record(ctx, &msg)
+	}
+	return msg, err
+}
+
+func (a *meteredAI) Models(ctx context.Context) ([]core.Model, error) {
+	return a.next.Models(ctx)
+}
+
+func (a *meteredAI) record(ctx context.Context, msg *core.Message) {
+	if msg.Usage == nil {
+		return
+	}
+	if warning := a.meter.record(ctx, a.purpose, *msg.Usage); warning != "" {
+		msg.Warning = warning
+	}
+}
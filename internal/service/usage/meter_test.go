@@ -0,0 +1,238 @@
+package usage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubConfig struct {
+	dir    string
+	budget float64
+}
+
+func (c stubConfig) GetPricesPath() string     { return filepath.Join(c.dir, "prices.json") }
+func (c stubConfig) GetMonthlyBudget() float64 { return c.budget }
+
+type memoryUsage struct {
+	records []core.UsageRecord
+}
+
+func (m *memoryUsage) AddUsage(ctx context.Context, rec core.UsageRecord) error {
+	m.records = append(m.records, rec)
+	return nil
+}
+
+func (m *memoryUsage) SumUsage(ctx context.Context, since time.Time, group core.UsageGroup) ([]core.UsageSum, error) {
+	var sum core.UsageSum
+	for _, rec := range m.records {
+		if rec.CreatedAt.Before(since) {
+			continue
+		}
+		sum.Requests++
+		sum.Usage = sum.Usage.Add(rec.Usage)
+	}
+	if sum.Requests == 0 {
+		return nil, nil
+	}
+	return []core.UsageSum{sum}, nil
+}
+
+type stubAI struct {
+	usage   core.Usage
+	models  []core.Model
+	calls   int
+	lookups int
+}
+
+func (s *stubAI) Chat(ctx context.Context, history []core.Message, tools []core.Tool) (core.Message, error) {
+	s.calls++
+	usage := s.usage
+	return core.Message{Role: core.RoleAssistant, Content: "ok", Usage: &usage}, nil
+}
+
+func (s *stubAI) Models(ctx context.Context) ([]core.Model, error) {
+	s.lookups++
+	return s.models, nil
+}
+
+func (s *stubAI) ModelProvider(ctx context.Context, spec string) (core.AIProvider, error) {
+	return s, nil
+}
+
+func newTestMeter(t *testing.T, budget float64, models ModelSource) (*Meter, *memoryUsage) {
+	repo := &memoryUsage{}
+	m, err := NewMeter(repo, stubConfig{dir: t.TempDir(), budget: budget}, models)
+	require.NoError(t, err)
+	return m, repo
+}
+
+func TestPrices_Match(t *testing.T) {
+	prices := Prices{
+		"anthropic/claude-sonnet-4":        {Prompt: 3},
+		"anthropic/claude-sonnet-4-5":      {Prompt: 4},
+		"openai/gpt-4o":                    {Prompt: 2.5},
+		"openai/gpt-4o-mini":               {Prompt: 0.15},
+		"ollama/":                          {},
+		"openrouter/qwen/qwen3-coder:free": {},
+	}
+
+	tests := []struct {
+		model  string
+		want   float64
+		wantOK bool
+	}{
+		{"openai/gpt-4o", 2.5, true},
+		{"openai/gpt-4o-mini", 0.15, true},
+		{"openai/gpt-4o-2024-08-06", 2.5, true},
+		{"anthropic/claude-sonnet-4-5-20250929", 4, true},
+		{"anthropic/claude-sonnet-4-20250514", 3, true},
+		{"ollama/llama3", 0, true},
+		{"openai/o3", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			price, ok := prices.Match(tt.model)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, price.Prompt)
+		})
+	}
+}
+
+func TestPrice_Cost(t *testing.T) {
+	price := Price{Prompt: 3, Completion: 15, CachedPrompt: 0.3}
+	usage := core.Usage{PromptTokens: 1_000_000, CachedTokens: 500_000, CompletionTokens: 100_000}
+
+	assert.InDelta(t, 1.5+0.15+1.5, price.Cost(usage), 1e-9)
+
+	// Without a cache price cached tokens cost as much as other prompt tokens
+	assert.InDelta(t, 3+1.5, Price{Prompt: 3, Completion: 15}.Cost(usage), 1e-9)
+}
+
+func TestPricesFromModels(t *testing.T) {
+	prices := pricesFromModels("openrouter", []core.Model{
+		{ID: "openai/gpt-4o", Pricing: &core.ModelPricing{Prompt: "0.0000025", Completion: "0.00001", InputCacheRead: "0.00000125"}},
+		{ID: "openrouter/auto", Pricing: &core.ModelPricing{Prompt: "-1", Completion: "-1"}},
+		{ID: "no-pricing"},
+	})
+
+	require.Len(t, prices, 1)
+	price := prices["openrouter/openai/gpt-4o"]
+	assert.InDelta(t, 2.5, price.Prompt, 1e-9)
+	assert.InDelta(t, 10, price.Completion, 1e-9)
+	assert.InDelta(t, 1.25, price.CachedPrompt, 1e-9)
+}
+
+func TestMeter_RecordsCost(t *testing.T) {
+	tests := []struct {
+		name   string
+		usage  core.Usage
+		models []core.Model
+		want   float64
+	}{
+		{
+			name:  "reported by provider",
+			usage: core.Usage{Model: "openrouter/x/y", PromptTokens: 1000, Cost: 0.42},
+			want:  0.42,
+		},
+		{
+			name:  "price table",
+			usage: core.Usage{Model: "openai/gpt-4o-2024-08-06", PromptTokens: 1_000_000},
+			want:  2.5,
+		},
+		{
+			name:  "provider model list",
+			usage: core.Usage{Model: "openrouter/x/y", CompletionTokens: 1_000_000},
+			models: []core.Model{
+				{ID: "x/y", Pricing: &core.ModelPricing{Prompt: "0.000001", Completion: "0.000002"}},
+			},
+			want: 2,
+		},
+		{
+			name:  "exact model list price before a table prefix",
+			usage: core.Usage{Model: "openai/gpt-4o-audio", PromptTokens: 1_000_000},
+			models: []core.Model{
+				{ID: "gpt-4o-audio", Pricing: &core.ModelPricing{Prompt: "0.000004", Completion: "0.000016"}},
+			},
+			want: 4,
+		},
+		{
+			name:  "unknown model",
+			usage: core.Usage{Model: "custom/local", PromptTokens: 1_000_000},
+			want:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ai := &stubAI{usage: tt.usage, models: tt.models}
+			m, repo := newTestMeter(t, 0, ai)
+
+			ctx := core.WithRunID(core.WithSessionID(context.Background(), "s1"), "r1")
+			_, err := m.Provider(ai, core.PurposeChat).Chat(ctx, nil, nil)
+			require.NoError(t, err)
+
+			require.Len(t, repo.records, 1)
+			rec := repo.records[0]
+			assert.Equal(t, "s1", rec.SessionID)
+			assert.Equal(t, "r1", rec.RunID)
+			assert.Equal(t, core.PurposeChat, rec.Purpose)
+			assert.InDelta(t, tt.want, rec.Usage.Cost, 1e-9)
+		})
+	}
+}
+
+func TestMeter_ModelListCached(t *testing.T) {
+	ai := &stubAI{
+		usage:  core.Usage{Model: "openrouter/x/y", PromptTokens: 1_000_000},
+		models: []core.Model{{ID: "x/y", Pricing: &core.ModelPricing{Prompt: "0.000001", Completion: "0"}}},
+	}
+	m, repo := newTestMeter(t, 0, ai)
+	provider := m.Provider(ai, core.PurposeChat)
+
+	for range 2 {
+		_, err := provider.Chat(context.Background(), nil, nil)
+		require.NoError(t, err)
+	}
+	ai.usage.Model = "openrouter/unknown"
+	_, err := provider.Chat(context.Background(), nil, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, ai.lookups, "the model list is fetched once per refresh")
+	require.Len(t, repo.records, 3)
+	assert.InDelta(t, 1, repo.records[1].Usage.Cost, 1e-9)
+	assert.Zero(t, repo.records[2].Usage.Cost)
+}
+
+func TestMeter_Budget(t *testing.T) {
+	ai := &stubAI{usage: core.Usage{Model: "openrouter/x/y", Cost: 3}}
+	m, repo := newTestMeter(t, 10, ai)
+	provider := m.Provider(ai, core.PurposeChat)
+	ctx := context.Background()
+
+	// Last month's spend does not count
+	repo.records = append(repo.records, core.UsageRecord{Usage: core.Usage{Cost: 100}, CreatedAt: m.MonthStart().Add(-time.Hour)})
+
+	var warnings []string
+	for range 4 {
+		msg, err := provider.Chat(ctx, nil, nil)
+		require.NoError(t, err)
+		warnings = append(warnings, msg.Warning)
+	}
+
+	// The warning at 80% of the budget is sent once
+	assert.Empty(t, warnings[0])
+	assert.Empty(t, warnings[1])
+	assert.Contains(t, warnings[2], "$9.00 of the $10.00")
+	assert.Empty(t, warnings[3])
+
+	_, err := provider.Chat(ctx, nil, nil)
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+	assert.Equal(t, 4, ai.calls)
+}
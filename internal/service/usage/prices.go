@@ -0,0 +1,129 @@
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+// Price is the price of a model in USD per million tokens.
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+	// CachedPrompt is the price of prompt tokens read from the cache. Zero
+	// means cached tokens cost as much as other prompt tokens.
+	CachedPrompt float64 `json:"cached_prompt,omitempty"`
+}
+
+// Cost returns the price of the tokens in u.
+func (p Price) Cost(u core.Usage) float64 {
+	cached := min(u.CachedTokens, u.PromptTokens)
+	cachedPrice := p.CachedPrompt
+	if cachedPrice == 0 {
+		cachedPrice = p.Prompt
+	}
+
+	return (float64(u.PromptTokens-cached)*p.Prompt +
+		float64(cached)*cachedPrice +
+		float64(u.CompletionTokens)*p.Completion) / 1e6
+}
+
+// Prices are model prices by "provider/model". A key also matches the
+// models it is a prefix of, such as dated snapshots; the longest key wins.
+type Prices map[string]Price
+
+// DefaultPrices covers common models of the providers that do not report
+// prices. Local models are free.
+func DefaultPrices() Prices {
+	return Prices{
+		"anthropic/claude-opus-4":    {Prompt: 15, Completion: 75, CachedPrompt: 1.5},
+		"anthropic/claude-sonnet-4":  {Prompt: 3, Completion: 15, CachedPrompt: 0.3},
+		"anthropic/claude-haiku-4-5": {Prompt: 1, Completion: 5, CachedPrompt: 0.1},
+		"openai/gpt-4o":              {Prompt: 2.5, Completion: 10, CachedPrompt: 1.25},
+		"openai/gpt-4o-mini":         {Prompt: 0.15, Completion: 0.6, CachedPrompt: 0.075},
+		"openai/gpt-4.1":             {Prompt: 2, Completion: 8, CachedPrompt: 0.5},
+		"openai/gpt-4.1-mini":        {Prompt: 0.4, Completion: 1.6, CachedPrompt: 0.1},
+		"ollama/":                    {},
+	}
+}
+
+// LoadPrices reads the price file, creating it with DefaultPrices if missing.
+func LoadPrices(path string) (Prices, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		p := DefaultPrices()
+		if err := p.Save(path); err != nil {
+			return nil, fmt.Errorf("failed to create default prices: %w", err)
+		}
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prices: %w", err)
+	}
+
+	var p Prices
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse prices: %w", err)
+	}
+	for model, price := range p {
+		if price.Prompt < 0 || price.Completion < 0 || price.CachedPrompt < 0 {
+			return nil, fmt.Errorf("invalid prices: %s: prices must not be negative", model)
+		}
+	}
+	return p, nil
+}
+
+func (p Prices) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal prices: %w", err)
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Match returns the price of a "provider/model".
+func (p Prices) Match(model string) (Price, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+
+	var best string
+	for key := range p {
+		if strings.HasPrefix(model, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return p[best], true
+}
+
+// pricesFromModels converts the per-token prices of a provider's model list.
+func pricesFromModels(provider string, models []core.Model) Prices {
+	prices := make(Prices)
+	for _, m := range models {
+		if m.Pricing == nil {
+			continue
+		}
+		prompt, err1 := strconv.ParseFloat(m.Pricing.Prompt, 64)
+		completion, err2 := strconv.ParseFloat(m.Pricing.Completion, 64)
+		if err1 != nil || err2 != nil || prompt < 0 || completion < 0 {
+			// OpenRouter uses -1 for routers with variable prices
+			continue
+		}
+		cached, _ := strconv.ParseFloat(m.Pricing.InputCacheRead, 64)
+
+		prices[provider+"/"+m.ID] = Price{
+			Prompt:       prompt * 1e6,
+			Completion:   completion * 1e6,
+			CachedPrompt: max(cached, 0) * 1e6,
+		}
+	}
+	return prices
+}
@@ -12,8 +12,9 @@ import (
 )
 
 const (
-	sqlInsertMessage    = `INSERT INTO messages (session_id, role, content, tool_calls, tool_call_id) VALUES (?, ?, ?, ?, ?)`
-	sqlSelectMessages   = `SELECT role, content, tool_calls, tool_call_id FROM messages WHERE session_id = ? ORDER BY id DESC LIMIT ?`
+	sqlInsertMessage    = `INSERT INTO messages (session_id, role, content, tool_calls, tool_call_id, parts, is_error) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	sqlSelectMessages   = `SELECT role, content, tool_calls, tool_call_id, parts, is_error FROM messages WHERE session_id = ? ORDER BY id DESC LIMIT ?`
+	sqlSelectSince      = `SELECT role, content, tool_calls, tool_call_id, parts, is_error FROM messages WHERE session_id = ? AND id > ? ORDER BY id DESC LIMIT ?`
 	sqlSelectUnembedded = `SELECT id, role, content, tool_calls, tool_call_id FROM messages WHERE embedded = false AND content != '' ORDER BY id ASC LIMIT ?`
 	sqlInsertVector     = `INSERT INTO messages_vec (rowid, embedding) VALUES (?, ?)`
 	sqlDeleteVector     = `DELETE FROM messages_vec WHERE rowid = ?`
@@ -34,9 +35,13 @@ func (r *MessagesRepo) AddMessage(ctx context.Context, sessionID string, msg cor
 	if err != nil {
 		return fmt.Errorf("failed to marshal tool calls: %w", err)
 	}
+	partsStr, err := marshalParts(msg.Parts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal content parts: %w", err)
+	}
 
 	return r.withTx(ctx, func(tx *sql.Tx) error {
-		res, err := tx.ExecContext(ctx, sqlInsertMessage, sessionID, msg.Role, msg.Content, toolCallsStr, msg.ToolCallID)
+		res, err := tx.ExecContext(ctx, sqlInsertMessage, sessionID, msg.Role, msg.Content, toolCallsStr, msg.ToolCallID, partsStr, msg.IsError)
 		if err != nil {
 			return fmt.Errorf("failed to insert message: %w", err)
 		}
@@ -76,6 +81,23 @@ func (r *MessagesRepo) GetMessages(ctx context.Context, sessionID string, limit
 	return messages, nil
 }
 
+// GetMessagesSince retrieves the last 'limit' messages newer than afterID in chronological order.
+func (r *MessagesRepo) GetMessagesSince(ctx context.Context, sessionID string, afterID int64, limit int) ([]core.Message, error) {
+	rows, err := r.db.QueryContext(ctx, sqlSelectSince, sessionID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(messages)
+	return messages, nil
+}
+
 // GetUnembeddedMessages retrieves messages that haven't been embedded yet.
 func (r *MessagesRepo) GetUnembeddedMessages(ctx context.Context, limit int) ([]core.StoredMessage, error) {
 	rows, err := r.db.QueryContext(ctx, sqlSelectUnembedded, limit)
@@ -168,15 +190,42 @@ func unmarshalToolCalls(data string) ([]core.ToolCall, error) {
 	return calls, nil
 }
 
+// marshalParts converts content parts to a JSON string. Their data stays in
+// the files the parts refer to.
+func marshalParts(parts []core.ContentPart) (string, error) {
+	if len(parts) == 0 {
+		return "", nil
+	}
+
+	b, err := json.Marshal(parts)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// unmarshalParts parses a JSON string into content parts.
+func unmarshalParts(data string) ([]core.ContentPart, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	var parts []core.ContentPart
+	if err := json.Unmarshal([]byte(data), &parts); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
 // scanMessages scans rows into core.Message slices.
 func scanMessages(rows *sql.Rows) ([]core.Message, error) {
 	var messages []core.Message
 
 	for rows.Next() {
 		var msg core.Message
-		var content, toolCallsStr, toolCallID sql.NullString
+		var content, toolCallsStr, toolCallID, partsStr sql.NullString
 
-		if err := rows.Scan(&msg.Role, &content, &toolCallsStr, &toolCallID); err != nil {
+		if err := rows.Scan(&msg.Role, &content, &toolCallsStr, &toolCallID, &partsStr, &msg.IsError); err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
 		}
 
@@ -189,6 +238,12 @@ func scanMessages(rows *sql.Rows) ([]core.Message, error) {
 		}
 		msg.ToolCalls = toolCalls
 
+		parts, err := unmarshalParts(partsStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal content parts: %w", err)
+		}
+		msg.Parts = parts
+
 		messages = append(messages, msg)
 	}
 
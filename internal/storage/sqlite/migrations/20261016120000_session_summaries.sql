@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE session_summaries (
+    session_id TEXT PRIMARY KEY,
+    summary TEXT NOT NULL,
+    last_message_id INTEGER NOT NULL, -- newest message covered by the summary
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE session_summaries;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE plans (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id TEXT NOT NULL,
+    title TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'active', -- active, completed, replaced, cancelled
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_plans_session_status ON plans(session_id, status);
+
+CREATE TABLE plan_steps (
+    plan_id INTEGER NOT NULL REFERENCES plans(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL, -- 1-based
+    description TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, in_progress, done, failed, skipped
+    note TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (plan_id, position)
+);
+
+-- +goose Down
+DROP TABLE plan_steps;
+DROP TABLE plans;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE session_settings (
+    session_id TEXT PRIMARY KEY,
+    model TEXT NOT NULL DEFAULT '', -- provider/model, empty for the global model
+    temperature REAL, -- NULL for the provider default
+    max_tokens INTEGER NOT NULL DEFAULT 0,
+    reasoning_effort TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE session_settings;
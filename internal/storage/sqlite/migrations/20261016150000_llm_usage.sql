@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE llm_usage (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id TEXT NOT NULL DEFAULT '',
+    run_id TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL, -- provider/model
+    purpose TEXT NOT NULL, -- chat, extraction, summary
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    cached_tokens INTEGER NOT NULL DEFAULT 0,
+    reasoning_tokens INTEGER NOT NULL DEFAULT 0,
+    cost REAL NOT NULL DEFAULT 0, -- USD
+    created_at DATETIME NOT NULL -- UTC
+);
+
+CREATE INDEX idx_llm_usage_created_at ON llm_usage(created_at);
+
+-- +goose Down
+DROP TABLE llm_usage;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- JSON list of content parts, their data is kept in files of the runtime path
+ALTER TABLE messages ADD COLUMN parts TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN parts;
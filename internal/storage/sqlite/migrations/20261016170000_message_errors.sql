@@ -0,0 +1,7 @@
+-- +goose Up
+-- Set on tool messages that report a failed call
+ALTER TABLE messages ADD COLUMN is_error BOOLEAN NOT NULL DEFAULT false;
+UPDATE messages SET is_error = true WHERE role = 'tool' AND content LIKE 'Error:%';
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN is_error;
@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+const (
+	sqlReplaceActivePlans = `UPDATE plans SET status = 'replaced', updated_at = CURRENT_TIMESTAMP WHERE session_id = ? AND status = 'active'`
+	sqlInsertPlan         = `INSERT INTO plans (session_id, title, status) VALUES (?, ?, 'active')`
+	sqlInsertPlanStep     = `INSERT INTO plan_steps (plan_id, position, description) VALUES (?, ?, ?)`
+	sqlSelectActivePlan   = `SELECT id, title, status, created_at, updated_at FROM plans WHERE session_id = ? AND status = 'active' ORDER BY id DESC LIMIT 1`
+	sqlSelectPlanSteps    = `SELECT position, description, status, note FROM plan_steps WHERE plan_id = ? ORDER BY position ASC`
+	sqlUpdatePlanStep     = `UPDATE plan_steps SET status = ?, note = ? WHERE plan_id = ? AND position = ?`
+	sqlTouchPlan          = `UPDATE plans SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	sqlUpdatePlanStatus   = `UPDATE plans SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+)
+
+type PlansRepo struct {
+	db *sql.DB
+}
+
+func NewPlansRepo(db *sql.DB) *PlansRepo {
+	return &PlansRepo{db: db}
+}
+
+func (r *PlansRepo) CreatePlan(ctx context.Context, sessionID, title string, steps []string) (core.Plan, error) {
+	plan := core.Plan{SessionID: sessionID, Title: title, Status: core.PlanActive}
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqlReplaceActivePlans, sessionID); err != nil {
+			return fmt.Errorf("failed to replace active plan: %w", err)
+		}
+
+		res, err := tx.ExecContext(ctx, sqlInsertPlan, sessionID, title)
+		if err != nil {
+			return fmt.Errorf("failed to insert plan: %w", err)
+		}
+		if plan.ID, err = res.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to get last insert id: %w", err)
+		}
+
+		for i, description := range steps {
+			if _, err := tx.ExecContext(ctx, sqlInsertPlanStep, plan.ID, i+1, description); err != nil {
+				return fmt.Errorf("failed to insert plan step: %w", err)
+			}
+			plan.Steps = append(plan.Steps, core.PlanStep{
+				Position:    i + 1,
+				Description: description,
+				Status:      core.StepPending,
+			})
+		}
+		return nil
+	})
+	return plan, err
+}
+
+func (r *PlansRepo) GetActivePlan(ctx context.Context, sessionID string) (*core.Plan, error) {
+	plan := &core.Plan{SessionID: sessionID}
+
+	err := r.db.QueryRowContext(ctx, sqlSelectActivePlan, sessionID).
+		Scan(&plan.ID, &plan.Title, &plan.Status, &plan.CreatedAt, &plan.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query plan: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, sqlSelectPlanSteps, plan.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query plan steps: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var step core.PlanStep
+		if err := rows.Scan(&step.Position, &step.Description, &step.Status, &step.Note); err != nil {
+			return nil, fmt.Errorf("failed to scan plan step: %w", err)
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	return plan, rows.Err()
+}
+
+func (r *PlansRepo) UpdateStep(ctx context.Context, planID int64, position int, status core.StepStatus, note string) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, sqlUpdatePlanStep, status, note, planID, position)
+		if err != nil {
+			return fmt.Errorf("failed to update plan step: %w", err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return fmt.Errorf("plan %d has no step %d", planID, position)
+		}
+
+		if _, err := tx.ExecContext(ctx, sqlTouchPlan, planID); err != nil {
+			return fmt.Errorf("failed to update plan: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *PlansRepo) SetPlanStatus(ctx context.Context, planID int64, status core.PlanStatus) error {
+	if _, err := r.db.ExecContext(ctx, sqlUpdatePlanStatus, status, planID); err != nil {
+		return fmt.Errorf("failed to update plan status: %w", err)
+	}
+	return nil
+}
+
+// withTx executes the given function within a transaction.
+func (r *PlansRepo) withTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+const (
+	sqlSelectSessionSettings = `SELECT model, temperature, max_tokens, reasoning_effort, updated_at FROM session_settings WHERE session_id = ?`
+	sqlUpsertSessionSettings = `
+		INSERT INTO session_settings (session_id, model, temperature, max_tokens, reasoning_effort, updated_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(session_id) DO UPDATE SET
+			model = excluded.model,
+			temperature = excluded.temperature,
+			max_tokens = excluded.max_tokens,
+			reasoning_effort = excluded.reasoning_effort,
+			updated_at = excluded.updated_at`
+)
+
+type SettingsRepo struct {
+	db *sql.DB
+}
+
+func NewSettingsRepo(db *sql.DB) *SettingsRepo {
+	return &SettingsRepo{db: db}
+}
+
+func (r *SettingsRepo) GetSessionSettings(ctx context.Context, sessionID string) (core.SessionSettings, error) {
+	s := core.SessionSettings{SessionID: sessionID}
+
+	var temperature sql.NullFloat64
+	err := r.db.QueryRowContext(ctx, sqlSelectSessionSettings, sessionID).
+		Scan(&s.Model, &temperature, &s.Options.MaxTokens, &s.Options.ReasoningEffort, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to query session settings: %w", err)
+	}
+
+	if temperature.Valid {
+		s.Options.Temperature = &temperature.Float64
+	}
+	return s, nil
+}
+
+func (r *SettingsRepo) SaveSessionSettings(ctx context.Context, s core.SessionSettings) error {
+	var temperature sql.NullFloat64
+	if s.Options.Temperature != nil {
+		temperature = sql.NullFloat64{Float64: *s.Options.Temperature, Valid: true}
+	}
+
+	_, err := r.db.ExecContext(ctx, sqlUpsertSessionSettings,
+		s.SessionID, s.Model, temperature, s.Options.MaxTokens, s.Options.ReasoningEffort)
+	if err != nil {
+		return fmt.Errorf("failed to save session settings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+const (
+	sqlSelectSummary = `SELECT summary, last_message_id, updated_at FROM session_summaries WHERE session_id = ?`
+	sqlUpsertSummary = `
+		INSERT INTO session_summaries (session_id, summary, last_message_id, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(session_id) DO UPDATE SET
+			summary = excluded.summary,
+			last_message_id = excluded.last_message_id,
+			updated_at = excluded.updated_at`
+	sqlSelectSessions    = `SELECT DISTINCT session_id FROM messages`
+	sqlCountSince        = `SELECT COUNT(*) FROM messages WHERE session_id = ? AND id > ?`
+	sqlSelectStoredSince = `SELECT id, role, content, tool_calls, tool_call_id FROM messages WHERE session_id = ? AND id > ? ORDER BY id ASC LIMIT ?`
+)
+
+type SummariesRepo struct {
+	db *sql.DB
+}
+
+func NewSummariesRepo(db *sql.DB) *SummariesRepo {
+	return &SummariesRepo{db: db}
+}
+
+// GetSummary returns the summary of a session, or a zero summary if there is none yet.
+func (r *SummariesRepo) GetSummary(ctx context.Context, sessionID string) (core.SessionSummary, error) {
+	s := core.SessionSummary{SessionID: sessionID}
+
+	err := r.db.QueryRowContext(ctx, sqlSelectSummary, sessionID).Scan(&s.Summary, &s.LastMessageID, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to query summary: %w", err)
+	}
+	return s, nil
+}
+
+func (r *SummariesRepo) SaveSummary(ctx context.Context, s core.SessionSummary) error {
+	if _, err := r.db.ExecContext(ctx, sqlUpsertSummary, s.SessionID, s.Summary, s.LastMessageID); err != nil {
+		return fmt.Errorf("failed to save summary: %w", err)
+	}
+	return nil
+}
+
+func (r *SummariesRepo) ListSessions(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, sqlSelectSessions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, id)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SummariesRepo) CountMessagesSince(ctx context.Context, sessionID string, afterID int64) (int, error) {
+	var n int
+	if err := r.db.QueryRowContext(ctx, sqlCountSince, sessionID, afterID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+	return n, nil
+}
+
+// GetStoredMessagesSince returns up to 'limit' messages newer than afterID, oldest first.
+func (r *SummariesRepo) GetStoredMessagesSince(ctx context.Context, sessionID string, afterID int64, limit int) ([]core.StoredMessage, error) {
+	rows, err := r.db.QueryContext(ctx, sqlSelectStoredSince, sessionID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages, err := scanStoredMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		messages[i].SessionID = sessionID
+	}
+	return messages, nil
+}
@@ -0,0 +1,76 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+)
+
+const (
+	sqlInsertUsage = `
+		INSERT INTO llm_usage (session_id, run_id, model, purpose, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	sqlSumUsage = `
+		SELECT %s AS key, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(cached_tokens), SUM(reasoning_tokens), SUM(cost)
+		FROM llm_usage
+		WHERE created_at >= ?
+		GROUP BY key
+		ORDER BY key ASC`
+)
+
+// usageKeys are the SQL expressions of the usage groups. Days are in UTC.
+var usageKeys = map[core.UsageGroup]string{
+	core.UsageTotal:   `''`,
+	core.UsageByDay:   `substr(created_at, 1, 10)`,
+	core.UsageByModel: `model`,
+}
+
+type UsageRepo struct {
+	db *sql.DB
+}
+
+func NewUsageRepo(db *sql.DB) *UsageRepo {
+	return &UsageRepo{db: db}
+}
+
+func (r *UsageRepo) AddUsage(ctx context.Context, rec core.UsageRecord) error {
+	u := rec.Usage
+	_, err := r.db.ExecContext(ctx, sqlInsertUsage,
+		rec.SessionID, rec.RunID, u.Model, rec.Purpose,
+		u.PromptTokens, u.CompletionTokens, u.CachedTokens, u.ReasoningTokens,
+		u.Cost, rec.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert usage: %w", err)
+	}
+	return nil
+}
+
+func (r *UsageRepo) SumUsage(ctx context.Context, since time.Time, group core.UsageGroup) ([]core.UsageSum, error) {
+	key, ok := usageKeys[group]
+	if !ok {
+		return nil, fmt.Errorf("unknown usage group: %q", group)
+	}
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(sqlSumUsage, key), since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	var sums []core.UsageSum
+	for rows.Next() {
+		var s core.UsageSum
+		err := rows.Scan(&s.Key, &s.Requests,
+			&s.Usage.PromptTokens, &s.Usage.CompletionTokens, &s.Usage.CachedTokens, &s.Usage.ReasoningTokens,
+			&s.Usage.Cost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		sums = append(sums, s)
+	}
+	return sums, rows.Err()
+}
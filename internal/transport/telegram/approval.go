@@ -0,0 +1,133 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sandevgo/tuskbot/internal/core"
+	"github.com/sandevgo/tuskbot/pkg/log"
+	tele "gopkg.in/telebot.v3"
+)
+
+const maxApprovalArgsLen = 1000
+
+var _ core.Approver = (*Bot)(nil)
+
+var (
+	btnApprove     = tele.Btn{Unique: "approve", Text: "✅ Approve"}
+	btnDeny        = tele.Btn{Unique: "deny", Text: "❌ Deny"}
+	btnAlwaysAllow = tele.Btn{Unique: "always_allow", Text: "♾ Always allow"}
+)
+
+// approvals tracks approval requests waiting for the owner's answer.
+type approvals struct {
+	seq     atomic.Uint64
+	mu      sync.Mutex
+	pending map[string]chan core.ApprovalDecision
+}
+
+func newApprovals() *approvals {
+	return &approvals{pending: make(map[string]chan core.ApprovalDecision)}
+}
+
+func (a *approvals) add() (string, chan core.ApprovalDecision) {
+	id := strconv.FormatUint(a.seq.Add(1), 10)
+	ch := make(chan core.ApprovalDecision, 1)
+
+	a.mu.Lock()
+	a.pending[id] = ch
+	a.mu.Unlock()
+	return id, ch
+}
+
+func (a *approvals) remove(id string) {
+	a.mu.Lock()
+	delete(a.pending, id)
+	a.mu.Unlock()
+}
+
+// resolve delivers the decision and reports whether the request was still pending.
+func (a *approvals) resolve(id string, decision core.ApprovalDecision) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ch, ok := a.pending[id]
+	if !ok {
+		return false
+	}
+	delete(a.pending, id)
+	ch <- decision
+	return true
+}
+
+// RequestApproval asks the owner to approve a tool call with inline buttons.
+func (b *Bot) RequestApproval(ctx context.Context, req core.ApprovalRequest) (core.ApprovalDecision, error) {
+	id, decided := b.approvals.add()
+	defer b.approvals.remove(id)
+
+	markup := &tele.ReplyMarkup{}
+	markup.Inline(markup.Row(
+		markup.Data(btnApprove.Text, btnApprove.Unique, id),
+		markup.Data(btnDeny.Text, btnDeny.Unique, id),
+		markup.Data(btnAlwaysAllow.Text, btnAlwaysAllow.Unique, id),
+	))
+
+	text := approvalText(req)
+	msg, err := b.bot.Send(&tele.User{ID: b.ownerID}, text, markup, tele.NoPreview)
+	if err != nil {
+		return core.ApprovalDeny, fmt.Errorf("failed to send approval request: %w", err)
+	}
+
+	var (
+		decision core.ApprovalDecision
+		status   string
+	)
+	select {
+	case decision = <-decided:
+		status = map[core.ApprovalDecision]string{
+			core.ApprovalApprove:     "✅ Approved",
+			core.ApprovalDeny:        "❌ Denied",
+			core.ApprovalAlwaysAllow: "♾ Always allowed",
+		}[decision]
+	case <-ctx.Done():
+		err = ctx.Err()
+		status = "❌ Denied"
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = "⌛ Timed out, denied"
+		}
+	}
+
+	// Replace the buttons with the outcome
+	if _, editErr := b.bot.Edit(msg, text+"\n\n"+status, tele.NoPreview); editErr != nil {
+		log.FromCtx(ctx).Warn().Err(editErr).Msg("failed to update approval message")
+	}
+	return decision, err
+}
+
+func (b *Bot) handleApproval(decision core.ApprovalDecision) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		if !b.approvals.resolve(c.Callback().Data, decision) {
+			return c.Respond(&tele.CallbackResponse{Text: "This request is no longer pending"})
+		}
+		return c.Respond()
+	}
+}
+
+func approvalText(req core.ApprovalRequest) string {
+	server := req.Server
+	if server == "" {
+		server = "native"
+	}
+
+	args := req.Args
+	if len(args) > maxApprovalArgsLen {
+		args = strings.ToValidUTF8(args[:maxApprovalArgsLen], "") + "…"
+	}
+
+	return fmt.Sprintf("🔐 Approval required\n\nTool: %s\nServer: %s\nArguments:\n%s", req.Tool, server, args)
+}
@@ -13,6 +13,8 @@ import (
 
 const baseContextKey = "base_context"
 
+var btnStop = tele.Btn{Unique: "stop", Text: "⏹ Stop"}
+
 type Bot struct {
 	bot     *tele.Bot
 	cfg     core.TelegramConfig
@@ -20,6 +22,8 @@ type Bot struct {
 	router  core.CmdRouter
 	ownerID int64
 	sender  *sender
+
+	approvals *approvals
 }
 
 func NewBot(
@@ -38,12 +42,13 @@ func NewBot(
 	}
 
 	return &Bot{
-		bot:     b,
-		cfg:     cfg,
-		agent:   agent,
-		router:  router,
-		ownerID: cfg.GetTelegramOwnerID(),
-		sender:  newSender(b),
+		bot:       b,
+		cfg:       cfg,
+		agent:     agent,
+		router:    router,
+		ownerID:   cfg.GetTelegramOwnerID(),
+		sender:    newSender(b),
+		approvals: newApprovals(),
 	}, nil
 }
 
@@ -69,6 +74,10 @@ func (b *Bot) Start(ctx context.Context) error {
 	})
 
 	b.bot.Handle(tele.OnText, b.handleMessage)
+	b.bot.Handle(&btnApprove, b.handleApproval(core.ApprovalApprove))
+	b.bot.Handle(&btnDeny, b.handleApproval(core.ApprovalDeny))
+	b.bot.Handle(&btnAlwaysAllow, b.handleApproval(core.ApprovalAlwaysAllow))
+	b.bot.Handle(&btnStop, b.handleStop)
 
 	scope := tele.CommandScope{
 		Type:   tele.CommandScopeAllPrivateChats,
@@ -103,9 +112,15 @@ func (b *Bot) handleMessage(c tele.Context) error {
 	logger := log.FromCtx(ctx)
 	sessionID := fmt.Sprintf("telegram-%d", c.Chat().ID)
 
-	// Check if it's a command
-	if response, isCmd := b.router.Execute(ctx, sessionID, c.Text()); isCmd {
-		return b.sender.sendMarkdown(ctx, c.Chat(), response, false)
+	// Progress messages carry a Stop button until the run or command ends
+	stopMarkup := &tele.ReplyMarkup{}
+	stopMarkup.Inline(stopMarkup.Row(stopMarkup.Data(btnStop.Text, btnStop.Unique, sessionID)))
+
+	// Check if it's a command. Long running commands show their progress
+	cmdProgress := newProgressMessage(b.bot, b.sender, c.Chat(), stopMarkup)
+	cmdCtx := core.WithProgress(ctx, func(text string) { cmdProgress.Update(ctx, text) })
+	if response, isCmd := b.router.Execute(cmdCtx, sessionID, c.Text()); isCmd {
+		return cmdProgress.Finish(ctx, response)
 	}
 
 	// Start background typing indicator
@@ -114,18 +129,48 @@ func (b *Bot) handleMessage(c tele.Context) error {
 
 	go b.typingLoop(typingCtx, c)
 
-	_, err := b.agent.Run(ctx, sessionID, c.Text(), func(msg core.Message) {
-		// Send Content
-		if msg.Content != "" {
-			if err := b.sender.sendMarkdown(ctx, c.Chat(), msg.Content, true); err != nil {
+	stream := newStreamMessage(b.bot, b.sender, c.Chat())
+
+	var progress []*tele.Message
+	defer func() {
+		for _, m := range progress {
+			_, _ = b.bot.EditReplyMarkup(m, nil)
+		}
+	}()
+
+	_, err := b.agent.RunStream(ctx, sessionID, c.Text(), agent.Callbacks{
+		OnDelta: func(delta core.StreamDelta) {
+			stream.Append(ctx, delta.Content)
+		},
+		OnUpdate: func(msg core.Message) {
+			// Render the final content of the turn
+			content := msg.Content
+			if content != "" && msg.FallbackModel != "" {
+				content += fmt.Sprintf("\n\n↪️ Answered by fallback model `%s`", msg.FallbackModel)
+			}
+			if err := stream.Finish(ctx, content); err != nil {
 				logger.Error().Err(err).Msg("failed to send telegram message")
 			}
-		}
 
-		// Notify about tool execution
-		for _, tc := range msg.ToolCalls {
-			_, _ = b.bot.Send(c.Chat(), fmt.Sprintf("🛠 Executing: %s", tc.Function.Name))
-		}
+			if msg.Warning != "" {
+				_, _ = b.bot.Send(c.Chat(), "⚠️ "+msg.Warning, tele.Silent)
+			}
+
+			// Notify about tool execution
+			for _, tc := range msg.ToolCalls {
+				m, err := b.bot.Send(c.Chat(), fmt.Sprintf("🛠 Executing: %s", tc.Function.Name), stopMarkup)
+				if err == nil {
+					progress = append(progress, m)
+				}
+			}
+		},
+		OnQueued: func(merged bool) {
+			notice := "⏳ Queued, will run after the current task"
+			if merged {
+				notice = "📥 Added to the current task"
+			}
+			_, _ = b.bot.Send(c.Chat(), notice, tele.Silent)
+		},
 	})
 
 	if err != nil {
@@ -137,6 +182,13 @@ func (b *Bot) handleMessage(c tele.Context) error {
 	return nil
 }
 
+func (b *Bot) handleStop(c tele.Context) error {
+	if !b.agent.Stop(c.Callback().Data) {
+		return c.Respond(&tele.CallbackResponse{Text: "Nothing is running"})
+	}
+	return c.Respond(&tele.CallbackResponse{Text: "Stopping…"})
+}
+
 func (b *Bot) typingLoop(ctx context.Context, c tele.Context) {
 	ticker := time.NewTicker(4 * time.Second) // Refresh before 5s expiry
 	defer ticker.Stop()
@@ -0,0 +1,76 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sandevgo/tuskbot/pkg/log"
+	tele "gopkg.in/telebot.v3"
+)
+
+// progressMessage shows the progress of a long running command in a single
+// message, edited in place, which the command's response replaces. The
+// progress carries markup, like a Stop button, that the response drops.
+type progressMessage struct {
+	bot      *tele.Bot
+	sender   *sender
+	chat     *tele.Chat
+	markup   *tele.ReplyMarkup
+	interval time.Duration
+
+	mu       sync.Mutex
+	msg      *tele.Message
+	lastEdit time.Time
+	rendered string
+}
+
+func newProgressMessage(bot *tele.Bot, sender *sender, chat *tele.Chat, markup *tele.ReplyMarkup) *progressMessage {
+	return &progressMessage{
+		bot:      bot,
+		sender:   sender,
+		chat:     chat,
+		markup:   markup,
+		interval: streamEditInterval,
+	}
+}
+
+// Update shows text if the throttle allows. Updates in between are dropped,
+// since each one replaces the previous.
+func (p *progressMessage) Update(ctx context.Context, text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if text == p.rendered || time.Since(p.lastEdit) < p.interval {
+		return
+	}
+
+	var err error
+	if p.msg == nil {
+		p.msg, err = p.bot.Send(p.chat, text, tele.Silent, tele.NoPreview, p.markup)
+	} else {
+		_, err = p.bot.Edit(p.msg, text, tele.NoPreview, p.markup)
+		if isNotModified(err) {
+			err = nil
+		}
+	}
+
+	p.lastEdit = time.Now()
+	if err != nil {
+		log.FromCtx(ctx).Warn().Err(err).Msg("failed to update progress message")
+		return
+	}
+	p.rendered = text
+}
+
+// Finish replaces the progress with the response, or sends the response if
+// no progress was shown.
+func (p *progressMessage) Finish(ctx context.Context, response string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.msg == nil {
+		return p.sender.sendMarkdown(ctx, p.chat, response, false)
+	}
+	return p.sender.editMarkdown(ctx, p.msg, response)
+}
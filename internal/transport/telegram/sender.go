@@ -2,6 +2,7 @@ package telegram
 
 import (
 	"context"
+	"errors"
 	"strings"
 
 	"github.com/sandevgo/tuskbot/pkg/conv"
@@ -23,14 +24,14 @@ func newSender(bot *tele.Bot) *sender {
 func (s *sender) sendMarkdown(ctx context.Context, to tele.Recipient, md string, silent bool) error {
 	logger := log.FromCtx(ctx)
 	html := strings.TrimSpace(conv.MarkdownToTelegramHTML([]byte(md)))
-	
+
 	chunks := splitHTML(html, maxTelegramMsgLen)
 	for i, chunk := range chunks {
 		opts := []interface{}{tele.ModeHTML}
 		if silent && i == 0 {
 			opts = append(opts, tele.Silent)
 		}
-		
+
 		if _, err := s.bot.Send(to, chunk, opts...); err != nil {
 			logger.Error().Err(err).Int("chunk", i).Int("len", len(chunk)).Msg("failed to send telegram chunk")
 			return err
@@ -39,6 +40,37 @@ func (s *sender) sendMarkdown(ctx context.Context, to tele.Recipient, md string,
 	return nil
 }
 
+// editMarkdown replaces the text of an existing message with rendered Markdown.
+// Content that does not fit into one message is sent as follow-up messages.
+func (s *sender) editMarkdown(ctx context.Context, msg *tele.Message, md string) error {
+	logger := log.FromCtx(ctx)
+	html := strings.TrimSpace(conv.MarkdownToTelegramHTML([]byte(md)))
+
+	chunks := splitHTML(html, maxTelegramMsgLen)
+	for i, chunk := range chunks {
+		var err error
+		if i == 0 {
+			_, err = s.bot.Edit(msg, chunk, tele.ModeHTML)
+			if isNotModified(err) {
+				err = nil
+			}
+		} else {
+			_, err = s.bot.Send(msg.Chat, chunk, tele.ModeHTML, tele.Silent)
+		}
+
+		if err != nil {
+			logger.Error().Err(err).Int("chunk", i).Int("len", len(chunk)).Msg("failed to edit telegram message")
+			return err
+		}
+	}
+	return nil
+}
+
+// isNotModified reports whether an edit failed only because the content did not change.
+func isNotModified(err error) bool {
+	return errors.Is(err, tele.ErrSameMessageContent) || errors.Is(err, tele.ErrMessageNotModified)
+}
+
 // splitHTML splits text into chunks respecting Telegram's limit.
 // It tries to split at newlines to preserve formatting.
 func splitHTML(text string, maxLen int) []string {
@@ -0,0 +1,120 @@
+package telegram
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sandevgo/tuskbot/pkg/log"
+	tele "gopkg.in/telebot.v3"
+)
+
+// streamEditInterval throttles in-place edits to stay within Telegram's
+// rate limits (roughly one message update per second per chat).
+const streamEditInterval = 1500 * time.Millisecond
+
+// streamMessage renders one assistant turn into a single Telegram message,
+// editing it in place as tokens arrive.
+type streamMessage struct {
+	bot      *tele.Bot
+	sender   *sender
+	chat     *tele.Chat
+	interval time.Duration
+
+	mu       sync.Mutex
+	text     strings.Builder
+	msg      *tele.Message
+	lastEdit time.Time
+	rendered string
+}
+
+func newStreamMessage(bot *tele.Bot, sender *sender, chat *tele.Chat) *streamMessage {
+	return &streamMessage{
+		bot:      bot,
+		sender:   sender,
+		chat:     chat,
+		interval: streamEditInterval,
+	}
+}
+
+// Append adds a content delta and updates the message if the throttle allows.
+// While streaming the text is sent without formatting, since partial Markdown
+// cannot be converted to valid HTML.
+func (s *streamMessage) Append(ctx context.Context, delta string) {
+	if delta == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.text.WriteString(delta)
+	if time.Since(s.lastEdit) < s.interval {
+		return
+	}
+	s.flush(ctx)
+}
+
+func (s *streamMessage) flush(ctx context.Context) {
+	text := strings.TrimSpace(s.text.String())
+	if text == "" || text == s.rendered {
+		return
+	}
+
+	// Show the tail while the message is growing past the limit
+	if len(text) > maxTelegramMsgLen {
+		cut := len(text) - maxTelegramMsgLen + len("…")
+		for cut < len(text) && !utf8.RuneStart(text[cut]) {
+			cut++
+		}
+		text = "…" + text[cut:]
+	}
+
+	var err error
+	if s.msg == nil {
+		s.msg, err = s.bot.Send(s.chat, text, tele.Silent, tele.NoPreview)
+	} else {
+		_, err = s.bot.Edit(s.msg, text, tele.NoPreview)
+		if isNotModified(err) {
+			err = nil
+		}
+	}
+
+	s.lastEdit = time.Now()
+	if err != nil {
+		log.FromCtx(ctx).Warn().Err(err).Msg("failed to update streaming message")
+		return
+	}
+	s.rendered = text
+}
+
+// Finish renders the final content of the turn with formatting and resets
+// the stream, so the next turn starts a new message.
+func (s *streamMessage) Finish(ctx context.Context, content string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.msg
+	s.reset()
+
+	if content == "" {
+		if msg != nil {
+			return s.bot.Delete(msg)
+		}
+		return nil
+	}
+
+	if msg == nil {
+		return s.sender.sendMarkdown(ctx, s.chat, content, true)
+	}
+	return s.sender.editMarkdown(ctx, msg, content)
+}
+
+func (s *streamMessage) reset() {
+	s.text.Reset()
+	s.msg = nil
+	s.lastEdit = time.Time{}
+	s.rendered = ""
+}
@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // MarshalEnv reflects over the struct and creates .env content from tags
@@ -33,8 +34,9 @@ func MarshalEnv(c any) (string, error) {
 
 		val := v.Field(i)
 
-		// Check if value is empty/zero
-		if isZeroValue(val) {
+		// Zero values are left out, unless leaving them out would bring
+		// back a different default on the next start
+		if isZeroValue(val) && !overridesDefault(field, val) {
 			continue
 		}
 
@@ -71,8 +73,23 @@ func isZeroValue(v reflect.Value) bool {
 	}
 }
 
+// overridesDefault reports whether a zero value differs from the field's
+// envDefault. Empty strings cannot be told from unset ones, so they never do.
+func overridesDefault(field reflect.StructField, v reflect.Value) bool {
+	def, ok := field.Tag.Lookup("envDefault")
+	if !ok || def == "" || v.Kind() == reflect.String {
+		return false
+	}
+	return def != formatValue(v)
+}
+
 // formatValue converts a reflect.Value to its string representation
 func formatValue(v reflect.Value) string {
+	// Durations must be written in a form time.ParseDuration accepts
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
 	switch v.Kind() {
 	case reflect.String:
 		return v.String()
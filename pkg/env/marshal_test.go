@@ -0,0 +1,54 @@
+package env
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caarlos0/env/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name        string        `env:"NAME,required"`
+	URL         string        `env:"URL" envDefault:"http://localhost"`
+	Steps       int           `env:"STEPS" envDefault:"25"`
+	Duration    time.Duration `env:"DURATION" envDefault:"15m"`
+	Threads     int           `env:"THREADS" envDefault:"0"`
+	Budget      float64       `env:"BUDGET" envDefault:"0"`
+	Concurrency int           `env:"CONCURRENCY" envDefault:"4"`
+}
+
+func parseEnv(t *testing.T, content string) testConfig {
+	t.Helper()
+	vars := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		vars[key] = value
+	}
+
+	var c testConfig
+	require.NoError(t, env.ParseWithOptions(&c, env.Options{Environment: vars}))
+	return c
+}
+
+func TestMarshalEnv_RoundTripsZeros(t *testing.T) {
+	c := testConfig{Name: "tusk", Concurrency: 8}
+
+	content, err := MarshalEnv(&c)
+	require.NoError(t, err)
+
+	// Zeros are only written where the default is not zero
+	assert.Contains(t, content, "STEPS=0\n")
+	assert.Contains(t, content, "DURATION=0s\n")
+	assert.NotContains(t, content, "THREADS")
+	assert.NotContains(t, content, "BUDGET")
+	assert.NotContains(t, content, "URL")
+
+	reloaded := parseEnv(t, content)
+	assert.Equal(t, 0, reloaded.Steps)
+	assert.Equal(t, time.Duration(0), reloaded.Duration)
+	assert.Equal(t, 8, reloaded.Concurrency)
+	assert.Equal(t, "http://localhost", reloaded.URL)
+}
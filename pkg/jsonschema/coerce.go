@@ -0,0 +1,102 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Coerce converts values whose type does not match the schema but whose
+// content does, the way language models commonly get them wrong: numbers
+// and booleans sent as strings, numbers sent for strings, and arrays or
+// objects sent as JSON-encoded strings. Numbers parsed from strings are
+// json.Number, so large integers keep their precision. It reports whether
+// anything changed.
+func (s *Schema) Coerce(value any) (any, bool) {
+	if len(s.Type) > 0 && !s.Type.has(typeOf(value)) {
+		if v, ok := s.convert(value); ok {
+			value, _ = s.Coerce(v)
+			return value, true
+		}
+		return value, false
+	}
+
+	changed := false
+	switch v := value.(type) {
+	case map[string]any:
+		for name, item := range v {
+			prop := s.Properties[name]
+			if prop == nil && s.AdditionalProperties != nil {
+				prop = s.AdditionalProperties.Schema
+			}
+			if prop == nil {
+				continue
+			}
+			if c, ok := prop.Coerce(item); ok {
+				v[name] = c
+				changed = true
+			}
+		}
+	case []any:
+		if s.Items == nil {
+			break
+		}
+		for i, item := range v {
+			if c, ok := s.Items.Coerce(item); ok {
+				v[i] = c
+				changed = true
+			}
+		}
+	}
+	return value, changed
+}
+
+func (s *Schema) convert(value any) (any, bool) {
+	switch v := value.(type) {
+	case string:
+		trimmed := strings.TrimSpace(v)
+		if s.Type.has("integer") || s.Type.has("number") {
+			if n, ok := parseJSON(trimmed).(json.Number); ok && s.Type.has(typeOf(n)) {
+				return n, true
+			}
+		}
+		if s.Type.has("boolean") {
+			if b, err := strconv.ParseBool(trimmed); err == nil {
+				return b, true
+			}
+		}
+		if s.Type.has("array") || s.Type.has("object") {
+			if decoded := parseJSON(trimmed); decoded != nil && s.Type.has(typeOf(decoded)) {
+				return decoded, true
+			}
+		}
+	case float64:
+		if s.Type.has("string") {
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		}
+	case json.Number:
+		if s.Type.has("string") {
+			return v.String(), true
+		}
+	case bool:
+		if s.Type.has("string") {
+			return strconv.FormatBool(v), true
+		}
+	}
+	return nil, false
+}
+
+// parseJSON reads a whole JSON document with UseNumber, or returns nil.
+func parseJSON(s string) any {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,134 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{
+  "type": "object",
+  "properties": {
+    "path": { "type": "string", "minLength": 1 },
+    "limit": { "type": "integer", "minimum": 1, "maximum": 100 },
+    "ratio": { "type": "number" },
+    "recursive": { "type": "boolean" },
+    "mode": { "type": "string", "enum": ["fast", "full"] },
+    "tags": { "type": "array", "items": { "type": "string" }, "maxItems": 2 },
+    "options": {
+      "type": "object",
+      "properties": { "depth": { "type": "integer" } },
+      "additionalProperties": false
+    },
+    "id": { "type": ["string", "integer"] }
+  },
+  "required": ["path"]
+}`
+
+// decode reads a value the way tool arguments are read, with UseNumber.
+func decode(t *testing.T, s string) any {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	require.NoError(t, dec.Decode(&v))
+	return v
+}
+
+func TestSchema_Validate(t *testing.T) {
+	schema, err := Parse([]byte(testSchema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{name: "valid", value: `{"path":"a.txt","limit":10,"ratio":0.5,"tags":["x"],"options":{"depth":2},"id":7}`},
+		{name: "missing required", value: `{}`, want: []string{"path: required property is missing"}},
+		{name: "wrong root type", value: `[]`, want: []string{"expected object, got array"}},
+		{name: "empty string", value: `{"path":""}`, want: []string{"path: must be at least 1 characters long"}},
+		{name: "not an integer", value: `{"path":"a","limit":1.5}`, want: []string{"limit: expected integer, got number"}},
+		{name: "integer is a number", value: `{"path":"a","ratio":2}`},
+		{name: "bounds", value: `{"path":"a","limit":0}`, want: []string{"limit: must be >= 1"}},
+		{name: "enum", value: `{"path":"a","mode":"slow"}`, want: []string{`mode: must be one of "fast", "full"`}},
+		{
+			name:  "array items",
+			value: `{"path":"a","tags":["x",1,"z"]}`,
+			want:  []string{"tags: must have at most 2 items", "tags[1]: expected string, got integer"},
+		},
+		{name: "additional properties", value: `{"path":"a","options":{"depth":1,"color":"red"}}`, want: []string{"options.color: unknown property"}},
+		{name: "type list", value: `{"path":"a","id":true}`, want: []string{"id: expected string or integer, got boolean"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range schema.Validate(decode(t, tt.value)) {
+				got = append(got, v.String())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSchema_Validate_AnyOf(t *testing.T) {
+	schema, err := Parse([]byte(`{"anyOf":[{"type":"string"},{"type":"integer","minimum":0}]}`))
+	require.NoError(t, err)
+
+	assert.Empty(t, schema.Validate("x"))
+	assert.Empty(t, schema.Validate(float64(3)))
+	assert.Len(t, schema.Validate(float64(-1)), 1)
+}
+
+func TestSchema_Validate_OneOf(t *testing.T) {
+	schema, err := Parse([]byte(`{"oneOf":[{"type":"integer"},{"type":"number","minimum":10}]}`))
+	require.NoError(t, err)
+
+	assert.Empty(t, schema.Validate(json.Number("3")))
+	assert.Empty(t, schema.Validate(json.Number("10.5")))
+	assert.Equal(t, []Violation{{Message: "matches 2 of the allowed schemas, but must match exactly one"}}, schema.Validate(json.Number("12")))
+	assert.Len(t, schema.Validate("x"), 1)
+}
+
+func TestSchema_Coerce(t *testing.T) {
+	schema, err := Parse([]byte(testSchema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		value       string
+		want        string
+		wantChanged bool
+	}{
+		{name: "unchanged", value: `{"path":"a","limit":3}`, want: `{"path":"a","limit":3}`},
+		{name: "string number", value: `{"path":"a","limit":"3"}`, want: `{"path":"a","limit":3}`, wantChanged: true},
+		{name: "string bool", value: `{"path":"a","recursive":"true"}`, want: `{"path":"a","recursive":true}`, wantChanged: true},
+		{name: "number for string", value: `{"path":42}`, want: `{"path":"42"}`, wantChanged: true},
+		{name: "encoded array", value: `{"path":"a","tags":"[\"x\",\"y\"]"}`, want: `{"path":"a","tags":["x","y"]}`, wantChanged: true},
+		{name: "nested", value: `{"path":"a","options":{"depth":"2"}}`, want: `{"path":"a","options":{"depth":2}}`, wantChanged: true},
+		{name: "not a whole number", value: `{"path":"a","limit":"1.5"}`, want: `{"path":"a","limit":"1.5"}`},
+		{name: "not a number", value: `{"path":"a","limit":"ten"}`, want: `{"path":"a","limit":"ten"}`},
+		{name: "large integer", value: `{"path":"a","limit":"9007199254740993"}`, want: `{"path":"a","limit":9007199254740993}`, wantChanged: true},
+		{name: "large integer for string", value: `{"path":9007199254740993}`, want: `{"path":"9007199254740993"}`, wantChanged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := schema.Coerce(decode(t, tt.value))
+			assert.Equal(t, tt.wantChanged, changed)
+			assert.Equal(t, decode(t, tt.want), got)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	schema, err := Parse(nil)
+	require.NoError(t, err)
+	assert.Empty(t, schema.Validate(map[string]any{"anything": true}))
+
+	_, err = Parse([]byte(`{"type": 5}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,236 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Violation is a constraint the value does not satisfy.
+type Violation struct {
+	// Path locates the value, e.g. "files[2].path"; empty for the root.
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// Validate checks a value decoded by encoding/json against the schema.
+// Numbers may be float64 or, when decoded with UseNumber, json.Number.
+func (s *Schema) Validate(value any) []Violation {
+	var out []Violation
+	s.validate("", value, &out)
+	return out
+}
+
+func (s *Schema) validate(path string, value any, out *[]Violation) {
+	add := func(format string, args ...any) {
+		*out = append(*out, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !s.Type.has(typeOf(value)) {
+		add("expected %s, got %s", strings.Join(s.Type, " or "), typeOf(value))
+		return
+	}
+	if len(s.Enum) > 0 && !contains(s.Enum, value) {
+		add("must be one of %s", list(s.Enum))
+	}
+	if s.Const != nil && !equal(s.Const, value) {
+		add("must be %s", encode(s.Const))
+	}
+	if len(s.AnyOf) > 0 && !s.matchesAny(s.AnyOf, value) {
+		add("does not match any of the allowed schemas")
+	}
+	if len(s.OneOf) > 0 {
+		switch n := s.matches(s.OneOf, value); {
+		case n == 0:
+			add("does not match any of the allowed schemas")
+		case n > 1:
+			add("matches %d of the allowed schemas, but must match exactly one", n)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		s.validateObject(path, v, out)
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			add("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			add("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, out)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			add("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			add("must be at most %d characters long", *s.MaxLength)
+		}
+	case float64, json.Number:
+		n := number(v)
+		if s.Minimum != nil && n < *s.Minimum {
+			add("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			add("must be <= %v", *s.Maximum)
+		}
+	}
+}
+
+func (s *Schema) validateObject(path string, obj map[string]any, out *[]Violation) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			*out = append(*out, Violation{Path: join(path, name), Message: "required property is missing"})
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if prop, ok := s.Properties[name]; ok {
+			prop.validate(join(path, name), obj[name], out)
+			continue
+		}
+		if a := s.AdditionalProperties; a != nil {
+			if !a.Allowed {
+				*out = append(*out, Violation{Path: join(path, name), Message: "unknown property"})
+			} else if a.Schema != nil {
+				a.Schema.validate(join(path, name), obj[name], out)
+			}
+		}
+	}
+}
+
+func (s *Schema) matchesAny(schemas []*Schema, value any) bool {
+	for _, sub := range schemas {
+		if len(sub.Validate(value)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// matches counts the schemas the value is valid against.
+func (s *Schema) matches(schemas []*Schema, value any) int {
+	n := 0
+	for _, sub := range schemas {
+		if len(sub.Validate(value)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// typeOf names the JSON type of a decoded value. Whole numbers are
+// integers, which also satisfy "number".
+func typeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return typeOf(number(v))
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// number returns the value of a float64 or json.Number.
+func number(value any) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	}
+	return 0
+}
+
+func contains(values []any, value any) bool {
+	for _, v := range values {
+		if equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares decoded values, treating json.Number and float64 alike.
+func equal(a, b any) bool {
+	return reflect.DeepEqual(withFloats(a), withFloats(b))
+}
+
+func withFloats(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		return number(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = withFloats(item)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = withFloats(item)
+		}
+		return out
+	}
+	return value
+}
+
+func list(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = encode(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func encode(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
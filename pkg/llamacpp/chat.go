@@ -0,0 +1,407 @@
+package llamacpp
+
+/*
+#include <stdlib.h>
+#include <stdbool.h>
+#include "llama.h"
+
+void set_tusk_abort_callback(struct llama_context * ctx, bool * flag);
+*/
+import "C"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// fallbackTemplate is used for models without a chat template, or with one
+// llama.cpp does not know.
+const fallbackTemplate = "chatml"
+
+// ChatParams configure a chat model.
+type ChatParams struct {
+	ContextSize int // context window in tokens, 0 uses the model's training context
+	Threads     int // CPU threads, 0 uses up to 8
+	GPULayers   int // layers offloaded to the GPU, 0 runs on the CPU only
+}
+
+// ChatMessage is a message passed to the model's chat template.
+type ChatMessage struct {
+	Role    string
+	Content string
+}
+
+// GenerateParams configure a completion.
+type GenerateParams struct {
+	MaxTokens   int     // 0 generates until the end of the context
+	Temperature float32 // 0 samples greedily
+	Grammar     string  // GBNF grammar with a "root" rule constraining the output, if set
+}
+
+// GenerateResult is a finished completion.
+type GenerateResult struct {
+	Text             string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// LlamaChat wraps a chat model and its context. The context keeps the
+// tokens of the last prompt, so a following prompt with the same beginning
+// is only decoded from where it differs.
+type LlamaChat struct {
+	mu       sync.Mutex
+	model    *C.struct_llama_model
+	ctx      *C.struct_llama_context
+	vocab    *C.struct_llama_vocab
+	template string
+	nCtx     int
+	nBatch   int
+	cached   []C.llama_token
+	abort    *C.bool
+}
+
+// NewLlamaChat initializes the backend (once), loads the model, and creates a context.
+func NewLlamaChat(modelPath string, params ChatParams) (*LlamaChat, error) {
+	onceBackend.Do(func() {
+		C.llama_backend_init()
+	})
+
+	cPath := C.CString(modelPath)
+	defer C.free(unsafe.Pointer(cPath))
+
+	mParams := C.llama_model_default_params()
+	mParams.n_gpu_layers = C.int32_t(params.GPULayers)
+
+	model := C.llama_model_load_from_file(cPath, mParams)
+	if model == nil {
+		return nil, fmt.Errorf("failed to load model from %s", modelPath)
+	}
+
+	nCtx := params.ContextSize
+	if nCtx <= 0 {
+		nCtx = int(C.llama_model_n_ctx_train(model))
+	}
+	nBatch := min(nCtx, 512)
+
+	nThreads := params.Threads
+	if nThreads <= 0 {
+		nThreads = min(runtime.NumCPU(), 8)
+	}
+
+	cParams := C.llama_context_default_params()
+	cParams.n_ctx = C.uint32_t(nCtx)
+	cParams.n_batch = C.uint32_t(nBatch)
+	cParams.n_ubatch = C.uint32_t(nBatch)
+	cParams.n_threads = C.int32_t(nThreads)
+	cParams.n_threads_batch = C.int32_t(nThreads)
+
+	ctx := C.llama_init_from_model(model, cParams)
+	if ctx == nil {
+		C.llama_model_free(model)
+		return nil, errors.New("failed to create llama context")
+	}
+
+	// The flag lives in C memory, since llama.cpp keeps the pointer
+	abort := (*C.bool)(C.malloc(C.size_t(unsafe.Sizeof(C.bool(false)))))
+	*abort = false
+	C.set_tusk_abort_callback(ctx, abort)
+
+	template := fallbackTemplate
+	if tmpl := C.llama_model_chat_template(model, nil); tmpl != nil {
+		template = C.GoString(tmpl)
+	}
+
+	return &LlamaChat{
+		model:    model,
+		ctx:      ctx,
+		vocab:    C.llama_model_get_vocab(model),
+		template: template,
+		nCtx:     nCtx,
+		nBatch:   nBatch,
+		abort:    abort,
+	}, nil
+}
+
+// ContextSize returns the context window in tokens.
+func (l *LlamaChat) ContextSize() int {
+	return l.nCtx
+}
+
+// Free releases the C memory associated with the model and context.
+func (l *LlamaChat) Free() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ctx != nil {
+		C.llama_free(l.ctx)
+		l.ctx = nil
+	}
+	if l.model != nil {
+		C.llama_model_free(l.model)
+		l.model = nil
+	}
+	if l.abort != nil {
+		C.free(unsafe.Pointer(l.abort))
+		l.abort = nil
+	}
+	l.cached = nil
+}
+
+// ApplyTemplate formats messages into a prompt with the model's chat
+// template, ending with the start of an assistant message.
+func (l *LlamaChat) ApplyTemplate(messages []ChatMessage) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.model == nil {
+		return "", errors.New("model is not initialized or already freed")
+	}
+
+	prompt, err := applyTemplate(l.template, messages)
+	if err != nil && l.template != fallbackTemplate {
+		prompt, err = applyTemplate(fallbackTemplate, messages)
+	}
+	return prompt, err
+}
+
+func applyTemplate(template string, messages []ChatMessage) (string, error) {
+	if len(messages) == 0 {
+		return "", errors.New("no messages")
+	}
+
+	cTemplate := C.CString(template)
+	defer C.free(unsafe.Pointer(cTemplate))
+
+	// The message array is passed to C, so it must not hold Go pointers
+	ptr := C.malloc(C.size_t(len(messages)) * C.size_t(unsafe.Sizeof(C.struct_llama_chat_message{})))
+	defer C.free(ptr)
+	cMessages := unsafe.Slice((*C.struct_llama_chat_message)(ptr), len(messages))
+
+	size := 0
+	for i, m := range messages {
+		cMessages[i].role = C.CString(m.Role)
+		cMessages[i].content = C.CString(strings.ReplaceAll(m.Content, "\x00", ""))
+		size += len(m.Role) + len(m.Content)
+	}
+	defer func() {
+		for _, m := range cMessages {
+			C.free(unsafe.Pointer(m.role))
+			C.free(unsafe.Pointer(m.content))
+		}
+	}()
+
+	buf := make([]byte, 2*size+1024)
+	for {
+		n := C.llama_chat_apply_template(cTemplate, &cMessages[0], C.size_t(len(messages)), true,
+			(*C.char)(unsafe.Pointer(&buf[0])), C.int32_t(len(buf)))
+		if n < 0 {
+			return "", fmt.Errorf("chat template %.40q is not supported", template)
+		}
+		if int(n) <= len(buf) {
+			return string(buf[:n]), nil
+		}
+		buf = make([]byte, n)
+	}
+}
+
+// Generate completes the prompt. Pieces of text are reported to onPiece as
+// they are generated, always split at whole UTF-8 characters.
+func (l *LlamaChat) Generate(ctx context.Context, prompt string, params GenerateParams, onPiece func(string)) (GenerateResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.model == nil || l.ctx == nil {
+		return GenerateResult{}, errors.New("model is not initialized or already freed")
+	}
+
+	tokens, err := l.tokenize(prompt)
+	if err != nil {
+		return GenerateResult{}, err
+	}
+	if len(tokens) >= l.nCtx {
+		return GenerateResult{}, fmt.Errorf("prompt of %d tokens exceeds the context length of %d tokens", len(tokens), l.nCtx)
+	}
+
+	maxTokens := l.nCtx - len(tokens)
+	if params.MaxTokens > 0 {
+		maxTokens = min(maxTokens, params.MaxTokens)
+	}
+
+	sampler, err := l.newSampler(params)
+	if err != nil {
+		return GenerateResult{}, err
+	}
+	defer C.llama_sampler_free(sampler)
+
+	// Abort decoding when ctx is cancelled
+	*l.abort = false
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			*l.abort = true
+		case <-done:
+		}
+	}()
+
+	if err := l.decodePrompt(ctx, tokens); err != nil {
+		return GenerateResult{}, err
+	}
+
+	var text strings.Builder
+	var pending []byte
+	result := GenerateResult{PromptTokens: len(tokens)}
+	for result.CompletionTokens < maxTokens {
+		if err := ctx.Err(); err != nil {
+			return GenerateResult{}, err
+		}
+
+		token := C.llama_sampler_sample(sampler, l.ctx, -1)
+		if C.llama_vocab_is_eog(l.vocab, token) {
+			break
+		}
+		result.CompletionTokens++
+
+		pending = append(pending, l.piece(token)...)
+		if n := completeUTF8(pending); n > 0 {
+			text.Write(pending[:n])
+			if onPiece != nil {
+				onPiece(string(pending[:n]))
+			}
+			pending = pending[n:]
+		}
+
+		if err := l.decode(ctx, []C.llama_token{token}); err != nil {
+			return GenerateResult{}, err
+		}
+	}
+	text.Write(pending)
+
+	result.Text = text.String()
+	return result, nil
+}
+
+// tokenize converts the prompt into tokens, parsing the special tokens the
+// chat template inserted.
+func (l *LlamaChat) tokenize(prompt string) ([]C.llama_token, error) {
+	prompt = strings.ReplaceAll(prompt, "\x00", "")
+	if prompt == "" {
+		return nil, errors.New("prompt is empty")
+	}
+
+	cPrompt := C.CString(prompt)
+	defer C.free(unsafe.Pointer(cPrompt))
+
+	// len(prompt) in bytes is a safe upper bound for the token count
+	tokens := make([]C.llama_token, len(prompt)+8)
+	n := C.llama_tokenize(l.vocab, cPrompt, C.int32_t(len(prompt)),
+		(*C.llama_token)(unsafe.Pointer(&tokens[0])), C.int32_t(len(tokens)), true, true)
+	if n < 0 {
+		return nil, fmt.Errorf("tokenization failed (code: %d)", n)
+	}
+	return tokens[:n], nil
+}
+
+// newSampler creates the sampler chain: the grammar first, so only tokens
+// it allows are considered, then temperature sampling.
+func (l *LlamaChat) newSampler(params GenerateParams) (*C.struct_llama_sampler, error) {
+	chain := C.llama_sampler_chain_init(C.llama_sampler_chain_default_params())
+
+	if params.Grammar != "" {
+		cGrammar := C.CString(params.Grammar)
+		cRoot := C.CString("root")
+		grammar := C.llama_sampler_init_grammar(l.vocab, cGrammar, cRoot)
+		C.free(unsafe.Pointer(cGrammar))
+		C.free(unsafe.Pointer(cRoot))
+		if grammar == nil {
+			C.llama_sampler_free(chain)
+			return nil, errors.New("failed to parse grammar")
+		}
+		C.llama_sampler_chain_add(chain, grammar)
+	}
+
+	if params.Temperature <= 0 {
+		C.llama_sampler_chain_add(chain, C.llama_sampler_init_greedy())
+		return chain, nil
+	}
+	C.llama_sampler_chain_add(chain, C.llama_sampler_init_min_p(0.05, 1))
+	C.llama_sampler_chain_add(chain, C.llama_sampler_init_temp(C.float(params.Temperature)))
+	C.llama_sampler_chain_add(chain, C.llama_sampler_init_dist(C.LLAMA_DEFAULT_SEED))
+	return chain, nil
+}
+
+// decodePrompt decodes the tokens of the prompt that differ from the
+// previous one, reusing the context memory for the common beginning.
+func (l *LlamaChat) decodePrompt(ctx context.Context, tokens []C.llama_token) error {
+	mem := C.llama_get_memory(l.ctx)
+
+	// At least the last token is decoded again to get its logits
+	keep := 0
+	for keep < len(l.cached) && keep < len(tokens)-1 && l.cached[keep] == tokens[keep] {
+		keep++
+	}
+	if !C.llama_memory_seq_rm(mem, 0, C.llama_pos(keep), -1) {
+		C.llama_memory_clear(mem, true)
+		keep = 0
+	}
+	l.cached = l.cached[:keep]
+
+	for start := keep; start < len(tokens); start += l.nBatch {
+		end := min(start+l.nBatch, len(tokens))
+		if err := l.decode(ctx, tokens[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decode evaluates tokens and appends them to the cached tokens.
+func (l *LlamaChat) decode(ctx context.Context, tokens []C.llama_token) error {
+	batch := C.llama_batch_get_one((*C.llama_token)(unsafe.Pointer(&tokens[0])), C.int32_t(len(tokens)))
+	if res := C.llama_decode(l.ctx, batch); res != 0 {
+		// The memory may hold part of the batch now
+		C.llama_memory_clear(C.llama_get_memory(l.ctx), true)
+		l.cached = nil
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("llama_decode failed with code %d", res)
+	}
+	l.cached = append(l.cached, tokens...)
+	return nil
+}
+
+// piece returns the text of a token.
+func (l *LlamaChat) piece(token C.llama_token) []byte {
+	buf := make([]byte, 64)
+	n := C.llama_token_to_piece(l.vocab, token, (*C.char)(unsafe.Pointer(&buf[0])), C.int32_t(len(buf)), 0, false)
+	if n < 0 {
+		buf = make([]byte, -n)
+		n = C.llama_token_to_piece(l.vocab, token, (*C.char)(unsafe.Pointer(&buf[0])), C.int32_t(len(buf)), 0, false)
+	}
+	if n < 0 {
+		return nil
+	}
+	return buf[:n]
+}
+
+// completeUTF8 returns the length of b without a trailing incomplete UTF-8
+// character, which the next token completes.
+func completeUTF8(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(b[i]) {
+			continue
+		}
+		if utf8.FullRune(b[i:]) {
+			return len(b)
+		}
+		return i
+	}
+	return len(b)
+}
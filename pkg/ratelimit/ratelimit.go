@@ -0,0 +1,224 @@
+// Package ratelimit delays requests to an API so they stay within its rate
+// limits, combining configured limits with the quota the server reports.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const window = time.Minute
+
+// Limits are the client-side limits. Zero means unlimited.
+type Limits struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+	Concurrency       int
+}
+
+// Priority decides who goes first when requests have to wait.
+type Priority int
+
+const (
+	// High is for interactive requests.
+	High Priority = iota
+	// Low is for background work, which waits while high priority requests
+	// are waiting.
+	Low
+)
+
+// Quota is what the server reports as left of one of its limits.
+type Quota struct {
+	Remaining int
+	Reset     time.Time
+}
+
+// State is the quota reported with a response. Nil quotas are unknown.
+type State struct {
+	Requests *Quota
+	Tokens   *Quota
+}
+
+type tokenUse struct {
+	at     time.Time
+	tokens int
+}
+
+type Limiter struct {
+	limits Limits
+	now    func() time.Time
+
+	mu          sync.Mutex
+	active      int
+	requests    []time.Time // starts within the window
+	tokens      []tokenUse  // token estimates within the window
+	server      State
+	pausedUntil time.Time
+	waitingHigh int
+	changed     chan struct{} // closed and replaced when a waiter may proceed
+}
+
+func New(limits Limits) *Limiter {
+	return &Limiter{
+		limits:  limits,
+		now:     time.Now,
+		changed: make(chan struct{}),
+	}
+}
+
+// Wait blocks until a request of about the given number of tokens may be
+// sent, and returns a function to call once the request is done.
+func (l *Limiter) Wait(ctx context.Context, priority Priority, tokens int) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	waiting := false
+	defer func() {
+		if waiting {
+			l.waitingHigh--
+			l.notify()
+		}
+	}()
+
+	for {
+		delay, ok := l.reserve(priority, tokens)
+		if ok {
+			var once sync.Once
+			return func() { once.Do(l.release) }, nil
+		}
+
+		if priority == High && !waiting {
+			waiting = true
+			l.waitingHigh++
+		}
+
+		changed := l.changed
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if delay > 0 {
+			timer = time.NewTimer(delay)
+			timeout = timer.C
+		}
+
+		l.mu.Unlock()
+		var err error
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-changed:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		l.mu.Lock()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Update takes over the quota reported by the server.
+func (l *Limiter) Update(state State) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if state.Requests != nil {
+		q := *state.Requests
+		l.server.Requests = &q
+	}
+	if state.Tokens != nil {
+		q := *state.Tokens
+		l.server.Tokens = &q
+	}
+	l.notify()
+}
+
+// Pause holds all requests until the given time, e.g. after the server
+// answered with Retry-After.
+func (l *Limiter) Pause(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// reserve takes a slot for the request if every limit allows it. Otherwise
+// it returns how long to wait, 0 if only a finished request can help.
+func (l *Limiter) reserve(priority Priority, tokens int) (time.Duration, bool) {
+	now := l.now()
+	l.prune(now)
+
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now), false
+	}
+	if priority == Low && l.waitingHigh > 0 {
+		return 0, false
+	}
+	if l.limits.Concurrency > 0 && l.active >= l.limits.Concurrency {
+		return 0, false
+	}
+	if l.limits.RequestsPerMinute > 0 && len(l.requests) >= l.limits.RequestsPerMinute {
+		return l.requests[0].Add(window).Sub(now), false
+	}
+	// A request larger than the limit goes alone rather than never
+	if l.limits.TokensPerMinute > 0 && len(l.tokens) > 0 && l.usedTokens()+tokens > l.limits.TokensPerMinute {
+		return l.tokens[0].at.Add(window).Sub(now), false
+	}
+	if q := l.server.Requests; q != nil && q.Remaining <= 0 && now.Before(q.Reset) {
+		return q.Reset.Sub(now), false
+	}
+	if q := l.server.Tokens; q != nil && q.Remaining < tokens && now.Before(q.Reset) {
+		return q.Reset.Sub(now), false
+	}
+
+	l.active++
+	l.requests = append(l.requests, now)
+	if tokens > 0 {
+		l.tokens = append(l.tokens, tokenUse{at: now, tokens: tokens})
+	}
+	// Count against the server quota until the next response updates it
+	if l.server.Requests != nil {
+		l.server.Requests.Remaining--
+	}
+	if l.server.Tokens != nil {
+		l.server.Tokens.Remaining -= tokens
+	}
+	return 0, true
+}
+
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.notify()
+}
+
+func (l *Limiter) prune(now time.Time) {
+	start := now.Add(-window)
+	for len(l.requests) > 0 && !l.requests[0].After(start) {
+		l.requests = l.requests[1:]
+	}
+	for len(l.tokens) > 0 && !l.tokens[0].at.After(start) {
+		l.tokens = l.tokens[1:]
+	}
+}
+
+func (l *Limiter) usedTokens() int {
+	var used int
+	for _, t := range l.tokens {
+		used += t.tokens
+	}
+	return used
+}
+
+// notify wakes all waiters to check the limits again.
+func (l *Limiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestLimiter(limits Limits) (*Limiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := New(limits)
+	l.now = clock.now
+	return l, clock
+}
+
+// blocked reports whether Wait is still waiting after a short time.
+func blocked(t *testing.T, l *Limiter, priority Priority, tokens int) bool {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	release, err := l.Wait(ctx, priority, tokens)
+	if err != nil {
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		return true
+	}
+	release()
+	return false
+}
+
+func TestLimiter_RequestsPerMinute(t *testing.T) {
+	l, clock := newTestLimiter(Limits{RequestsPerMinute: 2})
+
+	assert.False(t, blocked(t, l, High, 0))
+	assert.False(t, blocked(t, l, High, 0))
+	assert.True(t, blocked(t, l, High, 0))
+
+	clock.t = clock.t.Add(time.Minute + time.Second)
+	assert.False(t, blocked(t, l, High, 0))
+}
+
+func TestLimiter_TokensPerMinute(t *testing.T) {
+	l, clock := newTestLimiter(Limits{TokensPerMinute: 1000})
+
+	assert.False(t, blocked(t, l, High, 800))
+	assert.True(t, blocked(t, l, High, 300))
+	assert.False(t, blocked(t, l, High, 200))
+
+	// A request larger than the limit goes once the window is empty
+	clock.t = clock.t.Add(time.Minute + time.Second)
+	assert.False(t, blocked(t, l, High, 5000))
+}
+
+func TestLimiter_ServerQuota(t *testing.T) {
+	l, clock := newTestLimiter(Limits{})
+
+	l.Update(State{
+		Requests: &Quota{Remaining: 1, Reset: clock.t.Add(30 * time.Second)},
+		Tokens:   &Quota{Remaining: 10000, Reset: clock.t.Add(time.Second)},
+	})
+	assert.False(t, blocked(t, l, High, 100))
+	assert.True(t, blocked(t, l, High, 100), "the last request of the quota is used")
+
+	clock.t = clock.t.Add(31 * time.Second)
+	assert.False(t, blocked(t, l, High, 100))
+
+	l.Update(State{Tokens: &Quota{Remaining: 50, Reset: clock.t.Add(time.Second)}})
+	assert.True(t, blocked(t, l, High, 100))
+	assert.False(t, blocked(t, l, High, 10))
+}
+
+func TestLimiter_Pause(t *testing.T) {
+	l := New(Limits{})
+	l.Pause(time.Now().Add(50 * time.Millisecond))
+
+	start := time.Now()
+	release, err := l.Wait(context.Background(), High, 0)
+	require.NoError(t, err)
+	release()
+
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestLimiter_ConcurrencyAndPriority(t *testing.T) {
+	l := New(Limits{Concurrency: 1})
+
+	release, err := l.Wait(context.Background(), High, 0)
+	require.NoError(t, err)
+
+	order := make(chan Priority, 2)
+	wait := func(priority Priority) {
+		release, err := l.Wait(context.Background(), priority, 0)
+		if err == nil {
+			order <- priority
+			time.Sleep(10 * time.Millisecond)
+			release()
+		}
+	}
+
+	go wait(Low)
+	time.Sleep(10 * time.Millisecond)
+	go wait(High)
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.waitingHigh == 1
+	}, time.Second, time.Millisecond)
+
+	// The interactive request goes first although it came later
+	release()
+	release() // releasing twice frees one slot
+
+	assert.Equal(t, High, <-order)
+	assert.Equal(t, Low, <-order)
+}
@@ -2,12 +2,27 @@ package retry
 
 import (
 	"context"
+	"errors"
 	"math/rand"
 	"time"
 )
 
 type Operation = func() error
 
+// permanentError stops retrying.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error that must not be retried. Do returns the
+// wrapped error.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
 type Config struct {
 	MaxRetries    int
 	BackoffFactor float64
@@ -51,6 +66,11 @@ func (r *Retrier) Do(ctx context.Context, op Operation) error {
 			return nil
 		}
 
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+
 		if attempt == r.config.MaxRetries {
 			return err
 		}
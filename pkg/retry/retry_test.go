@@ -148,3 +148,23 @@ func TestRetry_BackoffAndJitter(t *testing.T) {
 		t.Errorf("expected 3 attempts, got %d", counter)
 	}
 }
+
+func TestRetry_Permanent(t *testing.T) {
+	ctx := context.Background()
+	retrier := NewDefaultRetrier()
+
+	expectedErr := errors.New("quota exhausted")
+	counter := 0
+	operation := func() error {
+		counter++
+		return Permanent(expectedErr)
+	}
+
+	err := retrier.Do(ctx, operation)
+	if err != expectedErr {
+		t.Errorf("expected %v, got %v", expectedErr, err)
+	}
+	if counter != 1 {
+		t.Errorf("expected 1 attempt, got %d", counter)
+	}
+}
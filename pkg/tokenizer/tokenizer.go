@@ -0,0 +1,43 @@
+// Package tokenizer counts tokens with the cl100k_base encoding.
+package tokenizer
+
+import (
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+var (
+	enc     *tiktoken.Tiktoken
+	encErr  error
+	encOnce sync.Once
+)
+
+// Encoding returns the shared cl100k_base encoding. The BPE ranks are
+// embedded in the binary, so loading never goes to the network.
+func Encoding() (*tiktoken.Tiktoken, error) {
+	encOnce.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+		enc, encErr = tiktoken.GetEncoding("cl100k_base")
+	})
+	return enc, encErr
+}
+
+// Count returns the number of tokens in text. If the encoding is not
+// available it falls back to Estimate.
+func Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	e, err := Encoding()
+	if err != nil {
+		return Estimate(text)
+	}
+	return len(e.Encode(text, nil, nil))
+}
+
+// Estimate approximates the token count as one token per 4 bytes.
+func Estimate(text string) int {
+	return (len(text) + 3) / 4
+}
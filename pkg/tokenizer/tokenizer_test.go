@@ -0,0 +1,26 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCount_Offline(t *testing.T) {
+	// Any download attempt fails through the unreachable proxy
+	t.Setenv("HTTPS_PROXY", "http://127.0.0.1:1")
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+
+	_, err := Encoding()
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, Count("hello world"))
+	assert.Equal(t, 0, Count(""))
+}
+
+func TestEstimate(t *testing.T) {
+	assert.Equal(t, 0, Estimate(""))
+	assert.Equal(t, 1, Estimate("abc"))
+	assert.Equal(t, 3, Estimate("hello world"))
+}